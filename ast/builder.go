@@ -0,0 +1,519 @@
+package ast
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builder creates AST nodes that are not backed by source text. This allows
+// nodes to be constructed programmatically, without having to allocate tokens
+// from a *FileInfo. The tokens in nodes created by a Builder are synthetic:
+// they cannot be used with a FileInfo until the nodes are added to a file via
+// an *Editor. When that happens, the editor allocates real tokens (and the
+// corresponding source text) for them.
+//
+// Since synthetic tokens are only meaningful to the builder that created them,
+// nodes created by one builder must only be added to a file using an editor
+// whose builder is the same one. The zero value is ready to use, but it is
+// typically more convenient to use the builder embedded in an *Editor.
+type Builder struct {
+	tokens []syntheticToken
+}
+
+type syntheticToken struct {
+	text string
+	// The whitespace that precedes the token. If nil, the whitespace is
+	// computed based on the surrounding tokens when the token is laid out.
+	whitespace *string
+	// Leading dots are rune nodes that are spaced like identifiers.
+	leadingDot bool
+	// Comments attributed to this token.
+	leadingComments, trailingComments []syntheticComment
+	// The node that was created with this token. This is used to verify that
+	// a node given to an editor was actually created by its builder.
+	node TerminalNode
+}
+
+type syntheticComment struct {
+	whitespace string
+	text       string
+	// If true, the comment was added via the builder, so its whitespace
+	// is computed when the token is laid out.
+	added bool
+	// If true, the comment is followed by a blank line.
+	detached bool
+}
+
+func (b *Builder) token(text string) Token {
+	b.tokens = append(b.tokens, syntheticToken{text: text})
+	// synthetic tokens are negative, so they can be distinguished from real
+	// tokens, which are indexes into a FileInfo
+	return Token(-len(b.tokens))
+}
+
+// owned records that the given node, which was just created with a token
+// from this builder, belongs to this builder.
+func (b *Builder) owned(n TerminalNode) {
+	b.synthetic(n.Token()).node = n
+}
+
+func (b *Builder) synthetic(t Token) *syntheticToken {
+	if t >= 0 || int(-t) > len(b.tokens) {
+		return nil
+	}
+	return &b.tokens[-t-1]
+}
+
+// AddComment adds the given comment to the given node, which must have been
+// created by this builder. The comment will be a leading comment that precedes
+// the node. The given comment must include the comment markers, "//" or "/*"
+// and "*/". Multiple comments may be added to the same node.
+//
+// Comments must be added before the node is added to a file via an *Editor.
+// Once it is in the file, its tokens are no longer synthetic, so an error is
+// returned.
+func (b *Builder) AddComment(n Node, comment string) error {
+	return b.addComment(n, comment, false, false)
+}
+
+// AddDetachedComment is like AddComment except that the comment is followed
+// by a blank line. So it is detached from the node: it is not considered part
+// of the node's leading comments when generating source code info.
+func (b *Builder) AddDetachedComment(n Node, comment string) error {
+	return b.addComment(n, comment, false, true)
+}
+
+// AddTrailingComment adds the given comment to the given node, which must have
+// been created by this builder. The comment will be a trailing comment that
+// follows the node. The given comment must include the comment markers, "//"
+// or "/*" and "*/". Multiple comments may be added to the same node.
+//
+// Like AddComment, this must be called before the node is added to a file.
+func (b *Builder) AddTrailingComment(n Node, comment string) error {
+	return b.addComment(n, comment, true, false)
+}
+
+func (b *Builder) addComment(n Node, comment string, trailing, detached bool) error {
+	tok := n.Start()
+	if trailing {
+		tok = n.End()
+	}
+	if tok >= 0 {
+		return fmt.Errorf("cannot add comment to a node that is already in a file; comments must be added before the node is added to the file")
+	}
+	st := b.synthetic(tok)
+	if st == nil {
+		return fmt.Errorf("cannot add comment to a node not created by this builder")
+	}
+	switch {
+	case strings.HasPrefix(comment, "//"):
+		if strings.Contains(strings.TrimSuffix(comment, "\n"), "\n") {
+			return fmt.Errorf("line comment cannot contain newlines: %q", comment)
+		}
+		if !strings.HasSuffix(comment, "\n") {
+			comment += "\n"
+		}
+	case strings.HasPrefix(comment, "/*") && strings.HasSuffix(comment, "*/"):
+		if strings.Contains(comment[2:len(comment)-2], "*/") {
+			return fmt.Errorf("block comment cannot contain \"*/\": %q", comment)
+		}
+	default:
+		return fmt.Errorf("comment must start with \"//\" or be enclosed in \"/*\" and \"*/\": %q", comment)
+	}
+	c := syntheticComment{text: comment, added: true, detached: detached}
+	if trailing {
+		st.trailingComments = append(st.trailingComments, c)
+	} else {
+		st.leadingComments = append(st.leadingComments, c)
+	}
+	return nil
+}
+
+// Rune creates a new *RuneNode for the given rune, which is typically
+// punctuation, such as '=', ';', or '{'.
+func (b *Builder) Rune(r rune) *RuneNode {
+	n := NewRuneNode(r, b.token(string(r)))
+	b.owned(n)
+	return n
+}
+
+// Keyword creates a new *KeywordNode for the given keyword.
+func (b *Builder) Keyword(kw string) *KeywordNode {
+	n := NewKeywordNode(kw, b.token(kw))
+	b.owned(n)
+	return n
+}
+
+// Ident creates a new *IdentNode for the given simple (unqualified) name.
+func (b *Builder) Ident(name string) *IdentNode {
+	n := NewIdentNode(name, b.token(name))
+	b.owned(n)
+	return n
+}
+
+// Identifier creates a new IdentValueNode for the given name, which may be
+// qualified and may have a leading dot. If the given name contains no dots,
+// the returned node is an *IdentNode. Otherwise, it is a *CompoundIdentNode.
+func (b *Builder) Identifier(name string) IdentValueNode {
+	var leadingDot *RuneNode
+	if strings.HasPrefix(name, ".") {
+		leadingDot = b.Rune('.')
+		b.synthetic(leadingDot.Token()).leadingDot = true
+		name = name[1:]
+	}
+	parts := strings.Split(name, ".")
+	if leadingDot == nil && len(parts) == 1 {
+		return b.Ident(name)
+	}
+	components := make([]*IdentNode, len(parts))
+	dots := make([]*RuneNode, len(parts)-1)
+	for i, part := range parts {
+		if i > 0 {
+			dots[i-1] = b.Rune('.')
+		}
+		components[i] = b.Ident(part)
+	}
+	return NewCompoundIdentNode(leadingDot, components, dots)
+}
+
+// String creates a new *StringLiteralNode for the given string value. The
+// value is quoted and escaped as necessary.
+func (b *Builder) String(val string) *StringLiteralNode {
+	n := NewStringLiteralNode(val, b.token(quote(val)))
+	b.owned(n)
+	return n
+}
+
+func quote(s string) string {
+	validUTF8 := utf8.ValidString(s)
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		default:
+			if c < ' ' || c == 0x7f {
+				// other control characters use octal escapes
+				fmt.Fprintf(&buf, `\%03o`, c)
+			} else if c >= 0x80 && !validUTF8 {
+				// invalid UTF8 is escaped, too
+				fmt.Fprintf(&buf, `\%03o`, c)
+			} else {
+				// printable ASCII and bytes of multi-byte UTF8 sequences
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Uint creates a new *UintLiteralNode for the given value.
+func (b *Builder) Uint(val uint64) *UintLiteralNode {
+	n := NewUintLiteralNode(val, b.token(strconv.FormatUint(val, 10)))
+	b.owned(n)
+	return n
+}
+
+// Int creates a new IntValueNode for the given value. If the value is
+// negative, the returned node is a *NegativeIntLiteralNode. Otherwise, it is
+// a *UintLiteralNode.
+func (b *Builder) Int(val int64) IntValueNode {
+	if val >= 0 {
+		return b.Uint(uint64(val))
+	}
+	minus := b.Rune('-')
+	var abs uint64
+	if val == math.MinInt64 {
+		abs = uint64(math.MaxInt64) + 1
+	} else {
+		abs = uint64(-val)
+	}
+	return NewNegativeIntLiteralNode(minus, b.Uint(abs))
+}
+
+// Float creates a new FloatValueNode for the given value. If the value is
+// negative, the returned node is a *SignedFloatLiteralNode. Otherwise, it is
+// a *FloatLiteralNode or, for infinity and not-a-number, a
+// *SpecialFloatLiteralNode.
+func (b *Builder) Float(val float64) FloatValueNode {
+	if math.IsNaN(val) {
+		return NewSpecialFloatLiteralNode(b.Keyword("nan"))
+	}
+	if math.Signbit(val) {
+		return NewSignedFloatLiteralNode(b.Rune('-'), b.Float(-val))
+	}
+	if math.IsInf(val, 1) {
+		return NewSpecialFloatLiteralNode(b.Keyword("inf"))
+	}
+	text := strconv.FormatFloat(val, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".e") {
+		// make sure it is not lexed as an integer
+		text += ".0"
+	}
+	n := NewFloatLiteralNode(val, b.token(text))
+	b.owned(n)
+	return n
+}
+
+// Bool creates a new *BoolLiteralNode for the given value.
+func (b *Builder) Bool(val bool) *BoolLiteralNode {
+	return NewBoolLiteralNode(b.Keyword(strconv.FormatBool(val)))
+}
+
+// Syntax creates a new *SyntaxNode that declares the given syntax, such as
+// "proto2" or "proto3".
+func (b *Builder) Syntax(syntax string) *SyntaxNode {
+	return NewSyntaxNode(b.Keyword("syntax"), b.Rune('='), b.String(syntax), b.Rune(';'))
+}
+
+// Package creates a new *PackageNode that declares the given package name.
+func (b *Builder) Package(pkg string) *PackageNode {
+	return NewPackageNode(b.Keyword("package"), b.Identifier(pkg), b.Rune(';'))
+}
+
+// Import creates a new *ImportNode that imports the given path. The modifier
+// should be empty for a normal import or "public" or "weak".
+func (b *Builder) Import(path string, modifier string) *ImportNode {
+	keyword := b.Keyword("import")
+	var public, weak *KeywordNode
+	switch modifier {
+	case "public":
+		public = b.Keyword(modifier)
+	case "weak":
+		weak = b.Keyword(modifier)
+	case "":
+	default:
+		panic(fmt.Sprintf("invalid import modifier: %q", modifier))
+	}
+	return NewImportNode(keyword, public, weak, b.String(path), b.Rune(';'))
+}
+
+// OptionName creates a new *OptionNameNode for the given option name. Any
+// extension names in the given name must be enclosed in parentheses, as in
+// "(foo.bar).baz".
+func (b *Builder) OptionName(name string) *OptionNameNode {
+	var parts []*FieldReferenceNode
+	var dots []*RuneNode
+	for len(name) > 0 {
+		if len(parts) > 0 {
+			if name[0] != '.' {
+				panic(fmt.Sprintf("invalid option name: expecting '.' but got %q", name))
+			}
+			dots = append(dots, b.Rune('.'))
+			name = name[1:]
+		}
+		if strings.HasPrefix(name, "(") {
+			end := strings.IndexByte(name, ')')
+			if end < 0 {
+				panic(fmt.Sprintf("invalid option name: missing ')' in %q", name))
+			}
+			parts = append(parts, NewExtensionFieldReferenceNode(b.Rune('('), b.Identifier(name[1:end]), b.Rune(')')))
+			name = name[end+1:]
+		} else {
+			end := strings.IndexByte(name, '.')
+			if end < 0 {
+				end = len(name)
+			}
+			parts = append(parts, NewFieldReferenceNode(b.Ident(name[:end])))
+			name = name[end:]
+		}
+	}
+	return NewOptionNameNode(parts, dots)
+}
+
+// Option creates a new *OptionNode for an option declaration (which starts
+// with the "option" keyword and ends with a semicolon), with the given name
+// and value. See OptionName for the format of the name.
+func (b *Builder) Option(name string, val ValueNode) *OptionNode {
+	return NewOptionNode(b.Keyword("option"), b.OptionName(name), b.Rune('='), val, b.Rune(';'))
+}
+
+// CompactOption creates a new *OptionNode for a compact option, which is used
+// in compact options for fields, enum values, and extension ranges. See
+// OptionName for the format of the name.
+func (b *Builder) CompactOption(name string, val ValueNode) *OptionNode {
+	return NewCompactOptionNode(b.OptionName(name), b.Rune('='), val)
+}
+
+// CompactOptions creates a new *CompactOptionsNode with the given options,
+// which should be created with CompactOption. If no options are given, this
+// returns nil.
+func (b *Builder) CompactOptions(opts ...*OptionNode) *CompactOptionsNode {
+	if len(opts) == 0 {
+		return nil
+	}
+	return NewCompactOptionsNode(b.Rune('['), opts, b.commas(len(opts)), b.Rune(']'))
+}
+
+// Field creates a new *FieldNode. The label may be empty (for fields that have
+// no label, like most proto3 fields) or "optional", "required", or "repeated".
+// The opts argument may be nil.
+func (b *Builder) Field(label string, fieldType string, name string, tag uint64, opts *CompactOptionsNode) *FieldNode {
+	var lbl *KeywordNode
+	if label != "" {
+		lbl = b.Keyword(label)
+	}
+	return NewFieldNode(lbl, b.Identifier(fieldType), b.Ident(name), b.Rune('='), b.Uint(tag), opts, b.Rune(';'))
+}
+
+// Message creates a new *MessageNode with the given name and declarations.
+func (b *Builder) Message(name string, decls ...MessageElement) *MessageNode {
+	return NewMessageNode(b.Keyword("message"), b.Ident(name), b.Rune('{'), decls, b.Rune('}'))
+}
+
+// Enum creates a new *EnumNode with the given name and declarations.
+func (b *Builder) Enum(name string, decls ...EnumElement) *EnumNode {
+	return NewEnumNode(b.Keyword("enum"), b.Ident(name), b.Rune('{'), decls, b.Rune('}'))
+}
+
+// EnumValue creates a new *EnumValueNode. The opts argument may be nil.
+func (b *Builder) EnumValue(name string, number int64, opts *CompactOptionsNode) *EnumValueNode {
+	return NewEnumValueNode(b.Ident(name), b.Rune('='), b.Int(number), opts, b.Rune(';'))
+}
+
+// Service creates a new *ServiceNode with the given name and declarations.
+func (b *Builder) Service(name string, decls ...ServiceElement) *ServiceNode {
+	return NewServiceNode(b.Keyword("service"), b.Ident(name), b.Rune('{'), decls, b.Rune('}'))
+}
+
+// RPC creates a new *RPCNode with the given name, request type, and response
+// type. If any declarations are given (which must be options or empty
+// declarations), the RPC will have a body. Otherwise, it ends in a semicolon.
+func (b *Builder) RPC(name string, input string, inputStream bool, output string, outputStream bool, decls ...RPCElement) *RPCNode {
+	keyword, ident := b.Keyword("rpc"), b.Ident(name)
+	in := b.rpcType(input, inputStream)
+	returns := b.Keyword("returns")
+	out := b.rpcType(output, outputStream)
+	if len(decls) == 0 {
+		return NewRPCNode(keyword, ident, in, returns, out, b.Rune(';'))
+	}
+	return NewRPCNodeWithBody(keyword, ident, in, returns, out, b.Rune('{'), decls, b.Rune('}'))
+}
+
+func (b *Builder) rpcType(msgType string, stream bool) *RPCTypeNode {
+	open := b.Rune('(')
+	var streamKeyword *KeywordNode
+	if stream {
+		streamKeyword = b.Keyword("stream")
+	}
+	return NewRPCTypeNode(open, streamKeyword, b.Identifier(msgType), b.Rune(')'))
+}
+
+// MapField creates a new *MapFieldNode with the given key and value types. The
+// opts argument may be nil.
+func (b *Builder) MapField(keyType string, valueType string, name string, tag uint64, opts *CompactOptionsNode) *MapFieldNode {
+	mapType := NewMapTypeNode(b.Keyword("map"), b.Rune('<'), b.Ident(keyType), b.Rune(','), b.Identifier(valueType), b.Rune('>'))
+	return NewMapFieldNode(mapType, b.Ident(name), b.Rune('='), b.Uint(tag), opts, b.Rune(';'))
+}
+
+// Group creates a new *GroupNode with the given name and declarations. The
+// label may be empty (for groups in a oneof) or "optional", "required", or
+// "repeated". The opts argument may be nil.
+func (b *Builder) Group(label string, name string, tag uint64, opts *CompactOptionsNode, decls ...MessageElement) *GroupNode {
+	var lbl *KeywordNode
+	if label != "" {
+		lbl = b.Keyword(label)
+	}
+	return NewGroupNode(lbl, b.Keyword("group"), b.Ident(name), b.Rune('='), b.Uint(tag), opts, b.Rune('{'), decls, b.Rune('}'))
+}
+
+// OneOf creates a new *OneOfNode with the given name and declarations.
+func (b *Builder) OneOf(name string, decls ...OneOfElement) *OneOfNode {
+	return NewOneOfNode(b.Keyword("oneof"), b.Ident(name), b.Rune('{'), decls, b.Rune('}'))
+}
+
+// Extend creates a new *ExtendNode for the given extendee and declarations.
+func (b *Builder) Extend(extendee string, decls ...ExtendElement) *ExtendNode {
+	return NewExtendNode(b.Keyword("extend"), b.Identifier(extendee), b.Rune('{'), decls, b.Rune('}'))
+}
+
+// Range creates a new *RangeNode for the given range, which is inclusive of
+// both start and end. If start and end are equal, the range has a single
+// value.
+func (b *Builder) Range(start, end int64) *RangeNode {
+	if start == end {
+		return NewRangeNode(b.Int(start), nil, nil, nil)
+	}
+	return NewRangeNode(b.Int(start), b.Keyword("to"), b.Int(end), nil)
+}
+
+// RangeToMax creates a new *RangeNode for a range that starts with the given
+// value and uses the "max" keyword for its end.
+func (b *Builder) RangeToMax(start int64) *RangeNode {
+	return NewRangeNode(b.Int(start), b.Keyword("to"), nil, b.Keyword("max"))
+}
+
+// ExtensionRange creates a new *ExtensionRangeNode with the given ranges. The
+// opts argument may be nil.
+func (b *Builder) ExtensionRange(ranges []*RangeNode, opts *CompactOptionsNode) *ExtensionRangeNode {
+	return NewExtensionRangeNode(b.Keyword("extensions"), ranges, b.commas(len(ranges)), opts, b.Rune(';'))
+}
+
+// ReservedRanges creates a new *ReservedNode that reserves the given ranges.
+func (b *Builder) ReservedRanges(ranges ...*RangeNode) *ReservedNode {
+	return NewReservedRangesNode(b.Keyword("reserved"), ranges, b.commas(len(ranges)), b.Rune(';'))
+}
+
+// ReservedNames creates a new *ReservedNode that reserves the given names.
+func (b *Builder) ReservedNames(names ...string) *ReservedNode {
+	vals := make([]StringValueNode, len(names))
+	for i, name := range names {
+		vals[i] = b.String(name)
+	}
+	return NewReservedNamesNode(b.Keyword("reserved"), vals, b.commas(len(names)), b.Rune(';'))
+}
+
+func (b *Builder) commas(count int) []*RuneNode {
+	if count == 0 {
+		return nil
+	}
+	commas := make([]*RuneNode, count-1)
+	for i := range commas {
+		commas[i] = b.Rune(',')
+	}
+	return commas
+}
+
+// MessageLiteral creates a new *MessageLiteralNode, for use as an option
+// value, with the given fields.
+func (b *Builder) MessageLiteral(fields ...*MessageFieldNode) *MessageLiteralNode {
+	return NewMessageLiteralNode(b.Rune('{'), fields, make([]*RuneNode, len(fields)), b.Rune('}'))
+}
+
+// MessageField creates a new *MessageFieldNode, for use in a message literal,
+// with the given name and value. Extension names must be enclosed in brackets,
+// as in "[foo.bar]". A separator (':') is included unless the value is a
+// message literal.
+func (b *Builder) MessageField(name string, val ValueNode) *MessageFieldNode {
+	var ref *FieldReferenceNode
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		ref = NewExtensionFieldReferenceNode(b.Rune('['), b.Identifier(name[1:len(name)-1]), b.Rune(']'))
+	} else {
+		ref = NewFieldReferenceNode(b.Ident(name))
+	}
+	var sep *RuneNode
+	if _, ok := val.(*MessageLiteralNode); !ok {
+		sep = b.Rune(':')
+	}
+	return NewMessageFieldNode(ref, sep, val)
+}
+
+// ArrayLiteral creates a new *ArrayLiteralNode, for use in a message literal,
+// with the given values.
+func (b *Builder) ArrayLiteral(vals ...ValueNode) *ArrayLiteralNode {
+	return NewArrayLiteralNode(b.Rune('['), vals, b.commas(len(vals)), b.Rune(']'))
+}
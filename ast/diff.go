@@ -0,0 +1,468 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChangeKind indicates the kind of change that was made to a declaration.
+type ChangeKind int
+
+const (
+	// ChangeAdded indicates a declaration that is present in the new file
+	// but not in the old one.
+	ChangeAdded = ChangeKind(iota + 1)
+	// ChangeRemoved indicates a declaration that is present in the old file
+	// but not in the new one.
+	ChangeRemoved
+	// ChangeModified indicates a declaration whose content changed, such as
+	// a field whose type or name changed.
+	ChangeModified
+	// ChangeMoved indicates a declaration that is in a different enclosing
+	// declaration, such as a field that was moved into a oneof or a message
+	// that was moved into a different enclosing message.
+	ChangeMoved
+	// ChangeComments indicates a declaration whose comments changed.
+	ChangeComments
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	case ChangeMoved:
+		return "moved"
+	case ChangeComments:
+		return "comments changed"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// Change describes a difference between two revisions of a file. See Diff.
+type Change struct {
+	Kind ChangeKind
+	// Element describes the kind of declaration that changed, such as
+	// "message", "field", or "option".
+	Element string
+	// Name identifies the declaration that changed. For named elements,
+	// this is the fully-qualified name. Options are identified by the name
+	// of the element they annotate followed by the option name, like
+	// "foo.Bar option deprecated". Other elements are identified by their
+	// keyword and contents, like `import "foo.proto"`.
+	//
+	// If the element was renamed, this is its name in the new file.
+	Name string
+	// Old is the declaration in the old file. It is nil if the kind is
+	// ChangeAdded.
+	Old Node
+	// New is the declaration in the new file. It is nil if the kind is
+	// ChangeRemoved.
+	New Node
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s %s %s", c.Kind, c.Element, c.Name)
+}
+
+// Diff computes the semantic differences between two revisions of a file.
+// Unlike a textual diff, changes in whitespace and in the order of
+// declarations are ignored.
+//
+// Declarations in the two files are matched by identity: fields (including
+// groups and map fields) and extensions are matched by their tag number and
+// most other elements are matched by their fully-qualified name. So renaming
+// a field is reported as a modification of that field, but renaming a message
+// is reported as the removal of the old message and the addition of a new
+// one. A message or enum that moves to a different enclosing message, but
+// keeps its simple name, is reported as moved.
+//
+// A matched declaration may produce up to three changes: one if it was moved,
+// one if its content was modified, and one if its comments changed. The
+// content of a declaration does not include nested declarations, which are
+// compared separately. So adding a field to a message is reported as an added
+// field, not as a modified message. Compact options, like those on fields and
+// enum values, are part of the content of the element they annotate.
+//
+// Comments of an element are its leading comments (including detached
+// comments) and its trailing comments.
+//
+// Removed declarations are reported first, in the order they appear in the
+// old file. These are followed by all other changes, in the order they appear
+// in the new file.
+func Diff(oldFile, newFile *FileNode) []Change {
+	oldElems := flattenForDiff(oldFile)
+	newElems := flattenForDiff(newFile)
+	byKey := func(elems []*diffElem) map[string]*diffElem {
+		m := make(map[string]*diffElem, len(elems))
+		for _, e := range elems {
+			m[e.key] = e
+		}
+		return m
+	}
+	oldByKey, newByKey := byKey(oldElems), byKey(newElems)
+
+	// Detect types that were moved to a different enclosing message. Old
+	// elements in a moved type are re-keyed so they match the corresponding
+	// elements in the new location.
+	for {
+		oldName, newName := findMovedType(oldElems, oldByKey, newElems, newByKey)
+		if oldName == "" {
+			break
+		}
+		for _, e := range oldElems {
+			e.key = replacePrefix(e.key, oldName, newName)
+			e.parent = replacePrefix(e.parent, oldName, newName)
+		}
+		oldByKey = byKey(oldElems)
+	}
+
+	var changes []Change
+	for _, o := range oldElems {
+		if newByKey[o.key] == nil {
+			changes = append(changes, Change{Kind: ChangeRemoved, Element: o.kind, Name: o.name, Old: o.node})
+		}
+	}
+	for _, n := range newElems {
+		o := oldByKey[n.key]
+		if o == nil {
+			changes = append(changes, Change{Kind: ChangeAdded, Element: n.kind, Name: n.name, New: n.node})
+			continue
+		}
+		if o.parent != n.parent {
+			changes = append(changes, Change{Kind: ChangeMoved, Element: n.kind, Name: n.name, Old: o.node, New: n.node})
+		}
+		if o.content != n.content {
+			changes = append(changes, Change{Kind: ChangeModified, Element: n.kind, Name: n.name, Old: o.node, New: n.node})
+		}
+		if o.comments != n.comments {
+			changes = append(changes, Change{Kind: ChangeComments, Element: n.kind, Name: n.name, Old: o.node, New: n.node})
+		}
+	}
+	return changes
+}
+
+// findMovedType returns the names of a message or enum that is in the old
+// file, but not the new, and a message or enum of the same kind and simple
+// name that is in the new file, but not the old. It returns empty strings if
+// there is no such pair. If there are multiple candidates for a simple name,
+// they are ambiguous and thus not considered moves.
+func findMovedType(oldElems []*diffElem, oldByKey map[string]*diffElem, newElems []*diffElem, newByKey map[string]*diffElem) (string, string) {
+	unmatched := func(elems []*diffElem, other map[string]*diffElem) map[string][]*diffElem {
+		m := map[string][]*diffElem{}
+		for _, e := range elems {
+			if e.kind != "message" && e.kind != "enum" {
+				continue
+			}
+			if other[e.key] != nil {
+				continue
+			}
+			simpleName := e.kind + " " + e.key[strings.LastIndexByte(e.key, '.')+1:]
+			m[simpleName] = append(m[simpleName], e)
+		}
+		return m
+	}
+	oldUnmatched := unmatched(oldElems, newByKey)
+	newUnmatched := unmatched(newElems, oldByKey)
+	names := make([]string, 0, len(oldUnmatched))
+	for name := range oldUnmatched {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// prefer outermost types, so that nested types move with them
+	var oldName, newName string
+	for _, name := range names {
+		o, n := oldUnmatched[name], newUnmatched[name]
+		if len(o) != 1 || len(n) != 1 {
+			continue
+		}
+		if oldName == "" || len(o[0].key) < len(oldName) {
+			oldName, newName = o[0].key, n[0].key
+		}
+	}
+	return oldName, newName
+}
+
+func replacePrefix(key, oldPrefix, newPrefix string) string {
+	if !strings.HasPrefix(key, oldPrefix) {
+		return key
+	}
+	rest := key[len(oldPrefix):]
+	if rest != "" && !strings.ContainsRune(".# ", rune(rest[0])) {
+		// prefix is not a complete name
+		return key
+	}
+	return newPrefix + rest
+}
+
+type diffElem struct {
+	// identity of the element, for matching with the other file
+	key string
+	// name of the element, for reporting
+	name string
+	// kind of the element, for reporting
+	kind string
+	node Node
+	// key of the enclosing element
+	parent string
+	// text of the element's tokens, excluding nested elements
+	content  string
+	comments string
+}
+
+type diffFlattener struct {
+	file  *FileNode
+	elems []*diffElem
+	keys  map[string]int
+}
+
+// flattenForDiff returns all declarations in the given file, in the order
+// they appear in the source.
+func flattenForDiff(file *FileNode) []*diffElem {
+	f := &diffFlattener{file: file, keys: map[string]int{}}
+	var pkg string
+	for _, decl := range file.Decls {
+		if pkgNode, ok := decl.(*PackageNode); ok {
+			pkg = string(pkgNode.Name.AsIdentifier())
+		}
+	}
+	if file.Syntax != nil {
+		f.add("syntax", "syntax", "syntax", "", file.Syntax, nil)
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *PackageNode:
+			f.add("package", "package", "package "+string(decl.Name.AsIdentifier()), "", decl, nil)
+		case *ImportNode:
+			name := fmt.Sprintf("import %q", decl.Name.AsString())
+			f.add("import", name, name, "", decl, nil)
+		case *OptionNode:
+			f.option("", "", decl)
+		case *MessageNode:
+			f.message(pkg, "", decl)
+		case *EnumNode:
+			f.enum(pkg, "", decl)
+		case *ExtendNode:
+			f.extend(pkg, "", decl)
+		case *ServiceNode:
+			f.service(pkg, decl)
+		}
+	}
+	return f.elems
+}
+
+func (f *diffFlattener) add(kind, key, name, parent string, n Node, children []Node) string {
+	// keys should be unique, but may not be if the file is not valid
+	if count := f.keys[key]; count > 0 {
+		f.keys[key]++
+		key = fmt.Sprintf("%s#%d", key, count)
+	} else {
+		f.keys[key] = 1
+	}
+	f.elems = append(f.elems, &diffElem{
+		key:      key,
+		name:     name,
+		kind:     kind,
+		node:     n,
+		parent:   parent,
+		content:  f.content(n, children),
+		comments: f.comments(n),
+	})
+	return key
+}
+
+func (f *diffFlattener) content(n Node, children []Node) string {
+	skip := make(map[Node]struct{}, len(children))
+	for _, child := range children {
+		skip[child] = struct{}{}
+	}
+	var sb strings.Builder
+	Inspect(n, func(n Node) bool {
+		if _, ok := skip[n]; ok {
+			return false
+		}
+		if _, ok := n.(TerminalNode); ok {
+			if sb.Len() > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(f.file.NodeInfo(n).RawText())
+		}
+		return true
+	})
+	return sb.String()
+}
+
+func (f *diffFlattener) comments(n Node) string {
+	info := f.file.NodeInfo(n)
+	var sb strings.Builder
+	for _, comments := range []Comments{info.LeadingComments(), info.TrailingComments()} {
+		for i := 0; i < comments.Len(); i++ {
+			sb.WriteString(strings.TrimSpace(comments.Index(i).RawText()))
+			sb.WriteByte('\n')
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func (f *diffFlattener) option(owner, parent string, n *OptionNode) {
+	name := "option " + OptionName(n.Name)
+	if owner != "" {
+		name = owner + " " + name
+	}
+	f.add("option", name, name, parent, n, nil)
+}
+
+func (f *diffFlattener) message(scope, parent string, n *MessageNode) {
+	fqn := qualify(scope, n.Name.Val)
+	children := make([]Node, len(n.Decls))
+	for i, decl := range n.Decls {
+		children[i] = decl
+	}
+	key := f.add("message", fqn, fqn, parent, n, children)
+	f.messageBody(fqn, key, n.Decls)
+}
+
+func (f *diffFlattener) messageBody(msgName, parent string, decls []MessageElement) {
+	for _, decl := range decls {
+		switch decl := decl.(type) {
+		case *OptionNode:
+			f.option(msgName, parent, decl)
+		case *FieldNode:
+			f.field(msgName, parent, decl)
+		case *MapFieldNode:
+			f.field(msgName, parent, decl)
+		case *GroupNode:
+			f.group(msgName, parent, decl)
+		case *OneOfNode:
+			f.oneOf(msgName, parent, decl)
+		case *MessageNode:
+			f.message(msgName, parent, decl)
+		case *EnumNode:
+			f.enum(msgName, parent, decl)
+		case *ExtendNode:
+			f.extend(msgName, parent, decl)
+		case *ExtensionRangeNode:
+			content := f.content(decl, nil)
+			f.add("extension range", msgName+" "+content, msgName+" "+strings.TrimSuffix(content, " ;"), parent, decl, nil)
+		case *ReservedNode:
+			content := f.content(decl, nil)
+			f.add("reserved", msgName+" "+content, msgName+" "+strings.TrimSuffix(content, " ;"), parent, decl, nil)
+		}
+	}
+}
+
+func (f *diffFlattener) field(msgName, parent string, n FieldDeclNode) {
+	key := fmt.Sprintf("%s#%s", msgName, f.content(n.FieldTag(), nil))
+	f.add("field", key, qualify(msgName, f.content(n.FieldName(), nil)), parent, n, nil)
+}
+
+func (f *diffFlattener) group(msgName, parent string, n *GroupNode) {
+	children := make([]Node, len(n.Decls))
+	for i, decl := range n.Decls {
+		children[i] = decl
+	}
+	key := fmt.Sprintf("%s#%s", msgName, f.content(n.Tag, nil))
+	key = f.add("group", key, qualify(msgName, n.Name.Val), parent, n, children)
+	f.messageBody(qualify(msgName, n.Name.Val), key, n.Decls)
+}
+
+func (f *diffFlattener) oneOf(msgName, parent string, n *OneOfNode) {
+	fqn := qualify(msgName, n.Name.Val)
+	children := make([]Node, len(n.Decls))
+	for i, decl := range n.Decls {
+		children[i] = decl
+	}
+	key := f.add("oneof", fqn, fqn, parent, n, children)
+	for _, decl := range n.Decls {
+		switch decl := decl.(type) {
+		case *OptionNode:
+			f.option(fqn, key, decl)
+		case *FieldNode:
+			f.field(msgName, key, decl)
+		case *GroupNode:
+			f.group(msgName, key, decl)
+		}
+	}
+}
+
+func (f *diffFlattener) enum(scope, parent string, n *EnumNode) {
+	fqn := qualify(scope, n.Name.Val)
+	children := make([]Node, len(n.Decls))
+	for i, decl := range n.Decls {
+		children[i] = decl
+	}
+	key := f.add("enum", fqn, fqn, parent, n, children)
+	for _, decl := range n.Decls {
+		switch decl := decl.(type) {
+		case *OptionNode:
+			f.option(fqn, key, decl)
+		case *EnumValueNode:
+			name := qualify(fqn, decl.Name.Val)
+			f.add("enum value", name, name, key, decl, nil)
+		case *ReservedNode:
+			content := f.content(decl, nil)
+			f.add("reserved", fqn+" "+content, fqn+" "+strings.TrimSuffix(content, " ;"), key, decl, nil)
+		}
+	}
+}
+
+func (f *diffFlattener) extend(scope, parent string, n *ExtendNode) {
+	// The extend block itself has no identity: its extensions are
+	// identified by their extendee and tag number.
+	extendee := string(n.Extendee.AsIdentifier())
+	for _, decl := range n.Decls {
+		switch decl := decl.(type) {
+		case *FieldNode:
+			key := fmt.Sprintf("%s extend %s#%s", scope, extendee, f.content(decl.Tag, nil))
+			f.add("extension", key, qualify(scope, decl.Name.Val), parent, decl, nil)
+		case *GroupNode:
+			children := make([]Node, len(decl.Decls))
+			for i, d := range decl.Decls {
+				children[i] = d
+			}
+			key := fmt.Sprintf("%s extend %s#%s", scope, extendee, f.content(decl.Tag, nil))
+			key = f.add("extension", key, qualify(scope, decl.Name.Val), parent, decl, children)
+			f.messageBody(qualify(scope, decl.Name.Val), key, decl.Decls)
+		}
+	}
+}
+
+func (f *diffFlattener) service(scope string, n *ServiceNode) {
+	fqn := qualify(scope, n.Name.Val)
+	children := make([]Node, len(n.Decls))
+	for i, decl := range n.Decls {
+		children[i] = decl
+	}
+	key := f.add("service", fqn, fqn, "", n, children)
+	for _, decl := range n.Decls {
+		switch decl := decl.(type) {
+		case *OptionNode:
+			f.option(fqn, key, decl)
+		case *RPCNode:
+			name := qualify(fqn, decl.Name.Val)
+			rpcChildren := make([]Node, len(decl.Decls))
+			for i, d := range decl.Decls {
+				rpcChildren[i] = d
+			}
+			rpcKey := f.add("rpc", name, name, key, decl, rpcChildren)
+			for _, d := range decl.Decls {
+				if opt, ok := d.(*OptionNode); ok {
+					f.option(name, rpcKey, opt)
+				}
+			}
+		}
+	}
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
@@ -0,0 +1,178 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile/ast"
+)
+
+const diffSource = `syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/empty.proto";
+
+option go_package = "foo/bar";
+
+// Foo is a message.
+message Foo {
+  string name = 1; // trailing
+  uint64 id = 2;
+  oneof choice {
+    string a = 3;
+    Nested b = 4;
+  }
+  message Nested {
+    repeated int32 vals = 1 [packed = false];
+  }
+  reserved 10 to 20;
+}
+
+enum Kind {
+  KIND_UNSET = 0;
+  KIND_A = 1;
+}
+
+service Svc {
+  rpc Do(Foo) returns (google.protobuf.Empty);
+}
+`
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		newText  func(string) string
+		expected []string
+	}{
+		{
+			name:    "no changes",
+			newText: func(s string) string { return s },
+		},
+		{
+			name: "whitespace and order ignored",
+			newText: func(s string) string {
+				s = strings.Replace(s, "  string name = 1; // trailing\n  uint64 id = 2;\n",
+					"  uint64   id=2;\n  string name = 1; // trailing\n", 1)
+				s = strings.Replace(s, "  KIND_UNSET = 0;\n  KIND_A = 1;\n", "  KIND_A = 1;   KIND_UNSET = 0;\n", 1)
+				return s
+			},
+		},
+		{
+			name: "added and removed",
+			newText: func(s string) string {
+				s = strings.Replace(s, "  uint64 id = 2;\n", "  uint64 id = 2;\n  bytes extra = 5;\n", 1)
+				s = strings.Replace(s, "  KIND_A = 1;\n", "", 1)
+				s = strings.Replace(s, `import "google/protobuf/empty.proto";`,
+					`import "google/protobuf/empty.proto";`+"\n"+`import "google/protobuf/any.proto";`, 1)
+				s = strings.Replace(s, "  reserved 10 to 20;\n", "  reserved 10 to 30;\n", 1)
+				return s
+			},
+			expected: []string{
+				"removed reserved foo.bar.Foo reserved 10 to 20",
+				"removed enum value foo.bar.Kind.KIND_A",
+				`added import import "google/protobuf/any.proto"`,
+				"added field foo.bar.Foo.extra",
+				"added reserved foo.bar.Foo reserved 10 to 30",
+			},
+		},
+		{
+			name: "modified",
+			newText: func(s string) string {
+				s = strings.Replace(s, "uint64 id = 2;", "int64 ident = 2;", 1)
+				s = strings.Replace(s, "packed = false", "packed = true", 1)
+				s = strings.Replace(s, `option go_package = "foo/bar";`, `option go_package = "foo/bar/v2";`, 1)
+				s = strings.Replace(s, "rpc Do(Foo) returns", "rpc Do(stream Foo) returns", 1)
+				return s
+			},
+			expected: []string{
+				"modified option option go_package",
+				"modified field foo.bar.Foo.ident",
+				"modified field foo.bar.Foo.Nested.vals",
+				"modified rpc foo.bar.Svc.Do",
+			},
+		},
+		{
+			name: "moved",
+			newText: func(s string) string {
+				s = strings.Replace(s, "  uint64 id = 2;\n  oneof choice {\n", "  oneof choice {\n    uint64 id = 2;\n", 1)
+				s = strings.Replace(s, "  message Nested {\n    repeated int32 vals = 1 [packed = false];\n  }\n", "", 1)
+				s = strings.Replace(s, "enum Kind {", "message Nested {\n  repeated int32 vals = 1 [packed = false];\n}\n\nenum Kind {", 1)
+				return s
+			},
+			expected: []string{
+				"moved field foo.bar.Foo.id",
+				"moved message foo.bar.Nested",
+			},
+		},
+		{
+			name: "comments",
+			newText: func(s string) string {
+				s = strings.Replace(s, "// Foo is a message.", "// Foo is a message.\n// It has fields.", 1)
+				s = strings.Replace(s, "// trailing", "/* trailing */", 1)
+				s = strings.Replace(s, "  KIND_A = 1;", "  // the A kind\n  KIND_A = 1;", 1)
+				return s
+			},
+			expected: []string{
+				"comments changed message foo.bar.Foo",
+				"comments changed field foo.bar.Foo.name",
+				"comments changed enum value foo.bar.Kind.KIND_A",
+			},
+		},
+		{
+			name: "renamed enum",
+			newText: func(s string) string {
+				return strings.Replace(s, "enum Kind {", "enum Sort {", 1)
+			},
+			expected: []string{
+				"removed enum foo.bar.Kind",
+				"removed enum value foo.bar.Kind.KIND_UNSET",
+				"removed enum value foo.bar.Kind.KIND_A",
+				"added enum foo.bar.Sort",
+				"added enum value foo.bar.Sort.KIND_UNSET",
+				"added enum value foo.bar.Sort.KIND_A",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldFile := parseForEdit(t, diffSource)
+			newFile := parseForEdit(t, tc.newText(diffSource))
+			changes := ast.Diff(oldFile, newFile)
+			actual := make([]string, len(changes))
+			for i, c := range changes {
+				actual[i] = c.String()
+				switch c.Kind {
+				case ast.ChangeAdded:
+					assert.Nil(t, c.Old)
+					assert.NotNil(t, c.New)
+				case ast.ChangeRemoved:
+					assert.NotNil(t, c.Old)
+					assert.Nil(t, c.New)
+				default:
+					assert.NotNil(t, c.Old)
+					assert.NotNil(t, c.New)
+				}
+			}
+			if len(tc.expected) == 0 {
+				assert.Empty(t, actual)
+			} else {
+				assert.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDiffNodes(t *testing.T) {
+	oldFile := parseForEdit(t, diffSource)
+	newFile := parseForEdit(t, strings.Replace(diffSource, "uint64 id = 2;", "fixed64 id = 2;", 1))
+	changes := ast.Diff(oldFile, newFile)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ast.ChangeModified, changes[0].Kind)
+	assert.Equal(t, ast.Identifier("uint64"), changes[0].Old.(*ast.FieldNode).FldType.AsIdentifier())
+	assert.Equal(t, ast.Identifier("fixed64"), changes[0].New.(*ast.FieldNode).FldType.AsIdentifier())
+	assert.Equal(t, "test.proto:12:3", newFile.NodeInfo(changes[0].New).Start().String())
+}
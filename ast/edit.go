@@ -0,0 +1,843 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Editor makes changes to the AST of a file. It can insert, remove, and
+// replace declarations in the bodies of the file, messages, enums, services,
+// and other elements that contain declarations. New nodes to add to the file
+// are created using the editor's embedded Builder.
+//
+// Changes are made in place: the *FileNode given to NewEditor (and the nodes
+// it contains) are modified by the editor. After each change, the file's
+// tokens and source text are re-computed. So the file is always consistent
+// and its nodes can be used to query source positions and comments, or to
+// print the modified source via Print.
+//
+// Comments in the file remain attached to the nodes to which they were
+// attributed. So when a declaration is removed, its comments are removed with
+// it; when a declaration is replaced, its comments are moved to the new node.
+// The whitespace for new nodes is computed to match the indentation of other
+// declarations in the enclosing body.
+type Editor struct {
+	Builder
+	file *FileNode
+}
+
+// NewEditor returns an editor that modifies the given file.
+func NewEditor(file *FileNode) *Editor {
+	e := &Editor{file: file}
+	if file.EOF == nil {
+		// files created via NewEmptyFileNode have no EOF
+		file.EOF = NewRuneNode(0, e.token(""))
+		file.Syntax = nil
+		file.Decls = nil
+		file.children = []Node{file.EOF}
+	}
+	e.layout()
+	return e
+}
+
+// File returns the file that is modified by this editor.
+func (e *Editor) File() *FileNode {
+	return e.file
+}
+
+// Insert inserts the given declarations into the body of the given container,
+// at the given index. The index is the position of the first new declaration
+// in the container's Decls field, so it must be between zero and the number of
+// existing declarations (inclusive). The file is laid out once, after all of
+// the declarations are inserted, so inserting many declarations with a single
+// call is much cheaper than inserting them one at a time.
+//
+// The container must be a node in the file, one of *FileNode, *MessageNode,
+// *GroupNode, *ExtendNode, *OneOfNode, *EnumNode, *ServiceNode, or *RPCNode.
+// The given declarations must be valid elements for that kind of container.
+// For example, a *FieldNode may be inserted into a *MessageNode, but not into
+// an *EnumNode. Each declaration must have been created by this editor's
+// builder (or be composed of nodes that are already in the file). An error is
+// returned if any of these conditions is not met, in which case the file is
+// not modified.
+func (e *Editor) Insert(container Node, index int, decls ...Node) error {
+	existing, err := e.decls(container)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index > len(existing) {
+		return fmt.Errorf("index %d is out of range: container has %d declarations", index, len(existing))
+	}
+	for _, decl := range decls {
+		if err := e.checkOwnership(decl); err != nil {
+			return err
+		}
+	}
+	newDecls := make([]Node, 0, len(existing)+len(decls))
+	newDecls = append(newDecls, existing[:index]...)
+	newDecls = append(newDecls, decls...)
+	newDecls = append(newDecls, existing[index:]...)
+	return e.update(container, newDecls)
+}
+
+// Append adds the given declarations to the end of the body of the given
+// container. See Insert for restrictions on the container and declarations.
+func (e *Editor) Append(container Node, decls ...Node) error {
+	existing, err := e.decls(container)
+	if err != nil {
+		return err
+	}
+	return e.Insert(container, len(existing), decls...)
+}
+
+// Remove removes the given declaration from the body of the given container.
+// An error is returned if the container is not in the file or if the given
+// declaration is not in its body. See Insert for more details on containers.
+//
+// Once removed, the declaration's tokens no longer refer to the file, so it
+// cannot be added back to the file.
+func (e *Editor) Remove(container Node, decl Node) error {
+	decls, err := e.decls(container)
+	if err != nil {
+		return err
+	}
+	index := indexOf(decls, decl)
+	if index < 0 {
+		return fmt.Errorf("declaration not found in container")
+	}
+	newDecls := make([]Node, 0, len(decls)-1)
+	newDecls = append(newDecls, decls[:index]...)
+	newDecls = append(newDecls, decls[index+1:]...)
+	return e.update(container, newDecls)
+}
+
+// Replace replaces the given old declaration, in the body of the given
+// container, with the given replacement. If the replacement was created by
+// this editor's builder, it acquires the whitespace and comments of the node
+// it replaces. See Insert for more details on containers and restrictions on
+// the replacement.
+func (e *Editor) Replace(container Node, old, replacement Node) error {
+	decls, err := e.decls(container)
+	if err != nil {
+		return err
+	}
+	index := indexOf(decls, old)
+	if index < 0 {
+		return fmt.Errorf("declaration not found in container")
+	}
+	newDecls := make([]Node, len(decls))
+	copy(newDecls, decls)
+	newDecls[index] = replacement
+	if err := e.checkDecls(container, newDecls); err != nil {
+		return err
+	}
+	if err := e.checkOwnership(replacement); err != nil {
+		return err
+	}
+	e.transferComments(old, replacement)
+	return e.update(container, newDecls)
+}
+
+// SetSyntax sets the syntax declaration of the file. If the given node is nil,
+// the file's syntax declaration is removed. If the given node was created by
+// this editor's builder, it acquires the comments of the declaration it
+// replaces.
+func (e *Editor) SetSyntax(syntax *SyntaxNode) error {
+	if syntax != nil {
+		if err := e.checkOwnership(syntax); err != nil {
+			return err
+		}
+	}
+	if e.file.Syntax != nil && syntax != nil {
+		e.transferComments(e.file.Syntax, syntax)
+	}
+	e.file.Syntax = syntax
+	children := make([]Node, 0, len(e.file.Decls)+2)
+	if syntax != nil {
+		children = append(children, syntax)
+	}
+	for _, decl := range e.file.Decls {
+		children = append(children, decl)
+	}
+	e.file.children = append(children, e.file.EOF)
+	e.layout()
+	return nil
+}
+
+// SetOptionValue changes the value of the given option, which must be in the
+// file. The option may be a declaration or a compact option. If the new value
+// was created by this editor's builder, it acquires the comments of the value
+// it replaces.
+func (e *Editor) SetOptionValue(opt *OptionNode, val ValueNode) error {
+	if !e.contains(opt) {
+		return fmt.Errorf("option is not in file %q", e.file.Name())
+	}
+	if err := e.checkOwnership(val); err != nil {
+		return err
+	}
+	e.transferComments(opt.Val, val)
+	var updated *OptionNode
+	if opt.Keyword != nil {
+		updated = NewOptionNode(opt.Keyword, opt.Name, opt.Equals, val, opt.Semicolon)
+	} else {
+		updated = NewCompactOptionNode(opt.Name, opt.Equals, val)
+	}
+	*opt = *updated
+	e.layout()
+	return nil
+}
+
+func indexOf(decls []Node, decl Node) int {
+	for i, d := range decls {
+		if d == decl {
+			return i
+		}
+	}
+	return -1
+}
+
+// transferComments moves the leading whitespace and comments of the given old
+// node to the given replacement, if the replacement is a synthetic node.
+func (e *Editor) transferComments(old, replacement Node) {
+	start := e.synthetic(replacement.Start())
+	end := e.synthetic(replacement.End())
+	if start == nil || end == nil {
+		return
+	}
+	oldStart, oldEnd := old.Start(), old.End()
+	if st := e.synthetic(oldStart); st != nil {
+		start.whitespace = st.whitespace
+		start.leadingComments = append(st.leadingComments, start.leadingComments...)
+		end.trailingComments = append(end.trailingComments, e.synthetic(oldEnd).trailingComments...)
+		return
+	}
+	startInfo := e.file.TokenInfo(oldStart)
+	ws := startInfo.LeadingWhitespace()
+	start.whitespace = &ws
+	start.leadingComments = append(asSyntheticComments(startInfo.LeadingComments()), start.leadingComments...)
+	end.trailingComments = append(end.trailingComments, asSyntheticComments(e.file.TokenInfo(oldEnd).TrailingComments())...)
+}
+
+func asSyntheticComments(comments Comments) []syntheticComment {
+	if comments.Len() == 0 {
+		return nil
+	}
+	result := make([]syntheticComment, comments.Len())
+	for i := range result {
+		c := comments.Index(i)
+		result[i] = syntheticComment{whitespace: c.LeadingWhitespace(), text: c.RawText()}
+	}
+	return result
+}
+
+// contains returns true if the given node is in the file.
+func (e *Editor) contains(n Node) bool {
+	found := false
+	var check func(Node)
+	check = func(node Node) {
+		if found {
+			return
+		}
+		if node == n {
+			found = true
+			return
+		}
+		if comp, ok := node.(CompositeNode); ok {
+			for _, child := range comp.Children() {
+				check(child)
+			}
+		}
+	}
+	check(e.file)
+	return found
+}
+
+// checkOwnership returns an error if the given node, which is to be added to
+// the file, contains tokens that were neither created by this editor's builder
+// nor are already in the file. Tokens from another file or from another
+// builder cannot be laid out.
+func (e *Editor) checkOwnership(n Node) error {
+	var inFile map[TerminalNode]struct{}
+	var check func(Node) bool
+	check = func(node Node) bool {
+		switch node := node.(type) {
+		case TerminalNode:
+			if tok := node.Token(); tok < 0 {
+				st := e.synthetic(tok)
+				return st != nil && st.node == unwrapTerminal(node)
+			}
+			if inFile == nil {
+				inFile = e.terminals()
+			}
+			_, ok := inFile[node]
+			return ok
+		case CompositeNode:
+			for _, child := range node.Children() {
+				if !check(child) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if !check(n) {
+		return fmt.Errorf("%T is not from file %q and was not created by this editor's builder", n, e.file.Name())
+	}
+	return nil
+}
+
+// unwrapTerminal returns the node that was created by a builder for the given
+// terminal node. Some terminal nodes wrap a *KeywordNode, which is the node
+// created by the builder.
+func unwrapTerminal(n TerminalNode) TerminalNode {
+	switch n := n.(type) {
+	case *BoolLiteralNode:
+		return n.KeywordNode
+	case *SpecialFloatLiteralNode:
+		return n.KeywordNode
+	}
+	return n
+}
+
+// terminals returns the set of terminal nodes in the file.
+func (e *Editor) terminals() map[TerminalNode]struct{} {
+	result := map[TerminalNode]struct{}{}
+	var collect func(Node)
+	collect = func(node Node) {
+		switch node := node.(type) {
+		case TerminalNode:
+			result[node] = struct{}{}
+		case CompositeNode:
+			for _, child := range node.Children() {
+				collect(child)
+			}
+		}
+	}
+	collect(e.file)
+	return result
+}
+
+func (e *Editor) decls(container Node) ([]Node, error) {
+	if !e.contains(container) {
+		return nil, fmt.Errorf("container is not in file %q", e.file.Name())
+	}
+	var decls []Node
+	switch c := container.(type) {
+	case *FileNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *MessageNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *GroupNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *ExtendNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *OneOfNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *EnumNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *ServiceNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	case *RPCNode:
+		for _, d := range c.Decls {
+			decls = append(decls, d)
+		}
+	default:
+		return nil, fmt.Errorf("%T cannot contain declarations", container)
+	}
+	return decls, nil
+}
+
+func (e *Editor) checkDecls(container Node, decls []Node) error {
+	for _, decl := range decls {
+		var ok bool
+		switch container.(type) {
+		case *FileNode:
+			_, ok = decl.(FileElement)
+		case *MessageNode, *GroupNode:
+			_, ok = decl.(MessageElement)
+		case *ExtendNode:
+			_, ok = decl.(ExtendElement)
+		case *OneOfNode:
+			_, ok = decl.(OneOfElement)
+		case *EnumNode:
+			_, ok = decl.(EnumElement)
+		case *ServiceNode:
+			_, ok = decl.(ServiceElement)
+		case *RPCNode:
+			_, ok = decl.(RPCElement)
+		}
+		if !ok {
+			return fmt.Errorf("%T is not allowed in %T", decl, container)
+		}
+	}
+	return nil
+}
+
+// update replaces the declarations in the given container with the given ones
+// and then re-computes the file's tokens.
+func (e *Editor) update(container Node, decls []Node) error {
+	if err := e.checkDecls(container, decls); err != nil {
+		return err
+	}
+	switch c := container.(type) {
+	case *FileNode:
+		fileDecls := make([]FileElement, len(decls))
+		for i, d := range decls {
+			fileDecls[i] = d.(FileElement)
+		}
+		children := make([]Node, 0, len(decls)+2)
+		if c.Syntax != nil {
+			children = append(children, c.Syntax)
+		}
+		children = append(children, decls...)
+		children = append(children, c.EOF)
+		c.Decls = fileDecls
+		c.children = children
+	case *MessageNode:
+		*c = *NewMessageNode(c.Keyword, c.Name, c.OpenBrace, asMessageElements(decls), c.CloseBrace)
+	case *GroupNode:
+		extendee := c.Extendee
+		*c = *NewGroupNode(c.Label.KeywordNode, c.Keyword, c.Name, c.Equals, c.Tag, c.Options, c.OpenBrace, asMessageElements(decls), c.CloseBrace)
+		c.Extendee = extendee
+	case *ExtendNode:
+		extDecls := make([]ExtendElement, len(decls))
+		for i, d := range decls {
+			extDecls[i] = d.(ExtendElement)
+		}
+		*c = *NewExtendNode(c.Keyword, c.Extendee, c.OpenBrace, extDecls, c.CloseBrace)
+	case *OneOfNode:
+		ooDecls := make([]OneOfElement, len(decls))
+		for i, d := range decls {
+			ooDecls[i] = d.(OneOfElement)
+		}
+		*c = *NewOneOfNode(c.Keyword, c.Name, c.OpenBrace, ooDecls, c.CloseBrace)
+	case *EnumNode:
+		enDecls := make([]EnumElement, len(decls))
+		for i, d := range decls {
+			enDecls[i] = d.(EnumElement)
+		}
+		*c = *NewEnumNode(c.Keyword, c.Name, c.OpenBrace, enDecls, c.CloseBrace)
+	case *ServiceNode:
+		svcDecls := make([]ServiceElement, len(decls))
+		for i, d := range decls {
+			svcDecls[i] = d.(ServiceElement)
+		}
+		*c = *NewServiceNode(c.Keyword, c.Name, c.OpenBrace, svcDecls, c.CloseBrace)
+	case *RPCNode:
+		rpcDecls := make([]RPCElement, len(decls))
+		for i, d := range decls {
+			rpcDecls[i] = d.(RPCElement)
+		}
+		openBrace, closeBrace := c.OpenBrace, c.CloseBrace
+		if openBrace == nil {
+			// adding a body to an RPC that did not have one
+			if len(decls) == 0 {
+				return nil
+			}
+			openBrace = e.Rune('{')
+			closeBrace = e.Rune('}')
+			// keep any comments that were attributed to the semicolon
+			semicolonInfo := e.file.NodeInfo(c.Semicolon)
+			e.synthetic(openBrace.Token()).leadingComments = asSyntheticComments(semicolonInfo.LeadingComments())
+			e.synthetic(closeBrace.Token()).trailingComments = asSyntheticComments(semicolonInfo.TrailingComments())
+		}
+		*c = *NewRPCNodeWithBody(c.Keyword, c.Name, c.Input, c.Returns, c.Output, openBrace, rpcDecls, closeBrace)
+	}
+	e.layout()
+	return nil
+}
+
+func asMessageElements(decls []Node) []MessageElement {
+	msgDecls := make([]MessageElement, len(decls))
+	for i, d := range decls {
+		msgDecls[i] = d.(MessageElement)
+	}
+	return msgDecls
+}
+
+// layout re-computes the tokens and source text for the file. This allocates
+// real tokens for any synthetic nodes in the file.
+func (e *Editor) layout() {
+	l := &layout{
+		b:    &e.Builder,
+		old:  e.file.fileInfo,
+		info: NewFileInfo(e.file.Name(), nil),
+	}
+	l.visit(e.file, "")
+	e.file.fileInfo = l.info
+}
+
+type layout struct {
+	b    *Builder
+	old  *FileInfo
+	info *FileInfo
+	// The text of the two most recently laid out tokens.
+	prevText, prevPrevText string
+	// If non-nil, the whitespace to use for the next token.
+	nextWhitespace *string
+}
+
+func (l *layout) visit(n Node, indent string) {
+	switch n := n.(type) {
+	case TerminalNode:
+		l.terminal(n)
+		return
+	case CompositeNode:
+		decls, closer := body(n)
+		_, isFile := n.(*FileNode)
+		childIndent := indent
+		if !isFile {
+			childIndent = l.childIndent(decls, indent)
+		}
+		isDecl := make(map[Node]bool, len(decls))
+		hasSynthetic := false
+		for _, d := range decls {
+			isDecl[d] = true
+			if d.Start() < 0 {
+				hasSynthetic = true
+			}
+		}
+		var prev Node
+		for i, child := range n.Children() {
+			if i > 0 {
+				prev = n.Children()[i-1]
+			}
+			switch {
+			case isDecl[child] && child.Start() < 0:
+				ws := l.lineBreak(childIndent)
+				if isFile && prev != nil {
+					switch child.(type) {
+					case *MessageNode, *EnumNode, *ExtendNode, *ServiceNode:
+						// blank line before top-level definitions
+						ws = "\n" + ws
+					default:
+						// and between groups of different kinds of declarations
+						if reflect.TypeOf(child) != reflect.TypeOf(prev) {
+							ws = "\n" + ws
+						}
+					}
+				}
+				l.nextWhitespace = &ws
+				l.visit(child, childIndent)
+			case isDecl[child]:
+				l.visit(child, childIndent)
+			case child == closer && (child.Start() < 0 || hasSynthetic):
+				if child.Start() < 0 || !strings.Contains(l.old.TokenInfo(child.Start()).LeadingWhitespace(), "\n") {
+					ws := l.lineBreak(indent)
+					l.nextWhitespace = &ws
+				}
+				l.visit(child, indent)
+			default:
+				l.visit(child, indent)
+			}
+		}
+	}
+}
+
+// body returns the declarations and the closing node for the body of the given
+// node. If the node has no body, this returns nil.
+func body(n Node) ([]Node, Node) {
+	var decls []Node
+	var closer Node
+	switch n := n.(type) {
+	case *FileNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.EOF
+	case *MessageNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *GroupNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *ExtendNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *OneOfNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *EnumNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *ServiceNode:
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	case *RPCNode:
+		if n.CloseBrace == nil {
+			return nil, nil
+		}
+		for _, d := range n.Decls {
+			decls = append(decls, d)
+		}
+		closer = n.CloseBrace
+	}
+	return decls, closer
+}
+
+// childIndent computes the indentation for declarations in a body. It uses the
+// indentation of existing declarations, if possible.
+func (l *layout) childIndent(decls []Node, indent string) string {
+	for _, d := range decls {
+		if d.Start() < 0 {
+			continue
+		}
+		ws := l.old.TokenInfo(d.Start()).LeadingWhitespace()
+		if pos := strings.LastIndexByte(ws, '\n'); pos >= 0 {
+			return ws[pos+1:]
+		}
+	}
+	return indent + "  "
+}
+
+// lineBreak returns whitespace that starts a new line with the given
+// indentation.
+func (l *layout) lineBreak(indent string) string {
+	if len(l.info.data) == 0 {
+		return ""
+	}
+	if l.info.data[len(l.info.data)-1] == '\n' {
+		// already at the start of a line (like after a line comment)
+		return indent
+	}
+	return "\n" + indent
+}
+
+func (l *layout) terminal(n TerminalNode) {
+	var ws, text string
+	var leading, trailing []syntheticComment
+	tok := n.Token()
+	if st := l.b.synthetic(tok); st != nil {
+		text = st.text
+		leading, trailing = st.leadingComments, st.trailingComments
+		switch {
+		case st.whitespace != nil:
+			ws = *st.whitespace
+		case l.nextWhitespace != nil:
+			ws = *l.nextWhitespace
+		default:
+			ws = l.defaultWhitespace(st)
+		}
+		if len(leading) > 0 || len(trailing) > 0 {
+			// Comments added via the builder need whitespace. Leading comments
+			// go where the token would have gone, and then the token follows
+			// with the same indentation.
+			indent := indentOf(ws)
+			leading = append([]syntheticComment(nil), leading...)
+			for i := range leading {
+				if !leading[i].added {
+					continue
+				}
+				if i == 0 {
+					leading[i].whitespace = ws
+				} else {
+					leading[i].whitespace = commentSeparator(leading[i-1], indent)
+				}
+			}
+			if len(leading) > 0 && leading[len(leading)-1].added {
+				ws = commentSeparator(leading[len(leading)-1], indent)
+			}
+			trailing = append([]syntheticComment(nil), trailing...)
+			for i := range trailing {
+				if !trailing[i].added {
+					continue
+				}
+				if i == 0 {
+					trailing[i].whitespace = " "
+				} else {
+					trailing[i].whitespace = commentSeparator(trailing[i-1], indent)
+				}
+			}
+		}
+		// now that it has a real token, it no longer needs synthetic info
+		*st = syntheticToken{}
+	} else if tok >= 0 && int(tok) < len(l.old.tokens) {
+		info := l.old.TokenInfo(tok)
+		ws = info.LeadingWhitespace()
+		text = info.RawText()
+		leading = asSyntheticComments(info.LeadingComments())
+		trailing = asSyntheticComments(info.TrailingComments())
+		if l.nextWhitespace != nil {
+			ws = *l.nextWhitespace
+		} else if l.needsLineBreak(tok, ws, leading) {
+			// The token (or its first comment) started a new line because it
+			// followed a line comment. But that comment may have been removed.
+			if len(leading) > 0 {
+				leading[0].whitespace = "\n" + leading[0].whitespace
+			} else {
+				ws = "\n" + ws
+			}
+		}
+	} else {
+		panic(fmt.Sprintf("token %d is not from this file or from the editor's builder", tok))
+	}
+	l.nextWhitespace = nil
+
+	// the index that the token will have, after any leading comments
+	newTok := Token(len(l.info.tokens) + len(leading))
+	for _, c := range leading {
+		l.write(c.whitespace)
+		offset := l.write(c.text)
+		l.info.AddComment(l.info.AddToken(offset, len(c.text)), newTok)
+	}
+	l.write(ws)
+	offset := l.write(text)
+	l.info.AddToken(offset, len(text))
+	for _, c := range trailing {
+		l.write(c.whitespace)
+		offset := l.write(c.text)
+		l.info.AddComment(l.info.AddToken(offset, len(c.text)), newTok)
+	}
+
+	n.(interface{ setToken(Token) }).setToken(newTok)
+	l.prevPrevText, l.prevText = l.prevText, text
+}
+
+// needsLineBreak returns true if the given original token, whose leading
+// whitespace and comments are given, started a line in the original file but
+// would not in the new file.
+func (l *layout) needsLineBreak(tok Token, ws string, leading []syntheticComment) bool {
+	if len(l.info.data) == 0 || l.info.data[len(l.info.data)-1] == '\n' {
+		return false
+	}
+	if len(leading) > 0 {
+		ws = leading[0].whitespace
+	}
+	if strings.Contains(ws, "\n") {
+		return false
+	}
+	start := l.old.tokens[tok].offset - len(ws)
+	for _, c := range leading {
+		start -= len(c.whitespace) + len(c.text)
+	}
+	return start > 0 && l.old.data[start-1] == '\n'
+}
+
+// commentSeparator returns the whitespace that follows the given comment,
+// before the next comment or token.
+func commentSeparator(c syntheticComment, indent string) string {
+	if !strings.HasSuffix(c.text, "\n") {
+		// block comment
+		if c.detached {
+			return "\n\n" + indent
+		}
+		return "\n" + indent
+	}
+	if c.detached {
+		return "\n" + indent
+	}
+	return indent
+}
+
+func indentOf(ws string) string {
+	return ws[strings.LastIndexByte(ws, '\n')+1:]
+}
+
+// defaultWhitespace computes the whitespace for a synthetic token that is not
+// at the start of a declaration.
+func (l *layout) defaultWhitespace(st *syntheticToken) string {
+	if len(l.info.data) == 0 || l.info.data[len(l.info.data)-1] == '\n' {
+		return ""
+	}
+	if !st.leadingDot {
+		switch st.text {
+		case ";", ",", ")", "]", ".", ":":
+			return ""
+		case "<":
+			if l.prevText == "map" {
+				return ""
+			}
+		case ">":
+			return ""
+		}
+	}
+	switch l.prevText {
+	case "(", "[", "<", ".", "-":
+		return ""
+	}
+	if st.text == "(" && l.prevPrevText == "rpc" {
+		// no space between method name and request type
+		return ""
+	}
+	return " "
+}
+
+func (l *layout) write(s string) int {
+	offset := len(l.info.data)
+	l.info.data = append(l.info.data, s...)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			l.info.AddLine(offset + i + 1)
+		}
+	}
+	return offset
+}
+
+// Print writes the source text for the given file, including all comments
+// and whitespace, to the given writer. For a file that was parsed, this
+// reproduces the original source. For a file that was modified with an
+// *Editor, this produces the modified source.
+func Print(w io.Writer, file *FileNode) error {
+	var err error
+	var print func(Node)
+	print = func(n Node) {
+		if err != nil {
+			return
+		}
+		switch n := n.(type) {
+		case TerminalNode:
+			info := file.NodeInfo(n)
+			if err = printComments(w, info.LeadingComments()); err != nil {
+				return
+			}
+			if _, err = io.WriteString(w, info.LeadingWhitespace()+info.RawText()); err != nil {
+				return
+			}
+			err = printComments(w, info.TrailingComments())
+		case CompositeNode:
+			for _, child := range n.Children() {
+				print(child)
+			}
+		}
+	}
+	print(file)
+	return err
+}
+
+func printComments(w io.Writer, comments Comments) error {
+	for i := 0; i < comments.Len(); i++ {
+		c := comments.Index(i)
+		if _, err := io.WriteString(w, c.LeadingWhitespace()+c.RawText()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package ast_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+const editSource = `syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/empty.proto";
+
+// Foo is a message.
+message Foo {
+  // the name
+  string name = 1; // trailing
+  // the id
+  uint64 id = 2;
+  option deprecated = true;
+}
+
+enum Kind {
+  KIND_UNSET = 0;
+}
+
+service Svc {
+  rpc Do(Foo) returns (google.protobuf.Empty);
+}
+`
+
+func parseForEdit(t *testing.T, source string) *ast.FileNode {
+	file, err := parser.Parse("test.proto", strings.NewReader(source), reporter.NewHandler(nil))
+	require.NoError(t, err)
+	return file
+}
+
+func printAndReparse(t *testing.T, file *ast.FileNode) string {
+	var buf bytes.Buffer
+	require.NoError(t, ast.Print(&buf, file))
+	// the result must be valid and must produce the same text when re-parsed
+	reparsed := parseForEdit(t, buf.String())
+	var buf2 bytes.Buffer
+	require.NoError(t, ast.Print(&buf2, reparsed))
+	assert.Equal(t, buf.String(), buf2.String())
+	return buf.String()
+}
+
+func TestEditor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		edit     func(*ast.Editor) error
+		expected string
+	}{
+		{
+			name: "no changes",
+			edit: func(*ast.Editor) error {
+				return nil
+			},
+			expected: editSource,
+		},
+		{
+			name: "insert import",
+			edit: func(e *ast.Editor) error {
+				return e.Insert(e.File(), 2, e.Import("google/protobuf/any.proto", ""))
+			},
+			expected: strings.Replace(editSource,
+				`import "google/protobuf/empty.proto";`,
+				`import "google/protobuf/empty.proto";`+"\n"+`import "google/protobuf/any.proto";`, 1),
+		},
+		{
+			name: "append field",
+			edit: func(e *ast.Editor) error {
+				msg := e.File().Decls[2].(*ast.MessageNode)
+				fld := e.Field("repeated", "foo.bar.Kind", "kinds", 3, e.CompactOptions(e.CompactOption("packed", e.Bool(false))))
+				if err := e.AddComment(fld, "// the kinds"); err != nil {
+					return err
+				}
+				return e.Append(msg, fld)
+			},
+			expected: strings.Replace(editSource,
+				"  option deprecated = true;\n",
+				"  option deprecated = true;\n  // the kinds\n  repeated foo.bar.Kind kinds = 3 [packed = false];\n", 1),
+		},
+		{
+			name: "append message",
+			edit: func(e *ast.Editor) error {
+				msg := e.Message("Bar",
+					e.Field("", "map<string, Foo>", "foos", 1, nil),
+					e.Enum("Nested", e.EnumValue("NESTED_UNSET", 0, nil), e.EnumValue("NEG", -1, nil)),
+				)
+				return e.Append(e.File(), msg)
+			},
+			expected: editSource + `
+message Bar {
+  map<string, Foo> foos = 1;
+  enum Nested {
+    NESTED_UNSET = 0;
+    NEG = -1;
+  }
+}
+`,
+		},
+		{
+			name: "remove field",
+			edit: func(e *ast.Editor) error {
+				msg := e.File().Decls[2].(*ast.MessageNode)
+				return e.Remove(msg, msg.Decls[0])
+			},
+			expected: strings.Replace(editSource,
+				"  // the name\n  string name = 1; // trailing\n", "", 1),
+		},
+		{
+			name: "replace field",
+			edit: func(e *ast.Editor) error {
+				msg := e.File().Decls[2].(*ast.MessageNode)
+				return e.Replace(msg, msg.Decls[1], e.Field("", "int64", "id", 2, nil))
+			},
+			expected: strings.Replace(editSource, "uint64 id = 2;", "int64 id = 2;", 1),
+		},
+		{
+			name: "set option value",
+			edit: func(e *ast.Editor) error {
+				msg := e.File().Decls[2].(*ast.MessageNode)
+				return e.SetOptionValue(msg.Decls[2].(*ast.OptionNode), e.Bool(false))
+			},
+			expected: strings.Replace(editSource, "deprecated = true", "deprecated = false", 1),
+		},
+		{
+			name: "add rpc body",
+			edit: func(e *ast.Editor) error {
+				svc := e.File().Decls[4].(*ast.ServiceNode)
+				rpc := svc.Decls[0].(*ast.RPCNode)
+				return e.Append(rpc, e.Option("idempotency_level", e.Identifier("NO_SIDE_EFFECTS")))
+			},
+			expected: strings.Replace(editSource,
+				"returns (google.protobuf.Empty);",
+				"returns (google.protobuf.Empty) {\n    option idempotency_level = NO_SIDE_EFFECTS;\n  }", 1),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := parseForEdit(t, editSource)
+			e := ast.NewEditor(file)
+			require.NoError(t, tc.edit(e))
+			assert.Equal(t, tc.expected, printAndReparse(t, file))
+		})
+	}
+}
+
+func TestEditorKeepsComments(t *testing.T) {
+	file := parseForEdit(t, editSource)
+	e := ast.NewEditor(file)
+	msg := file.Decls[2].(*ast.MessageNode)
+	replacement := e.Field("", "int64", "name", 1, nil)
+	require.NoError(t, e.Replace(msg, msg.Decls[0], replacement))
+
+	info := file.NodeInfo(replacement)
+	require.Equal(t, 1, info.LeadingComments().Len())
+	assert.Equal(t, "// the name\n", info.LeadingComments().Index(0).RawText())
+	require.Equal(t, 1, info.TrailingComments().Len())
+	assert.Equal(t, "// trailing\n", info.TrailingComments().Index(0).RawText())
+	assert.Equal(t, "test.proto:10:3", info.Start().String())
+
+	// other nodes have correct positions, too
+	assert.Equal(t, "test.proto:12:3", file.NodeInfo(msg.Decls[1]).Start().String())
+	assert.Equal(t, "// the id\n", file.NodeInfo(msg.Decls[1]).LeadingComments().Index(0).RawText())
+}
+
+func TestEditorErrors(t *testing.T) {
+	file := parseForEdit(t, editSource)
+	e := ast.NewEditor(file)
+	msg := file.Decls[2].(*ast.MessageNode)
+	en := file.Decls[3].(*ast.EnumNode)
+
+	err := e.Append(en, e.Field("", "string", "foo", 1, nil))
+	assert.EqualError(t, err, "*ast.FieldNode is not allowed in *ast.EnumNode")
+	err = e.Insert(msg, 10, e.Field("", "string", "foo", 3, nil))
+	assert.EqualError(t, err, "index 10 is out of range: container has 3 declarations")
+	err = e.Remove(msg, en)
+	assert.EqualError(t, err, "declaration not found in container")
+	err = e.Append(e.Message("Other"), e.Field("", "string", "foo", 1, nil))
+	assert.EqualError(t, err, `container is not in file "test.proto"`)
+	err = e.Append(file.Decls[0], e.Field("", "string", "foo", 1, nil))
+	assert.EqualError(t, err, `*ast.PackageNode cannot contain declarations`)
+
+	// nodes must be from the file or from the editor's builder
+	other := parseForEdit(t, editSource)
+	err = e.Append(file, other.Decls[2])
+	assert.EqualError(t, err, `*ast.MessageNode is not from file "test.proto" and was not created by this editor's builder`)
+	otherEditor := ast.NewEditor(ast.NewEmptyFileNode("other.proto"))
+	err = e.Append(msg, otherEditor.Field("", "string", "foo", 3, nil))
+	assert.EqualError(t, err, `*ast.FieldNode is not from file "test.proto" and was not created by this editor's builder`)
+	err = e.Replace(msg, msg.Decls[0], otherEditor.Field("", "string", "foo", 1, nil))
+	assert.EqualError(t, err, `*ast.FieldNode is not from file "test.proto" and was not created by this editor's builder`)
+	err = e.SetOptionValue(msg.Decls[2].(*ast.OptionNode), otherEditor.Bool(false))
+	assert.EqualError(t, err, `*ast.BoolLiteralNode is not from file "test.proto" and was not created by this editor's builder`)
+	err = e.SetSyntax(otherEditor.Syntax("proto2"))
+	assert.EqualError(t, err, `*ast.SyntaxNode is not from file "test.proto" and was not created by this editor's builder`)
+	err = e.Append(msg, e.Field("", "string", "foo", 3, nil), otherEditor.Field("", "string", "bar", 4, nil))
+	assert.EqualError(t, err, `*ast.FieldNode is not from file "test.proto" and was not created by this editor's builder`)
+	err = e.Insert(file, 1, e.Message("Other"), e.EnumValue("FOO", 0, nil))
+	assert.EqualError(t, err, "*ast.EnumValueNode is not allowed in *ast.FileNode")
+
+	// no changes were made
+	var buf bytes.Buffer
+	require.NoError(t, ast.Print(&buf, file))
+	assert.Equal(t, editSource, buf.String())
+
+	// a removed declaration cannot be added back
+	require.NoError(t, e.Remove(file, en))
+	err = e.Append(file, en)
+	assert.EqualError(t, err, `*ast.EnumNode is not from file "test.proto" and was not created by this editor's builder`)
+
+	// comments must be added to nodes before they are added to the file
+	fld := e.Field("", "string", "foo", 3, nil)
+	require.NoError(t, e.Append(msg, fld))
+	err = e.AddComment(fld, "// comment")
+	assert.EqualError(t, err, "cannot add comment to a node that is already in a file; comments must be added before the node is added to the file")
+	err = e.AddTrailingComment(fld, "// comment")
+	assert.EqualError(t, err, "cannot add comment to a node that is already in a file; comments must be added before the node is added to the file")
+	err = e.AddComment(msg, "// comment")
+	assert.EqualError(t, err, "cannot add comment to a node that is already in a file; comments must be added before the node is added to the file")
+	var b ast.Builder
+	err = b.AddComment(e.Field("", "string", "bar", 4, nil), "// comment")
+	assert.EqualError(t, err, "cannot add comment to a node not created by this builder")
+}
+
+func TestEditorNewFile(t *testing.T) {
+	file := ast.NewEmptyFileNode("new.proto")
+	e := ast.NewEditor(file)
+	require.NoError(t, e.Append(file, e.Package("foo.bar"), e.Option("go_package", e.String("foo/bar"))))
+	require.NoError(t, e.Append(file, e.Message("Foo",
+		e.Field("optional", "string", "name", 1, e.CompactOptions(e.CompactOption("default", e.String("abc")))),
+		e.Field("optional", "double", "val", 2, e.CompactOptions(e.CompactOption("default", e.Float(-1)))),
+	)))
+	assert.Equal(t, `package foo.bar;
+
+option go_package = "foo/bar";
+
+message Foo {
+  optional string name = 1 [default = "abc"];
+  optional double val = 2 [default = -1.0];
+}
+`, printAndReparse(t, file))
+}
+
+func TestEditorLayoutRoundTrips(t *testing.T) {
+	// laying out the tokens of a parsed file, without any changes, must
+	// reproduce the original source
+	err := filepath.Walk("../internal/testprotos", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) == ".proto" {
+			t.Run(path, func(t *testing.T) {
+				data, err := ioutil.ReadFile(path)
+				require.NoError(t, err)
+				root, err := parser.Parse(filepath.Base(path), bytes.NewReader(data), reporter.NewHandler(nil))
+				require.NoError(t, err)
+				ast.NewEditor(root)
+				var buf bytes.Buffer
+				require.NoError(t, ast.Print(&buf, root))
+				assert.Equal(t, string(data), buf.String())
+			})
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestEditorLayout(t *testing.T) {
+	file := ast.NewEmptyFileNode("new.proto")
+	e := ast.NewEditor(file)
+	require.NoError(t, e.SetSyntax(e.Syntax("proto3")))
+	require.NoError(t, e.Append(file, e.Package("foo.bar")))
+	require.NoError(t, e.Append(file, e.Import("google/protobuf/empty.proto", "")))
+	require.NoError(t, e.Append(file, e.Import("google/protobuf/any.proto", "public")))
+	opt := e.Option("go_package", e.String("foo/bar"))
+	require.NoError(t, e.AddDetachedComment(opt, "// detached"))
+	require.NoError(t, e.AddComment(opt, "/* block */"))
+	require.NoError(t, e.AddComment(opt, "// leading"))
+	require.NoError(t, e.AddTrailingComment(opt, "// trailing"))
+	require.NoError(t, e.Append(file, opt))
+	require.NoError(t, e.Append(file, e.Option("java_multiple_files", e.Bool(true))))
+	fld := e.Field("", "string", "name", 1, nil)
+	require.NoError(t, e.AddTrailingComment(fld, "/* trailing */"))
+	require.NoError(t, e.Append(file, e.Message("Foo", fld)))
+	require.NoError(t, e.Append(file, e.Service("Svc",
+		e.RPC("Do", "Foo", false, "google.protobuf.Empty", true),
+	)))
+	assert.Equal(t, `syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/empty.proto";
+import public "google/protobuf/any.proto";
+
+// detached
+
+/* block */
+// leading
+option go_package = "foo/bar"; // trailing
+option java_multiple_files = true;
+
+message Foo {
+  string name = 1; /* trailing */
+}
+
+service Svc {
+  rpc Do(Foo) returns (stream google.protobuf.Empty);
+}
+`, printAndReparse(t, file))
+}
@@ -54,6 +54,11 @@ func (n terminalNode) Token() Token {
 	return Token(n)
 }
 
+// setToken is used by *Editor to re-assign tokens when an AST is modified.
+func (n *terminalNode) setToken(t Token) {
+	*n = terminalNode(t)
+}
+
 // compositeNode contains book-keeping shared by all CompositeNode
 // implementations. It is embedded in all such node types in this
 // package. It provides the implementation of the CompositeNode
@@ -0,0 +1,484 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Query provides convenient, typed access to the contents of a file's AST.
+// It is an alternative to using Walk with a Visitor for common questions,
+// like "what are all the fields in this message" or "where are all of the
+// options with a given name".
+//
+// A Query builds an index of the parent of every node in the file when it is
+// created, which allows for efficient navigation up the tree (to ancestors)
+// and across it (to siblings). Because of this index, a Query should not be
+// used after the file's AST is modified. Instead, create a new Query for the
+// modified file.
+type Query struct {
+	file    *FileNode
+	parents map[Node]Node
+	// the index of each node in its parent's children
+	indexes map[Node]int
+}
+
+// NewQuery creates a new query for the given file. This traverses the entire
+// file to build an index of parent nodes.
+func NewQuery(file *FileNode) *Query {
+	q := &Query{
+		file:    file,
+		parents: map[Node]Node{},
+		indexes: map[Node]int{},
+	}
+	q.index(file)
+	return q
+}
+
+func (q *Query) index(n Node) {
+	comp, ok := n.(CompositeNode)
+	if !ok {
+		return
+	}
+	for i, child := range comp.Children() {
+		q.parents[child] = n
+		q.indexes[child] = i
+		q.index(child)
+	}
+}
+
+// File returns the file that is the root of all queried nodes.
+func (q *Query) File() *FileNode {
+	return q.file
+}
+
+// Parent returns the parent of the given node. It returns nil if the given
+// node is the file or if the node is not in the file.
+func (q *Query) Parent(n Node) Node {
+	return q.parents[n]
+}
+
+// Ancestors returns all ancestors of the given node, starting with its parent
+// and ending with the file. It returns nil if the given node is the file or if
+// the node is not in the file.
+func (q *Query) Ancestors(n Node) []Node {
+	var ancestors []Node
+	for p := q.parents[n]; p != nil; p = q.parents[p] {
+		ancestors = append(ancestors, p)
+	}
+	return ancestors
+}
+
+// Enclosing returns the nearest ancestor of the given node that matches the
+// given filter. It returns nil if no ancestor matches. For example, the
+// following finds the message in which a field is declared:
+//
+//   msg := q.Enclosing(field, ast.OfType((*ast.MessageNode)(nil)))
+func (q *Query) Enclosing(n Node, filter Filter) Node {
+	for p := q.parents[n]; p != nil; p = q.parents[p] {
+		if filter(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Siblings returns all children of the given node's parent, including the
+// node itself. It returns nil if the given node is the file or if the node is
+// not in the file.
+func (q *Query) Siblings(n Node) []Node {
+	p, ok := q.parents[n].(CompositeNode)
+	if !ok {
+		return nil
+	}
+	return p.Children()
+}
+
+// PrevSibling returns the sibling that immediately precedes the given node.
+// It returns nil if the given node is the first child of its parent, if it
+// is the file, or if it is not in the file.
+func (q *Query) PrevSibling(n Node) Node {
+	siblings := q.Siblings(n)
+	i := q.indexes[n]
+	if i == 0 || i > len(siblings) {
+		return nil
+	}
+	return siblings[i-1]
+}
+
+// NextSibling returns the sibling that immediately follows the given node.
+// It returns nil if the given node is the last child of its parent, if it is
+// the file, or if it is not in the file.
+func (q *Query) NextSibling(n Node) Node {
+	siblings := q.Siblings(n)
+	i := q.indexes[n]
+	if i+1 >= len(siblings) {
+		return nil
+	}
+	return siblings[i+1]
+}
+
+// Messages returns all messages declared in the file, including nested
+// messages, in the order they appear in the source. Groups and map fields,
+// which also define messages, are not included.
+func (q *Query) Messages() []*MessageNode {
+	var msgs []*MessageNode
+	Inspect(q.file, func(n Node) bool {
+		if msg, ok := n.(*MessageNode); ok {
+			msgs = append(msgs, msg)
+		}
+		return isDeclContainer(n)
+	})
+	return msgs
+}
+
+// Enums returns all enums declared in the file, including those nested in
+// messages, in the order they appear in the source.
+func (q *Query) Enums() []*EnumNode {
+	var enums []*EnumNode
+	Inspect(q.file, func(n Node) bool {
+		if en, ok := n.(*EnumNode); ok {
+			enums = append(enums, en)
+			return false
+		}
+		return isDeclContainer(n)
+	})
+	return enums
+}
+
+// Extends returns all extend blocks in the file, including those nested in
+// messages, in the order they appear in the source.
+func (q *Query) Extends() []*ExtendNode {
+	var extends []*ExtendNode
+	Inspect(q.file, func(n Node) bool {
+		if ext, ok := n.(*ExtendNode); ok {
+			extends = append(extends, ext)
+		}
+		return isDeclContainer(n)
+	})
+	return extends
+}
+
+// Services returns all services declared in the file, in the order they
+// appear in the source.
+func (q *Query) Services() []*ServiceNode {
+	var svcs []*ServiceNode
+	for _, decl := range q.file.Decls {
+		if svc, ok := decl.(*ServiceNode); ok {
+			svcs = append(svcs, svc)
+		}
+	}
+	return svcs
+}
+
+// Fields returns the fields declared in the given container, in the order
+// they appear in the source. The container should be a *FileNode,
+// *MessageNode, *GroupNode, *OneOfNode, or *ExtendNode. Other kinds of
+// nodes contain no fields, so nil is returned for them.
+//
+// The fields of a message include those in its oneofs, as well as extensions
+// that are declared in extend blocks inside the message. A group is a field
+// of its enclosing message, but the fields inside the group's body belong to
+// the group. Similarly, the fields of a file are the extensions declared in
+// its top-level extend blocks.
+//
+// If recursive is true, fields of nested messages and groups are also
+// returned. Each nested field appears after the field or message that
+// encloses it.
+func (q *Query) Fields(container Node, recursive bool) []FieldDeclNode {
+	var fields []FieldDeclNode
+	collectFields(container, recursive, &fields)
+	return fields
+}
+
+func collectFields(n Node, recursive bool, fields *[]FieldDeclNode) {
+	var decls []Node
+	switch n := n.(type) {
+	case *FileNode:
+		for _, decl := range n.Decls {
+			decls = append(decls, decl)
+		}
+	case *MessageNode:
+		for _, decl := range n.Decls {
+			decls = append(decls, decl)
+		}
+	case *GroupNode:
+		for _, decl := range n.Decls {
+			decls = append(decls, decl)
+		}
+	case *OneOfNode:
+		for _, decl := range n.Decls {
+			decls = append(decls, decl)
+		}
+	case *ExtendNode:
+		for _, decl := range n.Decls {
+			decls = append(decls, decl)
+		}
+	}
+	for _, decl := range decls {
+		switch decl := decl.(type) {
+		case *FieldNode:
+			*fields = append(*fields, decl)
+		case *MapFieldNode:
+			*fields = append(*fields, decl)
+		case *GroupNode:
+			*fields = append(*fields, decl)
+			if recursive {
+				collectFields(decl, recursive, fields)
+			}
+		case *OneOfNode, *ExtendNode:
+			collectFields(decl, recursive, fields)
+		case *MessageNode:
+			if recursive {
+				collectFields(decl, recursive, fields)
+			}
+		}
+	}
+}
+
+// Options returns all options in the file with the given name, in the order
+// they appear in the source. This includes compact options, like those on
+// fields and enum values. If name is empty, all options are returned.
+//
+// The name is matched against the option name as written in the source, but
+// without any whitespace or comments. So extension names must be enclosed in
+// parentheses, like "(foo.bar).baz", and are not resolved: an option written
+// as "(bar).baz" in a file whose package is "foo" does not match the name
+// "(foo.bar).baz".
+func (q *Query) Options(name string) []*OptionNode {
+	var opts []*OptionNode
+	Inspect(q.file, func(n Node) bool {
+		if opt, ok := n.(*OptionNode); ok {
+			if name == "" || OptionName(opt.Name) == name {
+				opts = append(opts, opt)
+			}
+			return false
+		}
+		return true
+	})
+	return opts
+}
+
+// OptionName returns the given option name as a string. Extension names are
+// enclosed in parentheses, and the components of the name are separated by
+// dots. For example: "(foo.bar).baz".
+func OptionName(n *OptionNameNode) string {
+	parts := make([]string, len(n.Parts))
+	for i, part := range n.Parts {
+		parts[i] = part.Value()
+	}
+	return strings.Join(parts, ".")
+}
+
+// Find returns all nodes in the tree rooted at the given node that match the
+// given filter, in the order they appear in the source. The root itself is
+// included if it matches. Descendants of matching nodes are also searched.
+func (q *Query) Find(root Node, filter Filter) []Node {
+	var nodes []Node
+	Inspect(root, func(n Node) bool {
+		if filter(n) {
+			nodes = append(nodes, n)
+		}
+		return true
+	})
+	return nodes
+}
+
+// NodeAt returns the innermost node whose span includes the given position.
+// Only the line and column of the position are examined. It returns nil if
+// the position is not inside any token in the file.
+func (q *Query) NodeAt(pos SourcePos) Node {
+	contains := q.Contains(pos)
+	if !contains(q.file) {
+		return nil
+	}
+	var found Node
+	Inspect(q.file, func(n Node) bool {
+		if !contains(n) {
+			return false
+		}
+		found = n
+		return true
+	})
+	if found == q.file {
+		// position is in whitespace or comments between tokens
+		return nil
+	}
+	return found
+}
+
+// Contains returns a filter that matches nodes whose span includes the given
+// position. Only the line and column of the position are examined.
+func (q *Query) Contains(pos SourcePos) Filter {
+	return func(n Node) bool {
+		info := q.file.NodeInfo(n)
+		return comparePos(info.Start(), pos) <= 0 && comparePos(pos, info.End()) < 0
+	}
+}
+
+// InRange returns a filter that matches nodes whose span is entirely inside
+// the given range. The range includes the start position but excludes the end
+// position. Only the line and column of the positions are examined.
+func (q *Query) InRange(start, end SourcePos) Filter {
+	return func(n Node) bool {
+		info := q.file.NodeInfo(n)
+		return comparePos(start, info.Start()) <= 0 && comparePos(info.End(), end) <= 0
+	}
+}
+
+func comparePos(a, b SourcePos) int {
+	switch {
+	case a.Line < b.Line:
+		return -1
+	case a.Line > b.Line:
+		return 1
+	case a.Col < b.Col:
+		return -1
+	case a.Col > b.Col:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isDeclContainer(n Node) bool {
+	switch n.(type) {
+	case *FileNode, *MessageNode, *GroupNode, *OneOfNode, *ExtendNode:
+		return true
+	default:
+		return false
+	}
+}
+
+// Filter is a predicate that matches AST nodes. Filters are used to find
+// nodes with a Query.
+type Filter func(Node) bool
+
+// OfType returns a filter that matches nodes that have the same concrete type
+// as any of the given example nodes. The examples are typically nil pointers
+// of the desired type, for example:
+//
+//   ast.OfType((*ast.FieldNode)(nil), (*ast.MapFieldNode)(nil))
+func OfType(examples ...Node) Filter {
+	types := make(map[reflect.Type]struct{}, len(examples))
+	for _, ex := range examples {
+		types[reflect.TypeOf(ex)] = struct{}{}
+	}
+	return func(n Node) bool {
+		_, ok := types[reflect.TypeOf(n)]
+		return ok
+	}
+}
+
+// And returns a filter that matches nodes that match all of the given filters.
+func And(filters ...Filter) Filter {
+	return func(n Node) bool {
+		for _, f := range filters {
+			if !f(n) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns a filter that matches nodes that match any of the given filters.
+func Or(filters ...Filter) Filter {
+	return func(n Node) bool {
+		for _, f := range filters {
+			if f(n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns a filter that matches nodes that do not match the given filter.
+func Not(filter Filter) Filter {
+	return func(n Node) bool {
+		return !filter(n)
+	}
+}
+
+// Inspect traverses the AST rooted at the given node in pre-order, calling fn
+// for each node. If fn returns false, the children of that node are skipped.
+//
+// Unlike Walk, this does not require a Visitor and it can traverse trees that
+// contain node types that are not known to the Visitor interface.
+func Inspect(root Node, fn func(Node) bool) {
+	if !fn(root) {
+		return
+	}
+	if comp, ok := root.(CompositeNode); ok {
+		for _, child := range comp.Children() {
+			Inspect(child, fn)
+		}
+	}
+}
+
+// Iterator provides iterator-style, pre-order traversal of an AST. This is
+// useful when a traversal should be driven by a loop instead of by callbacks:
+//
+//   for it := ast.NewIterator(file); it.Next(); {
+//     if _, ok := it.Node().(*ast.EnumNode); ok {
+//       it.SkipChildren()
+//     }
+//     ...
+//   }
+type Iterator struct {
+	// each frame is the list of nodes yet to be visited at a given depth
+	stack [][]Node
+	node  Node
+	depth int
+	skip  bool
+}
+
+// NewIterator returns an iterator over all nodes in the tree rooted at the
+// given node. The iterator is positioned before the root, so Next must be
+// called to advance to the first node.
+func NewIterator(root Node) *Iterator {
+	return &Iterator{stack: [][]Node{{root}}}
+}
+
+// Next advances the iterator to the next node. It returns false if there are
+// no more nodes.
+func (it *Iterator) Next() bool {
+	if comp, ok := it.node.(CompositeNode); ok && !it.skip {
+		if children := comp.Children(); len(children) > 0 {
+			it.stack = append(it.stack, children)
+		}
+	}
+	it.skip = false
+	for len(it.stack) > 0 {
+		top := len(it.stack) - 1
+		if len(it.stack[top]) == 0 {
+			it.stack = it.stack[:top]
+			continue
+		}
+		it.node = it.stack[top][0]
+		it.stack[top] = it.stack[top][1:]
+		it.depth = top
+		return true
+	}
+	it.node = nil
+	return false
+}
+
+// Node returns the current node. It returns nil if Next has not been called
+// or if the iteration is complete.
+func (it *Iterator) Node() Node {
+	return it.node
+}
+
+// Depth returns the depth of the current node, relative to the root of the
+// iteration. The root has a depth of zero, its children a depth of one, and
+// so on.
+func (it *Iterator) Depth() int {
+	return it.depth
+}
+
+// SkipChildren causes the next call to Next to skip the descendants of the
+// current node.
+func (it *Iterator) SkipChildren() {
+	it.skip = true
+}
@@ -0,0 +1,233 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile/ast"
+)
+
+const querySource = `syntax = "proto2";
+
+package foo.bar;
+
+option (foo.bar.opt).baz = 1;
+
+message Foo {
+  optional string name = 1 [deprecated = true];
+  oneof choice {
+    uint64 id = 2;
+    group Grp = 3 {
+      optional bool flag = 1 [deprecated = false];
+    }
+  }
+  map<string, Foo> others = 4;
+  message Nested {
+    optional int32 val = 1;
+    enum Kind {
+      KIND_UNSET = 0 [deprecated = true];
+    }
+  }
+  extend Foo {
+    optional string ext = 100;
+  }
+  extensions 100 to max;
+}
+
+extend Foo {
+  optional Foo.Nested top_ext = 101;
+}
+
+service Svc {
+  rpc Do(Foo) returns (Foo);
+}
+`
+
+func fieldNames(fields []ast.FieldDeclNode) []string {
+	names := make([]string, len(fields))
+	for i, fld := range fields {
+		names[i] = string(fld.FieldName().(*ast.IdentNode).Val)
+	}
+	return names
+}
+
+func TestQueryFinders(t *testing.T) {
+	file := parseForEdit(t, querySource)
+	q := ast.NewQuery(file)
+	msg := file.Decls[2].(*ast.MessageNode)
+
+	var msgNames []string
+	for _, m := range q.Messages() {
+		msgNames = append(msgNames, m.Name.Val)
+	}
+	assert.Equal(t, []string{"Foo", "Nested"}, msgNames)
+	require.Len(t, q.Enums(), 1)
+	assert.Equal(t, "Kind", q.Enums()[0].Name.Val)
+	require.Len(t, q.Extends(), 2)
+	require.Len(t, q.Services(), 1)
+	assert.Equal(t, "Svc", q.Services()[0].Name.Val)
+
+	testCases := []struct {
+		name      string
+		container ast.Node
+		recursive bool
+		expected  []string
+	}{
+		{
+			name:      "file",
+			container: file,
+			expected:  []string{"top_ext"},
+		},
+		{
+			name:      "file, recursive",
+			container: file,
+			recursive: true,
+			expected:  []string{"name", "id", "Grp", "flag", "others", "val", "ext", "top_ext"},
+		},
+		{
+			name:      "message",
+			container: msg,
+			expected:  []string{"name", "id", "Grp", "others", "ext"},
+		},
+		{
+			name:      "message, recursive",
+			container: msg,
+			recursive: true,
+			expected:  []string{"name", "id", "Grp", "flag", "others", "val", "ext"},
+		},
+		{
+			name:      "oneof",
+			container: msg.Decls[1],
+			expected:  []string{"id", "Grp"},
+		},
+		{
+			name:      "enum",
+			container: q.Enums()[0],
+			expected:  []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, fieldNames(q.Fields(tc.container, tc.recursive)))
+		})
+	}
+}
+
+func TestQueryOptions(t *testing.T) {
+	file := parseForEdit(t, querySource)
+	q := ast.NewQuery(file)
+
+	assert.Len(t, q.Options(""), 4)
+	deprecated := q.Options("deprecated")
+	require.Len(t, deprecated, 3)
+	assert.Equal(t, "test.proto:8:29", file.NodeInfo(deprecated[0]).Start().String())
+	assert.Equal(t, "test.proto:12:31", file.NodeInfo(deprecated[1]).Start().String())
+	assert.Equal(t, "test.proto:19:23", file.NodeInfo(deprecated[2]).Start().String())
+	custom := q.Options("(foo.bar.opt).baz")
+	require.Len(t, custom, 1)
+	assert.Equal(t, "(foo.bar.opt).baz", ast.OptionName(custom[0].Name))
+	assert.Empty(t, q.Options("baz"))
+}
+
+func TestQueryNavigation(t *testing.T) {
+	file := parseForEdit(t, querySource)
+	q := ast.NewQuery(file)
+	msg := file.Decls[2].(*ast.MessageNode)
+	oneof := msg.Decls[1].(*ast.OneOfNode)
+	grp := oneof.Decls[1].(*ast.GroupNode)
+	flag := grp.Decls[0].(*ast.FieldNode)
+
+	assert.Same(t, grp, q.Parent(flag))
+	assert.Equal(t, []ast.Node{grp, oneof, msg, file}, q.Ancestors(flag))
+	assert.Nil(t, q.Parent(file))
+	assert.Nil(t, q.Ancestors(file))
+	assert.Same(t, oneof, q.Enclosing(flag, ast.OfType((*ast.OneOfNode)(nil))))
+	assert.Same(t, msg, q.Enclosing(flag, ast.OfType((*ast.MessageNode)(nil))))
+	assert.Nil(t, q.Enclosing(flag, ast.OfType((*ast.EnumNode)(nil))))
+
+	assert.Same(t, oneof.Decls[0], q.PrevSibling(grp))
+	assert.Same(t, oneof.CloseBrace, q.NextSibling(grp))
+	assert.Same(t, oneof.Decls[1], q.NextSibling(oneof.Decls[0]))
+	assert.Nil(t, q.PrevSibling(oneof.Keyword))
+	assert.Nil(t, q.NextSibling(oneof.CloseBrace))
+	assert.Nil(t, q.PrevSibling(file))
+	assert.Equal(t, oneof.Children(), q.Siblings(grp))
+
+	// nodes not in the file
+	other := ast.NewIdentNode("foo", ast.Token(0))
+	assert.Nil(t, q.Parent(other))
+	assert.Nil(t, q.NextSibling(other))
+}
+
+func TestQueryFilters(t *testing.T) {
+	file := parseForEdit(t, querySource)
+	q := ast.NewQuery(file)
+	msg := file.Decls[2].(*ast.MessageNode)
+
+	nested := q.Messages()[1]
+	start := file.NodeInfo(nested).Start()
+	end := file.NodeInfo(nested).End()
+	fields := q.Find(file, ast.And(
+		ast.OfType((*ast.FieldNode)(nil), (*ast.EnumValueNode)(nil)),
+		q.InRange(start, end),
+	))
+	require.Len(t, fields, 2)
+	assert.Equal(t, "val", fields[0].(*ast.FieldNode).Name.Val)
+	assert.Equal(t, "KIND_UNSET", fields[1].(*ast.EnumValueNode).Name.Val)
+
+	notFields := q.Find(msg, ast.And(
+		ast.OfType((*ast.FieldNode)(nil), (*ast.GroupNode)(nil), (*ast.MapFieldNode)(nil)),
+		ast.Not(q.InRange(start, end)),
+	))
+	assert.Len(t, notFields, 6)
+	assert.Len(t, q.Find(file, ast.Or(ast.OfType((*ast.EnumNode)(nil)), ast.OfType((*ast.ServiceNode)(nil)))), 2)
+
+	// position of "id" in "uint64 id = 2;"
+	pos := ast.SourcePos{Filename: "test.proto", Line: 10, Col: 12}
+	ident, ok := q.NodeAt(pos).(*ast.IdentNode)
+	require.True(t, ok)
+	assert.Equal(t, "id", ident.Val)
+	enclosing := q.Find(file, q.Contains(pos))
+	require.Len(t, enclosing, 5)
+	assert.Same(t, file, enclosing[0])
+	assert.Same(t, msg, enclosing[1])
+	assert.Same(t, ident, enclosing[4])
+	// whitespace
+	assert.Nil(t, q.NodeAt(ast.SourcePos{Filename: "test.proto", Line: 2, Col: 1}))
+}
+
+func TestIterator(t *testing.T) {
+	file := parseForEdit(t, querySource)
+	var expected []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		expected = append(expected, n)
+		return true
+	})
+
+	var actual []ast.Node
+	var maxDepth int
+	for it := ast.NewIterator(file); it.Next(); {
+		actual = append(actual, it.Node())
+		if it.Depth() > maxDepth {
+			maxDepth = it.Depth()
+		}
+	}
+	assert.Equal(t, expected, actual)
+	// file > message > oneof > group > field > compact options > option > option name > field ref > ident
+	assert.Equal(t, 9, maxDepth)
+
+	var decls []ast.Node
+	it := ast.NewIterator(file)
+	require.True(t, it.Next())
+	assert.Same(t, file, it.Node())
+	assert.Equal(t, 0, it.Depth())
+	for it.Next() {
+		assert.Equal(t, 1, it.Depth())
+		decls = append(decls, it.Node())
+		it.SkipChildren()
+	}
+	assert.Nil(t, it.Node())
+	assert.Equal(t, file.Children(), decls)
+}
@@ -0,0 +1,726 @@
+package protocompile
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// CompileCache is a persistent store of compiled files, which allows a
+// Compiler to skip parsing, linking, and interpreting options for files that
+// have already been compiled. See Compiler.Cache.
+//
+// Keys are opaque strings that consist only of lowercase hexadecimal digits.
+// Implementations need not verify the integrity of the data they return: the
+// compiler does that, treating corrupt entries as if they were absent.
+// Implementations must be safe for concurrent use.
+type CompileCache interface {
+	// Load returns the data stored for the given key. If there is no data
+	// for the key, it returns false.
+	Load(key string) ([]byte, bool)
+	// Store stores the given data for the given key, replacing any data
+	// already stored for it. The compiler ignores errors returned by this
+	// method, since a failure to cache a file does not prevent compilation.
+	Store(key string, data []byte) error
+}
+
+// DiskCache is a CompileCache that stores entries as files in a directory.
+// The directory may be shared by multiple processes.
+//
+// If the cache has a maximum size, then the least recently used entries are
+// evicted when storing a new entry would exceed that size.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+var _ CompileCache = (*DiskCache)(nil)
+
+const diskCacheTempPrefix = ".tmp-"
+
+// NewDiskCache creates a cache that stores entries in the given directory,
+// which is created if it does not exist. If maxSize is positive, it is the
+// maximum total size, in bytes, of all entries in the cache.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{dir: dir, maxSize: maxSize}
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		c.size += entry.size
+	}
+	return c, nil
+}
+
+// Dir returns the directory in which the cache stores its entries.
+func (c *DiskCache) Dir() string {
+	return c.dir
+}
+
+func (c *DiskCache) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(c.dir, key)
+	}
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Load implements the CompileCache interface. Loading an entry updates its
+// modification time, which is used to determine which entries were least
+// recently used.
+func (c *DiskCache) Load(key string) ([]byte, bool) {
+	path := c.path(key)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Store implements the CompileCache interface. The entry is written to a
+// temporary file and then renamed, so concurrent readers never observe a
+// partially written entry.
+func (c *DiskCache) Store(key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), diskCacheTempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	var oldSize int64
+	if info, err := os.Stat(path); err == nil {
+		oldSize = info.Size()
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += int64(len(data)) - oldSize
+	if c.maxSize > 0 && c.size > c.maxSize {
+		return c.evictLocked()
+	}
+	return nil
+}
+
+// evictLocked removes the least recently used entries until the total size
+// of the cache is no more than its maximum size. Since other processes may
+// share the directory, the current size is re-computed from its contents.
+func (c *DiskCache) evictLocked() error {
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	c.size = 0
+	for _, entry := range entries {
+		c.size += entry.size
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, entry := range entries {
+		if c.size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.size -= entry.size
+	}
+	return nil
+}
+
+type diskCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *DiskCache) entries() ([]diskCacheEntry, error) {
+	var entries []diskCacheEntry
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed concurrently
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), diskCacheTempPrefix) {
+			return nil
+		}
+		entries = append(entries, diskCacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
+
+// cacheEntryMagic identifies the format of cache entries. It must be changed
+// whenever the format changes or when changes to the compiler could produce
+// different descriptors for the same source.
+var cacheEntryMagic = []byte("protocompile-cache-v2\n")
+
+var errCorruptCacheEntry = errors.New("corrupt cache entry")
+
+// cacheEntry is the data stored in a CompileCache for a file.
+type cacheEntry struct {
+	// the cache key under which this entry is stored
+	key string
+	// the file key, which is computed from the cache key plus the keys of
+	// the file's dependencies
+	fileKey []byte
+	// the imports of the file
+	deps []string
+	// the compiled file
+	proto *descriptorpb.FileDescriptorProto
+	// the warnings reported when the file was compiled
+	warnings []cachedWarning
+	// true if the file was checked for unused imports when it was compiled,
+	// which is only done for files that are explicitly compiled (as opposed
+	// to files that are only imported)
+	checkedImports bool
+}
+
+const (
+	cacheEntryKeyTag            = 1
+	cacheEntryFileKeyTag        = 2
+	cacheEntryDepTag            = 3
+	cacheEntryProtoTag          = 4
+	cacheEntryWarningTag        = 5
+	cacheEntryCheckedImportsTag = 6
+)
+
+// cachedWarning is a warning that was reported when a cached file was
+// compiled, so that it can be reported again when the file is loaded from
+// the cache.
+type cachedWarning struct {
+	pos     ast.SourcePos
+	message string
+	// if true, the warning is parser.ErrNoSyntax
+	noSyntax bool
+	// if non-empty, the warning is a linker.ErrUnusedImport for this import
+	unusedImport string
+}
+
+const (
+	cachedWarningFilenameTag     = 1
+	cachedWarningLineTag         = 2
+	cachedWarningColTag          = 3
+	cachedWarningOffsetTag       = 4
+	cachedWarningMessageTag      = 5
+	cachedWarningNoSyntaxTag     = 6
+	cachedWarningUnusedImportTag = 7
+)
+
+func newCachedWarning(err reporter.ErrorWithPos) cachedWarning {
+	w := cachedWarning{pos: err.GetPosition(), message: err.Unwrap().Error()}
+	var unused linker.ErrorUnusedImport
+	switch {
+	case errors.Is(err, parser.ErrNoSyntax):
+		w.noSyntax = true
+	case errors.As(err, &unused):
+		w.unusedImport = unused.UnusedImport()
+	}
+	return w
+}
+
+// err returns the error to report for the warning. It is the same as, or
+// equivalent to, the error reported when the file was compiled.
+func (w *cachedWarning) err() error {
+	switch {
+	case w.noSyntax:
+		return parser.ErrNoSyntax
+	case w.unusedImport != "":
+		return cachedUnusedImport{message: w.message, imp: w.unusedImport}
+	default:
+		return errors.New(w.message)
+	}
+}
+
+func (w *cachedWarning) encode() []byte {
+	var data []byte
+	data = protowire.AppendTag(data, cachedWarningFilenameTag, protowire.BytesType)
+	data = protowire.AppendString(data, w.pos.Filename)
+	data = protowire.AppendTag(data, cachedWarningLineTag, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(w.pos.Line))
+	data = protowire.AppendTag(data, cachedWarningColTag, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(w.pos.Col))
+	data = protowire.AppendTag(data, cachedWarningOffsetTag, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(w.pos.Offset))
+	data = protowire.AppendTag(data, cachedWarningMessageTag, protowire.BytesType)
+	data = protowire.AppendString(data, w.message)
+	if w.noSyntax {
+		data = protowire.AppendTag(data, cachedWarningNoSyntaxTag, protowire.VarintType)
+		data = protowire.AppendVarint(data, 1)
+	}
+	if w.unusedImport != "" {
+		data = protowire.AppendTag(data, cachedWarningUnusedImportTag, protowire.BytesType)
+		data = protowire.AppendString(data, w.unusedImport)
+	}
+	return data
+}
+
+func decodeCachedWarning(data []byte) (cachedWarning, error) {
+	var w cachedWarning
+	for len(data) > 0 {
+		tag, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return w, errCorruptCacheEntry
+		}
+		data = data[n:]
+		switch wireType {
+		case protowire.VarintType:
+			val, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return w, errCorruptCacheEntry
+			}
+			data = data[n:]
+			switch tag {
+			case cachedWarningLineTag:
+				w.pos.Line = int(val)
+			case cachedWarningColTag:
+				w.pos.Col = int(val)
+			case cachedWarningOffsetTag:
+				w.pos.Offset = int(val)
+			case cachedWarningNoSyntaxTag:
+				w.noSyntax = val != 0
+			}
+		case protowire.BytesType:
+			val, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return w, errCorruptCacheEntry
+			}
+			data = data[n:]
+			switch tag {
+			case cachedWarningFilenameTag:
+				w.pos.Filename = string(val)
+			case cachedWarningMessageTag:
+				w.message = string(val)
+			case cachedWarningUnusedImportTag:
+				w.unusedImport = string(val)
+			}
+		default:
+			return w, errCorruptCacheEntry
+		}
+	}
+	return w, nil
+}
+
+// cachedUnusedImport is the linker.ErrorUnusedImport reported for an unused
+// import in a file that was loaded from the cache.
+type cachedUnusedImport struct {
+	message string
+	imp     string
+}
+
+var _ linker.ErrorUnusedImport = cachedUnusedImport{}
+
+func (e cachedUnusedImport) Error() string {
+	return e.message
+}
+
+func (e cachedUnusedImport) UnusedImport() string {
+	return e.imp
+}
+
+// warningRecorder is a reporter that records the warnings reported for a file,
+// so they can be stored in the cache. It delegates to the task's handler.
+type warningRecorder struct {
+	h        *reporter.Handler
+	warnings []cachedWarning
+}
+
+func (r *warningRecorder) Error(err reporter.ErrorWithPos) error {
+	return r.h.HandleError(err)
+}
+
+func (r *warningRecorder) Warning(err reporter.ErrorWithPos) {
+	r.warnings = append(r.warnings, newCachedWarning(err))
+	r.h.HandleWarning(err.GetPosition(), err.Unwrap())
+}
+
+// encode serializes the entry. The result includes a checksum, so that
+// decodeCacheEntry can detect corruption.
+func (e *cacheEntry) encode() ([]byte, error) {
+	protoBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(e.proto)
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	payload = protowire.AppendTag(payload, cacheEntryKeyTag, protowire.BytesType)
+	payload = protowire.AppendString(payload, e.key)
+	payload = protowire.AppendTag(payload, cacheEntryFileKeyTag, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, e.fileKey)
+	for _, dep := range e.deps {
+		payload = protowire.AppendTag(payload, cacheEntryDepTag, protowire.BytesType)
+		payload = protowire.AppendString(payload, dep)
+	}
+	payload = protowire.AppendTag(payload, cacheEntryProtoTag, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, protoBytes)
+	for _, w := range e.warnings {
+		payload = protowire.AppendTag(payload, cacheEntryWarningTag, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, w.encode())
+	}
+	if e.checkedImports {
+		payload = protowire.AppendTag(payload, cacheEntryCheckedImportsTag, protowire.BytesType)
+		payload = protowire.AppendBytes(payload, nil)
+	}
+
+	checksum := sha256.Sum256(payload)
+	data := make([]byte, 0, len(cacheEntryMagic)+len(checksum)+len(payload))
+	data = append(data, cacheEntryMagic...)
+	data = append(data, checksum[:]...)
+	return append(data, payload...), nil
+}
+
+// decodeCacheEntry de-serializes an entry that was stored with the given
+// key. It returns errCorruptCacheEntry if the data is not a valid entry for
+// that key.
+func decodeCacheEntry(key string, data []byte) (*cacheEntry, error) {
+	if !bytes.HasPrefix(data, cacheEntryMagic) {
+		return nil, errCorruptCacheEntry
+	}
+	data = data[len(cacheEntryMagic):]
+	if len(data) < sha256.Size {
+		return nil, errCorruptCacheEntry
+	}
+	checksum, payload := data[:sha256.Size], data[sha256.Size:]
+	if actual := sha256.Sum256(payload); !bytes.Equal(checksum, actual[:]) {
+		return nil, errCorruptCacheEntry
+	}
+
+	var entry cacheEntry
+	var protoBytes []byte
+	for len(payload) > 0 {
+		tag, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 || wireType != protowire.BytesType {
+			return nil, errCorruptCacheEntry
+		}
+		payload = payload[n:]
+		val, n := protowire.ConsumeBytes(payload)
+		if n < 0 {
+			return nil, errCorruptCacheEntry
+		}
+		payload = payload[n:]
+		switch tag {
+		case cacheEntryKeyTag:
+			entry.key = string(val)
+		case cacheEntryFileKeyTag:
+			entry.fileKey = val
+		case cacheEntryDepTag:
+			entry.deps = append(entry.deps, string(val))
+		case cacheEntryProtoTag:
+			protoBytes = val
+		case cacheEntryWarningTag:
+			w, err := decodeCachedWarning(val)
+			if err != nil {
+				return nil, err
+			}
+			entry.warnings = append(entry.warnings, w)
+		case cacheEntryCheckedImportsTag:
+			entry.checkedImports = true
+		}
+	}
+	if entry.key != key || protoBytes == nil {
+		return nil, errCorruptCacheEntry
+	}
+	entry.proto = &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(protoBytes, entry.proto); err != nil {
+		return nil, errCorruptCacheEntry
+	}
+	return &entry, nil
+}
+
+// useCache returns true if files should be loaded from and stored in the
+// compiler's cache. The cache is not used when there are option validators,
+// since they could not be run for cached files.
+func (c *Compiler) useCache() bool {
+	return c.Cache != nil && c.OptionValidators == nil
+}
+
+// cacheKey computes the key under which the given source for the given file
+// is cached. It accounts for the compiler settings that affect the resulting
+// descriptors but not for the file's dependencies.
+func (c *Compiler) cacheKey(name string, source []byte) string {
+	h := sha256.New()
+	_, _ = h.Write(cacheEntryMagic)
+	var includeSourceInfo, includeOptionValueSourceInfo byte
+	if c.IncludeSourceInfo {
+		includeSourceInfo = 1
+		if c.IncludeOptionValueSourceInfo {
+			includeOptionValueSourceInfo = 1
+		}
+	}
+	_, _ = h.Write([]byte{includeSourceInfo, includeOptionValueSourceInfo})
+	// limits are included since cached files are not checked against them
+	_ = binary.Write(h, binary.LittleEndian, [4]int64{
+		int64(c.Limits.MaxFileSize),
+		int64(c.Limits.MaxNestingDepth),
+		int64(c.Limits.MaxDeclarations),
+		int64(c.Limits.MaxStringLength),
+	})
+	writeLengthPrefixed(h, []byte(name))
+	writeLengthPrefixed(h, source)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheFileKey computes the key for a compiled file from its cache key and
+// the keys of its dependencies. So a file's key changes if the source of any
+// file in its transitive closure changes.
+func cacheFileKey(key string, depKeys [][]byte) []byte {
+	h := sha256.New()
+	writeLengthPrefixed(h, []byte(key))
+	for _, depKey := range depKeys {
+		writeLengthPrefixed(h, depKey)
+	}
+	return h.Sum(nil)
+}
+
+func writeLengthPrefixed(w io.Writer, data []byte) {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+	_, _ = w.Write(lenBuf[:n])
+	_, _ = w.Write(data)
+}
+
+// asCachedFile compiles the file with the given source, using the compiler's
+// cache. If the cache has an entry for the file that is still valid, it is
+// used. Otherwise, the file is compiled and the result is stored in the cache.
+func (t *task) asCachedFile(ctx context.Context, name string, src io.Reader) (linker.File, error) {
+	if t.e.c.Limits.MaxFileSize > 0 {
+		// don't read more than necessary to tell that the file is too large
+		src = io.LimitReader(src, int64(t.e.c.Limits.MaxFileSize)+1)
+	}
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	key := t.e.c.cacheKey(name, data)
+	if entryData, ok := t.e.c.Cache.Load(key); ok {
+		if entry, err := decodeCacheEntry(key, entryData); err == nil && entry.proto.GetName() == name {
+			file, err := t.fromCache(ctx, name, entry)
+			if err != nil || file != nil {
+				return file, err
+			}
+		}
+	}
+
+	// record the warnings reported while compiling, so they can be
+	// reported again when the file is loaded from the cache
+	rec := &warningRecorder{h: t.h}
+	t.h = reporter.NewHandler(rec)
+	file, err := t.compileFile(ctx, name, SearchResult{Source: bytes.NewReader(data)})
+	t.h = rec.h
+	if err != nil {
+		return file, err
+	}
+	t.storeInCache(key, file, rec.warnings)
+	return file, nil
+}
+
+// fromCache returns the file for the given cache entry. If the entry is not
+// valid, because the keys of the file's dependencies have changed, it returns
+// nil and no error. In that case, the file must be re-compiled. The warnings
+// that were reported when the file was compiled are reported again.
+func (t *task) fromCache(ctx context.Context, name string, entry *cacheEntry) (linker.File, error) {
+	if t.r.explicitFile && !entry.checkedImports {
+		// the file was cached when it was only imported, so it was not
+		// checked for unused imports; re-compile it so that they are reported
+		return nil, nil
+	}
+	var deps linker.Files
+	var depKeys [][]byte
+	if len(entry.deps) > 0 {
+		t.r.setBlockedOn(entry.deps)
+
+		// If there is a problem with any of the dependencies, such as an
+		// import cycle, we re-compile the file so that the problem is
+		// reported the same way as when the file isn't cached.
+		discard := reporter.NewHandler(reporter.NewReporter(func(reporter.ErrorWithPos) error {
+			return nil
+		}, nil))
+		results := make([]*result, len(entry.deps))
+		checked := map[string]struct{}{}
+		for i, dep := range entry.deps {
+			if dep == name {
+				return nil, nil
+			}
+			res := t.e.compile(ctx, dep)
+			if err := t.e.checkForDependencyCycle(discard, res, []string{name, dep}, ast.UnknownPos(name), checked); err != nil {
+				return nil, nil
+			}
+			results[i] = res
+		}
+
+		// release our semaphore so dependencies can be processed w/out risk of deadlock
+		t.e.s.Release(1)
+		t.released = true
+		for _, res := range results {
+			select {
+			case <-res.ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		// reacquire semaphore so we can proceed
+		if err := t.e.s.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		t.released = false
+
+		for _, res := range results {
+			if res.err != nil || res.cacheKey == nil {
+				return nil, nil
+			}
+			deps = append(deps, res.res)
+			depKeys = append(depKeys, res.cacheKey)
+		}
+		t.r.setBlockedOn(nil)
+	}
+
+	fileKey := cacheFileKey(entry.key, depKeys)
+	if !bytes.Equal(fileKey, entry.fileKey) {
+		return nil, nil
+	}
+	file, err := newFileFromCache(entry.proto, deps)
+	if err != nil {
+		// should not be possible since the entry was valid when it
+		// was stored, so just re-compile
+		return nil, nil
+	}
+	if err := t.e.sym.Import(file, t.h); err != nil {
+		return nil, err
+	}
+	for _, w := range entry.warnings {
+		if w.unusedImport != "" && !t.r.explicitFile {
+			// unused imports are only reported for explicitly compiled files
+			continue
+		}
+		t.h.HandleWarning(w.pos, w.err())
+	}
+	t.r.cacheKey = fileKey
+	return file, nil
+}
+
+// storeInCache stores the given compiled file, and the warnings reported when
+// compiling it, in the cache under the given key. The file is only stored if
+// all of its dependencies were successfully compiled, so that it can later be
+// validated against their keys.
+func (t *task) storeInCache(key string, file linker.File, warnings []cachedWarning) {
+	res, ok := file.(linker.Result)
+	if !ok {
+		return
+	}
+	fd := res.Proto()
+	depKeys := make([][]byte, len(fd.Dependency))
+	for i, dep := range fd.Dependency {
+		t.e.mu.Lock()
+		depRes := t.e.results[dep]
+		t.e.mu.Unlock()
+		if depRes == nil || depRes.err != nil || depRes.cacheKey == nil {
+			return
+		}
+		depKeys[i] = depRes.cacheKey
+	}
+	entry := cacheEntry{
+		key:     key,
+		fileKey: cacheFileKey(key, depKeys),
+		deps:    fd.Dependency,
+		proto:   fd,
+
+		warnings:       warnings,
+		checkedImports: t.r.explicitFile,
+	}
+	data, err := entry.encode()
+	if err != nil {
+		return
+	}
+	_ = t.e.c.Cache.Store(key, data)
+	t.r.cacheKey = entry.fileKey
+}
+
+// newFileFromCache creates a file from the given descriptor proto, which was
+// loaded from the cache. Custom options in the proto are resolved using the
+// file's dependencies.
+func newFileFromCache(fd *descriptorpb.FileDescriptorProto, deps linker.Files) (linker.File, error) {
+	res := cacheClosure(deps).AsResolver()
+	resolved, err := linker.ResolveUnknownExtensions(fd, res)
+	if err != nil {
+		return nil, err
+	}
+	f, err := protodesc.NewFile(resolved.(*descriptorpb.FileDescriptorProto), res)
+	if err != nil {
+		return nil, err
+	}
+	return linker.NewFile(f, deps)
+}
+
+// cacheClosure returns the given files and all of their transitive
+// dependencies. This is needed to resolve references to elements that are
+// made available via public imports.
+func cacheClosure(files linker.Files) linker.Files {
+	var closure linker.Files
+	seen := map[string]struct{}{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if _, ok := seen[fd.Path()]; ok {
+			return
+		}
+		seen[fd.Path()] = struct{}{}
+		if f, ok := fd.(linker.File); ok {
+			closure = append(closure, f)
+		} else if f, err := linker.NewFileRecursive(fd); err == nil {
+			closure = append(closure, f)
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+	}
+	for _, f := range files {
+		add(f)
+	}
+	return closure
+}
@@ -0,0 +1,337 @@
+package protocompile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/options"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+func TestCompileWithCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompile-cache")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	cache, err := NewDiskCache(dir, 0)
+	require.NoError(t, err)
+
+	sources := map[string]string{
+		"a.proto": `
+syntax = "proto3";
+import "b.proto";
+message A { B b = 1; google.protobuf.Timestamp ts = 2 [(opt) = "foo"]; }
+`,
+		"b.proto": `
+syntax = "proto3";
+import public "google/protobuf/timestamp.proto";
+import "google/protobuf/descriptor.proto";
+message B { message C { message D {} } }
+extend google.protobuf.FieldOptions { string opt = 10101; }
+`,
+	}
+	compile := func(includeSourceInfo bool) (linker.Files, error) {
+		compiler := Compiler{
+			Resolver:          WithStandardImports(&SourceResolver{Accessor: SourceAccessorFromMap(sources)}),
+			IncludeSourceInfo: includeSourceInfo,
+			Cache:             cache,
+		}
+		return compiler.Compile(context.Background(), "a.proto")
+	}
+	isCached := func(f linker.File) bool {
+		_, isResult := f.(linker.Result)
+		return !isResult
+	}
+
+	fds, err := compile(true)
+	require.NoError(t, err)
+	assert.False(t, isCached(fds[0]))
+	expected, err := linker.CanonicalBytes(fds[0])
+	require.NoError(t, err)
+	entries, err := cache.entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// now it's cached
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.True(t, isCached(fds[0]))
+	assert.True(t, isCached(fds[0].FindImportByPath("b.proto")))
+	actual, err := linker.CanonicalBytes(fds[0])
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.NotNil(t, fds[0].SourceLocations().ByPath([]int32{4, 0}).Path)
+	opts := fds[0].Messages().Get(0).Fields().Get(1).Options()
+	var optVal interface{}
+	opts.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.FullName() == "opt" {
+			optVal = v.Interface()
+		}
+		return true
+	})
+	assert.Equal(t, "foo", optVal)
+
+	// different settings are cached separately
+	fds, err = compile(false)
+	require.NoError(t, err)
+	assert.False(t, isCached(fds[0]))
+	assert.Zero(t, fds[0].SourceLocations().Len())
+
+	// changing a dependency invalidates the files that import it
+	sources["b.proto"] += "message E {}\n"
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.False(t, isCached(fds[0]))
+	assert.False(t, isCached(fds[0].FindImportByPath("b.proto")))
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.True(t, isCached(fds[0]))
+
+	// corrupt entries are ignored and replaced
+	entries, err = cache.entries()
+	require.NoError(t, err)
+	for _, entry := range entries {
+		data, err := ioutil.ReadFile(entry.path)
+		require.NoError(t, err)
+		data[len(data)-1] ^= 0xff
+		require.NoError(t, ioutil.WriteFile(entry.path, data, 0644))
+	}
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.False(t, isCached(fds[0]))
+	assert.False(t, isCached(fds[0].FindImportByPath("b.proto")))
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.True(t, isCached(fds[0]))
+
+	// errors are not cached
+	sources["a.proto"] += "message A {}\n"
+	_, err = compile(true)
+	require.EqualError(t, err, `a.proto:5:9: symbol "A" already defined at a.proto:4:9`)
+	_, err = compile(true)
+	require.EqualError(t, err, `a.proto:5:9: symbol "A" already defined at a.proto:4:9`)
+
+	// a cached file whose dependency now imports it is reported as a cycle
+	sources["a.proto"] = strings.TrimSuffix(sources["a.proto"], "message A {}\n")
+	fds, err = compile(true)
+	require.NoError(t, err)
+	assert.True(t, isCached(fds[0]))
+	sources["b.proto"] = strings.Replace(sources["b.proto"], `import "google/protobuf/descriptor.proto";`, `import "google/protobuf/descriptor.proto"; import "a.proto";`, 1)
+	_, err = compile(true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle found in imports")
+}
+
+func TestCompileWithCacheAndValidators(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompile-cache")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	cache, err := NewDiskCache(dir, 0)
+	require.NoError(t, err)
+
+	sources := map[string]string{
+		"a.proto": `
+syntax = "proto3";
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MessageOptions { string opt = 10101; }
+message A { option (opt) = "foo"; }
+`,
+	}
+	compile := func(validators *options.Validators) (linker.Files, error) {
+		compiler := Compiler{
+			Resolver:         WithStandardImports(&SourceResolver{Accessor: SourceAccessorFromMap(sources)}),
+			Cache:            cache,
+			OptionValidators: validators,
+		}
+		return compiler.Compile(context.Background(), "a.proto")
+	}
+
+	_, err = compile(nil)
+	require.NoError(t, err)
+	entries, err := cache.entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// the cached file must not be used, since the validators would not run
+	var validators options.Validators
+	validators.Register("opt", func(v options.OptionValue) error {
+		return fmt.Errorf("invalid value %q", v.Value.String())
+	})
+	_, err = compile(&validators)
+	require.EqualError(t, err, `a.proto:5:20: message A: option (opt): invalid value "foo"`)
+	entries, err = cache.entries()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestCompileWithCacheReportsWarnings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompile-cache")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	cache, err := NewDiskCache(dir, 0)
+	require.NoError(t, err)
+
+	sources := map[string]string{
+		"a.proto": `
+import "b.proto";
+message A {}
+`,
+		"b.proto": `
+syntax = "proto3";
+import "google/protobuf/empty.proto";
+message B {}
+`,
+	}
+	compile := func(files ...string) ([]string, linker.Files) {
+		var warnings []string
+		compiler := Compiler{
+			Resolver: WithStandardImports(&SourceResolver{Accessor: SourceAccessorFromMap(sources)}),
+			Cache:    cache,
+			Reporter: reporter.NewReporter(nil, func(err reporter.ErrorWithPos) {
+				var kind string
+				var unused linker.ErrorUnusedImport
+				switch {
+				case errors.Is(err, parser.ErrNoSyntax):
+					kind = "no syntax"
+				case errors.As(err, &unused):
+					kind = "unused import " + unused.UnusedImport()
+				}
+				warnings = append(warnings, fmt.Sprintf("%v (%s)", err, kind))
+			}),
+		}
+		fds, err := compiler.Compile(context.Background(), files...)
+		require.NoError(t, err)
+		sort.Strings(warnings)
+		return warnings, fds
+	}
+	isCached := func(f linker.File) bool {
+		_, isResult := f.(linker.Result)
+		return !isResult
+	}
+
+	// b.proto is only imported, so its unused import is not reported
+	expected := []string{
+		`a.proto:2:1: import "b.proto" not used (unused import b.proto)`,
+		"a.proto:2:1: no syntax specified; defaulting to proto2 syntax (no syntax)",
+	}
+	warnings, fds := compile("a.proto")
+	assert.False(t, isCached(fds[0]))
+	assert.Equal(t, expected, warnings)
+	warnings, fds = compile("a.proto")
+	assert.True(t, isCached(fds[0]))
+	assert.True(t, isCached(fds[0].FindImportByPath("b.proto")))
+	assert.Equal(t, expected, warnings)
+
+	// when b.proto is compiled explicitly, its unused import is reported,
+	// even though it was cached when it was only imported
+	expected = []string{
+		`b.proto:3:1: import "google/protobuf/empty.proto" not used (unused import google/protobuf/empty.proto)`,
+	}
+	warnings, fds = compile("b.proto")
+	assert.False(t, isCached(fds[0]))
+	assert.Equal(t, expected, warnings)
+	warnings, fds = compile("b.proto")
+	assert.True(t, isCached(fds[0]))
+	assert.Equal(t, expected, warnings)
+
+	// but not when it is loaded from the cache as an import
+	expected = []string{
+		`a.proto:2:1: import "b.proto" not used (unused import b.proto)`,
+		"a.proto:2:1: no syntax specified; defaulting to proto2 syntax (no syntax)",
+	}
+	warnings, fds = compile("a.proto")
+	assert.True(t, isCached(fds[0]))
+	assert.Equal(t, expected, warnings)
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "protocompile-cache")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	cache, err := NewDiskCache(dir, 25)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Store("0001", []byte("0123456789")))
+	require.NoError(t, cache.Store("0002", []byte("0123456789")))
+	// make sure modification times are distinct and in order
+	for i, key := range []string{"0001", "0002"} {
+		modTime := time.Now().Add(-time.Hour).Add(time.Duration(i) * time.Second)
+		require.NoError(t, os.Chtimes(cache.path(key), modTime, modTime))
+	}
+	data, ok := cache.Load("0001")
+	assert.True(t, ok)
+	assert.Equal(t, "0123456789", string(data))
+
+	// 0002 is least recently used, so it's evicted
+	require.NoError(t, cache.Store("0003", []byte("0123456789")))
+	_, ok = cache.Load("0002")
+	assert.False(t, ok)
+	_, ok = cache.Load("0001")
+	assert.True(t, ok)
+	_, ok = cache.Load("0003")
+	assert.True(t, ok)
+	_, err = os.Stat(filepath.Join(dir, "00", "0003"))
+	assert.NoError(t, err)
+
+	// size is computed from existing contents
+	cache, err = NewDiskCache(dir, 25)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), cache.size)
+}
+
+func TestCacheEntryCorruption(t *testing.T) {
+	entry := cacheEntry{
+		key:     "abcd",
+		fileKey: []byte{1, 2, 3},
+		deps:    []string{"foo.proto", "bar.proto"},
+		proto:   &descriptorpb.FileDescriptorProto{Name: proto.String("test.proto")},
+		warnings: []cachedWarning{
+			{pos: ast.SourcePos{Filename: "test.proto", Line: 1, Col: 1}, message: "no syntax", noSyntax: true},
+			{pos: ast.SourcePos{Filename: "test.proto", Line: 3, Col: 1, Offset: 20}, message: "not used", unusedImport: "foo.proto"},
+		},
+		checkedImports: true,
+	}
+	data, err := entry.encode()
+	require.NoError(t, err)
+	decoded, err := decodeCacheEntry("abcd", data)
+	require.NoError(t, err)
+	assert.Equal(t, entry.fileKey, decoded.fileKey)
+	assert.Equal(t, entry.deps, decoded.deps)
+	assert.True(t, proto.Equal(entry.proto, decoded.proto))
+	assert.Equal(t, entry.warnings, decoded.warnings)
+	assert.True(t, decoded.checkedImports)
+
+	_, err = decodeCacheEntry("abce", data)
+	assert.Equal(t, errCorruptCacheEntry, err)
+	_, err = decodeCacheEntry("abcd", data[:len(data)-1])
+	assert.Equal(t, errCorruptCacheEntry, err)
+	_, err = decodeCacheEntry("abcd", data[1:])
+	assert.Equal(t, errCorruptCacheEntry, err)
+	data[len(data)-1]++
+	_, err = decodeCacheEntry("abcd", data)
+	assert.Equal(t, errCorruptCacheEntry, err)
+}
@@ -0,0 +1,126 @@
+// Command protodoc generates reference documentation for protobuf sources.
+// It compiles the given files and writes one page per package, in Markdown
+// or HTML, to an output directory.
+//
+// Usage:
+//
+//	protodoc [-I path]... [-format markdown|html] [-template file] [-out dir] file.proto...
+//
+// File names are relative to the import paths, which default to the current
+// directory. Standard imports, like "google/protobuf/descriptor.proto", are
+// always available.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/docs"
+	"github.com/jhump/protocompile/reporter"
+)
+
+type importPaths []string
+
+func (p *importPaths) String() string {
+	return strings.Join(*p, string(os.PathListSeparator))
+}
+
+func (p *importPaths) Set(s string) error {
+	*p = append(*p, filepath.SplitList(s)...)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "protodoc: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("protodoc", flag.ContinueOnError)
+	var paths importPaths
+	flags.Var(&paths, "I", "an import path for resolving files; may be repeated")
+	formatName := flags.String("format", "markdown", `the format of the documentation: "markdown" or "html"`)
+	templateFile := flags.String("template", "", "a file with a custom template used to render each package")
+	outDir := flags.String("out", ".", "the directory where documentation is written")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no files to document")
+	}
+
+	var format docs.Format
+	switch *formatName {
+	case "markdown", "md":
+		format = docs.FormatMarkdown
+	case "html":
+		format = docs.FormatHTML
+	default:
+		return fmt.Errorf("unknown format %q", *formatName)
+	}
+	gen := docs.Generator{Format: format}
+	if *templateFile != "" {
+		tmpl, err := loadTemplate(*templateFile, format)
+		if err != nil {
+			return err
+		}
+		gen.Template = tmpl
+	}
+
+	compiler := protocompile.Compiler{
+		Resolver:          protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: paths}),
+		IncludeSourceInfo: true,
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			fmt.Fprintln(os.Stderr, err)
+			return nil
+		}, func(err reporter.ErrorWithPos) {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}),
+	}
+	files, err := compiler.Compile(context.Background(), flags.Args()...)
+	if err != nil {
+		return err
+	}
+	pages, err := gen.Generate(files)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(pages))
+	for name := range pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(*outDir, name), pages[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadTemplate(fileName string, format docs.Format) (docs.Template, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(fileName)
+	if format == docs.FormatHTML {
+		return htmltemplate.New(name).Funcs(docs.Funcs(format)).Parse(string(data))
+	}
+	return texttemplate.New(name).Funcs(docs.Funcs(format)).Parse(string(data))
+}
@@ -59,6 +59,100 @@ type Compiler struct {
 	// concludes. Similarly, if they already have source code info but this flag
 	// is false, existing info will be left in place.
 	IncludeSourceInfo bool
+
+	// If true, and IncludeSourceInfo is also true, source code information
+	// includes locations for the fields and array elements inside the values
+	// of options, in addition to the option declarations themselves. Protoc
+	// does not produce these locations, so this is off by default. The
+	// locations do not include the entries of map fields, since the order of
+	// entries in the encoded options is not defined.
+	IncludeOptionValueSourceInfo bool
+
+	// If true, the compiler tries to produce descriptors even for files that
+	// have errors. This is useful for tools like editors and documentation
+	// generators, which want as much information as possible about files that
+	// may be incomplete or in the middle of being edited.
+	//
+	// In lenient mode, errors never abort compilation, even if the Reporter
+	// returns an error. Instead, all errors are reported and compilation
+	// proceeds as far as possible:
+	//  * Imports that cannot be loaded, that have syntax errors that prevent
+	//    producing a descriptor, or that are provided by the Resolver as
+	//    descriptor protos that are not valid, are replaced with placeholder
+	//    files. (The files' IsPlaceholder methods return true.)
+	//  * References to elements that cannot be resolved are represented by
+	//    placeholder message and enum descriptors. (These descriptors'
+	//    IsPlaceholder methods also return true.)
+	//  * Options are interpreted as far as possible. Custom options defined in
+	//    the file itself or in imports that could be loaded are interpreted,
+	//    even if other imports could not be. Options that cannot be
+	//    interpreted are reported and left in the "uninterpreted_option"
+	//    field of the element's options.
+	//
+	// Compile will return a (possibly partial) descriptor for every file that
+	// could be parsed along with a non-nil error if any errors were reported.
+	// The error will be the first error returned by the Reporter or, if the
+	// Reporter never returned an error, reporter.ErrInvalidSource.
+	Lenient bool
+
+	// Limits on the resources used to parse each source file. These are
+	// useful when compiling untrusted sources. A file that exceeds a limit
+	// fails to compile, even in lenient mode. The zero value imposes no
+	// limits.
+	//
+	// To limit the total time spent compiling, use a context with a deadline
+	// or timeout. Cancellation of the context is checked periodically while
+	// parsing, linking, and interpreting options, so a large file will not
+	// delay cancellation for long.
+	Limits parser.Limits
+
+	// An optional cache of compiled files. If set, files whose source code is
+	// provided by the Resolver (via SearchResult.Source) are stored in the
+	// cache after they are successfully compiled. Later compilations of the
+	// same source, with the same settings and the same dependencies, load the
+	// descriptor from the cache, skipping parsing, linking, and option
+	// interpretation.
+	//
+	// Files are cached by a hash of their contents, the relevant settings of
+	// this compiler (such as IncludeSourceInfo), and the hashes of their
+	// dependencies. So a file is re-compiled if it or any file in its
+	// transitive closure changes. Cache entries include a checksum; entries
+	// that are corrupt are ignored, and the file is re-compiled.
+	//
+	// Like files returned by the Resolver as descriptors, files loaded from
+	// the cache do not implement linker.Result, since there is no AST for
+	// them. Warnings that were reported when a file was compiled are reported
+	// again when it is loaded from the cache.
+	//
+	// The cache is not used if OptionValidators is set.
+	//
+	// See DiskCache for an implementation that stores files on disk.
+	Cache CompileCache
+
+	// Optional validators for the values of custom options. They are invoked
+	// after the options for an element are interpreted, and the errors they
+	// return are reported like other compilation errors. This can be used to
+	// enforce constraints that cannot be expressed in an option's type, such
+	// as requiring a string option to be a valid regular expression.
+	//
+	// Validators are not run for files that are provided by the Resolver as
+	// descriptors. Since validators cannot be run for files loaded from a
+	// cache, the Cache is not used when validators are set.
+	OptionValidators *options.Validators
+
+	// An optional symbol table, used to check that the names of elements and
+	// the numbers of extensions in compiled files do not collide with those in
+	// other files. If nil, a new table is used for each call to Compile, so
+	// files are only checked against the other files in that call and their
+	// dependencies.
+	//
+	// A table can be shared by many calls to Compile in order to check files
+	// against those compiled in earlier calls. It can also be initialized from
+	// a snapshot that was saved after an earlier compilation, which could even
+	// be in another process (see linker.NewSymbolsFromSnapshot). When a file
+	// is compiled whose path is already in the table, it replaces the table's
+	// entries for that path instead of colliding with them.
+	Symbols *linker.Symbols
 }
 
 // Compile compiles the given file names into fully-linked descriptors. The
@@ -73,6 +167,114 @@ func (c *Compiler) Compile(ctx context.Context, files ...string) (linker.Files,
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	e := c.newExecutor(cancel, false)
+	results := e.start(ctx, files)
+
+	descs := make([]linker.File, len(files))
+	var firstError error
+	for i, r := range results {
+		select {
+		case <-r.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if r.err != nil {
+			if firstError == nil {
+				firstError = r.err
+			}
+		}
+		descs[i] = r.res
+	}
+
+	if e.lenient != nil {
+		if err := e.lenient.firstError(); err != nil {
+			return descs, err
+		}
+	}
+	if err := e.h.Error(); err != nil {
+		return descs, err
+	}
+	// this should probably never happen; if any task returned an
+	// error, h.Error() should be non-nil
+	return descs, firstError
+}
+
+// FileResult is the outcome of compiling a single file with CompileEach.
+// Exactly one of its fields will be non-nil, unless the compiler is lenient.
+// In lenient mode, a file with errors may still have a (partial) descriptor.
+type FileResult struct {
+	// The compiled file, if compilation was successful.
+	File linker.File
+	// The error that caused compilation of the file to fail.
+	Err error
+}
+
+// CompileEach is like Compile except that each file is compiled in isolation
+// and the outcome for each file is returned separately. The returned slice
+// has one element for each of the given file names, in the same order.
+//
+// A failure to compile one file does not prevent other files from being
+// compiled: files that do not depend (directly or transitively) on a file with
+// errors will still be compiled successfully. Each file gets its own error
+// handler, so an error returned from the compiler's Reporter only aborts the
+// file whose error was being reported. If no Reporter is configured, the
+// compilation of each file fails at its first error, but other files are
+// unaffected.
+//
+// Errors in a file are reported (via the compiler's Reporter) only once. A
+// file that imports a file with errors fails with a *DependencyError instead
+// of repeating the errors of its dependency. (In lenient mode, such a file is
+// instead compiled using the partial result for its dependency.)
+//
+// If the given context is cancelled, the results for any files that have not
+// yet completed will contain the context's error.
+func (c *Compiler) CompileEach(ctx context.Context, files ...string) []FileResult {
+	if len(files) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e := c.newExecutor(cancel, true)
+	results := e.start(ctx, files)
+
+	fileResults := make([]FileResult, len(files))
+	for i, r := range results {
+		select {
+		case <-r.ready:
+			fileResults[i] = FileResult{File: r.res, Err: r.err}
+		case <-ctx.Done():
+			fileResults[i].Err = ctx.Err()
+		}
+	}
+	return fileResults
+}
+
+// DependencyError is the error returned by CompileEach for a file that could
+// not be compiled because one of its imports had errors. The errors in the
+// imported file are reported (and returned) for that file; they are not
+// repeated for every file that depends on it.
+type DependencyError struct {
+	// The file that could not be compiled.
+	File string
+	// The imported file that had errors.
+	Dependency string
+	// The error that caused compilation of the dependency to fail.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("%q depends on file with errors: %q", e.File, e.Dependency)
+}
+
+// Unwrap returns the error that caused compilation of the dependency to fail.
+func (e *DependencyError) Unwrap() error {
+	return e.Err
+}
+
+func (c *Compiler) newExecutor(cancel context.CancelFunc, isolated bool) *executor {
 	par := c.MaxParallelism
 	if par <= 0 {
 		par = runtime.GOMAXPROCS(-1)
@@ -82,17 +284,45 @@ func (c *Compiler) Compile(ctx context.Context, files ...string) (linker.Files,
 		}
 	}
 
-	h := reporter.NewHandler(c.Reporter)
+	rep := c.Reporter
+	var lenient *lenientReporter
+	if c.Lenient {
+		if rep == nil {
+			rep = reporter.NewReporter(nil, nil)
+		}
+		// this also serializes calls to the underlying reporter
+		lenient = &lenientReporter{rep: rep}
+		rep = lenient
+	} else if isolated {
+		if rep == nil {
+			rep = reporter.NewReporter(nil, nil)
+		}
+		// many handlers will share the same reporter, so we must
+		// serialize calls to it
+		rep = &syncReporter{rep: rep}
+	}
+
+	sym := c.Symbols
+	if sym == nil {
+		sym = &linker.Symbols{}
+	}
 
-	e := executor{
-		c:       c,
-		h:       h,
-		s:       semaphore.NewWeighted(int64(par)),
-		cancel:  cancel,
-		sym:     &linker.Symbols{},
-		results: map[string]*result{},
+	return &executor{
+		c:        c,
+		h:        reporter.NewHandler(rep),
+		rep:      rep,
+		isolated: isolated,
+		lenient:  lenient,
+		s:        semaphore.NewWeighted(int64(par)),
+		cancel:   cancel,
+		sym:      sym,
+		results:  map[string]*result{},
 	}
+}
 
+// start creates tasks to compile the given files and returns the results
+// for them, in the same order as the given files.
+func (e *executor) start(ctx context.Context, files []string) []*result {
 	// We lock now and create all tasks under lock to make sure that no
 	// async task can create a duplicate result. For example, if files
 	// contains both "foo.proto" and "bar.proto", then there is a race
@@ -102,36 +332,62 @@ func (c *Compiler) Compile(ctx context.Context, files ...string) (linker.Files,
 	// so we need this loop to define the result. So this loop holds the
 	// lock the whole time so async tasks can't create a result first.
 	results := make([]*result, len(files))
-	func() {
-		e.mu.Lock()
-		defer e.mu.Unlock()
-		for i, f := range files {
-			results[i] = e.compileLocked(ctx, f, true)
-		}
-	}()
-
-	descs := make([]linker.File, len(files))
-	var firstError error
-	for i, r := range results {
-		select {
-		case <-r.ready:
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		}
-		if r.err != nil {
-			if firstError == nil {
-				firstError = r.err
-			}
-		}
-		descs[i] = r.res
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, f := range files {
+		results[i] = e.compileLocked(ctx, f, true)
 	}
+	return results
+}
 
-	if err := h.Error(); err != nil {
-		return descs, err
+// syncReporter is a reporter that serializes calls to an underlying reporter,
+// so that it can be safely shared by many handlers.
+type syncReporter struct {
+	mu  sync.Mutex
+	rep reporter.Reporter
+}
+
+func (r *syncReporter) Error(err reporter.ErrorWithPos) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rep.Error(err)
+}
+
+func (r *syncReporter) Warning(err reporter.ErrorWithPos) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rep.Warning(err)
+}
+
+// lenientReporter is a reporter that never aborts: it reports errors to an
+// underlying reporter but always returns nil. It remembers the first error
+// returned by the underlying reporter so it can be returned once compilation
+// is complete.
+type lenientReporter struct {
+	mu  sync.Mutex
+	rep reporter.Reporter
+	err error
+}
+
+func (r *lenientReporter) Error(err reporter.ErrorWithPos) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if repErr := r.rep.Error(err); repErr != nil && r.err == nil {
+		r.err = repErr
 	}
-	// this should probably never happen; if any task returned an
-	// error, h.Error() should be non-nil
-	return descs, firstError
+	return nil
+}
+
+func (r *lenientReporter) Warning(err reporter.ErrorWithPos) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rep.Warning(err)
+}
+
+func (r *lenientReporter) firstError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
 }
 
 type result struct {
@@ -142,10 +398,16 @@ type result struct {
 	// this file is an import that is implicitly included
 	explicitFile bool
 
-	// produces a linker.File or error, only available when ready is closed
+	// produces a linker.File or error, only available when ready is closed;
+	// in lenient mode, a result can have both a (partial) file and an error
 	res linker.File
 	err error
 
+	// if the compiler has a cache, the key that identifies the contents of
+	// this file and its dependencies; only set if the file was compiled
+	// successfully
+	cacheKey []byte
+
 	mu sync.Mutex
 	// the results that are dependencies of this result; this result is
 	// blocked, waiting on these dependencies to complete
@@ -181,6 +443,14 @@ type executor struct {
 	cancel context.CancelFunc
 	sym    *linker.Symbols
 
+	// if true, each task uses its own handler (that reports to rep), so that
+	// errors in one file do not cause other files to fail
+	isolated bool
+	rep      reporter.Reporter
+
+	// non-nil if the compiler is lenient; it is also the reporter for h
+	lenient *lenientReporter
+
 	mu      sync.Mutex
 	results map[string]*result
 }
@@ -267,8 +537,15 @@ func (e errFailedToResolve) Unwrap() error {
 	return e.err
 }
 
+func (e *executor) newHandler() *reporter.Handler {
+	if e.isolated {
+		return reporter.NewHandler(e.rep)
+	}
+	return e.h.SubHandler()
+}
+
 func (e *executor) doCompile(ctx context.Context, file string, r *result) {
-	t := task{e: e, h: e.h.SubHandler(), r: r}
+	t := task{e: e, h: e.newHandler(), r: r}
 	if err := e.s.Acquire(ctx, 1); err != nil {
 		r.fail(err)
 		return
@@ -293,9 +570,20 @@ func (e *executor) doCompile(ctx context.Context, file string, r *result) {
 
 	desc, err := t.asFile(ctx, file, sr)
 	if err != nil {
+		if e.lenient != nil {
+			// in lenient mode, desc may be a partial result
+			r.res = desc
+		}
 		r.fail(err)
 		return
 	}
+	if e.c.useCache() && r.cacheKey == nil {
+		// the file wasn't compiled from source, so it was not cached; but
+		// its key is still needed to cache the files that import it
+		if digest, err := linker.TransitiveDigest(desc); err == nil {
+			r.cacheKey = digest[:]
+		}
+	}
 	r.complete(desc)
 }
 
@@ -315,6 +603,17 @@ type task struct {
 	r *result
 }
 
+// stepHandler returns the handler to use for the next step of compiling a
+// file. This is normally just t.h. But in lenient mode, errors reported in one
+// step do not stop the next step, so each step gets its own child handler.
+// Otherwise, the errors from prior steps could cause the next step to fail.
+func (t *task) stepHandler() *reporter.Handler {
+	if t.e.lenient != nil {
+		return t.h.SubHandler()
+	}
+	return t.h
+}
+
 func (t *task) release() {
 	if !t.released {
 		t.e.s.Release(1)
@@ -329,9 +628,15 @@ func (t *task) asFile(ctx context.Context, name string, r SearchResult) (linker.
 		}
 		return linker.NewFileRecursive(r.Desc)
 	}
+	if t.e.c.useCache() && r.Proto == nil && r.AST == nil && r.Source != nil {
+		return t.asCachedFile(ctx, name, r.Source)
+	}
+	return t.compileFile(ctx, name, r)
+}
 
-	parseRes, err := t.asParseResult(name, r)
-	if err != nil {
+func (t *task) compileFile(ctx context.Context, name string, r SearchResult) (linker.File, error) {
+	parseRes, err := t.asParseResult(ctx, name, r)
+	if err != nil && (parseRes == nil || t.e.lenient == nil) {
 		return nil, err
 	}
 
@@ -346,12 +651,20 @@ func (t *task) asFile(ctx context.Context, name string, r SearchResult) (linker.
 			if name == dep {
 				// doh! file imports itself
 				handleImportCycle(t.h, pos, []string{name}, dep)
+				if t.e.lenient != nil {
+					// leave results[i] nil to use a placeholder
+					continue
+				}
 				return nil, t.h.Error()
 			}
 
 			res := t.e.compile(ctx, dep)
 			// check for dependency cycle to prevent deadlock
-			if err := t.e.checkForDependencyCycle(res, []string{name, dep}, pos, checked); err != nil {
+			if err := t.e.checkForDependencyCycle(t.stepHandler(), res, []string{name, dep}, pos, checked); err != nil {
+				if t.e.lenient != nil {
+					// leave results[i] nil to use a placeholder
+					continue
+				}
 				return nil, err
 			}
 			results[i] = res
@@ -364,8 +677,16 @@ func (t *task) asFile(ctx context.Context, name string, r SearchResult) (linker.
 
 		// now we wait for them all to be computed
 		for i, res := range results {
+			if res == nil {
+				deps[i] = linker.NewPlaceholderFile(parseRes.Proto().Dependency[i])
+				continue
+			}
 			select {
 			case <-res.ready:
+				if res.err != nil && t.e.lenient != nil {
+					deps[i] = t.lenientDependency(parseRes, res)
+					continue
+				}
 				if res.err != nil {
 					if rerr, ok := res.err.(errFailedToResolve); ok {
 						// We don't report errors to get file from resolver to handler since
@@ -374,6 +695,9 @@ func (t *task) asFile(ctx context.Context, name string, r SearchResult) (linker.
 						// source position that pinpoints the import statement and report it.
 						return nil, reporter.Error(findImportPos(parseRes, res.name), rerr)
 					}
+					if t.e.isolated {
+						return nil, &DependencyError{File: name, Dependency: res.name, Err: res.err}
+					}
 					return nil, res.err
 				}
 				deps[i] = res.res
@@ -391,10 +715,25 @@ func (t *task) asFile(ctx context.Context, name string, r SearchResult) (linker.
 		t.released = false
 	}
 
-	return t.link(parseRes, deps)
+	return t.link(ctx, parseRes, deps)
+}
+
+// lenientDependency returns the file to use, in lenient mode, for the given
+// dependency that failed to compile. This is its partial result, if it has one,
+// or a placeholder.
+func (t *task) lenientDependency(parseRes parser.Result, res *result) linker.File {
+	if rerr, ok := res.err.(errFailedToResolve); ok {
+		// report the error at the position of the import statement (the
+		// handler won't abort since we're lenient)
+		_ = t.h.HandleError(reporter.Error(findImportPos(parseRes, res.name), rerr))
+	}
+	if res.res != nil {
+		return res.res
+	}
+	return linker.NewPlaceholderFile(res.name)
 }
 
-func (e *executor) checkForDependencyCycle(res *result, sequence []string, pos ast.SourcePos, checked map[string]struct{}) error {
+func (e *executor) checkForDependencyCycle(h *reporter.Handler, res *result, sequence []string, pos ast.SourcePos, checked map[string]struct{}) error {
 	if _, ok := checked[res.name]; ok {
 		// already checked this one
 		return nil
@@ -405,8 +744,8 @@ func (e *executor) checkForDependencyCycle(res *result, sequence []string, pos a
 		// is this a cycle?
 		for _, file := range sequence {
 			if file == dep {
-				handleImportCycle(e.h, pos, sequence, dep)
-				return e.h.Error()
+				handleImportCycle(h, pos, sequence, dep)
+				return h.Error()
 			}
 		}
 
@@ -416,7 +755,7 @@ func (e *executor) checkForDependencyCycle(res *result, sequence []string, pos a
 		if depRes == nil {
 			continue
 		}
-		if err := e.checkForDependencyCycle(depRes, append(sequence, dep), pos, checked); err != nil {
+		if err := e.checkForDependencyCycle(h, depRes, append(sequence, dep), pos, checked); err != nil {
 			return err
 		}
 	}
@@ -449,17 +788,43 @@ func findImportPos(res parser.Result, dep string) ast.SourcePos {
 	return ast.UnknownPos(res.FileNode().Name())
 }
 
-func (t *task) link(parseRes parser.Result, deps linker.Files) (linker.File, error) {
-	file, err := linker.Link(parseRes, deps, t.e.sym, t.h)
-	if err != nil {
+func (t *task) link(ctx context.Context, parseRes parser.Result, deps linker.Files) (linker.File, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	optsIndex, err := options.InterpretOptions(file, t.h)
-	if err != nil {
+	lenient := t.e.lenient != nil
+	file, err := linker.LinkWithContext(ctx, parseRes, deps, t.e.sym, t.stepHandler())
+	if err != nil && (file == nil || !lenient) {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var optsIndex options.Index
+	var valuesIndex options.ValueIndex
+	interpOpts := []options.InterpreterOption{options.WithValidators(t.e.c.OptionValidators), options.WithContext(ctx)}
+	if t.e.c.IncludeSourceInfo && t.e.c.IncludeOptionValueSourceInfo {
+		valuesIndex = options.ValueIndex{}
+		interpOpts = append(interpOpts, options.WithValueIndex(valuesIndex))
+	}
+	if lenient {
+		// interpret the options we can, even if some extensions could not
+		// be resolved due to errors in imports
+		optsIndex, err = options.InterpretOptionsPartial(file, t.stepHandler(), interpOpts...)
+	} else {
+		optsIndex, err = options.InterpretOptions(file, t.stepHandler(), interpOpts...)
+	}
+	if err != nil && !lenient {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	// now that options are interpreted, we can do some additional checks
-	if err := file.ValidateExtensions(t.h); err != nil {
+	if err := file.ValidateExtensions(t.stepHandler()); err != nil && !lenient {
+		return nil, err
+	}
+	if err := options.ValidateStandardOptions(file, optsIndex, t.stepHandler()); err != nil && !lenient {
 		return nil, err
 	}
 	if t.r.explicitFile {
@@ -467,28 +832,47 @@ func (t *task) link(parseRes parser.Result, deps linker.Files) (linker.File, err
 	}
 
 	if t.e.c.IncludeSourceInfo && parseRes.AST() != nil {
-		parseRes.Proto().SourceCodeInfo = sourceinfo.GenerateSourceInfo(parseRes.AST(), optsIndex)
+		var genOpts []sourceinfo.GenerateOption
+		if valuesIndex != nil {
+			genOpts = append(genOpts, sourceinfo.WithOptionValueLocations(valuesIndex))
+		}
+		parseRes.Proto().SourceCodeInfo = sourceinfo.GenerateSourceInfo(parseRes.AST(), optsIndex, genOpts...)
+	}
+	if err := t.h.Error(); err != nil {
+		if !lenient {
+			return nil, err
+		}
+		// in lenient mode, errors may have been reported in prior steps,
+		// but the (partial) file is still returned
+		return file, err
 	}
 	return file, nil
 }
 
-func (t *task) asParseResult(name string, r SearchResult) (parser.Result, error) {
+func (t *task) asParseResult(ctx context.Context, name string, r SearchResult) (parser.Result, error) {
 	if r.Proto != nil {
 		if r.Proto.GetName() != name {
 			return nil, fmt.Errorf("search result for %q returned descriptor for %q", name, r.Proto.GetName())
 		}
+		// descriptor protos may come from anywhere, so they are validated the
+		// same way that protoc validates descriptors it is given; even in
+		// lenient mode, an invalid proto is not linked, since the resulting
+		// descriptors could be inconsistent
+		if err := parser.ValidateProto(r.Proto, t.stepHandler()); err != nil {
+			return nil, err
+		}
 		return parser.ResultWithoutAST(r.Proto), nil
 	}
 
-	file, err := t.asAST(name, r)
-	if err != nil {
+	file, err := t.asAST(ctx, name, r)
+	if err != nil && (file == nil || t.e.lenient == nil) {
 		return nil, err
 	}
 
-	return parser.ResultFromAST(file, true, t.h)
+	return parser.ResultFromAST(file, true, t.stepHandler())
 }
 
-func (t *task) asAST(name string, r SearchResult) (*ast.FileNode, error) {
+func (t *task) asAST(ctx context.Context, name string, r SearchResult) (*ast.FileNode, error) {
 	if r.AST != nil {
 		if r.AST.Name() != name {
 			return nil, fmt.Errorf("search result for %q returned descriptor for %q", name, r.AST.Name())
@@ -496,5 +880,5 @@ func (t *task) asAST(name string, r SearchResult) (*ast.FileNode, error) {
 		return r.AST, nil
 	}
 
-	return parser.Parse(name, r.Source, t.h)
+	return parser.ParseWithLimits(ctx, name, r.Source, t.h, t.e.c.Limits)
 }
@@ -1,17 +1,30 @@
 package protocompile
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 
+	"github.com/jhump/protocompile/ast"
 	_ "github.com/jhump/protocompile/internal/testprotos"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
 )
 
 func TestParseFilesMessageComments(t *testing.T) {
@@ -217,4 +230,517 @@ func TestPanicHandling(t *testing.T) {
 	_, err := c.Compile(context.Background(), "test.proto")
 	panicErr := err.(PanicError)
 	t.Logf("%v\n\n%v", panicErr, panicErr.Stack)
-}
\ No newline at end of file
+}
+
+func TestInvalidDescriptorProto(t *testing.T) {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String("test.proto"),
+		Syntax: proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Foo"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:   proto.String("bar"),
+						Number: proto.Int32(1),
+						Label:  descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum(),
+						Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+		},
+	}
+	c := Compiler{
+		Resolver: ResolverFunc(func(string) (SearchResult, error) {
+			return SearchResult{Proto: fd}, nil
+		}),
+	}
+	_, err := c.Compile(context.Background(), "test.proto")
+	require.Error(t, err)
+	assert.Equal(t, "test.proto: field Foo.bar: label 'required' is not allowed in proto3", err.Error())
+	var descErr *parser.DescriptorError
+	require.True(t, errors.As(err, &descErr))
+	assert.Equal(t, []int32{4, 0, 2, 0, 4}, descErr.Path)
+}
+
+func TestCompileEach(t *testing.T) {
+	accessor := SourceAccessorFromMap(map[string]string{
+		"a.proto": `
+syntax = "proto3";
+message A {
+  Unknown u = 1;
+}
+`,
+		"b.proto": `
+syntax = "proto3";
+import "a.proto";
+message B {
+  A a = 1;
+}
+`,
+		"c.proto": `
+syntax = "proto3";
+import "b.proto";
+message C {
+  B b = 1;
+}
+`,
+		"d.proto": `
+syntax = "proto3";
+message D {
+  string name = 1;
+}
+`,
+		"e.proto": `
+syntax = "proto3";
+message E {
+  Unknown u = 1;
+  AlsoUnknown au = 2;
+}
+`,
+	})
+
+	var reported []reporter.ErrorWithPos
+	compiler := Compiler{
+		Resolver: &SourceResolver{Accessor: accessor},
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reported = append(reported, err)
+			return err
+		}, nil),
+	}
+	results := compiler.CompileEach(context.Background(), "c.proto", "b.proto", "a.proto", "d.proto", "e.proto")
+	require.Equal(t, 5, len(results))
+
+	var depErr *DependencyError
+	require.True(t, errors.As(results[0].Err, &depErr), "expecting *DependencyError; instead got %v", results[0].Err)
+	assert.Equal(t, "c.proto", depErr.File)
+	assert.Equal(t, "b.proto", depErr.Dependency)
+	require.True(t, errors.As(results[1].Err, &depErr), "expecting *DependencyError; instead got %v", results[1].Err)
+	assert.Equal(t, "b.proto", depErr.File)
+	assert.Equal(t, "a.proto", depErr.Dependency)
+	assert.Equal(t, results[2].Err, errors.Unwrap(depErr))
+	assert.EqualError(t, results[2].Err, `a.proto:4:3: field A.u: unknown type Unknown`)
+	assert.Nil(t, results[3].Err)
+	assert.Equal(t, "d.proto", results[3].File.Path())
+	assert.EqualError(t, results[4].Err, `e.proto:4:3: field E.u: unknown type Unknown`)
+
+	// each failed file's error is reported just once
+	require.Equal(t, 2, len(reported))
+	sort.Slice(reported, func(i, j int) bool {
+		return reported[i].GetPosition().Filename < reported[j].GetPosition().Filename
+	})
+	assert.Equal(t, "a.proto", reported[0].GetPosition().Filename)
+	assert.Equal(t, "e.proto", reported[1].GetPosition().Filename)
+}
+
+func TestCompileNonAbortingReporter(t *testing.T) {
+	accessor := SourceAccessorFromMap(map[string]string{
+		"test.proto": `
+syntax = "proto3";
+option java_package = 1;
+message Foo {
+  string name = 1;
+}
+`,
+	})
+	var reported []string
+	compiler := Compiler{
+		Resolver: WithStandardImports(&SourceResolver{Accessor: accessor}),
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reported = append(reported, err.Error())
+			// don't abort
+			return nil
+		}, nil),
+	}
+
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.Error(t, err)
+	require.Equal(t, 1, len(fds))
+	assert.Nil(t, fds[0])
+	assert.Equal(t, []string{`test.proto:3:23: option java_package: expecting string, got integer`}, reported)
+
+	// exactly one of the fields of each result is set
+	results := compiler.CompileEach(context.Background(), "test.proto")
+	require.Equal(t, 1, len(results))
+	assert.Error(t, results[0].Err)
+	assert.Nil(t, results[0].File)
+}
+
+func TestCompileLenient(t *testing.T) {
+	accessor := SourceAccessorFromMap(map[string]string{
+		"a.proto": `
+syntax = "proto3";
+package foo;
+import "missing.proto";
+message A {
+  required string name = 1;
+  bar.Thing thing = 2;
+  Unknown u = 3;
+  string id = 4 [deprecated = true];
+}
+`,
+		"b.proto": `
+syntax = "proto3";
+package foo;
+import "a.proto";
+message B {
+  A a = 1;
+}
+service BService {
+  rpc Do(B) returns (Unknown);
+}
+`,
+	})
+
+	var reported []string
+	compiler := Compiler{
+		Resolver: &SourceResolver{Accessor: accessor},
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reported = append(reported, err.Error())
+			return err
+		}, nil),
+		Lenient: true,
+	}
+	files, err := compiler.Compile(context.Background(), "b.proto")
+	require.Error(t, err)
+	// the first error returned by the reporter
+	assert.Contains(t, err.Error(), `a.proto:6:3: field foo.A.name: label 'required' is not allowed in proto3`)
+	assert.ElementsMatch(t, []string{
+		`a.proto:4:8: could not resolve path "missing.proto": file does not exist`,
+		`a.proto:6:3: field foo.A.name: label 'required' is not allowed in proto3`,
+		`a.proto:7:3: field foo.A.thing: unknown type bar.Thing`,
+		`a.proto:8:3: field foo.A.u: unknown type Unknown`,
+		`b.proto:9:22: method foo.BService.Do: unknown response type Unknown`,
+	}, reported)
+
+	require.Equal(t, 1, len(files))
+	fileB := files[0]
+	require.NotNil(t, fileB)
+	fileA := fileB.Imports().Get(0).FileDescriptor
+	assert.Equal(t, "a.proto", fileA.Path())
+	assert.False(t, fileA.IsPlaceholder())
+	missing := fileA.Imports().Get(0).FileDescriptor
+	assert.Equal(t, "missing.proto", missing.Path())
+	assert.True(t, missing.IsPlaceholder())
+
+	msgA := fileA.Messages().ByName("A")
+	require.NotNil(t, msgA)
+	thing := msgA.Fields().ByName("thing").Message()
+	assert.True(t, thing.IsPlaceholder())
+	assert.Equal(t, "bar.Thing", string(thing.FullName()))
+	unknown := msgA.Fields().ByName("u").Message()
+	assert.True(t, unknown.IsPlaceholder())
+	assert.Equal(t, "Unknown", string(unknown.FullName()))
+	// options still interpreted
+	assert.True(t, msgA.Fields().ByName("id").Options().(*descriptorpb.FieldOptions).GetDeprecated())
+
+	msgB := fileB.Messages().ByName("B")
+	assert.Equal(t, msgA, msgB.Fields().ByName("a").Message())
+	mtd := fileB.Services().ByName("BService").Methods().ByName("Do")
+	assert.Equal(t, msgB, mtd.Input())
+	assert.True(t, mtd.Output().IsPlaceholder())
+}
+
+func TestCompileLenientInvalidDescriptorProto(t *testing.T) {
+	// the field refers to a oneof that does not exist
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:   proto.String("a.proto"),
+		Syntax: proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("A"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:       proto.String("name"),
+						Number:     proto.Int32(1),
+						Label:      descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:       descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						OneofIndex: proto.Int32(5),
+					},
+				},
+			},
+		},
+	}
+	accessor := SourceAccessorFromMap(map[string]string{
+		"b.proto": `
+syntax = "proto3";
+import "a.proto";
+message B {
+  string id = 1;
+}
+`,
+	})
+	var reported []string
+	compiler := Compiler{
+		Resolver: ResolverFunc(func(name string) (SearchResult, error) {
+			if name == "a.proto" {
+				return SearchResult{Proto: fd}, nil
+			}
+			return (&SourceResolver{Accessor: accessor}).FindFileByPath(name)
+		}),
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reported = append(reported, err.Error())
+			return nil
+		}, nil),
+		Lenient: true,
+	}
+	files, err := compiler.Compile(context.Background(), "a.proto", "b.proto")
+	require.Error(t, err)
+	assert.Equal(t, []string{"a.proto: message A: field name: oneof index 5 is out of range"}, reported)
+
+	// the invalid file is not linked, so it is a placeholder for b.proto
+	require.Len(t, files, 2)
+	assert.Nil(t, files[0])
+	fileB := files[1]
+	require.NotNil(t, fileB)
+	assert.True(t, fileB.Imports().Get(0).IsPlaceholder())
+}
+
+func TestCompileLenientCustomOptions(t *testing.T) {
+	accessor := SourceAccessorFromMap(map[string]string{
+		"a.proto": `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+import "good.proto";
+import "missing.proto";
+extend google.protobuf.MessageOptions {
+  string local = 50001;
+}
+message A {
+  option (local) = "abc";
+  option (good) = 123;
+  option (good2).name = "xyz";
+  option (bar.bad) = true;
+  option (local) = 456;
+  string id = 1 [(bar.fld) = 1, deprecated = true];
+}
+`,
+		"good.proto": `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+message Info {
+  string name = 1;
+}
+extend google.protobuf.MessageOptions {
+  int32 good = 50002;
+  Info good2 = 50003;
+}
+`,
+	})
+
+	var reported []string
+	compiler := Compiler{
+		Resolver: WithStandardImports(&SourceResolver{Accessor: accessor}),
+		Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			reported = append(reported, err.Error())
+			return err
+		}, nil),
+		Lenient: true,
+	}
+	files, err := compiler.Compile(context.Background(), "a.proto")
+	require.Error(t, err)
+	// each error is reported exactly once
+	assert.Equal(t, []string{
+		`a.proto:6:8: could not resolve path "missing.proto": file does not exist`,
+		`a.proto:14:10: message foo.A: unknown extension bar.bad`,
+		`a.proto:16:18: field foo.A.id: unknown extension bar.fld`,
+		`a.proto:15:20: message foo.A: option (foo.local): expecting string, got integer`,
+	}, reported)
+
+	require.Equal(t, 1, len(files))
+	res := files[0].(linker.Result)
+	msgA := res.Messages().ByName("A")
+	require.NotNil(t, msgA)
+
+	// options that refer to resolvable extensions are interpreted; the
+	// others remain uninterpreted
+	msgOpts := msgA.Options().(*descriptorpb.MessageOptions)
+	assert.Equal(t, []string{"(bar.bad)", "(.foo.local)"}, uninterpretedNames(msgOpts.UninterpretedOption))
+	assert.Equal(t, []string{"(foo.good)=123", "(foo.good2)={name:\"xyz\"}", "(foo.local)=abc"}, interpretedValues(t, res, msgOpts))
+
+	fldOpts := msgA.Fields().ByName("id").Options().(*descriptorpb.FieldOptions)
+	assert.Equal(t, []string{"(bar.fld)"}, uninterpretedNames(fldOpts.UninterpretedOption))
+	assert.True(t, fldOpts.GetDeprecated())
+}
+
+func uninterpretedNames(opts []*descriptorpb.UninterpretedOption) []string {
+	var names []string
+	for _, opt := range opts {
+		var parts []string
+		for _, part := range opt.Name {
+			if part.GetIsExtension() {
+				parts = append(parts, "("+part.GetNamePart()+")")
+			} else {
+				parts = append(parts, part.GetNamePart())
+			}
+		}
+		names = append(names, strings.Join(parts, "."))
+	}
+	return names
+}
+
+func interpretedValues(t *testing.T, file linker.File, opts proto.Message) []string {
+	data, err := proto.Marshal(opts)
+	require.NoError(t, err)
+	msg := opts.ProtoReflect().New()
+	err = proto.UnmarshalOptions{Resolver: linker.ResolverFromFile(file)}.Unmarshal(data, msg.Interface())
+	require.NoError(t, err)
+	var values []string
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if !fd.IsExtension() {
+			return true
+		}
+		val := v.String()
+		if fd.Message() != nil {
+			val = "{" + strings.Replace(prototext.MarshalOptions{}.Format(v.Message().Interface()), " ", "", -1) + "}"
+		}
+		values = append(values, "("+string(fd.FullName())+")="+val)
+		return true
+	})
+	sort.Strings(values)
+	return values
+}
+
+func TestCompileWithLimits(t *testing.T) {
+	accessor := SourceAccessorFromMap(map[string]string{
+		"a.proto": `
+syntax = "proto3";
+import "b.proto";
+message A { B b = 1; }
+`,
+		"b.proto": `
+syntax = "proto3";
+message B { message C { message D {} } }
+`,
+	})
+	compiler := Compiler{
+		Resolver: &SourceResolver{Accessor: accessor},
+		Limits:   parser.Limits{MaxNestingDepth: 2},
+	}
+	_, err := compiler.Compile(context.Background(), "a.proto")
+	require.EqualError(t, err, "b.proto:3:35: nesting depth exceeds limit of 2")
+	var limitErr *parser.LimitError
+	assert.True(t, errors.As(err, &limitErr))
+
+	// lenient mode does not ignore limits
+	compiler.Lenient = true
+	fds, err := compiler.Compile(context.Background(), "a.proto")
+	require.EqualError(t, err, "b.proto:3:35: nesting depth exceeds limit of 2")
+	require.NotNil(t, fds[0])
+	assert.True(t, fds[0].Messages().Get(0).Fields().Get(0).Message().IsPlaceholder())
+
+	compiler.Lenient = false
+	compiler.Limits.MaxNestingDepth = 3
+	_, err = compiler.Compile(context.Background(), "a.proto")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = compiler.Compile(ctx, "a.proto")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestSynthesizedASTFromCompiledDescriptor(t *testing.T) {
+	filenames := []string{"desc_test_comments.proto", "desc_test_complex.proto", "desc_test_proto3_optional.proto"}
+	comp := Compiler{
+		Resolver:          WithStandardImports(&SourceResolver{ImportPaths: []string{"internal/testprotos"}}),
+		IncludeSourceInfo: true,
+	}
+	ctx := context.Background()
+	files, err := comp.Compile(ctx, filenames...)
+	require.NoError(t, err)
+
+	for i, file := range files {
+		fd := file.(linker.Result).Proto()
+		synthesized, err := parser.SynthesizeAST(fd)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, ast.Print(&buf, synthesized))
+
+		// compile the synthesized source, and make sure it is the same
+		source := buf.String()
+		comp := Compiler{
+			Resolver: WithStandardImports(&SourceResolver{
+				ImportPaths: []string{"internal/testprotos"},
+				Accessor: func(path string) (io.ReadCloser, error) {
+					if path == filepath.Join("internal/testprotos", filenames[i]) {
+						return io.NopCloser(strings.NewReader(source)), nil
+					}
+					return os.Open(path)
+				},
+			}),
+			IncludeSourceInfo: true,
+		}
+		recompiled, err := comp.Compile(ctx, filenames[i])
+		require.NoError(t, err, "source:\n%s", source)
+		fd2 := recompiled[0].(linker.Result).Proto()
+		fdNoSourceInfo := proto.Clone(fd).(*descriptorpb.FileDescriptorProto)
+		fdNoSourceInfo.SourceCodeInfo = nil
+		fd2NoSourceInfo := proto.Clone(fd2).(*descriptorpb.FileDescriptorProto)
+		fd2NoSourceInfo.SourceCodeInfo = nil
+		if !proto.Equal(fdNoSourceInfo, fd2NoSourceInfo) {
+			assert.Equal(t, prototext.Format(fdNoSourceInfo), prototext.Format(fd2NoSourceInfo), "source:\n%s", source)
+		}
+
+		// and that the comments for all elements are the same
+		checkComments(t, file, recompiled[0], file)
+	}
+}
+
+type hasDescriptors interface {
+	protoreflect.Descriptor
+	Messages() protoreflect.MessageDescriptors
+	Enums() protoreflect.EnumDescriptors
+	Extensions() protoreflect.ExtensionDescriptors
+}
+
+func checkComments(t *testing.T, file, other linker.File, d protoreflect.Descriptor) {
+	if _, isFile := d.(protoreflect.FileDescriptor); !isFile {
+		otherDesc := other.FindDescriptorByName(d.FullName())
+		if assert.NotNil(t, otherDesc, "%s", d.FullName()) {
+			loc := file.SourceLocations().ByDescriptor(d)
+			otherLoc := other.SourceLocations().ByDescriptor(otherDesc)
+			assert.Equal(t, loc.LeadingDetachedComments, otherLoc.LeadingDetachedComments, "%s", d.FullName())
+			assert.Equal(t, loc.LeadingComments, otherLoc.LeadingComments, "%s", d.FullName())
+			assert.Equal(t, loc.TrailingComments, otherLoc.TrailingComments, "%s", d.FullName())
+		}
+	}
+	var children []protoreflect.Descriptor
+	if container, ok := d.(hasDescriptors); ok {
+		for i := 0; i < container.Messages().Len(); i++ {
+			children = append(children, container.Messages().Get(i))
+		}
+		for i := 0; i < container.Enums().Len(); i++ {
+			children = append(children, container.Enums().Get(i))
+		}
+		for i := 0; i < container.Extensions().Len(); i++ {
+			children = append(children, container.Extensions().Get(i))
+		}
+	}
+	switch d := d.(type) {
+	case protoreflect.FileDescriptor:
+		for i := 0; i < d.Services().Len(); i++ {
+			children = append(children, d.Services().Get(i))
+		}
+	case protoreflect.MessageDescriptor:
+		for i := 0; i < d.Fields().Len(); i++ {
+			children = append(children, d.Fields().Get(i))
+		}
+		for i := 0; i < d.Oneofs().Len(); i++ {
+			children = append(children, d.Oneofs().Get(i))
+		}
+	case protoreflect.EnumDescriptor:
+		for i := 0; i < d.Values().Len(); i++ {
+			children = append(children, d.Values().Get(i))
+		}
+	case protoreflect.ServiceDescriptor:
+		for i := 0; i < d.Methods().Len(); i++ {
+			children = append(children, d.Methods().Get(i))
+		}
+	}
+	for _, child := range children {
+		checkComments(t, file, other, child)
+	}
+}
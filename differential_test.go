@@ -0,0 +1,326 @@
+package protocompile
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/linker"
+)
+
+// TestDifferential compiles a corpus of files and compares the results to
+// descriptor sets that were produced by protoc. Each *.protoset file in the
+// corpus directory (or its sub-directories) is a golden descriptor set, which
+// must have been created with protoc's --include_imports flag. The last file
+// in the set is the one that is compiled. If the golden files include source
+// code info (created with protoc's --include_source_info flag), then source
+// code info is also compared.
+//
+// Descriptors must match exactly. But the source code info produced by this
+// module is known to differ from protoc's in some ways (such as which
+// locations have comments attached). So the differences in source code info
+// are instead compared to a golden file next to the descriptor set, named
+// like the descriptor set but with a ".divergences.txt" extension. That way,
+// changes in how source code info is computed are visible in the diffs of
+// these files. Set regenerateMode to true to re-generate them.
+//
+// The golden descriptor sets are generated by testdata/differential/gen.sh,
+// which uses protoc 3.12.0. To add a file to the corpus, put it in the corpus
+// directory, add it to the list of files in that script, and then run it.
+//
+//go:generate ./testdata/differential/gen.sh
+func TestDifferential(t *testing.T) {
+	const corpusDir = "testdata/differential"
+	var goldens []string
+	err := filepath.Walk(corpusDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) == ".protoset" {
+			goldens = append(goldens, path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, goldens)
+	for _, golden := range goldens {
+		golden := golden
+		name, err := filepath.Rel(corpusDir, golden)
+		require.NoError(t, err)
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			data, err := ioutil.ReadFile(golden)
+			require.NoError(t, err)
+			var fdset descriptorpb.FileDescriptorSet
+			require.NoError(t, proto.Unmarshal(data, &fdset))
+			require.NotEmpty(t, fdset.File)
+			includeSourceInfo := fdset.File[len(fdset.File)-1].SourceCodeInfo != nil
+			// Files in the set that are not in the corpus are standard imports.
+			// Their descriptors are compiled into this module, so they won't
+			// match the versions that are bundled with protoc.
+			var names []string
+			for _, fd := range fdset.File {
+				if _, err := os.Stat(filepath.Join(corpusDir, fd.GetName())); err == nil {
+					names = append(names, fd.GetName())
+				} else {
+					require.Contains(t, standardImports, fd.GetName())
+				}
+			}
+
+			compiler := Compiler{
+				Resolver: WithStandardImports(&SourceResolver{
+					ImportPaths: []string{corpusDir},
+				}),
+				IncludeSourceInfo: includeSourceInfo,
+			}
+			fds, err := compiler.Compile(context.Background(), names...)
+			require.NoError(t, err)
+
+			// Now that we have descriptors, we can unmarshal the golden set
+			// again, so that custom options are recognized as extensions
+			// instead of unknown fields.
+			fdset.Reset()
+			require.NoError(t, proto.UnmarshalOptions{Resolver: fds.AsResolver()}.Unmarshal(data, &fdset))
+
+			compiled := map[string]protoreflect.FileDescriptor{}
+			for _, fd := range fds {
+				compiled[fd.Path()] = fd
+			}
+			var divergences bytes.Buffer
+			for _, exp := range fdset.File {
+				actFile := compiled[exp.GetName()]
+				if actFile == nil {
+					// standard import
+					continue
+				}
+				act := proto.Clone(toFileProto(actFile)).(*descriptorpb.FileDescriptorProto)
+				if includeSourceInfo && exp.SourceCodeInfo != nil {
+					for _, diff := range diffSourceInfo(exp.SourceCodeInfo, act.SourceCodeInfo) {
+						fmt.Fprintf(&divergences, "%s: %s\n", exp.GetName(), diff)
+					}
+				}
+				exp.SourceCodeInfo = nil
+				act.SourceCodeInfo = nil
+				for _, diff := range diffMessages(exp.GetName(), exp.ProtoReflect(), act.ProtoReflect()) {
+					t.Error(diff)
+				}
+			}
+
+			if !includeSourceInfo {
+				return
+			}
+			divergencesFile := strings.TrimSuffix(golden, ".protoset") + ".divergences.txt"
+			if regenerateMode {
+				require.NoError(t, ioutil.WriteFile(divergencesFile, divergences.Bytes(), 0666))
+			}
+			expected, err := ioutil.ReadFile(divergencesFile)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), divergences.String(), "source code info divergences from protoc changed")
+		})
+	}
+}
+
+// If true, re-generates the files of known divergences from protoc's source
+// code info.
+const regenerateMode = false
+
+// diffSourceInfo returns a description of each difference between the given
+// source code info. Locations are matched by path and span, so a location
+// whose span differs is reported as both missing and extra. For locations
+// that match, differences in their comments are reported.
+func diffSourceInfo(exp, act *descriptorpb.SourceCodeInfo) []string {
+	key := func(loc *descriptorpb.SourceCodeInfo_Location) string {
+		return fmt.Sprintf("%v %v", loc.Path, loc.Span)
+	}
+	actLocs := map[string][]*descriptorpb.SourceCodeInfo_Location{}
+	for _, loc := range act.GetLocation() {
+		k := key(loc)
+		actLocs[k] = append(actLocs[k], loc)
+	}
+	var diffs []string
+	for _, expLoc := range exp.GetLocation() {
+		k := key(expLoc)
+		if len(actLocs[k]) == 0 {
+			diffs = append(diffs, "missing "+k)
+			continue
+		}
+		actLoc := actLocs[k][0]
+		actLocs[k] = actLocs[k][1:]
+		if expLoc.GetLeadingComments() != actLoc.GetLeadingComments() {
+			diffs = append(diffs, fmt.Sprintf("leading comments %s: expected %q, got %q", k, expLoc.GetLeadingComments(), actLoc.GetLeadingComments()))
+		}
+		if expLoc.GetTrailingComments() != actLoc.GetTrailingComments() {
+			diffs = append(diffs, fmt.Sprintf("trailing comments %s: expected %q, got %q", k, expLoc.GetTrailingComments(), actLoc.GetTrailingComments()))
+		}
+		if fmt.Sprintf("%q", expLoc.LeadingDetachedComments) != fmt.Sprintf("%q", actLoc.LeadingDetachedComments) {
+			diffs = append(diffs, fmt.Sprintf("detached comments %s: expected %q, got %q", k, expLoc.LeadingDetachedComments, actLoc.LeadingDetachedComments))
+		}
+	}
+	// report extra locations in the order they appear
+	for _, actLoc := range act.GetLocation() {
+		k := key(actLoc)
+		if len(actLocs[k]) > 0 && actLocs[k][0] == actLoc {
+			actLocs[k] = actLocs[k][1:]
+			diffs = append(diffs, "extra "+k)
+		}
+	}
+	return diffs
+}
+
+func TestDiffMessages(t *testing.T) {
+	exp := &descriptorpb.FileDescriptorProto{
+		Name: proto.String("test.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Foo"), Field: []*descriptorpb.FieldDescriptorProto{{Name: proto.String("a"), Number: proto.Int32(1)}}},
+		},
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("foo")},
+	}
+	act := proto.Clone(exp).(*descriptorpb.FileDescriptorProto)
+	assert.Empty(t, diffMessages("test.proto", exp.ProtoReflect(), act.ProtoReflect()))
+
+	act.MessageType[0].Field[0].Number = proto.Int32(2)
+	act.Options.GoPackage = nil
+	act.Dependency = []string{"foo.proto"}
+	assert.Equal(t, []string{
+		"test.proto.dependency: expected 0 elements, got 1",
+		"test.proto.message_type[0].field[0].number: expected 1, got 2",
+		"test.proto.options.go_package: expected foo, got no value",
+	}, diffMessages("test.proto", exp.ProtoReflect(), act.ProtoReflect()))
+}
+
+func TestDiffSourceInfo(t *testing.T) {
+	exp := &descriptorpb.SourceCodeInfo{
+		Location: []*descriptorpb.SourceCodeInfo_Location{
+			{Path: []int32{}, Span: []int32{0, 0, 10, 1}},
+			{Path: []int32{4, 0}, Span: []int32{1, 0, 3, 1}, LeadingComments: proto.String(" Foo\n")},
+			{Path: []int32{4, 0, 1}, Span: []int32{1, 8, 11}},
+		},
+	}
+	act := proto.Clone(exp).(*descriptorpb.SourceCodeInfo)
+	assert.Empty(t, diffSourceInfo(exp, act))
+
+	act.Location[0].Span = []int32{0, 0, 11, 0}
+	act.Location[1].LeadingComments = nil
+	act.Location[1].TrailingComments = proto.String(" bar\n")
+	act.Location = append(act.Location, &descriptorpb.SourceCodeInfo_Location{Path: []int32{4, 0, 1}, Span: []int32{1, 8, 11}})
+	assert.Equal(t, []string{
+		"missing [] [0 0 10 1]",
+		`leading comments [4 0] [1 0 3 1]: expected " Foo\n", got ""`,
+		`trailing comments [4 0] [1 0 3 1]: expected "", got " bar\n"`,
+		"extra [] [0 0 11 0]",
+		"extra [4 0 1] [1 8 11]",
+	}, diffSourceInfo(exp, act))
+}
+
+func toFileProto(fd protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+	if res, ok := fd.(linker.Result); ok {
+		return res.Proto()
+	}
+	return protodesc.ToFileDescriptorProto(fd)
+}
+
+// diffMessages returns a description of each difference between the two
+// given messages. Each difference is described by the path to the field
+// that differs and the expected and actual values.
+func diffMessages(path string, exp, act protoreflect.Message) []string {
+	var diffs []string
+	fields := exp.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		diffs = append(diffs, diffField(path, fields.Get(i), exp, act)...)
+	}
+	exp.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fd.IsExtension() {
+			diffs = append(diffs, diffField(path, fd, exp, act)...)
+		}
+		return true
+	})
+	act.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.IsExtension() && !exp.Has(fd) {
+			diffs = append(diffs, fmt.Sprintf("%s.(%s): expected no value, got %v", path, fd.FullName(), v))
+		}
+		return true
+	})
+	if string(exp.GetUnknown()) != string(act.GetUnknown()) {
+		diffs = append(diffs, fmt.Sprintf("%s: unknown fields differ: expected %x, got %x", path, exp.GetUnknown(), act.GetUnknown()))
+	}
+	return diffs
+}
+
+func diffField(path string, fd protoreflect.FieldDescriptor, exp, act protoreflect.Message) []string {
+	name := string(fd.Name())
+	if fd.IsExtension() {
+		name = "(" + string(fd.FullName()) + ")"
+	}
+	path = path + "." + name
+	switch {
+	case fd.IsList():
+		expList, actList := exp.Get(fd).List(), act.Get(fd).List()
+		if expList.Len() != actList.Len() {
+			return []string{fmt.Sprintf("%s: expected %d elements, got %d", path, expList.Len(), actList.Len())}
+		}
+		var diffs []string
+		for i := 0; i < expList.Len(); i++ {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			if fd.Message() != nil {
+				diffs = append(diffs, diffMessages(elemPath, expList.Get(i).Message(), actList.Get(i).Message())...)
+			} else if !scalarsEqual(expList.Get(i), actList.Get(i)) {
+				diffs = append(diffs, fmt.Sprintf("%s: expected %v, got %v", elemPath, expList.Get(i), actList.Get(i)))
+			}
+		}
+		return diffs
+	case exp.Has(fd) != act.Has(fd):
+		if exp.Has(fd) {
+			return []string{fmt.Sprintf("%s: expected %v, got no value", path, exp.Get(fd))}
+		}
+		return []string{fmt.Sprintf("%s: expected no value, got %v", path, act.Get(fd))}
+	case !exp.Has(fd):
+		return nil
+	case fd.IsMap():
+		// descriptors have no map fields, but custom options might
+		expMap, actMap := exp.Get(fd).Map(), act.Get(fd).Map()
+		if expMap.Len() != actMap.Len() {
+			return []string{fmt.Sprintf("%s: expected %d entries, got %d", path, expMap.Len(), actMap.Len())}
+		}
+		var diffs []string
+		expMap.Range(func(k protoreflect.MapKey, expVal protoreflect.Value) bool {
+			entryPath := fmt.Sprintf("%s[%v]", path, k)
+			switch {
+			case !actMap.Has(k):
+				diffs = append(diffs, fmt.Sprintf("%s: expected %v, got no value", entryPath, expVal))
+			case fd.MapValue().Message() != nil:
+				diffs = append(diffs, diffMessages(entryPath, expVal.Message(), actMap.Get(k).Message())...)
+			case !scalarsEqual(expVal, actMap.Get(k)):
+				diffs = append(diffs, fmt.Sprintf("%s: expected %v, got %v", entryPath, expVal, actMap.Get(k)))
+			}
+			return true
+		})
+		return diffs
+	case fd.Message() != nil:
+		return diffMessages(path, exp.Get(fd).Message(), act.Get(fd).Message())
+	default:
+		if !scalarsEqual(exp.Get(fd), act.Get(fd)) {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", path, exp.Get(fd), act.Get(fd))}
+		}
+		return nil
+	}
+}
+
+func scalarsEqual(a, b protoreflect.Value) bool {
+	if aBytes, ok := a.Interface().([]byte); ok {
+		bBytes, ok := b.Interface().([]byte)
+		return ok && bytes.Equal(aBytes, bBytes)
+	}
+	// formatting the values makes NaN equal to itself
+	return a.Interface() == b.Interface() || fmt.Sprint(a.Interface()) == fmt.Sprint(b.Interface())
+}
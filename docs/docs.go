@@ -0,0 +1,479 @@
+// Package docs generates reference documentation for protobuf files. The
+// documentation is generated from compiled files (linker.File values), so no
+// external tools or plugins are needed. For the documentation to include
+// comments, the files should be compiled with source code info (see the
+// IncludeSourceInfo field of protocompile.Compiler).
+//
+// The documentation is organized by package. Each package has a page that
+// describes its messages, enums, extensions, and services. Pages can be
+// rendered as Markdown or HTML, using built-in or custom templates. (See
+// Generator.)
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/sourceinfo"
+	"github.com/jhump/protocompile/walk"
+)
+
+// Package is the documentation for a single protobuf package, which may be
+// defined across multiple files.
+type Package struct {
+	// The name of the package. This is empty for files that have no package
+	// declaration.
+	Name string
+	// The paths of the files that define elements in this package.
+	Files      []string
+	Messages   []*Message
+	Enums      []*Enum
+	Extensions []*Field
+	Services   []*Service
+}
+
+// Element contains the documentation common to all elements.
+type Element struct {
+	// The simple name of the element.
+	Name string
+	// The fully-qualified name of the element.
+	FullName string
+	// The comments that precede the element in the source, or the comments
+	// that trail it if there are no leading comments.
+	Description string
+	// True if the element is marked as deprecated via the "deprecated"
+	// option.
+	Deprecated bool
+	// The options set on the element, other than "deprecated". This includes
+	// custom options.
+	Options []Option
+}
+
+// Anchor returns a string that can be used as an anchor (for linking) for
+// this element in a page.
+func (e *Element) Anchor() string {
+	return e.FullName
+}
+
+// Message is the documentation for a message. Nested messages are documented
+// separately, so their fully-qualified names indicate their nesting.
+type Message struct {
+	Element
+	Fields     []*Field
+	Extensions []*Field
+}
+
+// Field is the documentation for a field or extension.
+type Field struct {
+	Element
+	Number int32
+	// The label of the field: "optional", "required", or "repeated". This is
+	// empty for map fields, fields in a oneof, and fields in proto3 that do
+	// not use a label.
+	Label string
+	// The type of the field.
+	Type TypeRef
+	// The default value of the field, if one is specified.
+	Default string
+	// The name of the oneof that contains this field, if any.
+	Oneof string
+	// For extensions, the message that is extended. This is the zero value
+	// for normal fields.
+	Extendee TypeRef
+}
+
+// TypeRef is a reference to a type. For messages and enums, the reference
+// can be linked to the type's documentation.
+type TypeRef struct {
+	// The name of the type. For scalar types, this is the keyword for the
+	// type, like "int32". For message and enum types, it is the fully-
+	// qualified name. For map fields, it is like "map<string, foo.Bar>".
+	Name string
+	// The fully-qualified name of the referenced message or enum. For map
+	// fields, this refers to the type of the map values. This is empty if
+	// the referenced type is a scalar type.
+	FullName string
+	// The package that contains the referenced message or enum. This is
+	// only set if the type is documented, so that it can be linked.
+	Package *Package
+}
+
+// Enum is the documentation for an enum.
+type Enum struct {
+	Element
+	Values []*EnumValue
+}
+
+// EnumValue is the documentation for an enum value.
+type EnumValue struct {
+	Element
+	Number int32
+}
+
+// Service is the documentation for a service.
+type Service struct {
+	Element
+	Methods []*Method
+}
+
+// Method is the documentation for a method (rpc) in a service.
+type Method struct {
+	Element
+	Request         TypeRef
+	Response        TypeRef
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+// Option is an option that was set on an element.
+type Option struct {
+	// The name of the option. For custom options (extensions), the name
+	// is in parentheses, like "(foo.bar.baz)".
+	Name string
+	// The value of the option, formatted as it would appear in source.
+	Value string
+}
+
+// NewPackages creates the documentation for the given files. The returned
+// slice has one element for each package defined by the given files, sorted
+// by package name. Only the given files are documented, not their
+// dependencies.
+func NewPackages(files linker.Files) []*Package {
+	pkgsByName := map[string]*Package{}
+	var pkgs []*Package
+	for _, file := range files {
+		pkg := pkgsByName[string(file.Package())]
+		if pkg == nil {
+			pkg = &Package{Name: string(file.Package())}
+			pkgsByName[pkg.Name] = pkg
+			pkgs = append(pkgs, pkg)
+		}
+		pkg.Files = append(pkg.Files, file.Path())
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+
+	// first pass: find all documented types, so they can be linked
+	types := map[protoreflect.FullName]*Package{}
+	for _, file := range files {
+		pkg := pkgsByName[string(file.Package())]
+		_ = walk.Descriptors(file, func(d protoreflect.Descriptor) error {
+			switch d := d.(type) {
+			case protoreflect.MessageDescriptor:
+				if !d.IsMapEntry() {
+					types[d.FullName()] = pkg
+				}
+			case protoreflect.EnumDescriptor:
+				types[d.FullName()] = pkg
+			}
+			return nil
+		})
+	}
+
+	b := builder{types: types}
+	for _, file := range files {
+		pkg := pkgsByName[string(file.Package())]
+		b.res = linker.ResolverFromFile(file)
+		b.defaults = fieldDefaults(file)
+		_ = walk.Descriptors(file, func(d protoreflect.Descriptor) error {
+			switch d := d.(type) {
+			case protoreflect.MessageDescriptor:
+				if !d.IsMapEntry() {
+					pkg.Messages = append(pkg.Messages, b.message(d))
+				}
+			case protoreflect.EnumDescriptor:
+				pkg.Enums = append(pkg.Enums, b.enum(d))
+			case protoreflect.FieldDescriptor:
+				if d.IsExtension() {
+					if _, ok := d.Parent().(protoreflect.FileDescriptor); ok {
+						pkg.Extensions = append(pkg.Extensions, b.field(d))
+					}
+				}
+			case protoreflect.ServiceDescriptor:
+				pkg.Services = append(pkg.Services, b.service(d))
+			}
+			return nil
+		})
+	}
+	return pkgs
+}
+
+type builder struct {
+	types map[protoreflect.FullName]*Package
+	// used to recognize custom options in the current file
+	res linker.Resolver
+	// default values of fields in the current file, as they appear in the
+	// file's descriptor proto
+	defaults map[protoreflect.FullName]string
+}
+
+// fieldDefaults returns the default values of all fields in the given file
+// that have one, keyed by the field's fully-qualified name. The values are
+// taken from the file's descriptor proto, since not all implementations of
+// protoreflect.FieldDescriptor report them via the Default method.
+func fieldDefaults(file linker.File) map[protoreflect.FullName]string {
+	var fd *descriptorpb.FileDescriptorProto
+	if res, ok := file.(linker.Result); ok {
+		fd = res.Proto()
+	} else {
+		fd = protodesc.ToFileDescriptorProto(file)
+	}
+	defaults := map[protoreflect.FullName]string{}
+	_ = walk.DescriptorProtos(fd, func(name protoreflect.FullName, msg proto.Message) error {
+		if fld, ok := msg.(*descriptorpb.FieldDescriptorProto); ok && fld.DefaultValue != nil {
+			defaults[name] = fld.GetDefaultValue()
+		}
+		return nil
+	})
+	return defaults
+}
+
+func (b *builder) element(d protoreflect.Descriptor) Element {
+	e := Element{
+		Name:     string(d.Name()),
+		FullName: string(d.FullName()),
+	}
+	if loc, ok := sourceinfo.DescriptorLocation(d); ok {
+		e.Description = loc.LeadingComments
+		if e.Description == "" {
+			e.Description = loc.TrailingComments
+		}
+		e.Description = cleanComment(e.Description)
+	}
+	opts := d.Options()
+	if opts == nil {
+		return e
+	}
+	msg := b.resolveOptions(opts.ProtoReflect())
+	var options []Option
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Name() == "deprecated" && !fd.IsExtension() {
+			e.Deprecated = v.Bool()
+			return true
+		}
+		name := string(fd.Name())
+		if fd.IsExtension() {
+			name = "(" + string(fd.FullName()) + ")"
+		}
+		options = append(options, Option{Name: name, Value: formatValue(fd, v)})
+		return true
+	})
+	sort.Slice(options, func(i, j int) bool {
+		return options[i].Name < options[j].Name
+	})
+	e.Options = options
+	return e
+}
+
+// resolveOptions returns a copy of the given options message where custom
+// options, which are stored as unrecognized fields, are instead extension
+// fields. If they cannot be resolved, the given message is returned as is.
+func (b *builder) resolveOptions(opts protoreflect.Message) protoreflect.Message {
+	if len(opts.GetUnknown()) == 0 {
+		return opts
+	}
+	resolved, err := linker.ResolveUnknownExtensions(opts.Interface(), b.res)
+	if err != nil {
+		return opts
+	}
+	return resolved.ProtoReflect()
+}
+
+func (b *builder) message(md protoreflect.MessageDescriptor) *Message {
+	msg := &Message{Element: b.element(md)}
+	for i := 0; i < md.Fields().Len(); i++ {
+		msg.Fields = append(msg.Fields, b.field(md.Fields().Get(i)))
+	}
+	for i := 0; i < md.Extensions().Len(); i++ {
+		msg.Extensions = append(msg.Extensions, b.field(md.Extensions().Get(i)))
+	}
+	return msg
+}
+
+func (b *builder) field(fd protoreflect.FieldDescriptor) *Field {
+	fld := &Field{
+		Element: b.element(fd),
+		Number:  int32(fd.Number()),
+		Type:    b.fieldType(fd),
+	}
+	switch {
+	case fd.IsMap():
+		// no label
+	case fd.Cardinality() == protoreflect.Repeated:
+		fld.Label = "repeated"
+	case fd.Cardinality() == protoreflect.Required:
+		fld.Label = "required"
+	case fd.HasOptionalKeyword():
+		fld.Label = "optional"
+	}
+	if def, ok := b.defaults[fd.FullName()]; ok {
+		fld.Default = def
+		switch fd.Kind() {
+		case protoreflect.StringKind:
+			fld.Default = quote([]byte(fld.Default))
+		case protoreflect.BytesKind:
+			// the default value of a bytes field is already escaped
+			fld.Default = `"` + fld.Default + `"`
+		}
+	}
+	if ood := fd.ContainingOneof(); ood != nil && !ood.IsSynthetic() {
+		fld.Oneof = string(ood.Name())
+	}
+	if fd.IsExtension() {
+		fld.Extendee = b.typeRef(fd.ContainingMessage())
+	}
+	return fld
+}
+
+func (b *builder) fieldType(fd protoreflect.FieldDescriptor) TypeRef {
+	if fd.IsMap() {
+		key := b.fieldType(fd.MapKey())
+		val := b.fieldType(fd.MapValue())
+		val.Name = fmt.Sprintf("map<%s, %s>", key.Name, val.Name)
+		return val
+	}
+	switch {
+	case fd.Message() != nil:
+		return b.typeRef(fd.Message())
+	case fd.Enum() != nil:
+		return b.typeRef(fd.Enum())
+	default:
+		return TypeRef{Name: fd.Kind().String()}
+	}
+}
+
+func (b *builder) typeRef(d protoreflect.Descriptor) TypeRef {
+	return TypeRef{
+		Name:     string(d.FullName()),
+		FullName: string(d.FullName()),
+		Package:  b.types[d.FullName()],
+	}
+}
+
+func (b *builder) enum(ed protoreflect.EnumDescriptor) *Enum {
+	en := &Enum{Element: b.element(ed)}
+	for i := 0; i < ed.Values().Len(); i++ {
+		vd := ed.Values().Get(i)
+		en.Values = append(en.Values, &EnumValue{Element: b.element(vd), Number: int32(vd.Number())})
+	}
+	return en
+}
+
+func (b *builder) service(sd protoreflect.ServiceDescriptor) *Service {
+	svc := &Service{Element: b.element(sd)}
+	for i := 0; i < sd.Methods().Len(); i++ {
+		md := sd.Methods().Get(i)
+		svc.Methods = append(svc.Methods, &Method{
+			Element:         b.element(md),
+			Request:         b.typeRef(md.Input()),
+			Response:        b.typeRef(md.Output()),
+			ClientStreaming: md.IsStreamingClient(),
+			ServerStreaming: md.IsStreamingServer(),
+		})
+	}
+	return svc
+}
+
+// cleanComment removes the leading space that usually follows the comment
+// delimiter on each line and trims leading and trailing blank lines.
+func cleanComment(comment string) string {
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimRight(line, " \t"), " ")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// formatValue formats the given value of the given field as it would appear
+// in source.
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch {
+	case fd.IsList():
+		l := v.List()
+		elems := make([]string, l.Len())
+		for i := 0; i < l.Len(); i++ {
+			elems[i] = formatSingularValue(fd, l.Get(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case fd.IsMap():
+		var entries []string
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			entries = append(entries, fmt.Sprintf("{ key: %s value: %s }",
+				formatSingularValue(fd.MapKey(), k.Value()), formatSingularValue(fd.MapValue(), v)))
+			return true
+		})
+		sort.Strings(entries)
+		return "[" + strings.Join(entries, ", ") + "]"
+	default:
+		return formatSingularValue(fd, v)
+	}
+}
+
+func formatSingularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return formatMessage(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return fmt.Sprintf("%d", v.Enum())
+	case protoreflect.StringKind:
+		return quote([]byte(v.String()))
+	case protoreflect.BytesKind:
+		return quote(v.Bytes())
+	default:
+		return fmt.Sprintf("%v", v.Interface())
+	}
+}
+
+// formatMessage formats the given message as a message literal, like in the
+// value of an option. Fields are formatted in order of field number, so the
+// output is deterministic.
+func formatMessage(msg protoreflect.Message) string {
+	var fields []protoreflect.FieldDescriptor
+	msg.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	if len(fields) == 0 {
+		return "{}"
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Number() < fields[j].Number()
+	})
+	elems := make([]string, len(fields))
+	for i, fd := range fields {
+		var name string
+		switch {
+		case fd.IsExtension():
+			name = "[" + string(fd.FullName()) + "]"
+		case fd.Kind() == protoreflect.GroupKind:
+			name = string(fd.Message().Name())
+		default:
+			name = string(fd.Name())
+		}
+		elems[i] = name + ": " + formatValue(fd, msg.Get(fd))
+	}
+	return "{ " + strings.Join(elems, " ") + " }"
+}
+
+// quote returns the given string or bytes value as a quoted string literal,
+// using the same escapes as protoc.
+func quote(b []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	internal.WriteEscapedBytes(&buf, b)
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,234 @@
+package docs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/docs"
+	"github.com/jhump/protocompile/linker"
+)
+
+const testSource = `
+syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/descriptor.proto";
+import "other.proto";
+
+extend google.protobuf.MessageOptions {
+  // Marks a message as sensitive.
+  bool sensitive = 50001;
+  baz.Gadget spec = 50002;
+}
+
+// A widget | with a pipe.
+// Second line.
+message Widget {
+  option (sensitive) = true;
+  option deprecated = true;
+
+  // The name of the widget.
+  string name = 1 [deprecated = true];
+  repeated Color colors = 2;
+  map<string, Widget> children = 3;
+  baz.Gadget gadget = 4;
+  optional int32 count = 5;
+  oneof choice {
+    string a = 6;
+    int64 b = 7;
+  }
+
+  message Part {
+    option (spec) = { size: 3 id: "a\"b\n" };
+    bytes data = 1;
+  }
+}
+
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  // Red, like a fire truck.
+  COLOR_RED = 1 [deprecated = true];
+}
+
+// Manages widgets.
+service WidgetService {
+  rpc GetWidget(Widget) returns (Widget);
+  rpc StreamParts(stream Widget) returns (stream Widget.Part);
+}
+`
+
+const otherSource = `
+syntax = "proto2";
+
+package baz;
+
+message Gadget {
+  optional string id = 1 [default = "abc"];
+  required int32 size = 2;
+  optional string label = 3 [default = "say \"hi\"\n"];
+  extensions 100 to 200;
+}
+`
+
+func compile(t *testing.T) linker.Files {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"test.proto":  testSource,
+				"other.proto": otherSource,
+			}),
+		}),
+		IncludeSourceInfo: true,
+	}
+	files, err := compiler.Compile(context.Background(), "test.proto", "other.proto")
+	require.NoError(t, err)
+	return files
+}
+
+func TestNewPackages(t *testing.T) {
+	pkgs := docs.NewPackages(compile(t))
+	require.Equal(t, 2, len(pkgs))
+	assert.Equal(t, "baz", pkgs[0].Name)
+	pkg := pkgs[1]
+	assert.Equal(t, "foo.bar", pkg.Name)
+	assert.Equal(t, []string{"test.proto"}, pkg.Files)
+
+	require.Equal(t, 2, len(pkg.Messages))
+	widget := pkg.Messages[0]
+	assert.Equal(t, "foo.bar.Widget", widget.FullName)
+	assert.Equal(t, "A widget | with a pipe.\nSecond line.", widget.Description)
+	assert.True(t, widget.Deprecated)
+	assert.Equal(t, []docs.Option{{Name: "(foo.bar.sensitive)", Value: "true"}}, widget.Options)
+	assert.Equal(t, "foo.bar.Widget.Part", pkg.Messages[1].FullName)
+	assert.Equal(t, []docs.Option{{Name: "(foo.bar.spec)", Value: `{ id: "a\"b\n" size: 3 }`}}, pkg.Messages[1].Options)
+
+	testCases := []struct {
+		name       string
+		label      string
+		typeName   string
+		typeLinked bool
+		oneof      string
+		deprecated bool
+	}{
+		{name: "name", typeName: "string", deprecated: true},
+		{name: "colors", label: "repeated", typeName: "foo.bar.Color", typeLinked: true},
+		{name: "children", typeName: "map<string, foo.bar.Widget>", typeLinked: true},
+		{name: "gadget", typeName: "baz.Gadget", typeLinked: true},
+		{name: "count", label: "optional", typeName: "int32"},
+		{name: "a", typeName: "string", oneof: "choice"},
+		{name: "b", typeName: "int64", oneof: "choice"},
+	}
+	require.Equal(t, len(testCases), len(widget.Fields))
+	for i, tc := range testCases {
+		fld := widget.Fields[i]
+		assert.Equal(t, tc.name, fld.Name)
+		assert.Equal(t, tc.label, fld.Label, "field %s", tc.name)
+		assert.Equal(t, tc.typeName, fld.Type.Name, "field %s", tc.name)
+		assert.Equal(t, tc.typeLinked, fld.Type.Package != nil, "field %s", tc.name)
+		assert.Equal(t, tc.oneof, fld.Oneof, "field %s", tc.name)
+		assert.Equal(t, tc.deprecated, fld.Deprecated, "field %s", tc.name)
+	}
+	assert.Equal(t, "The name of the widget.", widget.Fields[0].Description)
+
+	require.Equal(t, 1, len(pkg.Enums))
+	require.Equal(t, 2, len(pkg.Enums[0].Values))
+	red := pkg.Enums[0].Values[1]
+	assert.Equal(t, "COLOR_RED", red.Name)
+	assert.Equal(t, int32(1), red.Number)
+	assert.True(t, red.Deprecated)
+
+	require.Equal(t, 2, len(pkg.Extensions))
+	ext := pkg.Extensions[0]
+	assert.Equal(t, "foo.bar.sensitive", ext.FullName)
+	assert.Equal(t, "google.protobuf.MessageOptions", ext.Extendee.Name)
+	assert.Nil(t, ext.Extendee.Package)
+
+	require.Equal(t, 1, len(pkg.Services))
+	methods := pkg.Services[0].Methods
+	require.Equal(t, 2, len(methods))
+	assert.False(t, methods[0].ClientStreaming)
+	assert.False(t, methods[0].ServerStreaming)
+	assert.True(t, methods[1].ClientStreaming)
+	assert.True(t, methods[1].ServerStreaming)
+	assert.Equal(t, "foo.bar.Widget.Part", methods[1].Response.FullName)
+
+	gadget := pkgs[0].Messages[0]
+	assert.Equal(t, "optional", gadget.Fields[0].Label)
+	assert.Equal(t, `"abc"`, gadget.Fields[0].Default)
+	assert.Equal(t, "required", gadget.Fields[1].Label)
+	assert.Equal(t, `"say \"hi\"\n"`, gadget.Fields[2].Default)
+}
+
+func TestGenerate(t *testing.T) {
+	files := compile(t)
+	testCases := []struct {
+		format   docs.Format
+		pageName string
+		prefix   string
+		contains []string
+	}{
+		{
+			format:   docs.FormatMarkdown,
+			pageName: "foo.bar.md",
+			prefix:   "# Package `foo.bar`\n\nFiles:\n",
+			contains: []string{
+				"# Package `foo.bar`",
+				"### foo.bar.Widget",
+				"A widget | with a pipe.\nSecond line.",
+				"- `(foo.bar.sensitive) = true`",
+				"| <a name=\"foo.bar.Widget.name\"></a>`name` | 1 |  | `string` | **Deprecated.** The name of the widget. |",
+				"[baz.Gadget](baz.md#baz.Gadget)",
+				"[map<string, foo.bar.Widget>](foo.bar.md#foo.bar.Widget)",
+				"| <a name=\"foo.bar.COLOR_RED\"></a>`COLOR_RED` | 1 | **Deprecated.** Red, like a fire truck. |",
+				"| stream [foo.bar.Widget](foo.bar.md#foo.bar.Widget) | stream [foo.bar.Widget.Part](foo.bar.md#foo.bar.Widget.Part) |",
+			},
+		},
+		{
+			format:   docs.FormatHTML,
+			pageName: "foo.bar.html",
+			prefix:   "<!DOCTYPE html>\n<html>\n",
+			contains: []string{
+				"<h1>Package <code>foo.bar</code></h1>",
+				`<h3 id="foo.bar.Widget">foo.bar.Widget</h3>`,
+				`<p class="description">A widget | with a pipe.` + "\nSecond line.</p>",
+				`<a href="baz.html#baz.Gadget"><code>baz.Gadget</code></a>`,
+				`<code>map&lt;string, foo.bar.Widget&gt;</code>`,
+				`<li><a href="baz.html">baz</a></li>`,
+				`<td>stream <a href="foo.bar.html#foo.bar.Widget.Part"><code>foo.bar.Widget.Part</code></a></td>`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			gen := docs.Generator{Format: tc.format}
+			pages, err := gen.Generate(files)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(pages))
+			page := string(pages[tc.pageName])
+			assert.True(t, strings.HasPrefix(page, tc.prefix), "page does not start with %q:\n%s", tc.prefix, page)
+			for _, s := range tc.contains {
+				assert.True(t, strings.Contains(page, s), "page does not contain %q:\n%s", s, page)
+			}
+		})
+	}
+}
+
+func TestGenerateCustomTemplate(t *testing.T) {
+	tmpl, err := texttemplate.New("custom").Funcs(docs.Funcs(docs.FormatMarkdown)).Parse(
+		`{{range .Package.Messages}}{{.Name}}:{{range .Fields}} {{.Name}}={{typeLink .Type}}{{end}}
+{{end}}`)
+	require.NoError(t, err)
+	gen := docs.Generator{Template: tmpl}
+	pages, err := gen.Generate(compile(t))
+	require.NoError(t, err)
+	assert.Equal(t, "Gadget: id= size= label=\n", string(pages["baz.md"]))
+	assert.Equal(t, "Widget: name= colors=foo.bar.md#foo.bar.Color children=foo.bar.md#foo.bar.Widget"+
+		" gadget=baz.md#baz.Gadget count= a= b=\nPart: data=\n", string(pages["foo.bar.md"]))
+}
@@ -0,0 +1,359 @@
+package docs
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/jhump/protocompile/linker"
+)
+
+// Format is the format of generated documentation.
+type Format int
+
+const (
+	// FormatMarkdown generates documentation in Markdown, using GitHub-
+	// flavored tables.
+	FormatMarkdown = Format(iota)
+	// FormatHTML generates documentation as static HTML pages.
+	FormatHTML
+)
+
+// Extension returns the file extension used for pages in this format,
+// including the leading dot.
+func (f Format) Extension() string {
+	if f == FormatHTML {
+		return ".html"
+	}
+	return ".md"
+}
+
+// String returns a name for the format: "markdown" or "html".
+func (f Format) String() string {
+	switch f {
+	case FormatMarkdown:
+		return "markdown"
+	case FormatHTML:
+		return "html"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Template renders a page of documentation. Both *text/template.Template and
+// *html/template.Template implement this interface. The data passed to the
+// template is a *Page.
+//
+// Custom templates can use the functions returned by Funcs, for example to
+// link to the documentation of a type.
+type Template interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// Page is the data provided to a Template to render a page of documentation.
+type Page struct {
+	// The package that is documented by this page.
+	Package *Package
+	// All packages being documented, which can be used to render an index
+	// or navigation.
+	Packages []*Package
+	// The format of the documentation.
+	Format Format
+}
+
+// Generator renders documentation for compiled files. The zero value is
+// a valid generator that produces Markdown.
+type Generator struct {
+	// The format of the documentation. This determines the extension of
+	// generated file names and, if Template is nil, which built-in template
+	// is used.
+	Format Format
+	// The template used to render each page. If nil, a built-in template for
+	// the generator's format is used.
+	Template Template
+}
+
+// Generate renders documentation for the given files. It returns a map of
+// file names to file contents. There is one page per package (see PageName).
+func (g *Generator) Generate(files linker.Files) (map[string][]byte, error) {
+	tmpl := g.Template
+	if tmpl == nil {
+		var err error
+		tmpl, err = DefaultTemplate(g.Format)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pkgs := NewPackages(files)
+	results := make(map[string][]byte, len(pkgs))
+	for _, pkg := range pkgs {
+		var buf bytes.Buffer
+		page := &Page{Package: pkg, Packages: pkgs, Format: g.Format}
+		if err := tmpl.Execute(&buf, page); err != nil {
+			return nil, fmt.Errorf("failed to render documentation for package %q: %w", pkg.Name, err)
+		}
+		results[PageName(pkg, g.Format)] = buf.Bytes()
+	}
+	return results, nil
+}
+
+// PageName returns the file name of the page that documents the given
+// package. It is the package name plus the format's extension. Elements that
+// are not in a package are documented in a page named "default".
+func PageName(pkg *Package, format Format) string {
+	name := pkg.Name
+	if name == "" {
+		name = "default"
+	}
+	return name + format.Extension()
+}
+
+// DefaultTemplate returns the built-in template for the given format.
+func DefaultTemplate(format Format) (Template, error) {
+	switch format {
+	case FormatMarkdown:
+		return texttemplate.New("markdown").Funcs(Funcs(format)).Parse(markdownTemplate)
+	case FormatHTML:
+		return htmltemplate.New("html").Funcs(Funcs(format)).Parse(htmlTemplate)
+	default:
+		return nil, fmt.Errorf("unknown format: %v", format)
+	}
+}
+
+// Funcs returns the functions used by the built-in templates for the given
+// format. They can be added to custom templates via the Funcs method of
+// text/template.Template or html/template.Template. The functions are:
+//
+//	pageName  *Package -> string   the file name of a package's page
+//	typeLink  TypeRef -> string    a link to the type's documentation, or
+//	                               empty if the type is not documented
+//	cell      string -> string     escapes text for use in a Markdown table
+//	                               (only for FormatMarkdown)
+func Funcs(format Format) map[string]interface{} {
+	funcs := map[string]interface{}{
+		"pageName": func(pkg *Package) string {
+			return PageName(pkg, format)
+		},
+		"typeLink": func(ref TypeRef) string {
+			if ref.Package == nil {
+				return ""
+			}
+			return PageName(ref.Package, format) + "#" + ref.FullName
+		},
+	}
+	if format == FormatMarkdown {
+		funcs["cell"] = markdownCell
+	}
+	return funcs
+}
+
+var markdownCellReplacer = strings.NewReplacer("|", `\|`, "\n", "<br>")
+
+func markdownCell(s string) string {
+	return markdownCellReplacer.Replace(s)
+}
+
+const markdownTemplate = `{{define "type"}}{{with typeLink .}}[{{$.Name}}]({{.}}){{else}}` + "`{{.Name}}`" + `{{end}}{{end -}}
+
+{{define "notes" -}}
+{{if .Deprecated}}**Deprecated.** {{end}}{{cell .Description}}
+{{- range .Options}} ` + "`{{cell .Name}} = {{cell .Value}}`" + `{{end}}
+{{- end -}}
+
+{{define "options" -}}
+{{with .}}
+Options:
+{{range .}}
+- ` + "`{{.Name}} = {{.Value}}`" + `
+{{- end}}
+{{end}}
+{{- end -}}
+
+{{define "fieldNotes" -}}
+{{template "notes" .}}
+{{- with .Default}} Default: ` + "`{{cell .}}`" + `.{{end}}
+{{- with .Oneof}} Oneof: ` + "`{{.}}`" + `.{{end}}
+{{- end -}}
+
+{{define "extensions" -}}
+| Extension | Extendee | Number | Label | Type | Description |
+| --------- | -------- | ------ | ----- | ---- | ----------- |
+{{range .}}| <a name="{{.Anchor}}"></a>` + "`{{.FullName}}`" + ` | {{template "type" .Extendee}} | {{.Number}} | {{.Label}} | {{template "type" .Type}} | {{template "fieldNotes" .}} |
+{{end}}
+{{- end -}}
+
+{{define "element" -}}
+<a name="{{.Anchor}}"></a>
+### {{.FullName}}
+{{if .Deprecated}}
+**Deprecated.**
+{{end}}
+{{- with .Description}}
+{{.}}
+{{end}}
+{{- template "options" .Options}}
+{{- end -}}
+
+# {{with .Package.Name}}Package ` + "`{{.}}`" + `{{else}}Default Package{{end}}
+
+Files:
+{{range .Package.Files}}
+- ` + "`{{.}}`" + `
+{{- end}}
+{{with .Package.Messages}}
+## Messages
+{{range .}}
+{{template "element" .}}
+{{- with .Fields}}
+| Field | Number | Label | Type | Description |
+| ----- | ------ | ----- | ---- | ----------- |
+{{range .}}| <a name="{{.Anchor}}"></a>` + "`{{.Name}}`" + ` | {{.Number}} | {{.Label}} | {{template "type" .Type}} | {{template "fieldNotes" .}} |
+{{end}}
+{{- end}}
+{{- with .Extensions}}
+Nested extensions:
+
+{{template "extensions" .}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- with .Package.Enums}}
+## Enums
+{{range .}}
+{{template "element" .}}
+| Name | Number | Description |
+| ---- | ------ | ----------- |
+{{range .Values}}| <a name="{{.Anchor}}"></a>` + "`{{.Name}}`" + ` | {{.Number}} | {{template "notes" .}} |
+{{end}}
+{{- end}}
+{{- end}}
+{{- with .Package.Extensions}}
+## Extensions
+
+{{template "extensions" .}}
+{{- end}}
+{{- with .Package.Services}}
+## Services
+{{range .}}
+{{template "element" .}}
+| Method | Request | Response | Description |
+| ------ | ------- | -------- | ----------- |
+{{range .Methods}}| <a name="{{.Anchor}}"></a>` + "`{{.Name}}`" + ` | {{if .ClientStreaming}}stream {{end}}{{template "type" .Request}} | {{if .ServerStreaming}}stream {{end}}{{template "type" .Response}} | {{template "notes" .}} |
+{{end}}
+{{- end}}
+{{- end -}}
+`
+
+const htmlTemplate = `{{define "type"}}{{with typeLink .}}<a href="{{.}}"><code>{{$.Name}}</code></a>{{else}}<code>{{.Name}}</code>{{end}}{{end -}}
+
+{{define "notes"}}{{if .Deprecated}}<strong>Deprecated.</strong> {{end}}<span class="description">{{.Description}}</span>
+{{- range .Options}} <code>{{.Name}} = {{.Value}}</code>{{end}}{{end -}}
+
+{{define "options"}}{{with .}}
+<p>Options:</p>
+<ul>
+{{- range .}}
+<li><code>{{.Name}} = {{.Value}}</code></li>
+{{- end}}
+</ul>{{end}}{{end -}}
+
+{{define "fieldNotes"}}{{template "notes" .}}
+{{- with .Default}} Default: <code>{{.}}</code>.{{end}}
+{{- with .Oneof}} Oneof: <code>{{.}}</code>.{{end}}{{end -}}
+
+{{define "extensions"}}
+<table>
+<tr><th>Extension</th><th>Extendee</th><th>Number</th><th>Label</th><th>Type</th><th>Description</th></tr>
+{{- range .}}
+<tr id="{{.Anchor}}"><td><code>{{.FullName}}</code></td><td>{{template "type" .Extendee}}</td><td>{{.Number}}</td><td>{{.Label}}</td><td>{{template "type" .Type}}</td><td>{{template "fieldNotes" .}}</td></tr>
+{{- end}}
+</table>{{end -}}
+
+{{define "element"}}
+<h3 id="{{.Anchor}}">{{.FullName}}</h3>
+{{- if .Deprecated}}
+<p><strong>Deprecated.</strong></p>
+{{- end}}
+{{- with .Description}}
+<p class="description">{{.}}</p>
+{{- end}}
+{{- template "options" .Options}}{{end -}}
+
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{with .Package.Name}}Package {{.}}{{else}}Default Package{{end}}</title>
+<style>
+.description { white-space: pre-line; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<nav>
+<ul>
+{{- range .Packages}}
+<li><a href="{{pageName .}}">{{with .Name}}{{.}}{{else}}(default){{end}}</a></li>
+{{- end}}
+</ul>
+</nav>
+<h1>{{with .Package.Name}}Package <code>{{.}}</code>{{else}}Default Package{{end}}</h1>
+<p>Files:</p>
+<ul>
+{{- range .Package.Files}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- with .Package.Messages}}
+<h2>Messages</h2>
+{{- range .}}
+{{template "element" .}}
+{{- with .Fields}}
+<table>
+<tr><th>Field</th><th>Number</th><th>Label</th><th>Type</th><th>Description</th></tr>
+{{- range .}}
+<tr id="{{.Anchor}}"><td><code>{{.Name}}</code></td><td>{{.Number}}</td><td>{{.Label}}</td><td>{{template "type" .Type}}</td><td>{{template "fieldNotes" .}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Extensions}}
+<p>Nested extensions:</p>
+{{- template "extensions" .}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- with .Package.Enums}}
+<h2>Enums</h2>
+{{- range .}}
+{{template "element" .}}
+<table>
+<tr><th>Name</th><th>Number</th><th>Description</th></tr>
+{{- range .Values}}
+<tr id="{{.Anchor}}"><td><code>{{.Name}}</code></td><td>{{.Number}}</td><td>{{template "notes" .}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- with .Package.Extensions}}
+<h2>Extensions</h2>
+{{- template "extensions" .}}
+{{- end}}
+{{- with .Package.Services}}
+<h2>Services</h2>
+{{- range .}}
+{{template "element" .}}
+<table>
+<tr><th>Method</th><th>Request</th><th>Response</th><th>Description</th></tr>
+{{- range .Methods}}
+<tr id="{{.Anchor}}"><td><code>{{.Name}}</code></td><td>{{if .ClientStreaming}}stream {{end}}{{template "type" .Request}}</td><td>{{if .ServerStreaming}}stream {{end}}{{template "type" .Response}}</td><td>{{template "notes" .}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
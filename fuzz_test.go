@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package protocompile
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jhump/protocompile/parser"
+)
+
+func FuzzCompile(f *testing.F) {
+	for _, seed := range []struct{ a, b string }{
+		{
+			`syntax = "proto3"; import "b.proto"; message A { B b = 1; map<string, B> m = 2; }`,
+			`syntax = "proto3"; message B { oneof x { string s = 1; int32 i = 2; } }`,
+		},
+		{
+			`syntax = "proto2"; import "b.proto"; import "google/protobuf/descriptor.proto"; extend google.protobuf.MessageOptions { optional B opt = 1000; } message A { option (opt) = { foo: 1 }; }`,
+			`syntax = "proto2"; message B { optional int32 foo = 1; extensions 100 to max; }`,
+		},
+		{
+			`syntax = "proto3"; package a; import public "b.proto"; service S { rpc M(b.B) returns (stream b.B); }`,
+			`syntax = "proto3"; package b; message B { reserved 2 to 5; reserved "foo"; enum E { E0 = 0; } }`,
+		},
+	} {
+		f.Add(seed.a, seed.b)
+	}
+	f.Fuzz(func(t *testing.T, a, b string) {
+		accessor := SourceAccessorFromMap(map[string]string{"a.proto": a, "b.proto": b})
+		for _, lenient := range []bool{false, true} {
+			compiler := Compiler{
+				Resolver:          WithStandardImports(&SourceResolver{Accessor: accessor}),
+				IncludeSourceInfo: true,
+				Lenient:           lenient,
+				Limits:            parser.Limits{MaxFileSize: 1 << 16, MaxNestingDepth: 64},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err := compiler.Compile(ctx, "a.proto")
+			cancel()
+			var panicErr PanicError
+			if errors.As(err, &panicErr) {
+				t.Fatalf("compiling panicked: %v\n%s", panicErr.Value, panicErr.Stack)
+			}
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+)
+
+// JsonNameConflict describes a conflict between the JSON names of two fields
+// in the same message.
+type JsonNameConflict struct {
+	// The field whose JSON name conflicts with that of an earlier field.
+	Field *descriptorpb.FieldDescriptorProto
+	// The earlier field, which uses the same JSON name.
+	Existing *descriptorpb.FieldDescriptorProto
+	// The conflicting JSON name.
+	Name string
+	// True if the JSON name of Field is a custom one, defined via the
+	// json_name option, instead of its default JSON name.
+	Custom bool
+	// True if the JSON name of Existing is a custom one.
+	ExistingCustom bool
+}
+
+// IsError returns true if the conflict should be reported as an error. Like
+// protoc, conflicts in proto3 files are always errors, as are conflicts
+// between two custom JSON names. Other conflicts in proto2 files are only
+// warnings.
+func (c *JsonNameConflict) IsError(isProto3 bool) bool {
+	return isProto3 || (c.Custom && c.ExistingCustom)
+}
+
+// Err returns an error that describes the conflict. The given scope is used
+// as a prefix for the message, and the given position, which is the location
+// of the existing field's JSON name, is included in the message.
+func (c *JsonNameConflict) Err(scope string, existingPos ast.SourcePos) error {
+	return fmt.Errorf("%s: %s JSON name %q of field %s conflicts with %s JSON name of field %s, defined at %v",
+		scope, jsonNameKind(c.Custom), c.Name, c.Field.GetName(), jsonNameKind(c.ExistingCustom), c.Existing.GetName(), existingPos)
+}
+
+func jsonNameKind(custom bool) string {
+	if custom {
+		return "custom"
+	}
+	return "default"
+}
+
+// JsonNameConflicts returns the conflicts between the JSON names of the fields
+// in the given message.
+//
+// If checkDefault is true, conflicts between the default JSON names of fields
+// are returned. If checkCustom is true, conflicts that involve at least one
+// custom JSON name are returned. Since custom names are defined via an option,
+// the latter can only be checked after options are interpreted.
+//
+// No conflicts are returned if the message enables the
+// deprecated_legacy_json_field_conflicts option.
+func JsonNameConflicts(md *descriptorpb.DescriptorProto, checkDefault, checkCustom bool) []JsonNameConflict {
+	if LegacyJsonFieldConflicts(md.GetOptions()) {
+		return nil
+	}
+	var conflicts []JsonNameConflict
+	if checkDefault {
+		conflicts = appendJsonNameConflicts(conflicts, md, false)
+	}
+	if checkCustom {
+		conflicts = appendJsonNameConflicts(conflicts, md, true)
+	}
+	return conflicts
+}
+
+func appendJsonNameConflicts(conflicts []JsonNameConflict, md *descriptorpb.DescriptorProto, useCustom bool) []JsonNameConflict {
+	type nameInfo struct {
+		fld    *descriptorpb.FieldDescriptorProto
+		custom bool
+	}
+	names := map[string]nameInfo{}
+	for _, fld := range md.GetField() {
+		name := JsonName(fld.GetName())
+		custom := false
+		if useCustom && fld.JsonName != nil && fld.GetJsonName() != name {
+			name = fld.GetJsonName()
+			custom = true
+		}
+		existing, ok := names[name]
+		if !ok {
+			names[name] = nameInfo{fld: fld, custom: custom}
+			continue
+		}
+		if useCustom && !custom && !existing.custom {
+			// conflicts between two default names are checked separately
+			continue
+		}
+		conflicts = append(conflicts, JsonNameConflict{
+			Field:          fld,
+			Existing:       existing.fld,
+			Name:           name,
+			Custom:         custom,
+			ExistingCustom: existing.custom,
+		})
+	}
+	return conflicts
+}
+
+// LegacyJsonFieldConflicts returns true if the given message options enable
+// the deprecated_legacy_json_field_conflicts option, which disables checks
+// for conflicts between the JSON names of fields.
+//
+// This can be used before options are interpreted, in which case the option
+// is found in the uninterpreted options. After options are interpreted, the
+// option is usually present as an unrecognized field.
+func LegacyJsonFieldConflicts(opts *descriptorpb.MessageOptions) bool {
+	if opts == nil {
+		return false
+	}
+	for _, uo := range opts.UninterpretedOption {
+		if len(uo.Name) == 1 && !uo.Name[0].GetIsExtension() &&
+			uo.Name[0].GetNamePart() == "deprecated_legacy_json_field_conflicts" {
+			return uo.GetIdentifierValue() == "true"
+		}
+	}
+	msg := opts.ProtoReflect()
+	if fld := msg.Descriptor().Fields().ByNumber(MessageOptions_deprecatedLegacyJsonFieldConflictsTag); fld != nil {
+		return msg.Get(fld).Bool()
+	}
+	var enabled bool
+	unknown := msg.GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+		if num == MessageOptions_deprecatedLegacyJsonFieldConflictsTag && typ == protowire.VarintType {
+			val, n := protowire.ConsumeVarint(unknown)
+			if n < 0 {
+				return false
+			}
+			// last value wins
+			enabled = val != 0
+		}
+		n = protowire.ConsumeFieldValue(num, typ, unknown)
+		if n < 0 {
+			return false
+		}
+		unknown = unknown[n:]
+	}
+	return enabled
+}
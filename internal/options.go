@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/jhump/protocompile/ast"
@@ -42,3 +44,20 @@ func RemoveOption(uo []*descriptorpb.UninterpretedOption, indexToRemove int) []*
 		return append(uo[:indexToRemove], uo[indexToRemove+1:]...)
 	}
 }
+
+// ResolveUnknownExtensions returns a copy of msg in which unrecognized fields
+// that are extensions known to res are instead extension fields. It works by
+// round-tripping the message through the binary format. This is the
+// implementation of linker.ResolveUnknownExtensions, which is here so that
+// packages that cannot import the linker can use it.
+func ResolveUnknownExtensions(msg proto.Message, res protoregistry.ExtensionTypeResolver) (proto.Message, error) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	resolved := msg.ProtoReflect().New().Interface()
+	if err := (proto.UnmarshalOptions{Resolver: res}).Unmarshal(data, resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
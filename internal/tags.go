@@ -26,6 +26,9 @@ const (
 	// anywhere. The only places they appear in generated code are struct tags
 	// on fields of the generated descriptor protos.
 
+	// File_nameTag is the tag number of the name element in a file
+	// descriptor proto.
+	File_nameTag = 1
 	// File_packageTag is the tag number of the package element in a file
 	// descriptor proto.
 	File_packageTag = 2
@@ -47,6 +50,12 @@ const (
 	// File_optionsTag is the tag number of the options element in a file
 	// descriptor proto.
 	File_optionsTag = 8
+	// File_publicDependencyTag is the tag number of the public dependency
+	// element in a file descriptor proto.
+	File_publicDependencyTag = 10
+	// File_weakDependencyTag is the tag number of the weak dependency element
+	// in a file descriptor proto.
+	File_weakDependencyTag = 11
 	// File_syntaxTag is the tag number of the syntax element in a file
 	// descriptor proto.
 	File_syntaxTag = 12
@@ -119,6 +128,9 @@ const (
 	// Field_optionsTag is the tag number of the options element in a field
 	// descriptor proto.
 	Field_optionsTag = 8
+	// Field_oneofIndexTag is the tag number of the one-of index element in a
+	// field descriptor proto.
+	Field_oneofIndexTag = 9
 	// Field_jsonNameTag is the tag number of the JSON name element in a field
 	// descriptor proto.
 	Field_jsonNameTag = 10
@@ -212,4 +224,48 @@ const (
 	// UninterpretedName_nameTag is the tag number of the name element in an
 	// uninterpreted option name proto.
 	UninterpretedName_nameTag = 1
+
+	// FileOptions_javaOuterClassnameTag is the tag number of the
+	// java_outer_classname element in a file options proto.
+	FileOptions_javaOuterClassnameTag = 8
+	// FileOptions_optimizeForTag is the tag number of the optimize_for element
+	// in a file options proto.
+	FileOptions_optimizeForTag = 9
+	// FileOptions_javaMultipleFilesTag is the tag number of the
+	// java_multiple_files element in a file options proto.
+	FileOptions_javaMultipleFilesTag = 10
+	// MessageOptions_deprecatedLegacyJsonFieldConflictsTag is the tag number
+	// of the deprecated_legacy_json_field_conflicts element in a message
+	// options proto.
+	MessageOptions_deprecatedLegacyJsonFieldConflictsTag = 11
+	// ExtensionRangeOptions_declarationTag is the tag number of the
+	// declaration element in an extension range options proto.
+	ExtensionRangeOptions_declarationTag = 2
+	// ExtensionRangeOptions_verificationTag is the tag number of the
+	// verification element in an extension range options proto.
+	ExtensionRangeOptions_verificationTag = 3
+	// ExtensionDeclaration_numberTag is the tag number of the number element
+	// in an extension declaration proto.
+	ExtensionDeclaration_numberTag = 1
+	// ExtensionDeclaration_fullNameTag is the tag number of the full name
+	// element in an extension declaration proto.
+	ExtensionDeclaration_fullNameTag = 2
+	// ExtensionDeclaration_typeTag is the tag number of the type element in
+	// an extension declaration proto.
+	ExtensionDeclaration_typeTag = 3
+	// ExtensionDeclaration_reservedTag is the tag number of the reserved
+	// element in an extension declaration proto.
+	ExtensionDeclaration_reservedTag = 5
+	// ExtensionDeclaration_repeatedTag is the tag number of the repeated
+	// element in an extension declaration proto.
+	ExtensionDeclaration_repeatedTag = 6
+	// FieldOptions_ctypeTag is the tag number of the ctype element in a field
+	// options proto.
+	FieldOptions_ctypeTag = 1
+	// FieldOptions_packedTag is the tag number of the packed element in a
+	// field options proto.
+	FieldOptions_packedTag = 2
+	// FieldOptions_lazyTag is the tag number of the lazy element in a field
+	// options proto.
+	FieldOptions_lazyTag = 5
 )
@@ -0,0 +1,190 @@
+package linker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Digest is a SHA-256 hash of the canonical bytes of one or more files. It
+// is comparable, so it can be used as a map key.
+type Digest [sha256.Size]byte
+
+// String returns the digest as a hex-encoded string.
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// CanonicalBytes returns a canonical binary encoding of the given file's
+// descriptor. Two files that describe the same schema will have identical
+// canonical bytes, even if the options in their sources were declared in a
+// different order. This makes the result suitable for hashing (see
+// FileDigest), so that build caches and schema registries can deduplicate
+// identical schemas.
+//
+// The encoding is that of a google.protobuf.FileDescriptorProto, with the
+// following normalization:
+//  1. Source code info is omitted, since it describes the source file and
+//     not the schema.
+//  2. Custom options are resolved using the file's transitive dependencies,
+//     so they are encoded as known extension fields instead of as unknown
+//     fields.
+//  3. Fields are encoded in a fixed order: first extensions, then known
+//     fields, and then any remaining unrecognized fields, each group in
+//     field number order. (So fields are not in field number order overall,
+//     since an extension is encoded before any known field.) The relative
+//     order of values for the same field is preserved, since it is
+//     significant for repeated fields. Map entries are encoded in key order.
+//
+// Elements like messages, fields, and enum values are NOT re-ordered, since
+// their order is visible in the resulting descriptors, such as via the
+// Index() method of protoreflect.Descriptor.
+func CanonicalBytes(f File) ([]byte, error) {
+	fd := toFileDescriptorProto(f)
+	fd = proto.Clone(fd).(*descriptorpb.FileDescriptorProto)
+	fd.SourceCodeInfo = nil
+
+	// Resolve any custom options stored as unknown fields, so that they are
+	// encoded as extensions.
+	resolved, err := ResolveUnknownExtensions(fd, transitiveClosure(f).AsResolver())
+	if err != nil {
+		return nil, err
+	}
+	fd = resolved.(*descriptorpb.FileDescriptorProto)
+	sortUnknownFields(fd.ProtoReflect())
+	return proto.MarshalOptions{Deterministic: true}.Marshal(fd)
+}
+
+// FileDigest returns a digest of the canonical bytes of the given file. It
+// only considers the contents of the given file, not its dependencies, so
+// two files with the same digest could still have different schemas if they
+// import different versions of a dependency. Use TransitiveDigest to account
+// for the contents of dependencies.
+func FileDigest(f File) (Digest, error) {
+	data, err := CanonicalBytes(f)
+	if err != nil {
+		return Digest{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// TransitiveDigest returns a digest of the given file and all of its
+// transitive dependencies. Two files with the same transitive digest
+// describe identical schemas, including all of the types they reference.
+//
+// The result does not depend on the order in which the file's dependencies
+// are imported or visited, other than the order of the given file's direct
+// imports, which is part of its canonical bytes.
+func TransitiveDigest(f File) (Digest, error) {
+	files := transitiveClosure(f)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path() < files[j].Path()
+	})
+	h := sha256.New()
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, file := range files {
+		digest, err := FileDigest(file)
+		if err != nil {
+			return Digest{}, err
+		}
+		// length-prefix the path so that the encoding is unambiguous
+		n := binary.PutUvarint(lenBuf[:], uint64(len(file.Path())))
+		_, _ = h.Write(lenBuf[:n])
+		_, _ = h.Write([]byte(file.Path()))
+		_, _ = h.Write(digest[:])
+	}
+	var result Digest
+	h.Sum(result[:0])
+	return result, nil
+}
+
+func toFileDescriptorProto(f File) *descriptorpb.FileDescriptorProto {
+	if res, ok := f.(Result); ok {
+		return res.Proto()
+	}
+	return protodesc.ToFileDescriptorProto(f)
+}
+
+// transitiveClosure returns the given file and all of its transitive
+// dependencies. The given file is first, followed by its dependencies in
+// the order they are encountered in a depth-first traversal of imports.
+func transitiveClosure(f File) Files {
+	var files Files
+	seen := map[string]struct{}{}
+	var add func(File)
+	add = func(f File) {
+		if _, ok := seen[f.Path()]; ok {
+			return
+		}
+		seen[f.Path()] = struct{}{}
+		files = append(files, f)
+		for _, dep := range f.importsAsFiles() {
+			if dep != nil {
+				add(dep)
+			}
+		}
+	}
+	add(f)
+	return files
+}
+
+// sortUnknownFields recursively sorts the unrecognized fields in the given
+// message by field number. The sort is stable, so that multiple values for
+// the same field remain in the same relative order.
+func sortUnknownFields(msg protoreflect.Message) {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					sortUnknownFields(v.Message())
+					return true
+				})
+			}
+		case fd.Message() == nil:
+			// not a message, nothing to do
+		case fd.IsList():
+			l := v.List()
+			for i := 0; i < l.Len(); i++ {
+				sortUnknownFields(l.Get(i).Message())
+			}
+		default:
+			sortUnknownFields(v.Message())
+		}
+		return true
+	})
+
+	unknown := msg.GetUnknown()
+	if len(unknown) == 0 {
+		return
+	}
+	type unknownField struct {
+		num  protowire.Number
+		data []byte
+	}
+	var fields []unknownField
+	for len(unknown) > 0 {
+		num, _, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			// malformed data; leave it as is
+			return
+		}
+		fields = append(fields, unknownField{num: num, data: unknown[:n]})
+		unknown = unknown[n:]
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].num < fields[j].num
+	})
+	sorted := make([]byte, 0, len(msg.GetUnknown()))
+	for _, fld := range fields {
+		sorted = append(sorted, fld.data...)
+	}
+	msg.SetUnknown(sorted)
+}
@@ -0,0 +1,195 @@
+package linker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/linker"
+)
+
+const canonicalOptionsSource = `
+syntax = "proto2";
+package foo;
+import "google/protobuf/descriptor.proto";
+message Opts {
+  optional string name = 1;
+  repeated int32 ids = 2;
+  map<string, int32> m = 3;
+}
+extend google.protobuf.MessageOptions {
+  optional Opts opts = 10101;
+  repeated string tags = 10102;
+  optional int32 num = 10103;
+}
+`
+
+func compileForDigest(t *testing.T, sources map[string]string) linker.File {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+		IncludeSourceInfo: true,
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	return fds[0]
+}
+
+func TestCanonicalBytes(t *testing.T) {
+	base := compileForDigest(t, map[string]string{
+		"opts.proto": canonicalOptionsSource,
+		"test.proto": `
+syntax = "proto2";
+import "opts.proto";
+message Foo {
+  option (foo.num) = 123;
+  option (foo.tags) = "abc";
+  option deprecated = true;
+  option (foo.opts) = { name: "foo" ids: [1, 2] m: [ { key: "a" value: 1 }, { key: "b" value: 2 } ] };
+  option (foo.tags) = "def";
+}
+`,
+	})
+	testCases := []struct {
+		name   string
+		source string
+		same   bool
+	}{
+		{
+			name: "options re-ordered",
+			source: `
+syntax = "proto2";
+import "opts.proto";
+// comments and whitespace don't matter
+message Foo {
+  option (foo.tags) = "abc";
+  option (foo.opts).m = { key: "b" value: 2 };
+  option (foo.opts).ids = 1;
+  option (foo.tags) = "def";
+  option (foo.opts).m = { key: "a" value: 1 };
+  option deprecated = true;
+  option (foo.opts).name = "foo";
+  option (foo.opts).ids = 2;
+  option (foo.num) = 123;
+}
+`,
+			same: true,
+		},
+		{
+			name: "repeated values re-ordered",
+			source: `
+syntax = "proto2";
+import "opts.proto";
+message Foo {
+  option (foo.num) = 123;
+  option (foo.tags) = "def";
+  option deprecated = true;
+  option (foo.opts) = { name: "foo" ids: [1, 2] m: [ { key: "a" value: 1 }, { key: "b" value: 2 } ] };
+  option (foo.tags) = "abc";
+}
+`,
+		},
+		{
+			name: "option value changed",
+			source: `
+syntax = "proto2";
+import "opts.proto";
+message Foo {
+  option (foo.num) = 124;
+  option (foo.tags) = "abc";
+  option deprecated = true;
+  option (foo.opts) = { name: "foo" ids: [1, 2] m: [ { key: "a" value: 1 }, { key: "b" value: 2 } ] };
+  option (foo.tags) = "def";
+}
+`,
+		},
+	}
+	baseBytes, err := linker.CanonicalBytes(base)
+	require.NoError(t, err)
+	baseDigest, err := linker.FileDigest(base)
+	require.NoError(t, err)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := compileForDigest(t, map[string]string{
+				"opts.proto": canonicalOptionsSource,
+				"test.proto": tc.source,
+			})
+			data, err := linker.CanonicalBytes(file)
+			require.NoError(t, err)
+			digest, err := linker.FileDigest(file)
+			require.NoError(t, err)
+			if tc.same {
+				assert.Equal(t, baseBytes, data)
+				assert.Equal(t, baseDigest, digest)
+			} else {
+				assert.NotEqual(t, baseBytes, data)
+				assert.NotEqual(t, baseDigest, digest)
+			}
+		})
+	}
+
+	// canonical bytes omit source code info and can be unmarshalled
+	var fd descriptorpb.FileDescriptorProto
+	require.NoError(t, proto.Unmarshal(baseBytes, &fd))
+	assert.Nil(t, fd.SourceCodeInfo)
+	assert.Equal(t, "test.proto", fd.GetName())
+
+	// a file that isn't the result of compiling has the same canonical bytes
+	rebuilt, err := linker.NewFileRecursive(base)
+	require.NoError(t, err)
+	fdFromProto, err := protodesc.NewFile(protodesc.ToFileDescriptorProto(base), linker.ResolverFromFile(rebuilt))
+	require.NoError(t, err)
+	otherFile, err := linker.NewFile(fdFromProto, linker.Files{base.FindImportByPath("opts.proto")})
+	require.NoError(t, err)
+	otherBytes, err := linker.CanonicalBytes(otherFile)
+	require.NoError(t, err)
+	assert.Equal(t, baseBytes, otherBytes)
+}
+
+func TestTransitiveDigest(t *testing.T) {
+	source := `
+syntax = "proto2";
+import "opts.proto";
+message Foo {
+  option (foo.num) = 123;
+}
+`
+	file := compileForDigest(t, map[string]string{
+		"opts.proto": canonicalOptionsSource,
+		"test.proto": source,
+	})
+	fileDigest, err := linker.FileDigest(file)
+	require.NoError(t, err)
+	transitiveDigest, err := linker.TransitiveDigest(file)
+	require.NoError(t, err)
+	assert.NotEqual(t, fileDigest, transitiveDigest)
+	assert.Len(t, transitiveDigest.String(), 64)
+
+	// changing a dependency changes the transitive digest, but not the file digest
+	file2 := compileForDigest(t, map[string]string{
+		"opts.proto": canonicalOptionsSource + "message Other {}\n",
+		"test.proto": source,
+	})
+	fileDigest2, err := linker.FileDigest(file2)
+	require.NoError(t, err)
+	transitiveDigest2, err := linker.TransitiveDigest(file2)
+	require.NoError(t, err)
+	assert.Equal(t, fileDigest, fileDigest2)
+	assert.NotEqual(t, transitiveDigest, transitiveDigest2)
+
+	// compiling again gives the same results
+	file3 := compileForDigest(t, map[string]string{
+		"opts.proto": canonicalOptionsSource,
+		"test.proto": source,
+	})
+	transitiveDigest3, err := linker.TransitiveDigest(file3)
+	require.NoError(t, err)
+	assert.Equal(t, transitiveDigest, transitiveDigest3)
+}
@@ -0,0 +1,256 @@
+package linker
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// Values of the google.protobuf.ExtensionRangeOptions.VerificationState enum.
+const (
+	verificationDeclaration = 0
+	verificationUnverified  = 1
+)
+
+// extensionDeclaration is a declaration of an extension that is allowed to
+// use a number in an extension range.
+type extensionDeclaration struct {
+	number   int32
+	fullName string
+	typ      string
+	reserved bool
+	repeated bool
+}
+
+// extensionRangeDeclarations describes the extension declarations and the
+// verification state for an extension range.
+type extensionRangeDeclarations struct {
+	declarations    []extensionDeclaration
+	verification    int32
+	hasVerification bool
+}
+
+// verified returns true if extensions in the range must match a declaration.
+// This is the case if the range has any declarations or if its verification
+// state is explicitly DECLARATION.
+func (d *extensionRangeDeclarations) verified() bool {
+	return len(d.declarations) > 0 || (d.hasVerification && d.verification == verificationDeclaration)
+}
+
+func (d *extensionRangeDeclarations) find(number protoreflect.FieldNumber) *extensionDeclaration {
+	for i := range d.declarations {
+		if d.declarations[i].number == int32(number) {
+			return &d.declarations[i]
+		}
+	}
+	return nil
+}
+
+// getExtensionRangeDeclarations returns the extension declarations in the
+// given extension range options.
+//
+// When present, the declaration and verification fields are usually
+// unrecognized fields, so this examines the options in binary form.
+func getExtensionRangeDeclarations(opts protoreflect.ProtoMessage) extensionRangeDeclarations {
+	var result extensionRangeDeclarations
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return result
+	}
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return result
+	}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return result
+		}
+		data = data[n:]
+		switch {
+		case num == internal.ExtensionRangeOptions_declarationTag && typ == protowire.BytesType:
+			val, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return result
+			}
+			result.declarations = append(result.declarations, parseExtensionDeclaration(val))
+		case num == internal.ExtensionRangeOptions_verificationTag && typ == protowire.VarintType:
+			val, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return result
+			}
+			result.verification = int32(val)
+			result.hasVerification = true
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return result
+		}
+		data = data[n:]
+	}
+	return result
+}
+
+func parseExtensionDeclaration(data []byte) extensionDeclaration {
+	var decl extensionDeclaration
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return decl
+		}
+		data = data[n:]
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return decl
+		}
+		val := data[:n]
+		data = data[n:]
+		switch {
+		case typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(val)
+			switch num {
+			case internal.ExtensionDeclaration_numberTag:
+				decl.number = int32(v)
+			case internal.ExtensionDeclaration_reservedTag:
+				decl.reserved = v != 0
+			case internal.ExtensionDeclaration_repeatedTag:
+				decl.repeated = v != 0
+			}
+		case typ == protowire.BytesType:
+			v, _ := protowire.ConsumeBytes(val)
+			switch num {
+			case internal.ExtensionDeclaration_fullNameTag:
+				decl.fullName = string(v)
+			case internal.ExtensionDeclaration_typeTag:
+				decl.typ = string(v)
+			}
+		}
+	}
+	return decl
+}
+
+// validateExtensionDeclarations checks that the extension declarations in
+// the extension ranges of the given message are valid.
+func (r *result) validateExtensionDeclarations(md *msgDescriptor, handler *reporter.Handler) error {
+	file := r.FileNode()
+	names := map[string]struct{}{}
+	for _, er := range md.proto.ExtensionRange {
+		decls := getExtensionRangeDeclarations(er.Options)
+		if !decls.verified() {
+			continue
+		}
+		pos := file.NodeInfo(r.ExtensionRangeNode(er)).Start()
+		if len(decls.declarations) > 0 && decls.hasVerification && decls.verification == verificationUnverified {
+			if err := handler.HandleErrorf(pos, "message %s: cannot mark the extension range as UNVERIFIED when it has extension declarations", md.FullName()); err != nil {
+				return err
+			}
+		}
+		numbers := map[int32]struct{}{}
+		for _, decl := range decls.declarations {
+			if decl.number < er.GetStart() || decl.number >= er.GetEnd() {
+				if err := handler.HandleErrorf(pos, "message %s: extension declaration number %d is not in the extension range %d to %d", md.FullName(), decl.number, er.GetStart(), er.GetEnd()-1); err != nil {
+					return err
+				}
+			}
+			if _, ok := numbers[decl.number]; ok {
+				if err := handler.HandleErrorf(pos, "message %s: extension declaration number %d is declared multiple times", md.FullName(), decl.number); err != nil {
+					return err
+				}
+			}
+			numbers[decl.number] = struct{}{}
+			if decl.fullName != "" {
+				if !strings.HasPrefix(decl.fullName, ".") {
+					if err := handler.HandleErrorf(pos, "message %s: extension declaration full name %q must be fully-qualified, with a leading dot", md.FullName(), decl.fullName); err != nil {
+						return err
+					}
+				}
+				if _, ok := names[decl.fullName]; ok {
+					if err := handler.HandleErrorf(pos, "message %s: extension declaration full name %q is declared multiple times", md.FullName(), decl.fullName); err != nil {
+						return err
+					}
+				}
+				names[decl.fullName] = struct{}{}
+			}
+			if !decl.reserved && (decl.fullName == "" || decl.typ == "") {
+				if err := handler.HandleErrorf(pos, "message %s: extension declaration for number %d must have both full_name and type set unless it is reserved", md.FullName(), decl.number); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkExtensionDeclaration checks that the given extension matches the
+// declaration for its number in the extendee's extension range, if the range
+// requires extensions to be declared.
+func (r *result) checkExtensionDeclaration(fd *fldDescriptor, handler *reporter.Handler) error {
+	extendee := fd.ContainingMessage()
+	ranges := extendee.ExtensionRanges()
+	var decls extensionRangeDeclarations
+	found := false
+	for i := 0; i < ranges.Len(); i++ {
+		rng := ranges.Get(i)
+		if fd.Number() >= rng[0] && fd.Number() < rng[1] {
+			decls = getExtensionRangeDeclarations(extendee.ExtensionRangeOptions(i))
+			found = true
+			break
+		}
+	}
+	if !found || !decls.verified() {
+		return nil
+	}
+
+	file := r.FileNode()
+	node := r.FieldNode(fd.proto)
+	decl := decls.find(fd.Number())
+	if decl == nil {
+		pos := file.NodeInfo(node.FieldTag()).Start()
+		return handler.HandleErrorf(pos, "extension %s: number %d is not declared in the extension range of message %s, which requires extension declarations", fd.FullName(), fd.Number(), extendee.FullName())
+	}
+	if decl.reserved {
+		pos := file.NodeInfo(node.FieldTag()).Start()
+		return handler.HandleErrorf(pos, "extension %s: cannot use number %d because it is reserved in the extension declarations of message %s", fd.FullName(), fd.Number(), extendee.FullName())
+	}
+	if name := "." + string(fd.FullName()); decl.fullName != name {
+		pos := file.NodeInfo(node.FieldName()).Start()
+		return handler.HandleErrorf(pos, "extension %s: expected extension with number %d to be named %s, per its declaration in message %s", fd.FullName(), fd.Number(), strings.TrimPrefix(decl.fullName, "."), extendee.FullName())
+	}
+	if typ := declarationType(fd); decl.typ != typ {
+		pos := file.NodeInfo(node.FieldType()).Start()
+		return handler.HandleErrorf(pos, "extension %s: expected type %s, per its declaration in message %s, not %s", fd.FullName(), strings.TrimPrefix(decl.typ, "."), extendee.FullName(), strings.TrimPrefix(typ, "."))
+	}
+	if repeated := fd.Cardinality() == protoreflect.Repeated; decl.repeated != repeated {
+		var pos ast.SourcePos
+		if label := node.FieldLabel(); label != nil {
+			pos = file.NodeInfo(label).Start()
+		} else {
+			pos = file.NodeInfo(node.FieldType()).Start()
+		}
+		expected := "not be repeated"
+		if decl.repeated {
+			expected = "be repeated"
+		}
+		return handler.HandleErrorf(pos, "extension %s: expected to %s, per its declaration in message %s", fd.FullName(), expected, extendee.FullName())
+	}
+	return nil
+}
+
+// declarationType returns the type of the given field in the form used in an
+// extension declaration: the name of a scalar type or the fully-qualified
+// name, with a leading dot, of a message or enum type.
+func declarationType(fld protoreflect.FieldDescriptor) string {
+	switch fld.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "." + string(fld.Message().FullName())
+	case protoreflect.EnumKind:
+		return "." + string(fld.Enum().FullName())
+	default:
+		return fld.Kind().String()
+	}
+}
@@ -964,7 +964,15 @@ func (f *fldDescriptor) IsExtension() bool {
 }
 
 func (f *fldDescriptor) HasOptionalKeyword() bool {
-	return f.proto.Label != nil && f.proto.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if f.proto.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL {
+		return false
+	}
+	if f.proto.GetProto3Optional() {
+		return true
+	}
+	// in proto2, the keyword is present for all optional fields except those
+	// in a oneof
+	return f.file.Syntax() == protoreflect.Proto2 && f.proto.OneofIndex == nil
 }
 
 func (f *fldDescriptor) IsWeak() bool {
@@ -1041,7 +1049,12 @@ func (f *fldDescriptor) Default() protoreflect.Value {
 	case protoreflect.StringKind:
 		return protoreflect.ValueOfString("")
 	case protoreflect.EnumKind:
-		return protoreflect.ValueOfEnum(f.Enum().Values().Get(0).Number())
+		vals := f.Enum().Values()
+		if vals.Len() == 0 {
+			// placeholder enum
+			return protoreflect.ValueOfEnum(0)
+		}
+		return protoreflect.ValueOfEnum(vals.Get(0).Number())
 	case protoreflect.GroupKind, protoreflect.MessageKind:
 		return protoreflect.ValueOfMessage(dynamicpb.NewMessage(f.Message()))
 	default:
@@ -1051,7 +1064,7 @@ func (f *fldDescriptor) Default() protoreflect.Value {
 
 func (f *fldDescriptor) DefaultEnumValue() protoreflect.EnumValueDescriptor {
 	ed := f.Enum()
-	if ed == nil {
+	if ed == nil || ed.Values().Len() == 0 {
 		return nil
 	}
 	return ed.Values().Get(0)
@@ -1075,14 +1088,14 @@ func (f *fldDescriptor) ContainingMessage() protoreflect.MessageDescriptor {
 	if !f.IsExtension() {
 		return f.parent.(*msgDescriptor)
 	}
-	return f.file.ResolveMessageType(protoreflect.FullName(f.proto.GetExtendee()))
+	return f.file.resolveMessageOrPlaceholder(f.proto.GetExtendee())
 }
 
 func (f *fldDescriptor) Enum() protoreflect.EnumDescriptor {
 	if f.proto.GetType() != descriptorpb.FieldDescriptorProto_TYPE_ENUM {
 		return nil
 	}
-	return f.file.ResolveEnumType(protoreflect.FullName(f.proto.GetTypeName()))
+	return f.file.resolveEnumOrPlaceholder(f.proto.GetTypeName())
 }
 
 func (f *fldDescriptor) Message() protoreflect.MessageDescriptor {
@@ -1090,7 +1103,7 @@ func (f *fldDescriptor) Message() protoreflect.MessageDescriptor {
 		f.proto.GetType() != descriptorpb.FieldDescriptorProto_TYPE_GROUP {
 		return nil
 	}
-	return f.file.ResolveMessageType(protoreflect.FullName(f.proto.GetTypeName()))
+	return f.file.resolveMessageOrPlaceholder(f.proto.GetTypeName())
 }
 
 func (f *fldDescriptor) AddOptionBytes(opts []byte) {
@@ -1178,7 +1191,13 @@ func (o *oneofDescriptor) Options() protoreflect.ProtoMessage {
 }
 
 func (o *oneofDescriptor) IsSynthetic() bool {
-	// TODO
+	// a synthetic oneof is generated for a proto3 optional field and contains
+	// only that field
+	for _, fld := range o.parent.proto.GetField() {
+		if fld.OneofIndex != nil && int(fld.GetOneofIndex()) == o.index {
+			return fld.GetProto3Optional()
+		}
+	}
 	return false
 }
 
@@ -1363,11 +1382,11 @@ func (m *mtdDescriptor) Options() protoreflect.ProtoMessage {
 }
 
 func (m *mtdDescriptor) Input() protoreflect.MessageDescriptor {
-	return m.file.ResolveMessageType(protoreflect.FullName(m.proto.GetInputType()))
+	return m.file.resolveMessageOrPlaceholder(m.proto.GetInputType())
 }
 
 func (m *mtdDescriptor) Output() protoreflect.MessageDescriptor {
-	return m.file.ResolveMessageType(protoreflect.FullName(m.proto.GetOutputType()))
+	return m.file.resolveMessageOrPlaceholder(m.proto.GetOutputType())
 }
 
 func (m *mtdDescriptor) IsStreamingClient() bool {
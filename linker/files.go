@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"strings"
 
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
 
+	"github.com/jhump/protocompile/internal"
 	"github.com/jhump/protocompile/walk"
 )
 
@@ -188,6 +190,19 @@ func ResolverFromFile(f File) Resolver {
 	}
 }
 
+// ResolveUnknownExtensions returns a copy of the given message in which
+// unrecognized fields that are extensions known to the given resolver are
+// instead extension fields. This applies to nested messages, too. Custom
+// options are usually stored as unrecognized fields, since the options
+// messages are compiled into this module without knowledge of the custom
+// options' extensions. So this can be used to examine their values.
+//
+// This works by round-tripping the message through the binary format. The
+// given message is not modified.
+func ResolveUnknownExtensions(msg proto.Message, res protoregistry.ExtensionTypeResolver) (proto.Message, error) {
+	return internal.ResolveUnknownExtensions(msg, res)
+}
+
 type fileResolver struct {
 	f    File
 	deps Resolver
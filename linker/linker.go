@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"context"
 	"fmt"
 
 	"google.golang.org/protobuf/proto"
@@ -26,6 +27,14 @@ import (
 // Note that linking does NOT interpret options. So options messages in the
 // returned value have all values stored in UninterpretedOptions fields.
 func Link(parsed parser.Result, dependencies Files, symbols *Symbols, handler *reporter.Handler) (Result, error) {
+	return LinkWithContext(context.Background(), parsed, dependencies, symbols, handler)
+}
+
+// LinkWithContext is like Link, except that it stops early if the given
+// context is cancelled. The context is checked before each element of the
+// file is linked. If it is cancelled, the context's error is returned (it
+// is not reported to the handler) along with a nil result.
+func LinkWithContext(ctx context.Context, parsed parser.Result, dependencies Files, symbols *Symbols, handler *reporter.Handler) (Result, error) {
 	if symbols == nil {
 		symbols = &Symbols{}
 	}
@@ -66,7 +75,7 @@ func Link(parsed parser.Result, dependencies Files, symbols *Symbols, handler *r
 	// message references since we don't actually know message or enum until
 	// link time), and references will be re-written to be fully-qualified
 	// references (e.g. start with a dot ".").
-	if err := r.resolveReferences(handler, symbols); err != nil {
+	if err := r.resolveReferences(ctx, handler, symbols); err != nil {
 		return nil, err
 	}
 
@@ -103,9 +112,18 @@ type Result interface {
 	// or if the named element is not an extension, nil is returned.
 	ResolveExtension(protoreflect.FullName) protoreflect.ExtensionTypeDescriptor
 	// ValidateExtensions runs some validation checks on extensions that can only
-	// be done after files are linked and options are interpreted. Any errors or
-	// warnings encountered will be reported via the given handler. If any error
-	// is reported, this function returns a non-nil error.
+	// be done after files are linked and options are interpreted, such as
+	// checking that extensions match the extension declarations of the ranges
+	// they extend. Any errors or warnings encountered will be reported via the
+	// given handler. If any error is reported, this function returns a non-nil
+	// error.
+	//
+	// Extension declarations are defined by the "declaration" and
+	// "verification" fields of google.protobuf.ExtensionRangeOptions. These
+	// fields are not in the version of google/protobuf/descriptor.proto that
+	// is compiled into this module, so declarations can only be used (and
+	// are only checked) when the file that declares the extension range
+	// imports a newer version of descriptor.proto.
 	ValidateExtensions(handler *reporter.Handler) error
 	// CheckForUnusedImports is used to report warnings for unused imports. This
 	// should be called after options have been interpreted. Otherwise, the logic
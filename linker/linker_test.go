@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
@@ -23,6 +24,8 @@ import (
 	"github.com/jhump/protocompile"
 	_ "github.com/jhump/protocompile/internal/testprotos"
 	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
 )
 
 func TestSimpleLink(t *testing.T) {
@@ -71,6 +74,31 @@ func TestMultiFileLink(t *testing.T) {
 	}
 }
 
+func TestLinkWithContext(t *testing.T) {
+	h := reporter.NewHandler(nil)
+	fileNode, err := parser.Parse("test.proto", strings.NewReader(`
+syntax = "proto3";
+message Foo {
+  Bar bar = 1;
+}
+message Bar {}`), h)
+	require.NoError(t, err)
+	parsed, err := parser.ResultFromAST(fileNode, true, h)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := linker.LinkWithContext(ctx, parsed, nil, nil, h)
+	assert.Nil(t, res)
+	assert.Equal(t, context.Canceled, err)
+	// the cancellation is not reported as an error in the file
+	assert.NoError(t, h.Error())
+
+	res, err = linker.LinkWithContext(context.Background(), parsed, nil, nil, h)
+	require.NoError(t, err)
+	assert.Equal(t, ".Bar", res.Proto().MessageType[0].Field[0].GetTypeName())
+}
+
 func TestProto3Optional(t *testing.T) {
 	compiler := protocompile.Compiler{
 		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
@@ -88,6 +116,180 @@ func TestProto3Optional(t *testing.T) {
 	checkFiles(t, res, (*fdsProtoSet)(fdset), map[string]struct{}{})
 }
 
+func TestOptionalKeywordAndSyntheticOneofs(t *testing.T) {
+	files := map[string]string{
+		"proto2.proto": `
+			syntax = "proto2";
+			package foo;
+			message Foo {
+			  optional string a = 1;
+			  required string b = 2;
+			  repeated string c = 3;
+			  oneof d {
+			    string e = 4;
+			  }
+			  extensions 100 to 200;
+			}
+			extend Foo {
+			  optional string f = 100;
+			}`,
+		"proto3.proto": `
+			syntax = "proto3";
+			package bar;
+			message Bar {
+			  optional string a = 1;
+			  string b = 2;
+			  repeated string c = 3;
+			  oneof d {
+			    string e = 4;
+			  }
+			  optional string f = 5;
+			}`,
+	}
+	compiler := protocompile.Compiler{
+		Resolver: &protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		},
+	}
+	fds, err := compiler.Compile(context.Background(), "proto2.proto", "proto3.proto")
+	require.NoError(t, err)
+	for _, fd := range fds {
+		// descriptors created by protodesc are the reference implementation
+		expFd, err := protodesc.NewFile(fd.(linker.Result).Proto(), nil)
+		require.NoError(t, err)
+		type fields interface {
+			Len() int
+			Get(int) protoreflect.FieldDescriptor
+		}
+		checkFields := func(act, exp fields) {
+			for i := 0; i < exp.Len(); i++ {
+				assert.Equal(t, exp.Get(i).HasOptionalKeyword(), act.Get(i).HasOptionalKeyword(), "%s: HasOptionalKeyword", exp.Get(i).FullName())
+			}
+		}
+		checkFields(fd.Extensions(), expFd.Extensions())
+		for i := 0; i < expFd.Messages().Len(); i++ {
+			exp, act := expFd.Messages().Get(i), fd.Messages().Get(i)
+			checkFields(act.Fields(), exp.Fields())
+			for j := 0; j < exp.Oneofs().Len(); j++ {
+				assert.Equal(t, exp.Oneofs().Get(j).IsSynthetic(), act.Oneofs().Get(j).IsSynthetic(), "%s: IsSynthetic", exp.Oneofs().Get(j).FullName())
+			}
+		}
+	}
+	// sanity check that both kinds of results are covered
+	bar := fds[1].Messages().Get(0)
+	assert.True(t, bar.Fields().ByName("a").HasOptionalKeyword())
+	assert.False(t, bar.Fields().ByName("b").HasOptionalKeyword())
+	assert.True(t, bar.Oneofs().ByName("_a").IsSynthetic())
+	assert.False(t, bar.Oneofs().ByName("d").IsSynthetic())
+}
+
+func TestExtensionDeclarationsWithStandardImports(t *testing.T) {
+	const base = `
+		syntax = "proto2";
+		package foo;
+		import "google/protobuf/descriptor.proto";
+		message Base {
+		  extensions 100 to 199 [
+		    declaration = { number: 100 full_name: ".bar.name" type: "string" }
+		  ];
+		}`
+	const source = `
+		syntax = "proto2";
+		package bar;
+		import "base.proto";
+		extend foo.Base {
+		  optional string foo = 101;
+		}`
+	testCases := []struct {
+		name           string
+		descriptorFile string
+		expected       []string
+	}{
+		{
+			// the bundled descriptor.proto predates extension declarations
+			name: "bundled descriptor.proto",
+			expected: []string{
+				"base.proto:7:21: extension range foo.Base.100-200: option declaration: field declaration of google.protobuf.ExtensionRangeOptions does not exist",
+			},
+		},
+		{
+			// a newer descriptor.proto from the resolver takes precedence
+			name:           "newer descriptor.proto",
+			descriptorFile: descriptorProtoWithDeclarations,
+			expected: []string{
+				"test.proto:6:41: extension bar.foo: number 101 is not declared in the extension range of message foo.Base, which requires extension declarations",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{
+				"base.proto": base,
+				"test.proto": source,
+			}
+			if tc.descriptorFile != "" {
+				files["google/protobuf/descriptor.proto"] = tc.descriptorFile
+			}
+			var errs []string
+			compiler := protocompile.Compiler{
+				Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+					Accessor: protocompile.SourceAccessorFromMap(files),
+				}),
+				Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+					errs = append(errs, err.Error())
+					return nil
+				}, nil),
+			}
+			_, err := compiler.Compile(context.Background(), "base.proto", "test.proto")
+			require.Error(t, err)
+			assert.Equal(t, tc.expected, errs)
+		})
+	}
+}
+
+func TestResolveUnknownExtensions(t *testing.T) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"test.proto": `
+					syntax = "proto3";
+					package foo;
+					import "google/protobuf/descriptor.proto";
+					extend google.protobuf.MessageOptions {
+					  string label = 50001;
+					}
+					message Foo {
+					  option (label) = "abc";
+					}`,
+			}),
+		}),
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	// without a resolver, the custom option is an unrecognized field
+	data, err := proto.Marshal(fds[0].Messages().Get(0).Options())
+	require.NoError(t, err)
+	opts := &descriptorpb.MessageOptions{}
+	require.NoError(t, proto.Unmarshal(data, opts))
+	require.NotEmpty(t, opts.ProtoReflect().GetUnknown())
+
+	resolved, err := linker.ResolveUnknownExtensions(opts, linker.ResolverFromFile(fds[0]))
+	require.NoError(t, err)
+	assert.Empty(t, resolved.ProtoReflect().GetUnknown())
+	ext := fds[0].Extensions().ByName("label")
+	require.NotNil(t, ext)
+	var value interface{}
+	resolved.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.FullName() == ext.FullName() {
+			value = v.Interface()
+		}
+		return true
+	})
+	assert.Equal(t, "abc", value)
+	// the given message is unchanged
+	assert.NotEmpty(t, opts.ProtoReflect().GetUnknown())
+}
+
 func checkFiles(t *testing.T, act protoreflect.FileDescriptor, expSet fileProtoSet, checked map[string]struct{}) {
 	if _, ok := checked[act.Path()]; ok {
 		// already checked
@@ -668,6 +870,63 @@ func TestLinkerValidation(t *testing.T) {
 			},
 			`foo.proto:7:34: message Baz: option (foo).baz.options.(foo).buzz.name: oneof "bar" already has field "baz" set`,
 		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto3\";\n" +
+					"message Foo {\n" +
+					"  string foo = 1 [json_name = \"bar\"];\n" +
+					"  string bar = 2;\n" +
+					"}",
+			},
+			`foo.proto:4:10: message Foo: default JSON name "bar" of field bar conflicts with custom JSON name of field foo, defined at foo.proto:3:31`,
+		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto2\";\n" +
+					"message Foo {\n" +
+					"  optional string foo = 1 [json_name = \"baz\"];\n" +
+					"  optional string bar = 2 [json_name = \"baz\"];\n" +
+					"}",
+			},
+			`foo.proto:4:40: message Foo: custom JSON name "baz" of field bar conflicts with custom JSON name of field foo, defined at foo.proto:3:40`,
+		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto2\";\n" +
+					"message Foo {\n" +
+					"  optional string foo = 1 [json_name = \"[foo]\"];\n" +
+					"}",
+			},
+			`foo.proto:3:40: field Foo.foo: custom JSON name "[foo]" cannot be enclosed in brackets`,
+		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto2\";\n" +
+					"message Foo {\n" +
+					"  optional string foo = 1 [json_name = \"foo\\nbar\"];\n" +
+					"}",
+			},
+			`foo.proto:3:40: field Foo.foo: custom JSON name "foo\nbar" contains invalid character '\n'`,
+		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto2\";\n" +
+					"message Foo { extensions 1 to 10; }\n" +
+					"extend Foo { optional string foo = 1 [json_name = \"Foo\"]; }",
+			},
+			`foo.proto:3:51: field foo: option json_name is not allowed on extensions`,
+		},
+		{
+			map[string]string{
+				"foo.proto": "syntax = \"proto3\";\n" +
+					"message Foo {\n" +
+					"  string foo_bar = 1;\n" +
+					"  string fooBar = 2 [json_name = \"foo_bar\"];\n" +
+					"}",
+			},
+			// like protoc, default JSON names must not conflict even if custom JSON names are used
+			`foo.proto:4:10: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at foo.proto:3:10`,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -935,3 +1194,186 @@ func compareUnknown(t *testing.T, path string, exp, act protoreflect.RawFields)
 		}
 	}
 }
+
+// descriptorProtoWithDeclarations is a subset of a version of descriptor.proto
+// that is newer than the one in the protobuf runtime and that supports
+// extension declarations.
+const descriptorProtoWithDeclarations = `
+syntax = "proto2";
+package google.protobuf;
+message ExtensionRangeOptions {
+  repeated UninterpretedOption uninterpreted_option = 999;
+  message Declaration {
+    optional int32 number = 1;
+    optional string full_name = 2;
+    optional string type = 3;
+    optional bool reserved = 5;
+    optional bool repeated = 6;
+  }
+  repeated Declaration declaration = 2;
+  enum VerificationState {
+    DECLARATION = 0;
+    UNVERIFIED = 1;
+  }
+  optional VerificationState verification = 3 [default = UNVERIFIED];
+  extensions 1000 to max;
+}
+message UninterpretedOption {
+  message NamePart {
+    required string name_part = 1;
+    required bool is_extension = 2;
+  }
+  repeated NamePart name = 2;
+  optional string identifier_value = 3;
+  optional uint64 positive_int_value = 4;
+  optional int64 negative_int_value = 5;
+  optional double double_value = 6;
+  optional bytes string_value = 7;
+  optional string aggregate_value = 8;
+}
+`
+
+func TestExtensionDeclarations(t *testing.T) {
+	const base = `
+		syntax = "proto2";
+		package foo;
+		import "google/protobuf/descriptor.proto";
+		message Base {
+		  extensions 100 to 199 [
+		    declaration = { number: 100 full_name: ".bar.name" type: "string" },
+		    declaration = { number: 101 full_name: ".bar.tags" type: "string" repeated: true },
+		    declaration = { number: 102 full_name: ".bar.base" type: ".foo.Base" },
+		    declaration = { number: 103 reserved: true }
+		  ];
+		  extensions 200 to 299 [verification = DECLARATION];
+		  extensions 300 to 399 [verification = UNVERIFIED];
+		  extensions 400 to 499;
+		}
+		enum Color { RED = 0; }`
+	testCases := []struct {
+		name     string
+		base     string
+		source   string
+		expected []string
+	}{
+		{
+			name: "valid",
+			source: `
+				syntax = "proto2";
+				package bar;
+				import "base.proto";
+				extend foo.Base {
+				  optional string name = 100;
+				  repeated string tags = 101;
+				  optional foo.Base base = 102;
+				  optional int32 unverified = 300;
+				  optional int32 other = 400;
+				}`,
+		},
+		{
+			name: "undeclared",
+			source: `
+				syntax = "proto2";
+				package bar;
+				import "base.proto";
+				extend foo.Base {
+				  optional string foo = 104;
+				  optional string bar = 200;
+				}`,
+			expected: []string{
+				"test.proto:6:57: extension bar.foo: number 104 is not declared in the extension range of message foo.Base, which requires extension declarations",
+				"test.proto:7:57: extension bar.bar: number 200 is not declared in the extension range of message foo.Base, which requires extension declarations",
+			},
+		},
+		{
+			name: "reserved",
+			source: `
+				syntax = "proto2";
+				package bar;
+				import "base.proto";
+				extend foo.Base {
+				  optional string foo = 103;
+				}`,
+			expected: []string{
+				"test.proto:6:57: extension bar.foo: cannot use number 103 because it is reserved in the extension declarations of message foo.Base",
+			},
+		},
+		{
+			name: "mismatch",
+			source: `
+				syntax = "proto2";
+				package bar;
+				import "base.proto";
+				extend foo.Base {
+				  optional string nom = 100;
+				  optional string tags = 101;
+				  optional foo.Color base = 102;
+				}`,
+			expected: []string{
+				"test.proto:6:51: extension bar.nom: expected extension with number 100 to be named bar.name, per its declaration in message foo.Base",
+				"test.proto:7:35: extension bar.tags: expected to be repeated, per its declaration in message foo.Base",
+				"test.proto:8:44: extension bar.base: expected type foo.Base, per its declaration in message foo.Base, not foo.Color",
+			},
+		},
+		{
+			name: "invalid declarations",
+			base: `
+				syntax = "proto2";
+				package foo;
+				import "google/protobuf/descriptor.proto";
+				message Base {
+				  extensions 100 to 199 [
+				    declaration = { number: 100 full_name: ".bar.a" type: "string" },
+				    declaration = { number: 100 full_name: ".bar.b" type: "string" },
+				    declaration = { number: 101 full_name: ".bar.a" type: "string" },
+				    declaration = { number: 102 full_name: "bar.c" type: "string" },
+				    declaration = { number: 103 full_name: ".bar.d" },
+				    declaration = { number: 200 full_name: ".bar.e" type: "string" },
+				    verification = UNVERIFIED
+				  ];
+				}`,
+			expected: []string{
+				"base.proto:6:46: message foo.Base: cannot mark the extension range as UNVERIFIED when it has extension declarations",
+				"base.proto:6:46: message foo.Base: extension declaration number 100 is declared multiple times",
+				`base.proto:6:46: message foo.Base: extension declaration full name ".bar.a" is declared multiple times`,
+				`base.proto:6:46: message foo.Base: extension declaration full name "bar.c" must be fully-qualified, with a leading dot`,
+				"base.proto:6:46: message foo.Base: extension declaration for number 103 must have both full_name and type set unless it is reserved",
+				"base.proto:6:46: message foo.Base: extension declaration number 200 is not in the extension range 100 to 199",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			baseSource := tc.base
+			if baseSource == "" {
+				baseSource = base
+			}
+			files := map[string]string{
+				"google/protobuf/descriptor.proto": descriptorProtoWithDeclarations,
+				"base.proto":                       baseSource,
+			}
+			names := []string{"base.proto"}
+			if tc.source != "" {
+				files["test.proto"] = tc.source
+				names = append(names, "test.proto")
+			}
+			var errs []string
+			compiler := protocompile.Compiler{
+				Resolver: &protocompile.SourceResolver{
+					Accessor: protocompile.SourceAccessorFromMap(files),
+				},
+				Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+					errs = append(errs, err.Error())
+					return nil
+				}, nil),
+			}
+			_, err := compiler.Compile(context.Background(), names...)
+			if len(tc.expected) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, tc.expected, errs)
+		})
+	}
+}
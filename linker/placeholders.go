@@ -0,0 +1,203 @@
+package linker
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// NewPlaceholderFile returns a File that stands in for the file with the given
+// path, which could not be loaded. The returned file's IsPlaceholder method
+// returns true and it contains no elements.
+//
+// This can be used to link a file even though some of its imports are not
+// available. References to elements that would have been defined in such an
+// import cannot be resolved, so they are reported as errors and represented
+// by placeholder descriptors (whose IsPlaceholder method also returns true).
+func NewPlaceholderFile(path string) File {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{Name: proto.String(path)}, nil)
+	if err != nil {
+		// should not be possible: there's nothing in the descriptor to be invalid
+		panic(err)
+	}
+	return file{
+		FileDescriptor: placeholderFile{FileDescriptor: fd},
+		descs:          map[protoreflect.FullName]protoreflect.Descriptor{},
+	}
+}
+
+type placeholderFile struct {
+	protoreflect.FileDescriptor
+}
+
+func (f placeholderFile) ParentFile() protoreflect.FileDescriptor {
+	return f
+}
+
+func (f placeholderFile) IsPlaceholder() bool {
+	return true
+}
+
+// unresolvedName returns the name to use for a type reference that could not
+// be resolved. Like protoc, we assume such a reference is fully-qualified, so
+// this just adds the leading dot if it is missing. The returned name can then
+// be represented with a placeholder descriptor.
+func unresolvedName(name string) *string {
+	if !strings.HasPrefix(name, ".") {
+		name = "." + name
+	}
+	return proto.String(name)
+}
+
+func (r *result) resolveMessageOrPlaceholder(typeName string) protoreflect.MessageDescriptor {
+	name := protoreflect.FullName(strings.TrimPrefix(typeName, "."))
+	if md := r.ResolveMessageType(name); md != nil {
+		return md
+	}
+	return placeholderMessage{name: name}
+}
+
+func (r *result) resolveEnumOrPlaceholder(typeName string) protoreflect.EnumDescriptor {
+	name := protoreflect.FullName(strings.TrimPrefix(typeName, "."))
+	if ed := r.ResolveEnumType(name); ed != nil {
+		return ed
+	}
+	return placeholderEnum{name: name}
+}
+
+// placeholderMessage is a message descriptor that stands in for a message that
+// could not be resolved. It has no fields or nested elements.
+type placeholderMessage struct {
+	protoreflect.MessageDescriptor
+	name protoreflect.FullName
+}
+
+func (m placeholderMessage) ParentFile() protoreflect.FileDescriptor {
+	return nil
+}
+
+func (m placeholderMessage) Parent() protoreflect.Descriptor {
+	return nil
+}
+
+func (m placeholderMessage) Index() int {
+	return 0
+}
+
+func (m placeholderMessage) Syntax() protoreflect.Syntax {
+	return 0
+}
+
+func (m placeholderMessage) Name() protoreflect.Name {
+	return m.name.Name()
+}
+
+func (m placeholderMessage) FullName() protoreflect.FullName {
+	return m.name
+}
+
+func (m placeholderMessage) IsPlaceholder() bool {
+	return true
+}
+
+func (m placeholderMessage) Options() protoreflect.ProtoMessage {
+	return (*descriptorpb.MessageOptions)(nil)
+}
+
+func (m placeholderMessage) IsMapEntry() bool {
+	return false
+}
+
+func (m placeholderMessage) Fields() protoreflect.FieldDescriptors {
+	return &fldDescriptors{}
+}
+
+func (m placeholderMessage) Oneofs() protoreflect.OneofDescriptors {
+	return &oneofDescriptors{}
+}
+
+func (m placeholderMessage) ReservedNames() protoreflect.Names {
+	return names{}
+}
+
+func (m placeholderMessage) ReservedRanges() protoreflect.FieldRanges {
+	return fieldRanges{}
+}
+
+func (m placeholderMessage) RequiredNumbers() protoreflect.FieldNumbers {
+	return fieldNums{}
+}
+
+func (m placeholderMessage) ExtensionRanges() protoreflect.FieldRanges {
+	return extRanges{}
+}
+
+func (m placeholderMessage) Enums() protoreflect.EnumDescriptors {
+	return &enumDescriptors{}
+}
+
+func (m placeholderMessage) Messages() protoreflect.MessageDescriptors {
+	return &msgDescriptors{}
+}
+
+func (m placeholderMessage) Extensions() protoreflect.ExtensionDescriptors {
+	return &extDescriptors{}
+}
+
+var _ protoreflect.MessageDescriptor = placeholderMessage{}
+
+// placeholderEnum is an enum descriptor that stands in for an enum that could
+// not be resolved. It has no values.
+type placeholderEnum struct {
+	protoreflect.EnumDescriptor
+	name protoreflect.FullName
+}
+
+func (e placeholderEnum) ParentFile() protoreflect.FileDescriptor {
+	return nil
+}
+
+func (e placeholderEnum) Parent() protoreflect.Descriptor {
+	return nil
+}
+
+func (e placeholderEnum) Index() int {
+	return 0
+}
+
+func (e placeholderEnum) Syntax() protoreflect.Syntax {
+	return 0
+}
+
+func (e placeholderEnum) Name() protoreflect.Name {
+	return e.name.Name()
+}
+
+func (e placeholderEnum) FullName() protoreflect.FullName {
+	return e.name
+}
+
+func (e placeholderEnum) IsPlaceholder() bool {
+	return true
+}
+
+func (e placeholderEnum) Options() protoreflect.ProtoMessage {
+	return (*descriptorpb.EnumOptions)(nil)
+}
+
+func (e placeholderEnum) Values() protoreflect.EnumValueDescriptors {
+	return &enValDescriptors{}
+}
+
+func (e placeholderEnum) ReservedNames() protoreflect.Names {
+	return names{}
+}
+
+func (e placeholderEnum) ReservedRanges() protoreflect.EnumRanges {
+	return enumRanges{}
+}
+
+var _ protoreflect.EnumDescriptor = placeholderEnum{}
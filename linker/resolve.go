@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -76,6 +77,10 @@ func (r *result) CheckForUnusedImports(handler *reporter.Handler) {
 			if isPublic {
 				continue
 			}
+			if imp := r.deps.FindFileByPath(dep); imp != nil && imp.IsPlaceholder() {
+				// the import could not be loaded, so we can't tell if it's used
+				continue
+			}
 			pos := ast.UnknownPos(fd.GetName())
 			if file != nil {
 				for _, decl := range file.Decls {
@@ -263,7 +268,7 @@ func descriptorType(d protoreflect.Descriptor) string {
 	}
 }
 
-func (r *result) resolveReferences(handler *reporter.Handler, s *Symbols) error {
+func (r *result) resolveReferences(ctx context.Context, handler *reporter.Handler, s *Symbols) error {
 	fd := r.Proto()
 	scopes := []scope{fileScope(r)}
 	if fd.Options != nil {
@@ -274,6 +279,9 @@ func (r *result) resolveReferences(handler *reporter.Handler, s *Symbols) error
 
 	return walk.DescriptorProtosEnterAndExit(fd,
 		func(fqn protoreflect.FullName, d proto.Message) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			switch d := d.(type) {
 			case *descriptorpb.DescriptorProto:
 				scopes = append(scopes, messageScope(r, fqn)) // push new scope on entry
@@ -292,15 +300,7 @@ func (r *result) resolveReferences(handler *reporter.Handler, s *Symbols) error
 					}
 				}
 			case *descriptorpb.FieldDescriptorProto:
-				elemType := "field"
-				if d.GetExtendee() != "" {
-					elemType = "extension"
-				}
-				if d.Options != nil {
-					if err := r.resolveOptions(handler, elemType, fqn, d.Options.UninterpretedOption, scopes); err != nil {
-						return err
-					}
-				}
+				// resolveFieldTypes also resolves the field's options
 				if err := r.resolveFieldTypes(handler, s, fqn, d, scopes); err != nil {
 					return err
 				}
@@ -359,38 +359,8 @@ func (r *result) resolveFieldTypes(handler *reporter.Handler, s *Symbols, fqn pr
 	elemType := "field"
 	if fld.GetExtendee() != "" {
 		elemType = "extension"
-		dsc := r.resolve(fld.GetExtendee(), true, scopes)
-		if dsc == nil {
-			return handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "unknown extendee type %s", fld.GetExtendee())
-		}
-		if isSentinelDescriptor(dsc) {
-			return handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "unknown extendee type %s; resolved to %s which is not defined; consider using a leading dot", fld.GetExtendee(), dsc.FullName())
-		}
-		extd, ok := dsc.(protoreflect.MessageDescriptor)
-		if !ok {
-			otherType := descriptorType(dsc)
-			return handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "extendee is invalid: %s is a %s, not a message", dsc.FullName(), otherType)
-		}
-		fld.Extendee = proto.String("." + string(dsc.FullName()))
-		// make sure the tag number is in range
-		found := false
-		tag := protoreflect.FieldNumber(fld.GetNumber())
-		for i := 0; i < extd.ExtensionRanges().Len(); i++ {
-			rng := extd.ExtensionRanges().Get(i)
-			if tag >= rng[0] && tag < rng[1] {
-				found = true
-				break
-			}
-		}
-		if !found {
-			if err := handler.HandleErrorf(file.NodeInfo(node.FieldTag()).Start(), "%s: tag %d is not in valid range for extended type %s", scope, tag, dsc.FullName()); err != nil {
-				return err
-			}
-		} else {
-			// make sure tag is not a duplicate
-			if err := s.addExtension(dsc.FullName(), tag, file.NodeInfo(node.FieldTag()).Start(), handler); err != nil {
-				return err
-			}
+		if err := r.resolveExtendee(handler, s, scope, fld, node, scopes); err != nil {
+			return err
 		}
 	}
 
@@ -406,11 +376,20 @@ func (r *result) resolveFieldTypes(handler *reporter.Handler, s *Symbols, fqn pr
 	}
 
 	dsc := r.resolve(fld.GetTypeName(), true, scopes)
-	if dsc == nil {
-		return handler.HandleErrorf(file.NodeInfo(node.FieldType()).Start(), "%s: unknown type %s", scope, fld.GetTypeName())
-	}
-	if isSentinelDescriptor(dsc) {
-		return handler.HandleErrorf(file.NodeInfo(node.FieldType()).Start(), "%s: unknown type %s; resolved to %s which is not defined; consider using a leading dot", scope, fld.GetTypeName(), dsc.FullName())
+	if dsc == nil || isSentinelDescriptor(dsc) {
+		var err error
+		if dsc == nil {
+			err = handler.HandleErrorf(file.NodeInfo(node.FieldType()).Start(), "%s: unknown type %s", scope, fld.GetTypeName())
+		} else {
+			err = handler.HandleErrorf(file.NodeInfo(node.FieldType()).Start(), "%s: unknown type %s; resolved to %s which is not defined; consider using a leading dot", scope, fld.GetTypeName(), dsc.FullName())
+		}
+		// if we continue, the field will refer to a placeholder; like protoc,
+		// we assume the unknown type is a message
+		fld.TypeName = unresolvedName(fld.GetTypeName())
+		if fld.Type == nil {
+			fld.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		}
+		return err
 	}
 	switch dsc := dsc.(type) {
 	case protoreflect.MessageDescriptor:
@@ -436,6 +415,43 @@ func (r *result) resolveFieldTypes(handler *reporter.Handler, s *Symbols, fqn pr
 	return nil
 }
 
+func (r *result) resolveExtendee(handler *reporter.Handler, s *Symbols, scope string, fld *descriptorpb.FieldDescriptorProto, node ast.FieldDeclNode, scopes []scope) error {
+	file := r.FileNode()
+	dsc := r.resolve(fld.GetExtendee(), true, scopes)
+	if dsc == nil || isSentinelDescriptor(dsc) {
+		var err error
+		if dsc == nil {
+			err = handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "unknown extendee type %s", fld.GetExtendee())
+		} else {
+			err = handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "unknown extendee type %s; resolved to %s which is not defined; consider using a leading dot", fld.GetExtendee(), dsc.FullName())
+		}
+		// if we continue, the extension will extend a placeholder
+		fld.Extendee = unresolvedName(fld.GetExtendee())
+		return err
+	}
+	extd, ok := dsc.(protoreflect.MessageDescriptor)
+	if !ok {
+		otherType := descriptorType(dsc)
+		return handler.HandleErrorf(file.NodeInfo(node.FieldExtendee()).Start(), "extendee is invalid: %s is a %s, not a message", dsc.FullName(), otherType)
+	}
+	fld.Extendee = proto.String("." + string(dsc.FullName()))
+	// make sure the tag number is in range
+	found := false
+	tag := protoreflect.FieldNumber(fld.GetNumber())
+	for i := 0; i < extd.ExtensionRanges().Len(); i++ {
+		rng := extd.ExtensionRanges().Get(i)
+		if tag >= rng[0] && tag < rng[1] {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return handler.HandleErrorf(file.NodeInfo(node.FieldTag()).Start(), "%s: tag %d is not in valid range for extended type %s", scope, tag, dsc.FullName())
+	}
+	// make sure tag is not a duplicate
+	return s.addExtension(dsc.FullName(), tag, file.NodeInfo(node.FieldTag()).Start(), handler)
+}
+
 func (r *result) resolveMethodTypes(handler *reporter.Handler, fqn protoreflect.FullName, mtd *descriptorpb.MethodDescriptorProto, scopes []scope) error {
 	scope := fmt.Sprintf("method %s", fqn)
 	file := r.FileNode()
@@ -445,10 +461,12 @@ func (r *result) resolveMethodTypes(handler *reporter.Handler, fqn protoreflect.
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetInputType()).Start(), "%s: unknown request type %s", scope, mtd.GetInputType()); err != nil {
 			return err
 		}
+		mtd.InputType = unresolvedName(mtd.GetInputType())
 	} else if isSentinelDescriptor(dsc) {
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetInputType()).Start(), "%s: unknown request type %s; resolved to %s which is not defined; consider using a leading dot", scope, mtd.GetInputType(), dsc.FullName()); err != nil {
 			return err
 		}
+		mtd.InputType = unresolvedName(mtd.GetInputType())
 	} else if _, ok := dsc.(protoreflect.MessageDescriptor); !ok {
 		otherType := descriptorType(dsc)
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetInputType()).Start(), "%s: invalid request type: %s is a %s, not a message", scope, dsc.FullName(), otherType); err != nil {
@@ -464,10 +482,12 @@ func (r *result) resolveMethodTypes(handler *reporter.Handler, fqn protoreflect.
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetOutputType()).Start(), "%s: unknown response type %s", scope, mtd.GetOutputType()); err != nil {
 			return err
 		}
+		mtd.OutputType = unresolvedName(mtd.GetOutputType())
 	} else if isSentinelDescriptor(dsc) {
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetInputType()).Start(), "%s: unknown response type %s; resolved to %s which is not defined; consider using a leading dot", scope, mtd.GetOutputType(), dsc.FullName()); err != nil {
 			return err
 		}
+		mtd.OutputType = unresolvedName(mtd.GetOutputType())
 	} else if _, ok := dsc.(protoreflect.MessageDescriptor); !ok {
 		otherType := descriptorType(dsc)
 		if err := handler.HandleErrorf(file.NodeInfo(node.GetOutputType()).Start(), "%s: invalid response type: %s is a %s, not a message", scope, dsc.FullName(), otherType); err != nil {
@@ -0,0 +1,121 @@
+package linker
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protocompile/ast"
+)
+
+// SymbolsSnapshot is a copy of the contents of a Symbols table that can be
+// persisted, using encoding/json. A snapshot can be taken after compiling a
+// set of files and then used to initialize the table for a later compilation,
+// so that the later files are checked for collisions with the earlier ones:
+// an error is reported if a later file defines an element with the same name
+// as an element in an earlier file or an extension with the same number for
+// the same extendee, and the error indicates the location of the original
+// definition.
+type SymbolsSnapshot struct {
+	// The paths of the files whose contents are in the snapshot.
+	Files []string `json:"files,omitempty"`
+	// The fully-qualified names of all elements in the snapshot, sorted by
+	// name.
+	Symbols []SnapshotSymbol `json:"symbols,omitempty"`
+	// The extension numbers in use in the snapshot, sorted by extendee and
+	// then by number.
+	Extensions []SnapshotExtension `json:"extensions,omitempty"`
+}
+
+// SnapshotSymbol describes an element in a SymbolsSnapshot.
+type SnapshotSymbol struct {
+	// The fully-qualified name of the element.
+	Name protoreflect.FullName `json:"name"`
+	// The location of the element's declaration.
+	Pos ast.SourcePos `json:"pos"`
+	// True if the element is an enum value. Since enum values are defined in
+	// the scope that encloses their enum, this is used to provide more context
+	// when reporting collisions.
+	IsEnumValue bool `json:"isEnumValue,omitempty"`
+}
+
+// SnapshotExtension describes an extension number that is in use in a
+// SymbolsSnapshot.
+type SnapshotExtension struct {
+	// The fully-qualified name of the extended message.
+	Extendee protoreflect.FullName `json:"extendee"`
+	// The extension number.
+	Number protoreflect.FieldNumber `json:"number"`
+	// The location of the extension's declaration.
+	Pos ast.SourcePos `json:"pos"`
+}
+
+// Snapshot returns a snapshot of the current contents of s.
+func (s *Symbols) Snapshot() *SymbolsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := &SymbolsSnapshot{}
+	for path := range s.paths {
+		snapshot.Files = append(snapshot.Files, path)
+	}
+	sort.Strings(snapshot.Files)
+	for name, entry := range s.symbols {
+		snapshot.Symbols = append(snapshot.Symbols, SnapshotSymbol{
+			Name:        name,
+			Pos:         entry.pos,
+			IsEnumValue: entry.isEnumValue,
+		})
+	}
+	sort.Slice(snapshot.Symbols, func(i, j int) bool {
+		return snapshot.Symbols[i].Name < snapshot.Symbols[j].Name
+	})
+	for extendee, tags := range s.exts {
+		for tag, pos := range tags {
+			snapshot.Extensions = append(snapshot.Extensions, SnapshotExtension{
+				Extendee: extendee,
+				Number:   tag,
+				Pos:      pos,
+			})
+		}
+	}
+	sort.Slice(snapshot.Extensions, func(i, j int) bool {
+		exti, extj := snapshot.Extensions[i], snapshot.Extensions[j]
+		if exti.Extendee != extj.Extendee {
+			return exti.Extendee < extj.Extendee
+		}
+		return exti.Number < extj.Number
+	})
+	return snapshot
+}
+
+// NewSymbolsFromSnapshot returns a symbol table that is populated with the
+// contents of the given snapshot. Files that are later imported into the
+// returned table are checked for collisions with the contents of the
+// snapshot. But files whose paths are in the snapshot are not: they are
+// considered to be new versions of the files in the snapshot and replace
+// their entries.
+func NewSymbolsFromSnapshot(snapshot *SymbolsSnapshot) *Symbols {
+	s := &Symbols{
+		paths:   map[string]struct{}{},
+		symbols: map[protoreflect.FullName]symbolEntry{},
+		exts:    map[protoreflect.FullName]map[protoreflect.FieldNumber]ast.SourcePos{},
+	}
+	for _, path := range snapshot.Files {
+		s.paths[path] = struct{}{}
+	}
+	for _, sym := range snapshot.Symbols {
+		s.paths[sym.Pos.Filename] = struct{}{}
+		s.symbols[sym.Name] = symbolEntry{pos: sym.Pos, isEnumValue: sym.IsEnumValue}
+	}
+	for _, ext := range snapshot.Extensions {
+		s.paths[ext.Pos.Filename] = struct{}{}
+		tags := s.exts[ext.Extendee]
+		if tags == nil {
+			tags = map[protoreflect.FieldNumber]ast.SourcePos{}
+			s.exts[ext.Extendee] = tags
+		}
+		tags[ext.Number] = ext.Pos
+	}
+	return s
+}
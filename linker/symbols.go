@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -9,6 +10,7 @@ import (
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
 	"github.com/jhump/protocompile/reporter"
 	"github.com/jhump/protocompile/walk"
 )
@@ -18,10 +20,19 @@ import (
 // to enforce uniqueness for symbol names and tag numbers across many files and
 // many link operations.
 //
+// Entries are associated with the path of the file that defines them. If a
+// file is imported whose path is already in the table, but which is not the
+// same file descriptor instance, it is assumed to be a new version of the same
+// file: it does not collide with the entries for that path, which it replaces.
+// This allows a table to be re-used across compilations, or to be initialized
+// from a snapshot of a table from an earlier compilation (see Snapshot and
+// NewSymbolsFromSnapshot).
+//
 // This type is thread-safe.
 type Symbols struct {
 	mu      sync.Mutex
 	files   map[protoreflect.FileDescriptor]struct{}
+	paths   map[string]struct{}
 	symbols map[protoreflect.FullName]symbolEntry
 	exts    map[protoreflect.FullName]map[protoreflect.FieldNumber]ast.SourcePos
 }
@@ -41,11 +52,6 @@ func (s *Symbols) Import(fd protoreflect.FileDescriptor, handler *reporter.Handl
 		return nil
 	}
 
-	if f, ok := fd.(file); ok {
-		// unwrap any file instance
-		fd = f.FileDescriptor
-	}
-
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -53,6 +59,12 @@ func (s *Symbols) Import(fd protoreflect.FileDescriptor, handler *reporter.Handl
 }
 
 func (s *Symbols) importLocked(fd protoreflect.FileDescriptor, handler *reporter.Handler) error {
+	if f, ok := fd.(file); ok {
+		// unwrap any file instance (which may also be found in the
+		// imports of other files)
+		fd = f.FileDescriptor
+	}
+
 	if _, ok := s.files[fd]; ok {
 		// already imported
 		return nil
@@ -97,7 +109,7 @@ func reportSymbolCollision(pos ast.SourcePos, fqn protoreflect.FullName, additio
 func (s *Symbols) checkFileLocked(f protoreflect.FileDescriptor, handler *reporter.Handler) error {
 	return walk.Descriptors(f, func(d protoreflect.Descriptor) error {
 		pos := sourcePositionFor(d)
-		if existing, ok := s.symbols[d.FullName()]; ok {
+		if existing, ok := s.symbols[d.FullName()]; ok && existing.pos.Filename != f.Path() {
 			_, isEnumVal := d.(protoreflect.EnumValueDescriptor)
 			if err := reportSymbolCollision(pos, d.FullName(), isEnumVal, existing, handler); err != nil {
 				return err
@@ -111,7 +123,7 @@ func (s *Symbols) checkFileLocked(f protoreflect.FileDescriptor, handler *report
 
 		extendee := fld.ContainingMessage().FullName()
 		if tags, ok := s.exts[extendee]; ok {
-			if existing, ok := tags[fld.Number()]; ok {
+			if existing, ok := tags[fld.Number()]; ok && existing.Filename != f.Path() {
 				if err := handler.HandleErrorf(pos, "extension with tag %d for message %s already defined at %v", fld.Number(), extendee, existing); err != nil {
 					return err
 				}
@@ -143,12 +155,7 @@ func isZeroLoc(loc protoreflect.SourceLocation) bool {
 }
 
 func (s *Symbols) commitFileLocked(f protoreflect.FileDescriptor) {
-	if s.symbols == nil {
-		s.symbols = map[protoreflect.FullName]symbolEntry{}
-	}
-	if s.exts == nil {
-		s.exts = map[protoreflect.FullName]map[protoreflect.FieldNumber]ast.SourcePos{}
-	}
+	s.replacePathLocked(f.Path())
 	_ = walk.Descriptors(f, func(d protoreflect.Descriptor) error {
 		pos := sourcePositionFor(d)
 		name := d.FullName()
@@ -199,7 +206,7 @@ func (s *Symbols) importResultLocked(r *result, populatePool bool, checkExts boo
 	}
 
 	// second pass: commit all symbols
-	s.commitResultLocked(r, populatePool)
+	s.commitResultLocked(r, populatePool, checkExts)
 
 	return nil
 }
@@ -212,7 +219,7 @@ func (s *Symbols) checkResultLocked(r *result, checkExts bool, handler *reporter
 		node := r.Node(d)
 		pos := nameStart(file, node)
 		// check symbols already in this symbol table
-		if existing, ok := s.symbols[fqn]; ok {
+		if existing, ok := s.symbols[fqn]; ok && existing.pos.Filename != r.Path() {
 			if err := reportSymbolCollision(pos, fqn, isEnumVal, existing, handler); err != nil {
 				return err
 			}
@@ -244,7 +251,7 @@ func (s *Symbols) checkResultLocked(r *result, checkExts bool, handler *reporter
 
 		extendeeFqn := protoreflect.FullName(strings.TrimPrefix(extendee, "."))
 		if tags, ok := s.exts[extendeeFqn]; ok {
-			if existing, ok := tags[protoreflect.FieldNumber(fld.GetNumber())]; ok {
+			if existing, ok := tags[protoreflect.FieldNumber(fld.GetNumber())]; ok && existing.Filename != r.Path() {
 				pos := file.NodeInfo(node.(ast.FieldDeclNode).FieldTag()).Start()
 				if err := handler.HandleErrorf(pos, "extension with tag %d for message %s already defined at %v", fld.GetNumber(), extendeeFqn, existing); err != nil {
 					return err
@@ -276,20 +283,28 @@ func nameStart(file ast.FileDeclNode, n ast.Node) ast.SourcePos {
 	}
 }
 
-func (s *Symbols) commitResultLocked(r *result, populatePool bool) {
-	if s.symbols == nil {
-		s.symbols = map[protoreflect.FullName]symbolEntry{}
-	}
-	if s.exts == nil {
-		s.exts = map[protoreflect.FullName]map[protoreflect.FieldNumber]ast.SourcePos{}
-	}
+// commitResultLocked adds the symbols in the given result to the table. If
+// commitExts is true, the result has already been linked, so its extensions
+// are also added. (Otherwise, extensions are added as they are resolved
+// during linking; see addExtension.)
+func (s *Symbols) commitResultLocked(r *result, populatePool bool, commitExts bool) {
+	s.replacePathLocked(r.Path())
 	_ = walk.DescriptorProtos(r.Proto(), func(fqn protoreflect.FullName, d proto.Message) error {
 		pos := nameStart(r.FileNode(), r.Node(d))
-		_, isEnumValue := d.(protoreflect.EnumValueDescriptor)
+		_, isEnumValue := d.(*descriptorpb.EnumValueDescriptorProto)
 		s.symbols[fqn] = symbolEntry{pos: pos, isEnumValue: isEnumValue}
 		if populatePool {
 			r.descriptorPool[string(fqn)] = d
 		}
+		if fld, ok := d.(*descriptorpb.FieldDescriptorProto); ok && commitExts && fld.GetExtendee() != "" {
+			extendee := protoreflect.FullName(strings.TrimPrefix(fld.GetExtendee(), "."))
+			tags := s.exts[extendee]
+			if tags == nil {
+				tags = map[protoreflect.FieldNumber]ast.SourcePos{}
+				s.exts[extendee] = tags
+			}
+			tags[protoreflect.FieldNumber(fld.GetNumber())] = r.FileNode().NodeInfo(r.FieldNode(fld).FieldTag()).Start()
+		}
 		return nil
 	})
 
@@ -299,6 +314,41 @@ func (s *Symbols) commitResultLocked(r *result, populatePool bool) {
 	s.files[r] = struct{}{}
 }
 
+// replacePathLocked prepares the table for the addition of the file with the
+// given path. If entries for the path are already present, they are for
+// another version of the file (for example, one loaded from a snapshot), so
+// they are removed.
+func (s *Symbols) replacePathLocked(path string) {
+	if s.symbols == nil {
+		s.symbols = map[protoreflect.FullName]symbolEntry{}
+	}
+	if s.exts == nil {
+		s.exts = map[protoreflect.FullName]map[protoreflect.FieldNumber]ast.SourcePos{}
+	}
+	if s.paths == nil {
+		s.paths = map[string]struct{}{}
+	}
+	if _, ok := s.paths[path]; !ok {
+		s.paths[path] = struct{}{}
+		return
+	}
+	for name, entry := range s.symbols {
+		if entry.pos.Filename == path {
+			delete(s.symbols, name)
+		}
+	}
+	for extendee, tags := range s.exts {
+		for tag, pos := range tags {
+			if pos.Filename == path {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.exts, extendee)
+		}
+	}
+}
+
 func (s *Symbols) addExtension(extendee protoreflect.FullName, tag protoreflect.FieldNumber, pos ast.SourcePos, handler *reporter.Handler) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -321,3 +371,108 @@ func (s *Symbols) addExtension(extendee protoreflect.FullName, tag protoreflect.
 	}
 	return nil
 }
+
+// Lookup returns the location of the declaration of the element with the given
+// fully-qualified name. The location's Filename field is the path of the file
+// that declares the element. If the table has no element with the given name,
+// this returns false.
+func (s *Symbols) Lookup(name protoreflect.FullName) (ast.SourcePos, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.symbols[name]
+	return entry.pos, ok
+}
+
+// RangeSymbols calls fn for each element in the table whose fully-qualified
+// name is in the given package, including elements in sub-packages and the
+// descendants of other elements. If pkg is empty, fn is called for all
+// elements in the table. Elements are visited in order of their names. If fn
+// returns false, iteration stops.
+//
+// The table is not locked while fn is called, so it may be modified during
+// iteration. Such modifications are not observed by the iteration.
+func (s *Symbols) RangeSymbols(pkg protoreflect.FullName, fn func(protoreflect.FullName, ast.SourcePos) bool) {
+	type symbol struct {
+		name protoreflect.FullName
+		pos  ast.SourcePos
+	}
+	var syms []symbol
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		prefix := string(pkg) + "."
+		for name, entry := range s.symbols {
+			if pkg == "" || name == pkg || strings.HasPrefix(string(name), prefix) {
+				syms = append(syms, symbol{name: name, pos: entry.pos})
+			}
+		}
+	}()
+	sort.Slice(syms, func(i, j int) bool {
+		return syms[i].name < syms[j].name
+	})
+	for _, sym := range syms {
+		if !fn(sym.name, sym.pos) {
+			return
+		}
+	}
+}
+
+// Extensions returns the numbers of all extensions of the given message that
+// are in the table, in increasing order.
+func (s *Symbols) Extensions(extendee protoreflect.FullName) []protoreflect.FieldNumber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tags := s.exts[extendee]
+	if len(tags) == 0 {
+		return nil
+	}
+	nums := make([]protoreflect.FieldNumber, 0, len(tags))
+	for tag := range tags {
+		nums = append(nums, tag)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	return nums
+}
+
+// LookupExtension returns the location of the declaration of the extension of
+// the given message with the given number. If the table has no such extension,
+// this returns false.
+func (s *Symbols) LookupExtension(extendee protoreflect.FullName, number protoreflect.FieldNumber) (ast.SourcePos, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos, ok := s.exts[extendee][number]
+	return pos, ok
+}
+
+// NextExtensionNumber returns the smallest number in the given range, from
+// start to end inclusive, that is not used by any extension of the given
+// message in the table. Numbers that are reserved for the implementation of
+// the protobuf runtime (19000 to 19999) are skipped. If all numbers in the
+// range are in use, this returns false.
+func (s *Symbols) NextExtensionNumber(extendee protoreflect.FullName, start, end protoreflect.FieldNumber) (protoreflect.FieldNumber, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if start < 1 {
+		start = 1
+	}
+	if end > internal.MaxTag {
+		end = internal.MaxTag
+	}
+	tags := s.exts[extendee]
+	for num := start; num <= end; num++ {
+		if num >= internal.SpecialReservedStart && num <= internal.SpecialReservedEnd {
+			num = internal.SpecialReservedEnd
+			continue
+		}
+		if _, ok := tags[num]; !ok {
+			return num, true
+		}
+	}
+	return 0, false
+}
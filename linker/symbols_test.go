@@ -0,0 +1,283 @@
+package linker_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/reporter"
+)
+
+const publishedProto = `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string label = 50001;
+}
+message Thing {
+  string name = 1;
+}
+enum Kind {
+  KIND_UNSPECIFIED = 0;
+}
+`
+
+func TestSymbolsSnapshot(t *testing.T) {
+	syms := &linker.Symbols{}
+	_, err := compileWithSymbols(t, syms, map[string]string{"published.proto": publishedProto}, nil)
+	require.NoError(t, err)
+	snapshot := syms.Snapshot()
+	assert.Equal(t, []string{"google/protobuf/descriptor.proto", "published.proto"}, snapshot.Files)
+	symbols := map[string]string{}
+	for _, sym := range snapshot.Symbols {
+		symbols[string(sym.Name)] = fmt.Sprintf("%v %v", sym.Pos, sym.IsEnumValue)
+	}
+	assert.Equal(t, "published.proto:8:9 false", symbols["foo.Thing"])
+	assert.Equal(t, "published.proto:12:3 true", symbols["foo.KIND_UNSPECIFIED"])
+	assert.Equal(t, "google/protobuf/descriptor.proto false", symbols["google.protobuf.FieldOptions"])
+	var exts []string
+	for _, ext := range snapshot.Extensions {
+		exts = append(exts, fmt.Sprintf("%s %d %v", ext.Extendee, ext.Number, ext.Pos))
+	}
+	assert.Equal(t, []string{"google.protobuf.FieldOptions 50001 published.proto:6:18"}, exts)
+
+	// the snapshot survives a round-trip through JSON
+	data, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	var loaded linker.SymbolsSnapshot
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	assert.Equal(t, snapshot, &loaded)
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name: "no collisions",
+			files: map[string]string{"new.proto": `
+syntax = "proto3";
+package bar;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string label = 50002;
+}
+message Thing {
+  string name = 1;
+}`},
+		},
+		{
+			name: "collisions",
+			files: map[string]string{"new.proto": `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string other_label = 50001;
+}
+message Thing {
+  string name = 1;
+}
+enum Other {
+  KIND_UNSPECIFIED = 0;
+}`},
+			expected: []string{
+				`new.proto:8:9: symbol "foo.Thing" already defined at published.proto:8:9`,
+				`new.proto:9:10: symbol "foo.Thing.name" already defined at published.proto:9:10`,
+				`new.proto:12:3: symbol "foo.KIND_UNSPECIFIED" already defined at published.proto:12:3; protobuf uses C++ scoping rules for enum values, so they exist in the scope enclosing the enum`,
+			},
+		},
+		{
+			name: "extension collision",
+			files: map[string]string{"new.proto": `
+syntax = "proto3";
+package bar;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string other_label = 50001;
+}`},
+			expected: []string{
+				`new.proto:6:24: extension with tag 50001 for message google.protobuf.FieldOptions already defined at published.proto:6:18`,
+			},
+		},
+		{
+			name: "new version of published file",
+			files: map[string]string{"published.proto": `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string label = 50001;
+  string other_label = 50002;
+}
+message Thing {
+  string name = 1;
+}`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []string
+			_, err := compileWithSymbols(t, linker.NewSymbolsFromSnapshot(&loaded), tc.files, &errs)
+			if len(tc.expected) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, tc.expected, errs)
+		})
+	}
+
+	// a new version of a file replaces the entries for the old version
+	syms = linker.NewSymbolsFromSnapshot(&loaded)
+	_, err = compileWithSymbols(t, syms, map[string]string{"published.proto": `
+syntax = "proto3";
+package foo;
+message Thing {
+  string name = 1;
+}`}, nil)
+	require.NoError(t, err)
+	snapshot = syms.Snapshot()
+	var names []string
+	for _, sym := range snapshot.Symbols {
+		if sym.Pos.Filename == "published.proto" {
+			names = append(names, string(sym.Name))
+		}
+	}
+	assert.Equal(t, []string{"foo.Thing", "foo.Thing.name"}, names)
+	for _, ext := range snapshot.Extensions {
+		assert.NotEqual(t, "published.proto", ext.Pos.Filename)
+	}
+}
+
+func compileWithSymbols(t *testing.T, syms *linker.Symbols, files map[string]string, errs *[]string) (linker.Files, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(files),
+		}),
+		Symbols: syms,
+	}
+	if errs != nil {
+		compiler.Reporter = reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+			*errs = append(*errs, err.Error())
+			return nil
+		}, nil)
+	}
+	return compiler.Compile(context.Background(), names...)
+}
+
+func TestSymbolsQueries(t *testing.T) {
+	syms := &linker.Symbols{}
+	_, err := compileWithSymbols(t, syms, map[string]string{
+		"published.proto": publishedProto,
+		"other.proto": `
+syntax = "proto3";
+package foo.bar;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.FieldOptions {
+  string a = 50002;
+  string b = 50004;
+  string c = 18999;
+}
+message Widget {}`,
+	}, nil)
+	require.NoError(t, err)
+
+	pos, ok := syms.Lookup("foo.Thing.name")
+	assert.True(t, ok)
+	assert.Equal(t, "published.proto:9:10", pos.String())
+	pos, ok = syms.Lookup("google.protobuf.FieldOptions")
+	assert.True(t, ok)
+	assert.Equal(t, "google/protobuf/descriptor.proto", pos.Filename)
+	_, ok = syms.Lookup("foo.Unknown")
+	assert.False(t, ok)
+
+	testCases := []struct {
+		pkg      protoreflect.FullName
+		expected []string
+	}{
+		{
+			pkg: "foo",
+			expected: []string{
+				"foo.KIND_UNSPECIFIED published.proto:12:3",
+				"foo.Kind published.proto:11:6",
+				"foo.Thing published.proto:8:9",
+				"foo.Thing.name published.proto:9:10",
+				"foo.bar.Widget other.proto:10:9",
+				"foo.bar.a other.proto:6:10",
+				"foo.bar.b other.proto:7:10",
+				"foo.bar.c other.proto:8:10",
+				"foo.label published.proto:6:10",
+			},
+		},
+		{
+			pkg: "foo.bar",
+			expected: []string{
+				"foo.bar.Widget other.proto:10:9",
+				"foo.bar.a other.proto:6:10",
+				"foo.bar.b other.proto:7:10",
+				"foo.bar.c other.proto:8:10",
+			},
+		},
+		{
+			pkg:      "foo.Thing",
+			expected: []string{"foo.Thing published.proto:8:9", "foo.Thing.name published.proto:9:10"},
+		},
+		{
+			pkg: "fo",
+		},
+	}
+	for _, tc := range testCases {
+		var actual []string
+		syms.RangeSymbols(tc.pkg, func(name protoreflect.FullName, pos ast.SourcePos) bool {
+			actual = append(actual, fmt.Sprintf("%s %v", name, pos))
+			return true
+		})
+		assert.Equal(t, tc.expected, actual, "package %q", tc.pkg)
+	}
+	count := 0
+	syms.RangeSymbols("", func(protoreflect.FullName, ast.SourcePos) bool {
+		count++
+		return count < 3
+	})
+	assert.Equal(t, 3, count)
+
+	assert.Equal(t, []protoreflect.FieldNumber{18999, 50001, 50002, 50004}, syms.Extensions("google.protobuf.FieldOptions"))
+	assert.Nil(t, syms.Extensions("google.protobuf.MessageOptions"))
+	pos, ok = syms.LookupExtension("google.protobuf.FieldOptions", 50002)
+	assert.True(t, ok)
+	assert.Equal(t, "other.proto:6:14", pos.String())
+	_, ok = syms.LookupExtension("google.protobuf.FieldOptions", 50003)
+	assert.False(t, ok)
+
+	nextCases := []struct {
+		start, end protoreflect.FieldNumber
+		expected   protoreflect.FieldNumber
+	}{
+		{start: 50001, end: 59999, expected: 50003},
+		{start: 50004, end: 59999, expected: 50005},
+		{start: 18999, end: 20000, expected: 20000},
+		{start: 50001, end: 50002},
+	}
+	for _, tc := range nextCases {
+		num, ok := syms.NextExtensionNumber("google.protobuf.FieldOptions", tc.start, tc.end)
+		assert.Equal(t, tc.expected != 0, ok, "range %d to %d", tc.start, tc.end)
+		assert.Equal(t, tc.expected, num, "range %d to %d", tc.start, tc.end)
+	}
+	num, ok := syms.NextExtensionNumber("foo.Thing", 100, 200)
+	assert.True(t, ok)
+	assert.Equal(t, protoreflect.FieldNumber(100), num)
+}
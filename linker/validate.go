@@ -9,7 +9,9 @@ import (
 )
 
 // ValidateExtensions runs some validation checks on extensions that can only
-// be done after files are linked and options are interpreted.
+// be done after files are linked and options are interpreted. This includes
+// checking that extensions match the extension declarations of the ranges
+// they extend.
 func (r *result) ValidateExtensions(handler *reporter.Handler) error {
 	return r.validateExtensions(r, handler)
 }
@@ -21,7 +23,13 @@ func (r *result) validateExtensions(d hasExtensionsAndMessages, handler *reporte
 		}
 	}
 	for i := 0; i < d.Messages().Len(); i++ {
-		if err := r.validateExtensions(d.Messages().Get(i), handler); err != nil {
+		md := d.Messages().Get(i)
+		if msgd, ok := md.(*msgDescriptor); ok {
+			if err := r.validateExtensionDeclarations(msgd, handler); err != nil {
+				return err
+			}
+		}
+		if err := r.validateExtensions(md, handler); err != nil {
 			return err
 		}
 	}
@@ -60,5 +68,5 @@ func (r *result) validateExtension(fld protoreflect.FieldDescriptor, handler *re
 		}
 	}
 
-	return nil
+	return r.checkExtensionDeclaration(fd, handler)
 }
@@ -0,0 +1,40 @@
+//go:build go1.18
+// +build go1.18
+
+package options
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+func FuzzInterpretOptions(f *testing.F) {
+	for _, seed := range []string{
+		`option go_package = "foo.bar"; option (must.link) = "FOO";`,
+		`message Test { option (must.link) = 1.234; option deprecated = true; }`,
+		`message Test { optional string uid = 1 [default = "\x00\xff", json_name = "UID"]; }`,
+		`syntax = "proto2"; message Test { optional float f = 1 [default = -inf]; optional bytes b = 2 [default = "abc"]; }`,
+		`enum Foo { option allow_alias = true; BAR = 0 [deprecated = true]; BAZ = 0; }`,
+		`service Svc { option (foo) = { a: 1 b: [ "x", "y" ] c < d: true > }; rpc M(Req) returns (Resp) { option idempotency_level = NO_SIDE_EFFECTS; } }`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, contents string) {
+		handler := reporter.NewHandler(reporter.NewReporter(func(reporter.ErrorWithPos) error {
+			return nil
+		}, nil))
+		file, err := parser.Parse("test.proto", strings.NewReader(contents), handler)
+		if err != nil {
+			return
+		}
+		res, err := parser.ResultFromAST(file, true, handler)
+		if err != nil {
+			return
+		}
+		// interpreting options must not panic, even if they are invalid
+		_, _ = InterpretUnlinkedOptions(res)
+	})
+}
@@ -0,0 +1,331 @@
+package options
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+)
+
+// InterpretedOption describes a value in an element's options and the source
+// that produced it.
+type InterpretedOption struct {
+	// The node that produced the value. This is an *ast.OptionNode for an
+	// option declaration, an *ast.MessageFieldNode for a field inside a
+	// message literal, or an ast.ValueNode for an element of an array
+	// literal.
+	Node ast.Node
+	// The option declaration that contains Node. When Node is an option
+	// declaration, this is the same as Node.
+	Option *ast.OptionNode
+	// The node for the value itself: the value of the option declaration
+	// or message literal field, or Node if it is an element of an array
+	// literal.
+	ValueNode ast.ValueNode
+	// The path from the element's options message to the value, in the same
+	// form as the paths in Index and ValueIndex. It is a sequence of field
+	// numbers, with an extra element for the index of the value when it is an
+	// element of a repeated field.
+	Path []int32
+	// The fields along Path, starting with a field or extension of the
+	// element's options message. It has one entry for each field number in
+	// Path (so not for the indexes).
+	Fields []protoreflect.FieldDescriptor
+	// The value at Path. If the last element of Path is a repeated field
+	// (instead of an index), this is the value of the entire field, so it
+	// includes values from all declarations that set the field. If Path
+	// refers to a map field or to one of its entries, this is the value of
+	// the entire map, since entries are not stored in source order. If a
+	// value cannot be found, this is the zero value (which is not valid).
+	Value protoreflect.Value
+}
+
+// InterpretedOptions returns the options that were interpreted for the given
+// descriptor, along with the source nodes that produced them. The descriptor
+// must be from the given linked result, and the given index must be the one
+// returned when its options were interpreted (see InterpretOptions). The
+// given value index, which may be nil, must be the one populated at the same
+// time (see WithValueIndex).
+//
+// The results are in the order the nodes appear in the source. Each option
+// declaration is followed by entries for the fields and array elements in its
+// value, if it is a message or array literal and a value index is given.
+// Pseudo-options, like "default" and "json_name", and options that were left
+// uninterpreted are not included. Nor are the entries of map fields (see
+// ValueIndex). If the descriptor is not from the given result or the result
+// has no AST, this returns nil.
+func InterpretedOptions(res linker.Result, index Index, values ValueIndex, d protoreflect.Descriptor) []InterpretedOption {
+	if d.ParentFile() == nil || d.ParentFile().Path() != res.Path() || res.AST() == nil {
+		return nil
+	}
+	descProto := descriptorProto(res.Proto(), d)
+	if descProto == nil {
+		return nil
+	}
+	optNodes := optionNodes(d, res.Node(descProto))
+	if len(optNodes) == 0 {
+		return nil
+	}
+	opts := resolvedOptions(res, d)
+	if opts == nil {
+		return nil
+	}
+
+	var results []InterpretedOption
+	for _, optNode := range optNodes {
+		path, ok := index[optNode]
+		if !ok || len(path) == 0 || path[0] < 0 {
+			// uninterpreted or a pseudo-option
+			continue
+		}
+		add := func(n ast.Node, val ast.ValueNode, path []int32) {
+			fields, v := optionValue(res, opts, path)
+			results = append(results, InterpretedOption{
+				Node:      n,
+				Option:    optNode,
+				ValueNode: val,
+				Path:      path,
+				Fields:    fields,
+				Value:     v,
+			})
+		}
+		add(optNode, optNode.Val, path)
+		ast.Inspect(optNode.Val, func(n ast.Node) bool {
+			path, ok := values[n]
+			if !ok {
+				return true
+			}
+			switch n := n.(type) {
+			case *ast.MessageFieldNode:
+				add(n, n.Val, path)
+			case ast.ValueNode:
+				add(n, n, path)
+			}
+			return true
+		})
+	}
+	return results
+}
+
+// descriptorProto returns the descriptor proto in the given file that
+// corresponds to the given descriptor, or nil if there is none.
+func descriptorProto(fd *descriptorpb.FileDescriptorProto, d protoreflect.Descriptor) proto.Message {
+	if _, ok := d.(protoreflect.FileDescriptor); ok {
+		return fd
+	}
+	parent := descriptorProto(fd, d.Parent())
+	if parent == nil {
+		return nil
+	}
+	i := d.Index()
+	switch d := d.(type) {
+	case protoreflect.MessageDescriptor:
+		switch parent := parent.(type) {
+		case *descriptorpb.FileDescriptorProto:
+			return elementAt(parent.MessageType, i)
+		case *descriptorpb.DescriptorProto:
+			return elementAt(parent.NestedType, i)
+		}
+	case protoreflect.FieldDescriptor:
+		switch parent := parent.(type) {
+		case *descriptorpb.FileDescriptorProto:
+			return elementAt(parent.Extension, i)
+		case *descriptorpb.DescriptorProto:
+			if d.IsExtension() {
+				return elementAt(parent.Extension, i)
+			}
+			return elementAt(parent.Field, i)
+		}
+	case protoreflect.OneofDescriptor:
+		if parent, ok := parent.(*descriptorpb.DescriptorProto); ok {
+			return elementAt(parent.OneofDecl, i)
+		}
+	case protoreflect.EnumDescriptor:
+		switch parent := parent.(type) {
+		case *descriptorpb.FileDescriptorProto:
+			return elementAt(parent.EnumType, i)
+		case *descriptorpb.DescriptorProto:
+			return elementAt(parent.EnumType, i)
+		}
+	case protoreflect.EnumValueDescriptor:
+		if parent, ok := parent.(*descriptorpb.EnumDescriptorProto); ok {
+			return elementAt(parent.Value, i)
+		}
+	case protoreflect.ServiceDescriptor:
+		if parent, ok := parent.(*descriptorpb.FileDescriptorProto); ok {
+			return elementAt(parent.Service, i)
+		}
+	case protoreflect.MethodDescriptor:
+		if parent, ok := parent.(*descriptorpb.ServiceDescriptorProto); ok {
+			return elementAt(parent.Method, i)
+		}
+	}
+	return nil
+}
+
+// elementAt returns the element of the given slice of descriptor protos at
+// the given index, or nil if the index is out of range.
+func elementAt(slice interface{}, i int) proto.Message {
+	var n int
+	var get func(int) proto.Message
+	switch s := slice.(type) {
+	case []*descriptorpb.DescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.FieldDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.OneofDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.EnumDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.EnumValueDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.ServiceDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	case []*descriptorpb.MethodDescriptorProto:
+		n, get = len(s), func(i int) proto.Message { return s[i] }
+	default:
+		panic(fmt.Sprintf("unexpected type: %T", slice))
+	}
+	if i < 0 || i >= n {
+		return nil
+	}
+	return get(i)
+}
+
+// optionNodes returns the option declarations for the given descriptor,
+// whose declaration is the given node.
+func optionNodes(d protoreflect.Descriptor, node ast.Node) []*ast.OptionNode {
+	var opts []*ast.OptionNode
+	switch d.(type) {
+	case protoreflect.FileDescriptor:
+		if n, ok := node.(*ast.FileNode); ok {
+			for _, decl := range n.Decls {
+				if opt, ok := decl.(*ast.OptionNode); ok {
+					opts = append(opts, opt)
+				}
+			}
+		}
+	case protoreflect.MessageDescriptor:
+		var decls []ast.MessageElement
+		switch n := node.(type) {
+		case *ast.MessageNode:
+			decls = n.Decls
+		case *ast.GroupNode:
+			decls = n.Decls
+		}
+		for _, decl := range decls {
+			if opt, ok := decl.(*ast.OptionNode); ok {
+				opts = append(opts, opt)
+			}
+		}
+	case protoreflect.FieldDescriptor, protoreflect.EnumValueDescriptor:
+		var compact *ast.CompactOptionsNode
+		switch n := node.(type) {
+		case *ast.FieldNode:
+			compact = n.Options
+		case *ast.GroupNode:
+			compact = n.Options
+		case *ast.MapFieldNode:
+			compact = n.Options
+		case *ast.EnumValueNode:
+			compact = n.Options
+		}
+		if compact != nil {
+			opts = compact.Options
+		}
+	case protoreflect.OneofDescriptor:
+		if n, ok := node.(*ast.OneOfNode); ok {
+			for _, decl := range n.Decls {
+				if opt, ok := decl.(*ast.OptionNode); ok {
+					opts = append(opts, opt)
+				}
+			}
+		}
+	case protoreflect.EnumDescriptor:
+		if n, ok := node.(*ast.EnumNode); ok {
+			for _, decl := range n.Decls {
+				if opt, ok := decl.(*ast.OptionNode); ok {
+					opts = append(opts, opt)
+				}
+			}
+		}
+	case protoreflect.ServiceDescriptor:
+		if n, ok := node.(*ast.ServiceNode); ok {
+			for _, decl := range n.Decls {
+				if opt, ok := decl.(*ast.OptionNode); ok {
+					opts = append(opts, opt)
+				}
+			}
+		}
+	case protoreflect.MethodDescriptor:
+		if n, ok := node.(*ast.RPCNode); ok {
+			for _, decl := range n.Decls {
+				if opt, ok := decl.(*ast.OptionNode); ok {
+					opts = append(opts, opt)
+				}
+			}
+		}
+	}
+	return opts
+}
+
+// resolvedOptions returns the options message for the given descriptor, with
+// custom options resolved to extension fields using the given result's
+// dependencies. It returns nil if the descriptor has no options.
+func resolvedOptions(res linker.Result, d protoreflect.Descriptor) protoreflect.Message {
+	opts := d.Options()
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+	// custom options are stored as unrecognized fields
+	resolved, err := linker.ResolveUnknownExtensions(opts, linker.ResolverFromFile(res))
+	if err != nil {
+		return nil
+	}
+	return resolved.ProtoReflect()
+}
+
+// optionValue returns the fields along the given path, starting from the
+// given options message, and the value at the end of the path. If the path
+// goes through a map field, the value is the entire map.
+func optionValue(res linker.Result, opts protoreflect.Message, path []int32) ([]protoreflect.FieldDescriptor, protoreflect.Value) {
+	var fields []protoreflect.FieldDescriptor
+	val := protoreflect.ValueOfMessage(opts)
+	resolver := linker.ResolverFromFile(res)
+	for i := 0; i < len(path); i++ {
+		if !val.IsValid() {
+			return fields, protoreflect.Value{}
+		}
+		msg := val.Message()
+		fld := msg.Descriptor().Fields().ByNumber(protoreflect.FieldNumber(path[i]))
+		if fld == nil {
+			xt, err := resolver.FindExtensionByNumber(msg.Descriptor().FullName(), protoreflect.FieldNumber(path[i]))
+			if err != nil {
+				return fields, protoreflect.Value{}
+			}
+			fld = xt.TypeDescriptor()
+		}
+		fields = append(fields, fld)
+		val = msg.Get(fld)
+		if fld.IsMap() {
+			// entries are not stored in source order, so the rest of the
+			// path can't be resolved
+			return fields, val
+		}
+		if i+1 == len(path) || !fld.IsList() {
+			continue
+		}
+		// the next path element is an index
+		i++
+		idx := int(path[i])
+		if idx >= val.List().Len() {
+			return fields, protoreflect.Value{}
+		}
+		val = val.List().Get(idx)
+	}
+	return fields, val
+}
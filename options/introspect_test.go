@@ -0,0 +1,195 @@
+package options_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/options"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+const introspectProto = `syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+option java_package = "com.foo";
+message Rule {
+  string name = 1;
+  repeated int32 codes = 2;
+  map<string, Rule> children = 3;
+}
+extend google.protobuf.MessageOptions {
+  Rule rule = 50001;
+  repeated string tags = 50002;
+}
+extend google.protobuf.FieldOptions {
+  int32 weight = 50001;
+}
+message Widget {
+  option deprecated = true;
+  option (rule) = {
+    name: "w"
+    codes: [1, 2]
+    children: [{key: "a" value: {name: "x"}}, {key: "b"}]
+  };
+  option (tags) = "t1";
+  option (tags) = "t2";
+  string id = 1 [json_name = "ID", (weight) = 5, deprecated = true];
+}
+enum Color {
+  option allow_alias = true;
+  RED = 0 [deprecated = true];
+  CRIMSON = 0;
+}
+`
+
+func TestInterpretedOptions(t *testing.T) {
+	h := reporter.NewHandler(nil)
+	fileNode, err := parser.Parse("test.proto", strings.NewReader(introspectProto), h)
+	require.NoError(t, err)
+	parsed, err := parser.ResultFromAST(fileNode, true, h)
+	require.NoError(t, err)
+	dep, err := linker.NewFileRecursive(descriptorpb.File_google_protobuf_descriptor_proto)
+	require.NoError(t, err)
+	res, err := linker.Link(parsed, linker.Files{dep}, nil, h)
+	require.NoError(t, err)
+	values := options.ValueIndex{}
+	index, err := options.InterpretOptions(res, h, options.WithValueIndex(values))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		element  protoreflect.FullName
+		expected []string
+	}{
+		{
+			element:  "foo",
+			expected: []string{`4:1 option [1] java_package = "com.foo"`},
+		},
+		{
+			element: "foo.Widget",
+			expected: []string{
+				`18:3 option [3] deprecated = true`,
+				`19:3 option [50001] (foo.rule) = {children:map[a:{name:"x"} b:{}] codes:[1 2] name:"w"}`,
+				`20:5 field [50001 1] (foo.rule).name = "w"`,
+				`21:5 field [50001 2] (foo.rule).codes = [1 2]`,
+				`21:13 element [50001 2 0] (foo.rule).codes = 1`,
+				`21:16 element [50001 2 1] (foo.rule).codes = 2`,
+				`22:5 field [50001 3] (foo.rule).children = map[a:{name:"x"} b:{}]`,
+				`24:3 option [50002 0] (foo.tags) = "t1"`,
+				`25:3 option [50002 1] (foo.tags) = "t2"`,
+			},
+		},
+		{
+			element: "foo.Widget.id",
+			expected: []string{
+				`26:36 option [50001] (foo.weight) = 5`,
+				`26:50 option [3] deprecated = true`,
+			},
+		},
+		{
+			element:  "foo.Color",
+			expected: []string{`29:3 option [2] allow_alias = true`},
+		},
+		{
+			element:  "foo.RED",
+			expected: []string{`30:12 option [1] deprecated = true`},
+		},
+		{
+			element: "foo.CRIMSON",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.element), func(t *testing.T) {
+			var d protoreflect.Descriptor
+			if tc.element == res.Package() {
+				d = res
+			} else {
+				d = res.FindDescriptorByName(tc.element)
+			}
+			require.NotNil(t, d)
+			var actual []string
+			for _, opt := range options.InterpretedOptions(res, index, values, d) {
+				if _, ok := opt.Node.(*ast.OptionNode); ok {
+					assert.Same(t, opt.Node, opt.Option)
+				}
+				actual = append(actual, describeOption(fileNode, opt))
+			}
+			assert.Equal(t, tc.expected, actual)
+
+			// without a value index, only option declarations are included
+			var decls []string
+			for _, exp := range tc.expected {
+				if strings.Contains(exp, " option ") {
+					decls = append(decls, exp)
+				}
+			}
+			actual = nil
+			for _, opt := range options.InterpretedOptions(res, index, nil, d) {
+				actual = append(actual, describeOption(fileNode, opt))
+			}
+			assert.Equal(t, decls, actual)
+		})
+	}
+}
+
+func describeOption(file *ast.FileNode, opt options.InterpretedOption) string {
+	var kind string
+	switch opt.Node.(type) {
+	case *ast.OptionNode:
+		kind = "option"
+	case *ast.MessageFieldNode:
+		kind = "field"
+	default:
+		kind = "element"
+	}
+	names := make([]string, len(opt.Fields))
+	for i, fld := range opt.Fields {
+		if fld.IsExtension() {
+			names[i] = "(" + string(fld.FullName()) + ")"
+		} else {
+			names[i] = string(fld.Name())
+		}
+	}
+	pos := file.NodeInfo(opt.Node).Start()
+	return fmt.Sprintf("%d:%d %s %v %s = %s", pos.Line, pos.Col, kind, opt.Path, strings.Join(names, "."), describeValue(opt.Value))
+}
+
+func describeValue(v protoreflect.Value) string {
+	switch v := v.Interface().(type) {
+	case protoreflect.Message:
+		var fields []string
+		v.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+			fields = append(fields, string(fd.Name())+":"+describeValue(v))
+			return true
+		})
+		sort.Strings(fields)
+		return "{" + strings.Join(fields, " ") + "}"
+	case protoreflect.List:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = describeValue(v.Get(i))
+		}
+		return "[" + strings.Join(elems, " ") + "]"
+	case protoreflect.Map:
+		var entries []string
+		v.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			entries = append(entries, k.String()+":"+describeValue(v))
+			return true
+		})
+		sort.Strings(entries)
+		return "map[" + strings.Join(entries, " ") + "]"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -13,10 +13,14 @@ package options
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -36,12 +40,39 @@ import (
 // to the resolved option field.
 type Index map[*ast.OptionNode][]int32
 
+// ValueIndex is a mapping of AST nodes inside option values to a corresponding
+// path, like the paths in Index. When an option's value is a message literal,
+// each *ast.MessageFieldNode in the literal maps to the path of the field it
+// sets. When a field's value is an array literal, each element of the array
+// (an ast.ValueNode) maps to the path of the corresponding list element. The
+// paths have the same root as the paths in Index, so they all begin with the
+// path of the enclosing option's field.
+//
+// Entries of map fields, and the nodes inside them, are not included. Their
+// positions in the encoded options do not correspond to their positions in
+// the source, so there is no path that refers to them. A field node that sets
+// a map field maps to the path of the map field itself.
+//
+// Use WithValueIndex to have the interpreter populate a ValueIndex.
+type ValueIndex map[ast.Node][]int32
+
 type interpreter struct {
 	file     file
 	resolver linker.Resolver
 	lenient  bool
-	reporter *reporter.Handler
-	index    Index
+	// in lenient mode, whether errors are reported to the handler instead
+	// of being ignored
+	reportLenient bool
+	reporter      *reporter.Handler
+	index         Index
+	// paths of values inside message literals; may be nil
+	values ValueIndex
+	// validators for custom options; may be nil
+	validators *Validators
+	// if non-nil, interpretation stops early when this is cancelled
+	ctx context.Context
+	// nodes that define custom JSON names for fields, for reporting conflicts
+	jsonNames map[*descriptorpb.FieldDescriptorProto]ast.Node
 }
 
 type file interface {
@@ -74,8 +105,11 @@ func (n noResolveFile) ResolveExtension(name protoreflect.FullName) protoreflect
 //
 // The given handler is used to report errors and warnings. If any errors are
 // reported, this function returns a non-nil error.
-func InterpretOptions(linked linker.Result, handler *reporter.Handler) (Index, error) {
-	return interpretOptions(false, linked, handler)
+//
+// Semantic validation of custom option values can be added by providing
+// validators via the WithValidators option.
+func InterpretOptions(linked linker.Result, handler *reporter.Handler, interpOpts ...InterpreterOption) (Index, error) {
+	return interpretOptions(false, linked, handler, interpOpts...)
 }
 
 // InterpretOptionsLenient interprets options in a lenient/best-effort way in
@@ -91,6 +125,27 @@ func InterpretOptionsLenient(linked linker.Result) (Index, error) {
 	return interpretOptions(true, linked, reporter.NewHandler(nil))
 }
 
+// InterpretOptionsPartial interprets as many options as possible in the given
+// linked result, returning an index that can be used to generate source code
+// info. This is useful for files whose imports could not all be resolved, such
+// as when compiling in lenient mode (see the Lenient field of
+// protocompile.Compiler): custom options that are defined in the file itself
+// or in imports that were resolved are interpreted, even if options defined in
+// other imports cannot be.
+//
+// Like InterpretOptionsLenient, options that cannot be interpreted remain in
+// the "uninterpreted_option" fields. But, unlike that function, the errors
+// that prevent their interpretation are reported to the given handler.
+// Options whose names could not be resolved by the linker are not reported
+// again, since the linker already reported them. This function only returns
+// a non-nil error if the handler aborts, by returning an error when one is
+// reported.
+func InterpretOptionsPartial(linked linker.Result, handler *reporter.Handler, interpOpts ...InterpreterOption) (Index, error) {
+	return interpretOptions(true, linked, handler, append(interpOpts, func(interp *interpreter) {
+		interp.reportLenient = true
+	})...)
+}
+
 // InterpretUnlinkedOptions does a best-effort attempt to interpret options in
 // the given parsed result, returning an index that can be used to generate
 // source code info. This step mutates the parsed result's underlying proto to
@@ -106,12 +161,16 @@ func InterpretUnlinkedOptions(parsed parser.Result) (Index, error) {
 	return interpretOptions(true, noResolveFile{parsed}, reporter.NewHandler(nil))
 }
 
-func interpretOptions(lenient bool, file file, handler *reporter.Handler) (Index, error) {
+func interpretOptions(lenient bool, file file, handler *reporter.Handler, interpOpts ...InterpreterOption) (Index, error) {
 	interp := interpreter{
-		file:     file,
-		lenient:  lenient,
-		reporter: handler,
-		index:    Index{},
+		file:      file,
+		lenient:   lenient,
+		reporter:  handler,
+		index:     Index{},
+		jsonNames: map[*descriptorpb.FieldDescriptorProto]ast.Node{},
+	}
+	for _, opt := range interpOpts {
+		opt(&interp)
 	}
 	if f, ok := file.(linker.File); ok {
 		interp.resolver = linker.ResolverFromFile(f)
@@ -196,6 +255,9 @@ func (interp *interpreter) interpretMessageOptions(fqn string, md *descriptorpb.
 			return err
 		}
 	}
+	if err := interp.checkJsonNameConflicts(fqn, md); err != nil {
+		return err
+	}
 	for _, ood := range md.GetOneofDecl() {
 		oodFqn := fqn + "." + ood.GetName()
 		opts := ood.GetOptions()
@@ -261,8 +323,8 @@ func (interp *interpreter) interpretFieldOptions(fqn string, fld *descriptorpb.F
 				if err := interp.reporter.HandleErrorf(interp.nodeInfo(optNode.GetValue()).Start(), "%s: expecting string value for json_name option", scope); err != nil {
 					return err
 				}
-			} else {
-				fld.JsonName = proto.String(string(opt.StringValue))
+			} else if err := interp.checkJsonName(scope, fld, string(opt.StringValue), optNode.GetValue()); err != nil {
+				return err
 			}
 		}
 
@@ -290,6 +352,56 @@ func (interp *interpreter) interpretFieldOptions(fqn string, fld *descriptorpb.F
 	return nil
 }
 
+// checkJsonName validates the given custom JSON name for the given field. If
+// it is valid, the field's JSON name is updated.
+func (interp *interpreter) checkJsonName(scope string, fld *descriptorpb.FieldDescriptorProto, jsonName string, node ast.Node) error {
+	pos := interp.nodeInfo(node).Start()
+	if fld.Extendee != nil {
+		return interp.reporter.HandleErrorf(pos, "%s: option json_name is not allowed on extensions", scope)
+	}
+	if jsonName == "" {
+		return interp.reporter.HandleErrorf(pos, "%s: custom JSON name cannot be empty", scope)
+	}
+	if strings.HasPrefix(jsonName, "[") && strings.HasSuffix(jsonName, "]") {
+		// the JSON format uses bracketed names to refer to extensions
+		return interp.reporter.HandleErrorf(pos, "%s: custom JSON name %q cannot be enclosed in brackets", scope, jsonName)
+	}
+	for _, r := range jsonName {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return interp.reporter.HandleErrorf(pos, "%s: custom JSON name %q contains invalid character %q", scope, jsonName, r)
+		}
+	}
+	fld.JsonName = proto.String(jsonName)
+	interp.jsonNames[fld] = node
+	return nil
+}
+
+// checkJsonNameConflicts checks that custom JSON names of fields in the given
+// message do not conflict with the JSON names of other fields. Conflicts
+// between two default JSON names are checked by the parser.
+func (interp *interpreter) checkJsonNameConflicts(fqn string, md *descriptorpb.DescriptorProto) error {
+	isProto3 := interp.file.Proto().GetSyntax() == "proto3"
+	scope := fmt.Sprintf("message %s", fqn)
+	for _, conflict := range internal.JsonNameConflicts(md, false, true) {
+		pos := interp.jsonNamePos(conflict.Field, conflict.Custom)
+		existingPos := interp.jsonNamePos(conflict.Existing, conflict.ExistingCustom)
+		err := conflict.Err(scope, existingPos)
+		if !conflict.IsError(isProto3) {
+			interp.reporter.HandleWarning(pos, err)
+		} else if err := interp.reporter.HandleError(reporter.Error(pos, err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (interp *interpreter) jsonNamePos(fld *descriptorpb.FieldDescriptorProto, custom bool) ast.SourcePos {
+	if node := interp.jsonNames[fld]; custom && node != nil {
+		return interp.nodeInfo(node).Start()
+	}
+	return interp.nodeInfo(interp.file.FieldNode(fld).FieldName()).Start()
+}
+
 func (interp *interpreter) processDefaultOption(scope string, fqn string, fld *descriptorpb.FieldDescriptorProto, uos []*descriptorpb.UninterpretedOption) (defaultIndex int, err error) {
 	found, err := internal.FindOption(interp.file, interp.reporter, scope, uos, "default")
 	if err != nil || found == -1 {
@@ -390,6 +502,11 @@ func (interp *interpreter) interpretEnumOptions(fqn string, ed *descriptorpb.Enu
 }
 
 func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Message, uninterpreted []*descriptorpb.UninterpretedOption) ([]*descriptorpb.UninterpretedOption, error) {
+	if interp.ctx != nil {
+		if err := interp.ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
 	optsFqn := string(opts.ProtoReflect().Descriptor().FullName())
 	var msg protoreflect.Message
 	// see if the parse included an override copy for these options
@@ -406,10 +523,11 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 
 	mc := &messageContext{res: interp.file, file: interp.file.Proto(), elementName: fqn, elementType: descriptorType(element)}
 	var remain []*descriptorpb.UninterpretedOption
+	var validated []validatedOption
 	for _, uo := range uninterpreted {
 		node := interp.file.OptionNode(uo)
 		if !uo.Name[0].GetIsExtension() && uo.Name[0].GetNamePart() == "uninterpreted_option" {
-			if interp.lenient {
+			if interp.lenient && !interp.reportLenient {
 				remain = append(remain, uo)
 				continue
 			}
@@ -417,11 +535,32 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 			if err := interp.reporter.HandleErrorf(interp.nodeInfo(node.GetName()).Start(), "%vinvalid option 'uninterpreted_option'", mc); err != nil {
 				return nil, err
 			}
+			if interp.lenient {
+				remain = append(remain, uo)
+				continue
+			}
+		}
+		if interp.reportLenient && !interp.namesResolved(uo) {
+			// the linker already reported that the name could not be resolved
+			remain = append(remain, uo)
+			continue
 		}
 		mc.option = uo
-		path, err := interp.interpretField(mc, element, msg, uo, 0, nil)
+		var path []int32
+		var err error
+		if interp.reportLenient {
+			path, err = interp.interpretFieldPartial(mc, element, msg, uo)
+		} else {
+			path, err = interp.interpretField(mc, element, msg, uo, 0, nil)
+		}
 		if err != nil {
-			if interp.lenient {
+			// when reporting errors, any other error means the handler aborted
+			if interp.lenient && (!interp.reportLenient || err == errOptionNotInterpreted) {
+				if optn, ok := node.(*ast.OptionNode); ok {
+					// the option remains uninterpreted, so the value index
+					// must not have entries for anything inside its value
+					interp.removeValueEntries(optn.GetValue())
+				}
 				remain = append(remain, uo)
 				continue
 			}
@@ -430,6 +569,7 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 		if optn, ok := node.(*ast.OptionNode); ok {
 			interp.index[optn] = path
 		}
+		validated = interp.recordValidatedOption(validated, uo)
 	}
 
 	if interp.lenient {
@@ -437,6 +577,12 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 		// and leave it partially populated. So we convert into a copy first
 		optsClone := opts.ProtoReflect().New().Interface()
 		if err := cloneInto(optsClone, msg.Interface(), interp.resolver); err != nil {
+			if interp.reportLenient {
+				node := interp.file.Node(element)
+				if err := interp.reporter.HandleError(reporter.Error(interp.nodeInfo(node).Start(), err)); err != nil {
+					return nil, err
+				}
+			}
 			// TODO: do this in a more granular way, so we can convert individual
 			// fields and leave bad ones uninterpreted instead of skipping all of
 			// the work we've done so far.
@@ -447,6 +593,11 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 		proto.Reset(opts)
 		proto.Merge(opts, optsClone)
 
+		if interp.reportLenient {
+			if err := interp.validateOptions(mc, fqn, element, msg, validated); err != nil {
+				return nil, err
+			}
+		}
 		return remain, nil
 	}
 
@@ -463,9 +614,53 @@ func (interp *interpreter) interpretOptions(fqn string, element, opts proto.Mess
 		return nil, interp.reporter.HandleError(reporter.Error(interp.nodeInfo(node).Start(), err))
 	}
 
+	if err := interp.validateOptions(mc, fqn, element, msg, validated); err != nil {
+		return nil, err
+	}
+
 	return nil, nil
 }
 
+// errOptionNotInterpreted is returned by interpretFieldPartial when an option
+// could not be interpreted but the handler did not abort.
+var errOptionNotInterpreted = errors.New("option not interpreted")
+
+// interpretFieldPartial interprets the given option, like interpretField,
+// except that errors are reported via a sub-handler. If any errors are
+// reported, the option could not be interpreted, so this returns
+// errOptionNotInterpreted, even if the handler did not abort.
+func (interp *interpreter) interpretFieldPartial(mc *messageContext, element proto.Message, msg protoreflect.Message, opt *descriptorpb.UninterpretedOption) ([]int32, error) {
+	handler := interp.reporter
+	interp.reporter = handler.SubHandler()
+	defer func() {
+		interp.reporter = handler
+	}()
+	path, err := interp.interpretField(mc, element, msg, opt, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if interp.reporter.Error() != nil {
+		return nil, errOptionNotInterpreted
+	}
+	return path, nil
+}
+
+// namesResolved returns true if the extension names in the given option
+// were resolved by the linker, which replaces them with fully-qualified names
+// that have a leading dot.
+func (interp *interpreter) namesResolved(opt *descriptorpb.UninterpretedOption) bool {
+	for _, nm := range opt.Name {
+		if !nm.GetIsExtension() {
+			continue
+		}
+		name := nm.GetNamePart()
+		if !strings.HasPrefix(name, ".") || interp.file.ResolveExtension(protoreflect.FullName(name[1:])) == nil {
+			return false
+		}
+	}
+	return true
+}
+
 func cloneInto(dest proto.Message, src proto.Message, res linker.Resolver) error {
 	if dest.ProtoReflect().Descriptor() == src.ProtoReflect().Descriptor() {
 		proto.Reset(dest)
@@ -688,7 +883,7 @@ func (interp *interpreter) interpretField(mc *messageContext, element proto.Mess
 	}
 
 	optNode := interp.file.OptionNode(opt)
-	if err := interp.setOptionField(mc, msg, fld, node, optNode.GetValue()); err != nil {
+	if _, err := interp.setOptionField(mc, msg, fld, node, optNode.GetValue(), pathPrefix); err != nil {
 		return nil, interp.reporter.HandleError(err)
 	}
 	if fld.IsMap() {
@@ -699,12 +894,39 @@ func (interp *interpreter) interpretField(mc *messageContext, element proto.Mess
 	return path, nil
 }
 
-func (interp *interpreter) setOptionField(mc *messageContext, msg protoreflect.Message, fld protoreflect.FieldDescriptor, name ast.Node, val ast.ValueNode) error {
+// recordValue records the path of the given node inside an option value, if
+// the interpreter is populating a value index.
+func (interp *interpreter) recordValue(n ast.Node, path []int32) {
+	if interp.values != nil {
+		interp.values[n] = path
+	}
+}
+
+// removeValueEntries removes the value index entries for the nodes inside the
+// given option value.
+func (interp *interpreter) removeValueEntries(val ast.ValueNode) {
+	if interp.values == nil {
+		return
+	}
+	ast.Inspect(val, func(n ast.Node) bool {
+		delete(interp.values, n)
+		return true
+	})
+}
+
+// setOptionField sets the given field of msg to the given value. The given
+// path is the path to msg. The returned path is the path to the field that
+// was set, including the index of the value if the field is a list and the
+// value is not an array literal. Paths are also recorded in the value index
+// for the contents of message literals in the given value, except for those
+// in map entries.
+func (interp *interpreter) setOptionField(mc *messageContext, msg protoreflect.Message, fld protoreflect.FieldDescriptor, name ast.Node, val ast.ValueNode, path []int32) ([]int32, error) {
+	fieldPath := append(dup(path), int32(fld.Number()))
 	v := val.Value()
 	if sl, ok := v.([]ast.ValueNode); ok {
 		// handle slices a little differently than the others
 		if fld.Cardinality() != protoreflect.Repeated {
-			return reporter.Errorf(interp.nodeInfo(val).Start(), "%vvalue is an array but field is not repeated", mc)
+			return nil, reporter.Errorf(interp.nodeInfo(val).Start(), "%vvalue is an array but field is not repeated", mc)
 		}
 		origPath := mc.optAggPath
 		defer func() {
@@ -712,11 +934,16 @@ func (interp *interpreter) setOptionField(mc *messageContext, msg protoreflect.M
 		}()
 		for index, item := range sl {
 			mc.optAggPath = fmt.Sprintf("%s[%d]", origPath, index)
-			value, err := interp.fieldValue(mc, fld, item)
+			itemPath := fieldPath
+			if fld.IsList() {
+				itemPath = append(dup(fieldPath), interp.nextIndex(msg, fld))
+			}
+			value, err := interp.fieldValue(mc, fld, item, itemPath)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			if fld.IsMap() {
+				interp.removeValueEntries(item)
 				entry := value.Message()
 				key := entry.Get(fld.MapKey()).MapKey()
 				val := entry.Get(fld.MapValue())
@@ -725,21 +952,28 @@ func (interp *interpreter) setOptionField(mc *messageContext, msg protoreflect.M
 				}
 				msg.Mutable(fld).Map().Set(key, val)
 			} else {
+				interp.recordValue(item, itemPath)
 				msg.Mutable(fld).List().Append(value)
 			}
 		}
-		return nil
+		return fieldPath, nil
 	}
 
-	value, err := interp.fieldValue(mc, fld, val)
+	if fld.IsList() {
+		fieldPath = append(fieldPath, interp.nextIndex(msg, fld))
+	}
+	value, err := interp.fieldValue(mc, fld, val, fieldPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if fld.IsMap() {
+		interp.removeValueEntries(val)
 	}
 
 	if ood := fld.ContainingOneof(); ood != nil {
 		existingFld := msg.WhichOneof(ood)
 		if existingFld != nil && existingFld.Number() != fld.Number() {
-			return reporter.Errorf(interp.nodeInfo(name).Start(), "%voneof %q already has field %q set", mc, ood.Name(), fieldName(existingFld))
+			return nil, reporter.Errorf(interp.nodeInfo(name).Start(), "%voneof %q already has field %q set", mc, ood.Name(), fieldName(existingFld))
 		}
 	}
 
@@ -755,12 +989,21 @@ func (interp *interpreter) setOptionField(mc *messageContext, msg protoreflect.M
 		msg.Mutable(fld).List().Append(value)
 	} else {
 		if msg.Has(fld) {
-			return reporter.Errorf(interp.nodeInfo(name).Start(), "%vnon-repeated option field %s already set", mc, fieldName(fld))
+			return nil, reporter.Errorf(interp.nodeInfo(name).Start(), "%vnon-repeated option field %s already set", mc, fieldName(fld))
 		}
 		msg.Set(fld, value)
 	}
 
-	return nil
+	return fieldPath, nil
+}
+
+// nextIndex returns the index of the next value that will be added to the
+// given repeated field of msg.
+func (interp *interpreter) nextIndex(msg protoreflect.Message, fld protoreflect.FieldDescriptor) int32 {
+	if !msg.Has(fld) {
+		return 0
+	}
+	return int32(msg.Get(fld).List().Len())
 }
 
 type messageContext struct {
@@ -850,7 +1093,10 @@ func valueKind(val interface{}) string {
 	}
 }
 
-func (interp *interpreter) fieldValue(mc *messageContext, fld protoreflect.FieldDescriptor, val ast.ValueNode) (protoreflect.Value, error) {
+// fieldValue computes the value of the given field from the given AST node.
+// The given path is the path to the value, which is used to record the paths
+// of fields in message literals in the index.
+func (interp *interpreter) fieldValue(mc *messageContext, fld protoreflect.FieldDescriptor, val ast.ValueNode, path []int32) (protoreflect.Value, error) {
 	k := fld.Kind()
 	switch k {
 	case protoreflect.EnumKind:
@@ -910,9 +1156,11 @@ func (interp *interpreter) fieldValue(mc *messageContext, fld protoreflect.Field
 				if ffld == nil {
 					return protoreflect.Value{}, reporter.Errorf(interp.nodeInfo(val).Start(), "%vfield %s not found", mc, string(a.Name.Name.AsIdentifier()))
 				}
-				if err := interp.setOptionField(mc, fdm, ffld, a.Name, a.Val); err != nil {
+				fieldPath, err := interp.setOptionField(mc, fdm, ffld, a.Name, a.Val, path)
+				if err != nil {
 					return protoreflect.Value{}, err
 				}
+				interp.recordValue(a, fieldPath)
 			}
 			return protoreflect.ValueOfMessage(fdm), nil
 		}
@@ -1064,3 +1312,7 @@ func descriptorType(m proto.Message) string {
 		return fmt.Sprintf("%T", m)
 	}
 }
+
+func dup(p []int32) []int32 {
+	return append(([]int32)(nil), p...)
+}
@@ -6,8 +6,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/descriptorpb"
 
+	"github.com/jhump/protocompile/internal"
 	"github.com/jhump/protocompile/parser"
 	"github.com/jhump/protocompile/reporter"
 )
@@ -244,3 +247,34 @@ func qualify(qualifier, name string) string {
 	}
 	return qualifier + "." + name
 }
+
+func TestLegacyJsonFieldConflicts(t *testing.T) {
+	withUnknown := func(vals ...uint64) *descriptorpb.MessageOptions {
+		opts := &descriptorpb.MessageOptions{Deprecated: proto.Bool(true)}
+		var unknown []byte
+		unknown = protowire.AppendTag(unknown, 1000, protowire.BytesType)
+		unknown = protowire.AppendBytes(unknown, []byte("abc"))
+		for _, val := range vals {
+			unknown = protowire.AppendTag(unknown, internal.MessageOptions_deprecatedLegacyJsonFieldConflictsTag, protowire.VarintType)
+			unknown = protowire.AppendVarint(unknown, val)
+		}
+		opts.ProtoReflect().SetUnknown(unknown)
+		return opts
+	}
+	assert.False(t, internal.LegacyJsonFieldConflicts(nil))
+	assert.False(t, internal.LegacyJsonFieldConflicts(&descriptorpb.MessageOptions{}))
+	assert.False(t, internal.LegacyJsonFieldConflicts(withUnknown()))
+	assert.True(t, internal.LegacyJsonFieldConflicts(withUnknown(1)))
+	assert.False(t, internal.LegacyJsonFieldConflicts(withUnknown(1, 0)))
+
+	uninterpreted := func(val string) *descriptorpb.MessageOptions {
+		return &descriptorpb.MessageOptions{
+			UninterpretedOption: []*descriptorpb.UninterpretedOption{{
+				Name:            []*descriptorpb.UninterpretedOption_NamePart{{NamePart: proto.String("deprecated_legacy_json_field_conflicts"), IsExtension: proto.Bool(false)}},
+				IdentifierValue: proto.String(val),
+			}},
+		}
+	}
+	assert.True(t, internal.LegacyJsonFieldConflicts(uninterpreted("true")))
+	assert.False(t, internal.LegacyJsonFieldConflicts(uninterpreted("false")))
+}
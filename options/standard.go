@@ -0,0 +1,193 @@
+package options
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/reporter"
+	"github.com/jhump/protocompile/walk"
+)
+
+// ValidateStandardOptions checks that the standard options (those defined in
+// google/protobuf/descriptor.proto) that are set in the given linked result
+// are valid for the elements on which they are set. This enforces the rules
+// that protoc enforces for these options:
+//  * The packed option may only be set on repeated fields of scalar types.
+//  * The lazy option may only be set on fields whose type is a message.
+//  * The ctype option may only be set on string and bytes fields, and it
+//    may not be CORD for extensions.
+//  * Files that do not use optimize_for = LITE_RUNTIME may not import files
+//    that do.
+//  * A file's java_outer_classname should not match the name of one of its
+//    top-level types unless java_multiple_files is true. Like protoc, which
+//    only complains about this when generating Java code, this is reported
+//    as a warning.
+//
+// Other rules, like the prohibition on setting map_entry explicitly, are
+// enforced when the file is parsed or when its options are interpreted.
+//
+// This must be called after the result's options have been interpreted. The
+// given index, which is returned from InterpretOptions, is used to report
+// errors at the positions of the offending options. Any errors or warnings
+// encountered are reported via the given handler. If any error is reported,
+// this function returns a non-nil error.
+func ValidateStandardOptions(res linker.Result, index Index, handler *reporter.Handler) error {
+	handler = handler.SubHandler()
+	v := &standardValidator{res: res, index: index, handler: handler}
+	if err := v.validateFile(); err != nil {
+		return err
+	}
+	if err := walk.Descriptors(res, func(d protoreflect.Descriptor) error {
+		if fld, ok := d.(protoreflect.FieldDescriptor); ok {
+			return v.validateField(fld)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return handler.Error()
+}
+
+type standardValidator struct {
+	res     linker.Result
+	index   Index
+	handler *reporter.Handler
+}
+
+func (v *standardValidator) validateFile() error {
+	opts, _ := v.res.Options().(*descriptorpb.FileOptions)
+	if opts.GetOptimizeFor() != descriptorpb.FileOptions_LITE_RUNTIME {
+		imports := v.res.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			dep := imports.Get(i).FileDescriptor
+			depOpts, _ := dep.Options().(*descriptorpb.FileOptions)
+			if depOpts.GetOptimizeFor() == descriptorpb.FileOptions_LITE_RUNTIME {
+				pos := v.importPos(dep.Path())
+				if err := v.handler.HandleErrorf(pos, "files that do not use optimize_for = LITE_RUNTIME cannot import files which do use this option; this file is not lite, but it imports %q which is", dep.Path()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	outerClassname := opts.GetJavaOuterClassname()
+	if outerClassname != "" && !opts.GetJavaMultipleFiles() {
+		var conflict protoreflect.Descriptor
+		if d := v.res.Messages().ByName(protoreflect.Name(outerClassname)); d != nil {
+			conflict = d
+		} else if d := v.res.Enums().ByName(protoreflect.Name(outerClassname)); d != nil {
+			conflict = d
+		} else if d := v.res.Services().ByName(protoreflect.Name(outerClassname)); d != nil {
+			conflict = d
+		}
+		if conflict != nil {
+			pos := v.optionPos(v.res, internal.FileOptions_javaOuterClassnameTag)
+			v.handler.HandleWarning(pos, fmt.Errorf("java_outer_classname %q matches the name of %s %s; Java code cannot be generated unless java_multiple_files is true", outerClassname, descriptorKind(conflict), conflict.FullName()))
+		}
+	}
+	return nil
+}
+
+func (v *standardValidator) validateField(fld protoreflect.FieldDescriptor) error {
+	if fld.ContainingMessage().IsMapEntry() {
+		// synthesized by the compiler, so no options to check
+		return nil
+	}
+	opts, _ := fld.Options().(*descriptorpb.FieldOptions)
+	if opts == nil {
+		return nil
+	}
+	scope := fmt.Sprintf("field %s", fld.FullName())
+	if fld.IsExtension() {
+		scope = fmt.Sprintf("extension %s", fld.FullName())
+	}
+	if opts.GetPacked() && !isPackable(fld) {
+		pos := v.optionPos(fld, internal.FieldOptions_packedTag)
+		if err := v.handler.HandleErrorf(pos, "%s: [packed = true] can only be specified for repeated primitive fields", scope); err != nil {
+			return err
+		}
+	}
+	if opts.GetLazy() && fld.Kind() != protoreflect.MessageKind {
+		pos := v.optionPos(fld, internal.FieldOptions_lazyTag)
+		if err := v.handler.HandleErrorf(pos, "%s: [lazy = true] can only be specified for submessage fields", scope); err != nil {
+			return err
+		}
+	}
+	if opts.Ctype != nil {
+		if fld.Kind() != protoreflect.StringKind && fld.Kind() != protoreflect.BytesKind {
+			pos := v.optionPos(fld, internal.FieldOptions_ctypeTag)
+			if err := v.handler.HandleErrorf(pos, "%s: [ctype = %v] can only be specified for string and bytes fields", scope, opts.GetCtype()); err != nil {
+				return err
+			}
+		} else if fld.IsExtension() && opts.GetCtype() == descriptorpb.FieldOptions_CORD {
+			pos := v.optionPos(fld, internal.FieldOptions_ctypeTag)
+			if err := v.handler.HandleErrorf(pos, "%s: [ctype = CORD] is not supported for extensions", scope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isPackable returns true if the given field may use the packed option.
+func isPackable(fld protoreflect.FieldDescriptor) bool {
+	if fld.Cardinality() != protoreflect.Repeated {
+		return false
+	}
+	switch fld.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind, protoreflect.MessageKind, protoreflect.GroupKind:
+		return false
+	default:
+		return true
+	}
+}
+
+// optionPos returns the position of the name of the option declaration on
+// the given descriptor that sets the standard option with the given tag. If
+// no such declaration is found, it returns the position of the descriptor's
+// declaration.
+func (v *standardValidator) optionPos(d protoreflect.Descriptor, tag int32) ast.SourcePos {
+	file := v.res.FileNode()
+	descProto := descriptorProto(v.res.Proto(), d)
+	if descProto == nil {
+		return ast.UnknownPos(v.res.Path())
+	}
+	node := v.res.Node(descProto)
+	for _, opt := range optionNodes(d, node) {
+		if path, ok := v.index[opt]; ok && len(path) > 0 && path[0] == tag {
+			return file.NodeInfo(opt.Name).Start()
+		}
+	}
+	return file.NodeInfo(node).Start()
+}
+
+// importPos returns the position of the import statement for the given path.
+func (v *standardValidator) importPos(path string) ast.SourcePos {
+	file := v.res.FileNode()
+	if fileNode, ok := file.(*ast.FileNode); ok {
+		for _, decl := range fileNode.Decls {
+			if imp, ok := decl.(*ast.ImportNode); ok && imp.Name.AsString() == path {
+				return file.NodeInfo(imp.Name).Start()
+			}
+		}
+	}
+	return file.NodeInfo(file).Start()
+}
+
+func descriptorKind(d protoreflect.Descriptor) string {
+	switch d.(type) {
+	case protoreflect.MessageDescriptor:
+		return "message"
+	case protoreflect.EnumDescriptor:
+		return "enum"
+	case protoreflect.ServiceDescriptor:
+		return "service"
+	default:
+		return "element"
+	}
+}
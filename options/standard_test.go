@@ -0,0 +1,261 @@
+package options_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/reporter"
+)
+
+func TestValidateStandardOptions(t *testing.T) {
+	testCases := []struct {
+		name             string
+		source           string
+		expectedErrs     []string
+		expectedWarnings []string
+	}{
+		{
+			name: "valid",
+			source: `
+				syntax = "proto2";
+				package foo;
+				option java_outer_classname = "FooProto";
+				message Foo {
+				  repeated int32 a = 1 [packed = true];
+				  repeated Color b = 2 [packed = true];
+				  optional Foo c = 3 [lazy = true];
+				  optional string d = 4 [ctype = CORD];
+				  repeated bytes e = 5 [ctype = STRING_PIECE];
+				  repeated string f = 6 [packed = false];
+				  optional int32 g = 7 [lazy = false];
+				  extensions 100 to 200;
+				}
+				enum Color {
+				  RED = 0;
+				}
+				extend Foo {
+				  optional string h = 100 [ctype = STRING];
+				}`,
+		},
+		{
+			name: "packed",
+			source: `
+				syntax = "proto2";
+				package foo;
+				message Foo {
+				  optional int32 a = 1 [packed = true];
+				  repeated string b = 2 [deprecated = true, packed = true];
+				  repeated Foo c = 3 [packed = true];
+				}`,
+			expectedErrs: []string{
+				"test.proto:5:57: field foo.Foo.a: [packed = true] can only be specified for repeated primitive fields",
+				"test.proto:6:77: field foo.Foo.b: [packed = true] can only be specified for repeated primitive fields",
+				"test.proto:7:55: field foo.Foo.c: [packed = true] can only be specified for repeated primitive fields",
+			},
+		},
+		{
+			name: "lazy",
+			source: `
+				syntax = "proto3";
+				package foo;
+				message Foo {
+				  string a = 1 [lazy = true];
+				  map<string, Foo> b = 2 [lazy = true];
+				}`,
+			expectedErrs: []string{
+				"test.proto:5:49: field foo.Foo.a: [lazy = true] can only be specified for submessage fields",
+			},
+		},
+		{
+			name: "ctype",
+			source: `
+				syntax = "proto2";
+				package foo;
+				message Foo {
+				  optional int64 a = 1 [ctype = STRING];
+				  extensions 100 to 200;
+				}
+				extend Foo {
+				  optional bytes b = 100 [ctype = CORD];
+				}`,
+			expectedErrs: []string{
+				"test.proto:5:57: field foo.Foo.a: [ctype = STRING] can only be specified for string and bytes fields",
+				"test.proto:9:59: extension foo.b: [ctype = CORD] is not supported for extensions",
+			},
+		},
+		{
+			name: "lite import",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "lite.proto";
+				message Foo {
+				  bar.Lite lite = 1;
+				}`,
+			expectedErrs: []string{
+				`test.proto:4:40: files that do not use optimize_for = LITE_RUNTIME cannot import files which do use this option; this file is not lite, but it imports "lite.proto" which is`,
+			},
+		},
+		{
+			name: "lite import from lite file",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "lite.proto";
+				option optimize_for = LITE_RUNTIME;
+				message Foo {
+				  bar.Lite lite = 1;
+				}`,
+		},
+		{
+			name: "java outer classname",
+			source: `
+				syntax = "proto3";
+				package foo;
+				option java_outer_classname = "Foo";
+				message Foo {
+				}`,
+			expectedWarnings: []string{
+				`test.proto:4:40: java_outer_classname "Foo" matches the name of message foo.Foo; Java code cannot be generated unless java_multiple_files is true`,
+			},
+		},
+		{
+			name: "java outer classname with multiple files",
+			source: `
+				syntax = "proto3";
+				package foo;
+				option java_outer_classname = "Foo";
+				option java_multiple_files = true;
+				message Foo {
+				}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs, warnings []string
+			compiler := protocompile.Compiler{
+				Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+					Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+						"lite.proto": `
+							syntax = "proto3";
+							package bar;
+							option optimize_for = LITE_RUNTIME;
+							message Lite {}`,
+						"test.proto": tc.source,
+					}),
+				}),
+				Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+					errs = append(errs, err.Error())
+					return nil
+				}, func(err reporter.ErrorWithPos) {
+					warnings = append(warnings, err.Error())
+				}),
+			}
+			_, err := compiler.Compile(context.Background(), "test.proto")
+			if len(tc.expectedErrs) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, tc.expectedErrs, errs)
+			assert.Equal(t, tc.expectedWarnings, warnings)
+		})
+	}
+}
+
+func TestLegacyJsonFieldConflictsOption(t *testing.T) {
+	// a subset of a version of descriptor.proto that is newer than the one
+	// in the protobuf runtime and that has deprecated_legacy_json_field_conflicts
+	const descriptorProto = `
+		syntax = "proto2";
+		package google.protobuf;
+		message MessageOptions {
+		  optional bool deprecated_legacy_json_field_conflicts = 11;
+		  repeated UninterpretedOption uninterpreted_option = 999;
+		  extensions 1000 to max;
+		}
+		message UninterpretedOption {
+		  message NamePart {
+		    required string name_part = 1;
+		    required bool is_extension = 2;
+		  }
+		  repeated NamePart name = 2;
+		  optional string identifier_value = 3;
+		  optional uint64 positive_int_value = 4;
+		  optional int64 negative_int_value = 5;
+		  optional double double_value = 6;
+		  optional bytes string_value = 7;
+		  optional string aggregate_value = 8;
+		}`
+	testCases := []struct {
+		name         string
+		source       string
+		expectedErrs []string
+	}{
+		{
+			name: "default names",
+			source: `
+				syntax = "proto3";
+				import "google/protobuf/descriptor.proto";
+				message Foo {
+				  option deprecated_legacy_json_field_conflicts = true;
+				  string foo_bar = 1;
+				  string fooBar = 2;
+				}`,
+		},
+		{
+			name: "custom names",
+			source: `
+				syntax = "proto3";
+				import "google/protobuf/descriptor.proto";
+				message Foo {
+				  option deprecated_legacy_json_field_conflicts = true;
+				  string foo = 1 [json_name = "bar"];
+				  string bar = 2;
+				  string baz = 3 [json_name = "bar"];
+				}`,
+		},
+		{
+			name: "disabled",
+			source: `
+				syntax = "proto3";
+				import "google/protobuf/descriptor.proto";
+				message Foo {
+				  option deprecated_legacy_json_field_conflicts = false;
+				  string foo_bar = 1;
+				  string fooBar = 2;
+				}`,
+			expectedErrs: []string{
+				`test.proto:7:42: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at test.proto:6:42`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var errs []string
+			compiler := protocompile.Compiler{
+				Resolver: &protocompile.SourceResolver{
+					Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+						"google/protobuf/descriptor.proto": descriptorProto,
+						"test.proto":                       tc.source,
+					}),
+				},
+				Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+					errs = append(errs, err.Error())
+					return nil
+				}, nil),
+			}
+			_, err := compiler.Compile(context.Background(), "test.proto")
+			if len(tc.expectedErrs) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, tc.expectedErrs, errs)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package options
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// InterpreterOption is an option that can be passed to InterpretOptions to
+// customize how options are interpreted.
+type InterpreterOption func(*interpreter)
+
+// WithValidators returns an option that causes the interpreter to invoke the
+// given validators for the custom options it interprets.
+func WithValidators(validators *Validators) InterpreterOption {
+	return func(interp *interpreter) {
+		interp.validators = validators
+	}
+}
+
+// WithValueIndex returns an option that causes the interpreter to record, in
+// the given index, the paths of the fields and array elements inside message
+// literals in option values.
+func WithValueIndex(index ValueIndex) InterpreterOption {
+	return func(interp *interpreter) {
+		interp.values = index
+	}
+}
+
+// WithContext returns an option that causes the interpreter to stop early if
+// the given context is cancelled. The context is checked before the options
+// of each element are interpreted. If it is cancelled, the context's error is
+// returned (it is not reported to the handler).
+func WithContext(ctx context.Context) InterpreterOption {
+	return func(interp *interpreter) {
+		interp.ctx = ctx
+	}
+}
+
+// OptionValidator performs semantic validation of the value of a custom
+// option. If the value is not valid, it returns an error. If the error is a
+// reporter.ErrorWithPos, it is reported as is. Otherwise, it is reported at
+// the position of the first declaration of the option (see OptionValue.Nodes).
+type OptionValidator func(OptionValue) error
+
+// OptionValue is the data provided to an OptionValidator.
+type OptionValue struct {
+	// The extension that defines the custom option.
+	Extension protoreflect.ExtensionTypeDescriptor
+	// The interpreted value of the option. If the option is repeated, this is
+	// a list that includes all values for the option on the target element.
+	Value protoreflect.Value
+	// The element on which the option is set. For options on an extension
+	// range, this is the message that contains the range.
+	Target protoreflect.Descriptor
+	// The option declarations that set the value, in the order they appear
+	// in the source. There is more than one when the option is repeated or
+	// when fields of a message option are set in separate declarations, like
+	// "option (foo).bar = 1; option (foo).baz = 2;".
+	Nodes []ast.OptionDeclNode
+
+	file ast.FileDeclNode
+}
+
+// Pos returns the position of the given node, which should be one of the
+// nodes in v.Nodes or a descendant of one. This can be used to construct a
+// reporter.ErrorWithPos that refers to a particular part of the option's
+// value.
+func (v OptionValue) Pos(n ast.Node) ast.SourcePos {
+	return v.file.NodeInfo(n).Start()
+}
+
+// Validators is a registry of validators for custom options, keyed by the
+// fully-qualified name of the extension that defines the option. The zero
+// value is an empty registry that is ready to use. A registry is not safe to
+// modify concurrently with its use in interpreting options.
+type Validators struct {
+	validators map[protoreflect.FullName][]OptionValidator
+}
+
+// Register adds the given validator for the custom option defined by the
+// extension with the given name. More than one validator may be registered
+// for the same extension, in which case they are invoked in the order they
+// were registered.
+func (v *Validators) Register(extension protoreflect.FullName, validator OptionValidator) {
+	if v.validators == nil {
+		v.validators = map[protoreflect.FullName][]OptionValidator{}
+	}
+	v.validators[extension] = append(v.validators[extension], validator)
+}
+
+func (v *Validators) get(extension protoreflect.FullName) []OptionValidator {
+	if v == nil {
+		return nil
+	}
+	return v.validators[extension]
+}
+
+// validatedOption is a custom option that was interpreted for an element and
+// has at least one registered validator.
+type validatedOption struct {
+	ext protoreflect.ExtensionTypeDescriptor
+	uos []*descriptorpb.UninterpretedOption
+}
+
+// recordValidatedOption records that the given uninterpreted option, which
+// was successfully interpreted, should be validated. It is a no-op if no
+// validators are registered for the option.
+func (interp *interpreter) recordValidatedOption(opts []validatedOption, uo *descriptorpb.UninterpretedOption) []validatedOption {
+	if !uo.Name[0].GetIsExtension() {
+		return opts
+	}
+	name := protoreflect.FullName(strings.TrimPrefix(uo.Name[0].GetNamePart(), "."))
+	if len(interp.validators.get(name)) == 0 {
+		return opts
+	}
+	for i := range opts {
+		if opts[i].ext.FullName() == name {
+			opts[i].uos = append(opts[i].uos, uo)
+			return opts
+		}
+	}
+	ext := interp.file.ResolveExtension(name)
+	if ext == nil {
+		return opts
+	}
+	return append(opts, validatedOption{ext: ext, uos: []*descriptorpb.UninterpretedOption{uo}})
+}
+
+// validateOptions invokes validators for the given custom options, whose
+// values are in msg.
+func (interp *interpreter) validateOptions(mc *messageContext, fqn string, element interface{}, msg protoreflect.Message, opts []validatedOption) error {
+	if len(opts) == 0 {
+		return nil
+	}
+	target := interp.target(fqn, element)
+	if target == nil {
+		return nil
+	}
+	for _, opt := range opts {
+		nodes := make([]ast.OptionDeclNode, len(opt.uos))
+		for i, uo := range opt.uos {
+			nodes[i] = interp.file.OptionNode(uo)
+		}
+		val := OptionValue{
+			Extension: opt.ext,
+			Value:     msg.Get(opt.ext),
+			Target:    target,
+			Nodes:     nodes,
+			file:      interp.file.FileNode(),
+		}
+		mc.option = opt.uos[0]
+		for _, validate := range interp.validators.get(opt.ext.FullName()) {
+			err := validate(val)
+			if err == nil {
+				continue
+			}
+			if _, ok := err.(reporter.ErrorWithPos); !ok {
+				err = reporter.Errorf(interp.nodeInfo(nodes[0].GetName()).Start(), "%v%v", mc, err)
+			}
+			if err := interp.reporter.HandleError(err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// target returns the descriptor for the element with the given name and
+// proto, or nil if it cannot be found.
+func (interp *interpreter) target(fqn string, element interface{}) protoreflect.Descriptor {
+	file, ok := interp.file.(linker.File)
+	if !ok {
+		return nil
+	}
+	var parent, name string
+	if pos := strings.LastIndexByte(fqn, '.'); pos >= 0 {
+		parent, name = fqn[:pos], fqn[pos+1:]
+	}
+	switch element.(type) {
+	case *descriptorpb.FileDescriptorProto:
+		return file
+	case *descriptorpb.DescriptorProto_ExtensionRange:
+		// the name of an extension range is the message name plus the range,
+		// like "foo.Bar.100-200"
+		return file.FindDescriptorByName(protoreflect.FullName(parent))
+	case *descriptorpb.OneofDescriptorProto:
+		if md, ok := file.FindDescriptorByName(protoreflect.FullName(parent)).(protoreflect.MessageDescriptor); ok {
+			if ood := md.Oneofs().ByName(protoreflect.Name(name)); ood != nil {
+				return ood
+			}
+		}
+		return nil
+	case *descriptorpb.EnumValueDescriptorProto:
+		// the given name is qualified by the enum, but the full name of an
+		// enum value is a sibling of the enum
+		if ed, ok := file.FindDescriptorByName(protoreflect.FullName(parent)).(protoreflect.EnumDescriptor); ok {
+			if evd := ed.Values().ByName(protoreflect.Name(name)); evd != nil {
+				return evd
+			}
+		}
+		return nil
+	default:
+		return file.FindDescriptorByName(protoreflect.FullName(fqn))
+	}
+}
@@ -0,0 +1,232 @@
+package options_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/options"
+	"github.com/jhump/protocompile/parser"
+	"github.com/jhump/protocompile/reporter"
+)
+
+const validatorsOptionsProto = `
+syntax = "proto3";
+package foo;
+import "google/protobuf/descriptor.proto";
+message Route {
+  string path = 1;
+  string method = 2;
+}
+extend google.protobuf.FieldOptions {
+  string pattern = 50001;
+  repeated string tags = 50002;
+}
+extend google.protobuf.MessageOptions {
+  Route route = 50001;
+}
+extend google.protobuf.EnumValueOptions {
+  string alias = 50001;
+}
+extend google.protobuf.OneofOptions {
+  bool exclusive = 50001;
+}
+`
+
+func newTestValidators(calls *[]string) *options.Validators {
+	var validators options.Validators
+	// a string option that must be a valid regular expression
+	validators.Register("foo.pattern", func(v options.OptionValue) error {
+		*calls = append(*calls, fmt.Sprintf("pattern %s", v.Target.FullName()))
+		_, err := regexp.Compile(v.Value.String())
+		return err
+	})
+	// a repeated option whose values must be unique
+	validators.Register("foo.tags", func(v options.OptionValue) error {
+		*calls = append(*calls, fmt.Sprintf("tags %s %d %d", v.Target.FullName(), v.Value.List().Len(), len(v.Nodes)))
+		seen := map[string]bool{}
+		for i := 0; i < v.Value.List().Len(); i++ {
+			tag := v.Value.List().Get(i).String()
+			if seen[tag] {
+				// all tags are declared with separate options in the test, so
+				// the index of the value is the index of the node
+				return reporter.Errorf(v.Pos(v.Nodes[i].GetValue()), "duplicate tag %q", tag)
+			}
+			seen[tag] = true
+		}
+		return nil
+	})
+	// a message option whose path must refer to fields of the target
+	validators.Register("foo.route", func(v options.OptionValue) error {
+		*calls = append(*calls, fmt.Sprintf("route %s %d", v.Target.FullName(), len(v.Nodes)))
+		md := v.Target.(protoreflect.MessageDescriptor)
+		route := v.Value.Message()
+		path := route.Get(route.Descriptor().Fields().ByName("path")).String()
+		for _, part := range strings.Split(path, "/") {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				name := part[1 : len(part)-1]
+				if md.Fields().ByName(protoreflect.Name(name)) == nil {
+					return fmt.Errorf("path refers to unknown field %q", name)
+				}
+			}
+		}
+		return nil
+	})
+	validators.Register("foo.route", func(v options.OptionValue) error {
+		route := v.Value.Message()
+		method := route.Get(route.Descriptor().Fields().ByName("method")).String()
+		if method != "" && method != "GET" && method != "POST" {
+			return errors.New("method must be GET or POST")
+		}
+		return nil
+	})
+	validators.Register("foo.alias", func(v options.OptionValue) error {
+		*calls = append(*calls, fmt.Sprintf("alias %s", v.Target.FullName()))
+		return nil
+	})
+	validators.Register("foo.exclusive", func(v options.OptionValue) error {
+		*calls = append(*calls, fmt.Sprintf("exclusive %s", v.Target.FullName()))
+		return nil
+	})
+	return &validators
+}
+
+func TestOptionValidators(t *testing.T) {
+	testCases := []struct {
+		name          string
+		source        string
+		expectedErrs  []string
+		expectedCalls []string
+	}{
+		{
+			name: "valid",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "options.proto";
+				message Widget {
+				  option (route).path = "/widgets/{id}";
+				  option (route).method = "GET";
+				  string id = 1 [(pattern) = "^[a-z]+$", (tags) = "a", (tags) = "b"];
+				  oneof kind {
+				    option (exclusive) = true;
+				    string name = 2;
+				  }
+				}
+				enum Color {
+				  COLOR_UNSPECIFIED = 0 [(alias) = "none"];
+				}`,
+			expectedCalls: []string{
+				"route foo.Widget 2",
+				"pattern foo.Widget.id",
+				"tags foo.Widget.id 2 2",
+				"exclusive foo.Widget.kind",
+				"alias foo.COLOR_UNSPECIFIED",
+			},
+		},
+		{
+			name: "invalid regex",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "options.proto";
+				message Widget {
+				  string id = 1 [(pattern) = "[a-z"];
+				}`,
+			expectedErrs: []string{
+				"test.proto:6:50: field foo.Widget.id: option (foo.pattern): error parsing regexp: missing closing ]: `[a-z`",
+			},
+			expectedCalls: []string{"pattern foo.Widget.id"},
+		},
+		{
+			name: "positioned error",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "options.proto";
+				message Widget {
+				  string id = 1 [(tags) = "a", (tags) = "b",
+				                 (tags) = "a"];
+				}`,
+			expectedErrs: []string{
+				`test.proto:7:59: duplicate tag "a"`,
+			},
+			expectedCalls: []string{"tags foo.Widget.id 3 3"},
+		},
+		{
+			name: "multiple validators and errors",
+			source: `
+				syntax = "proto3";
+				package foo;
+				import "options.proto";
+				message Widget {
+				  option (route) = { path: "/widgets/{name}" method: "PUT" };
+				  string id = 1;
+				}
+				message Gadget {
+				  option (route).method = "DELETE";
+				}`,
+			expectedErrs: []string{
+				`test.proto:6:42: message foo.Widget: option (foo.route): path refers to unknown field "name"`,
+				`test.proto:6:42: message foo.Widget: option (foo.route): method must be GET or POST`,
+				`test.proto:10:42: message foo.Gadget: option (foo.route).method: method must be GET or POST`,
+			},
+			expectedCalls: []string{"route foo.Widget 1", "route foo.Gadget 1"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls, errs []string
+			compiler := protocompile.Compiler{
+				Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+					Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+						"options.proto": validatorsOptionsProto,
+						"test.proto":    tc.source,
+					}),
+				}),
+				Reporter: reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+					errs = append(errs, err.Error())
+					return nil
+				}, nil),
+				OptionValidators: newTestValidators(&calls),
+			}
+			_, err := compiler.Compile(context.Background(), "test.proto")
+			if len(tc.expectedErrs) == 0 {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+			assert.Equal(t, tc.expectedErrs, errs)
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestInterpretOptionsWithContext(t *testing.T) {
+	h := reporter.NewHandler(nil)
+	fileNode, err := parser.Parse("test.proto", strings.NewReader(introspectProto), h)
+	require.NoError(t, err)
+	parsed, err := parser.ResultFromAST(fileNode, true, h)
+	require.NoError(t, err)
+	dep, err := linker.NewFileRecursive(descriptorpb.File_google_protobuf_descriptor_proto)
+	require.NoError(t, err)
+	res, err := linker.Link(parsed, linker.Files{dep}, nil, h)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = options.InterpretOptions(res, h, options.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	// the cancellation is not reported as an error in the file
+	assert.NoError(t, h.Error())
+}
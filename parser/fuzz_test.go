@@ -0,0 +1,124 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// addSeedCorpus adds the test proto source files in the repo as seeds for
+// the given fuzz target. This does not include testdata/largeproto.proto
+// since large inputs make fuzzing too slow to be useful.
+func addSeedCorpus(f *testing.F) {
+	err := filepath.Walk("../internal/testprotos", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f.Add(data)
+		return nil
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+}
+
+func nonAbortingHandler() *reporter.Handler {
+	return reporter.NewHandler(reporter.NewReporter(func(reporter.ErrorWithPos) error {
+		return nil
+	}, nil))
+}
+
+func FuzzLexer(f *testing.F) {
+	addSeedCorpus(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l, err := NewLexer("fuzz.proto", bytes.NewReader(data), nonAbortingHandler())
+		if err != nil {
+			t.Fatal(err)
+		}
+		prevEnd := -1
+		// every token consumes at least one byte, except for the final
+		// EOF token, so this bounds the loop
+		for i := 0; i <= len(data)+1; i++ {
+			tok, err := l.Next()
+			if err != nil {
+				// some errors, like invalid UTF-8, prevent further lexing
+				return
+			}
+			start := tok.Start().Offset
+			if start < prevEnd {
+				t.Fatalf("token %q at offset %d overlaps previous token, which ended at %d", tok.Text(), start, prevEnd)
+			}
+			if tok.Kind == TokenEOF {
+				return
+			}
+			if tok.Text() == "" {
+				t.Fatalf("token at offset %d has no text", start)
+			}
+			prevEnd = start + len(tok.Text())
+		}
+		t.Fatal("lexer never returned EOF")
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	addSeedCorpus(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := Parse("fuzz.proto", bytes.NewReader(data), nonAbortingHandler())
+		if file == nil {
+			t.Fatal("Parse returned nil AST")
+		}
+		hdr, hdrErr := ParseHeader("fuzz.proto", bytes.NewReader(data), nonAbortingHandler())
+		if err != nil {
+			return
+		}
+		if hdrErr != nil {
+			t.Fatalf("ParseHeader failed but Parse succeeded: %v", hdrErr)
+		}
+		if len(hdr.Imports) > countImports(file) {
+			t.Fatalf("ParseHeader found %d imports but Parse found only %d", len(hdr.Imports), countImports(file))
+		}
+
+		// a successfully parsed AST must print exactly the original source
+		// (unless it's empty, in which case the parser returns a synthetic
+		// empty AST that doesn't include any whitespace or comments)
+		isEmpty := file.Syntax == nil && len(file.Decls) == 0
+		if !isEmpty && !bytes.HasPrefix(data, utf8Bom) && utf8.Valid(data) {
+			var buf bytes.Buffer
+			if err := ast.Print(&buf, file); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatalf("printed AST does not match source:\n%s\n---\n%s", buf.Bytes(), data)
+			}
+		}
+
+		// creating a descriptor must not panic, even if the file is invalid
+		_, _ = ResultFromAST(file, true, nonAbortingHandler())
+	})
+}
+
+func countImports(file *ast.FileNode) int {
+	var count int
+	for _, decl := range file.Decls {
+		if _, ok := decl.(*ast.ImportNode); ok {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"io"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// Header contains the declarations in the header of a file. The header is
+// everything in the file that precedes the first message, enum, extend, or
+// service declaration.
+type Header struct {
+	// The AST for the header. It contains only the header declarations. Its
+	// EOF token is positioned at the start of the first declaration after
+	// the header (or at the end of the file if there is none) and holds the
+	// comments that precede that declaration.
+	AST *ast.FileNode
+	// The syntax declaration, or nil if the file has none.
+	Syntax *ast.SyntaxNode
+	// The package declaration, or nil if the file has none.
+	Package *ast.PackageNode
+	Imports []*ast.ImportNode
+	Options []*ast.OptionNode
+}
+
+// ParseHeader is like Parse, except that it only parses the header of the
+// file: the syntax, package, import, and file option declarations. Parsing
+// stops at the first declaration that is not part of the header, so this is
+// much faster than Parse for large files. It is useful when only the header is
+// needed, such as to discover a file's dependencies.
+//
+// The protobuf language allows header declarations to appear after other
+// declarations, such as an import statement after a message. But these are
+// very uncommon, and they are not included in the returned header.
+//
+// If any errors are reported while parsing the header, this function returns
+// a non-nil error. Errors in the rest of the file are not detected.
+func ParseHeader(filename string, r io.Reader, handler *reporter.Handler) (*Header, error) {
+	lx, err := newLexer(r, filename, handler)
+	if err != nil {
+		return nil, err
+	}
+	lx.headerOnly = true
+	protoParse(lx)
+	if lx.res == nil || len(lx.res.Children()) == 0 {
+		if handler.Error() == nil {
+			// the header is empty, but the EOF token still indicates
+			// where the rest of the file starts
+			lx.res = ast.NewFileNode(lx.info, nil, nil, lx.eof)
+		} else {
+			// nil AST means there was an error that prevented any parsing
+			lx.res = ast.NewEmptyFileNode(filename)
+		}
+	}
+	hdr := &Header{AST: lx.res, Syntax: lx.res.Syntax}
+	for _, decl := range lx.res.Decls {
+		switch decl := decl.(type) {
+		case *ast.PackageNode:
+			if hdr.Package == nil {
+				hdr.Package = decl
+			}
+		case *ast.ImportNode:
+			hdr.Imports = append(hdr.Imports, decl)
+		case *ast.OptionNode:
+			hdr.Options = append(hdr.Options, decl)
+		}
+	}
+	return hdr, handler.Error()
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+func TestParseHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		source   string
+		syntax   string
+		pkg      string
+		imports  []string
+		options  []string
+		eofPos   string
+		errMsg   string
+		fullDecl int
+	}{
+		{
+			name:   "empty",
+			source: "",
+			eofPos: "test.proto:1:1",
+		},
+		{
+			name:   "header only",
+			source: "syntax = \"proto3\";\npackage foo.bar;\nimport \"a.proto\";\nimport public \"b.proto\";\noption go_package = \"foo/bar\";\n",
+			syntax: "proto3",
+			pkg:    "foo.bar",
+			imports: []string{
+				"a.proto",
+				"b.proto",
+			},
+			options: []string{"go_package"},
+			eofPos:  "test.proto:6:1",
+		},
+		{
+			name: "stops at first message",
+			source: `syntax = "proto2";
+import "a.proto";
+// Foo is a message
+message Foo {
+  optional string name = 1;
+}
+import "b.proto";
+`,
+			syntax:  "proto2",
+			imports: []string{"a.proto"},
+			eofPos:  "test.proto:4:1",
+		},
+		{
+			name:   "no header",
+			source: "enum Foo { FOO = 0; }\n",
+			eofPos: "test.proto:1:1",
+		},
+		{
+			name: "option with message literal",
+			source: `package foo;
+option (foo) = { message: 1 enum: [ FOO ] service { name: "x" } };
+;
+option (bar).service = true;
+service Svc {}
+`,
+			pkg:     "foo",
+			options: []string{"(foo)", "(bar).service"},
+			eofPos:  "test.proto:5:1",
+		},
+		{
+			name:   "errors after header are ignored",
+			source: "package foo;\nmessage Foo { this is not valid }\n",
+			pkg:    "foo",
+			eofPos: "test.proto:2:1",
+		},
+		{
+			name:   "error in header",
+			source: "package foo;\nimport foo.proto;\n",
+			errMsg: `test.proto:2:8: syntax error: unexpected identifier, expecting string literal or "weak" or "public"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hdr, err := ParseHeader("test.proto", strings.NewReader(tc.source), reporter.NewHandler(nil))
+			if tc.errMsg != "" {
+				assert.EqualError(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			if tc.syntax == "" {
+				assert.Nil(t, hdr.Syntax)
+			} else {
+				require.NotNil(t, hdr.Syntax)
+				assert.Equal(t, tc.syntax, hdr.Syntax.Syntax.AsString())
+			}
+			if tc.pkg == "" {
+				assert.Nil(t, hdr.Package)
+			} else {
+				require.NotNil(t, hdr.Package)
+				assert.Equal(t, tc.pkg, string(hdr.Package.Name.AsIdentifier()))
+			}
+			var imports []string
+			for _, imp := range hdr.Imports {
+				imports = append(imports, imp.Name.AsString())
+			}
+			assert.Equal(t, tc.imports, imports)
+			var options []string
+			for _, opt := range hdr.Options {
+				options = append(options, ast.OptionName(opt.Name))
+			}
+			assert.Equal(t, tc.options, options)
+			assert.Equal(t, tc.eofPos, hdr.AST.NodeInfo(hdr.AST.EOF).Start().String())
+		})
+	}
+}
+
+func TestParseHeaderMatchesParse(t *testing.T) {
+	err := filepath.Walk("../internal/testprotos", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		t.Run(path, func(t *testing.T) {
+			data, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			file, err := Parse(path, bytes.NewReader(data), reporter.NewHandler(nil))
+			require.NoError(t, err)
+			hdr, err := ParseHeader(path, bytes.NewReader(data), reporter.NewHandler(nil))
+			require.NoError(t, err)
+
+			var expected []string
+			if file.Syntax != nil {
+				expected = append(expected, file.NodeInfo(file.Syntax).Start().String())
+			}
+		decls:
+			for _, decl := range file.Decls {
+				switch decl.(type) {
+				case *ast.PackageNode, *ast.ImportNode, *ast.OptionNode:
+					expected = append(expected, file.NodeInfo(decl).Start().String())
+				case *ast.EmptyDeclNode:
+				default:
+					break decls
+				}
+			}
+			var actual []string
+			if hdr.Syntax != nil {
+				actual = append(actual, hdr.AST.NodeInfo(hdr.Syntax).Start().String())
+			}
+			for _, decl := range hdr.AST.Decls {
+				if _, ok := decl.(*ast.EmptyDeclNode); !ok {
+					actual = append(actual, hdr.AST.NodeInfo(decl).Start().String())
+				}
+			}
+			assert.Equal(t, expected, actual)
+		})
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func BenchmarkParseHeader(b *testing.B) {
+	r := readerForTestdata(b, "largeproto.proto")
+	bs, err := ioutil.ReadAll(r)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.ReportAllocs()
+		hdr, err := ParseHeader("largeproto.proto", bytes.NewReader(bs), reporter.NewHandler(nil))
+		require.NoError(b, err)
+		assert.Equal(b, "google.privacy.dlp.v2", string(hdr.Package.Name.AsIdentifier()))
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -71,6 +72,22 @@ type protoLex struct {
 	eof        ast.Token
 
 	comments []ast.Token
+
+	// if true, lexing stops at the first top-level declaration that
+	// is not part of the file header
+	headerOnly bool
+	depth      int
+
+	// optional context and limits, when parsing with limits
+	ctx        context.Context
+	limits     Limits
+	tokenCount int
+	declCount  int
+	// if non-nil, lexing was aborted and this is the reason
+	abortErr error
+	// true if an error reading the input (like invalid UTF-8) has
+	// already been reported
+	inputErrReported bool
 }
 
 var utf8Bom = []byte{0xEF, 0xBB, 0xBF}
@@ -159,6 +176,19 @@ func (l *protoLex) Lex(lval *protoSymType) int {
 
 	l.comments = nil
 
+	if l.abortErr != nil {
+		return 0
+	}
+	if l.ctx != nil {
+		l.tokenCount++
+		if l.tokenCount%cancelCheckInterval == 0 {
+			if err := l.ctx.Err(); err != nil {
+				l.abortErr = err
+				return 0
+			}
+		}
+	}
+
 	for {
 		l.input.setMark()
 
@@ -172,6 +202,15 @@ func (l *protoLex) Lex(lval *protoSymType) int {
 			l.eof = lval.b.Token()
 			return 0
 		} else if err != nil {
+			if l.inputErrReported {
+				// The input can't be read past this point. The error has
+				// already been reported, so we treat it like EOF. Otherwise,
+				// the parser would keep asking for more tokens, forever.
+				l.setRune(lval, 0)
+				l.eof = lval.b.Token()
+				return 0
+			}
+			l.inputErrReported = true
 			l.setError(lval, err)
 			return _ERROR
 		}
@@ -210,6 +249,14 @@ func (l *protoLex) Lex(lval *protoSymType) int {
 			l.readIdentifier()
 			token := l.input.getMark()
 			str := string(token)
+			if l.headerOnly && l.atEndOfHeader(str) {
+				// rewind so the EOF token is positioned at the start
+				// of this identifier
+				l.input.pos = l.input.mark
+				l.setRune(lval, 0)
+				l.eof = lval.b.Token()
+				return 0
+			}
 			if t, ok := keywords[str]; ok {
 				l.setIdent(lval, str)
 				return t
@@ -273,6 +320,9 @@ func (l *protoLex) Lex(lval *protoSymType) int {
 		if c == '\'' || c == '"' {
 			// string literal
 			str, err := l.readStringLiteral(c)
+			if limitErr, ok := err.(*LimitError); ok {
+				return l.abort(limitErr)
+			}
 			if err != nil {
 				l.setError(lval, err)
 				return _ERROR
@@ -319,11 +369,41 @@ func (l *protoLex) Lex(lval *protoSymType) int {
 			l.setError(lval, errors.New("invalid character"))
 			return _ERROR
 		}
+		switch c {
+		case '{', '[', '<':
+			l.depth++
+			if l.limits.MaxNestingDepth > 0 && l.depth > l.limits.MaxNestingDepth {
+				return l.abort(&LimitError{Limit: limitNestingDepth, Max: l.limits.MaxNestingDepth})
+			}
+		case '}', ']', '>':
+			l.depth--
+		}
 		l.setRune(lval, c)
 		return int(c)
 	}
 }
 
+// atEndOfHeader returns true if the given identifier starts a top-level
+// declaration that is not part of the file header. The header includes
+// the syntax, package, import, and option declarations.
+func (l *protoLex) atEndOfHeader(ident string) bool {
+	if l.depth > 0 {
+		return false
+	}
+	if l.prevSym != nil {
+		if rn, ok := l.prevSym.(*ast.RuneNode); !ok || rn.Rune != ';' {
+			// not the start of a declaration
+			return false
+		}
+	}
+	switch ident {
+	case "syntax", "package", "import", "option":
+		return false
+	default:
+		return true
+	}
+}
+
 func parseFloat(token string) (float64, error) {
 	// strconv.ParseFloat allows _ to separate digits, but protobuf does not
 	if strings.ContainsRune(token, '_') {
@@ -538,6 +618,9 @@ func (l *protoLex) readStringLiteral(quote rune) (string, error) {
 		if c == quote {
 			break
 		}
+		if l.limits.MaxStringLength > 0 && buf.Len() > l.limits.MaxStringLength {
+			return "", &LimitError{Limit: limitStringLength, Max: l.limits.MaxStringLength}
+		}
 		if c == 0 {
 			return "", errors.New("null character ('\\0') not allowed in string literal")
 		}
@@ -665,6 +748,9 @@ func (l *protoLex) readStringLiteral(quote rune) (string, error) {
 			buf.WriteRune(c)
 		}
 	}
+	if l.limits.MaxStringLength > 0 && buf.Len() > l.limits.MaxStringLength {
+		return "", &LimitError{Limit: limitStringLength, Max: l.limits.MaxStringLength}
+	}
 	return buf.String(), nil
 }
 
@@ -718,6 +804,18 @@ func (l *protoLex) addSourceError(err error) reporter.ErrorWithPos {
 	return ewp
 }
 
+// abort reports the given error and stops lexing. All subsequent calls to Lex
+// will return EOF.
+func (l *protoLex) abort(err error) int {
+	l.abortErr = l.addSourceError(err)
+	return 0
+}
+
 func (l *protoLex) Error(s string) {
+	if l.abortErr != nil {
+		// the parser will complain about the unexpected EOF, but
+		// the real error has already been reported
+		return
+	}
 	_ = l.addSourceError(errors.New(s))
 }
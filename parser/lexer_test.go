@@ -301,3 +301,102 @@ func newTestLexer(t *testing.T, in io.Reader, h *reporter.Handler) *protoLex {
 	require.NoError(t, err)
 	return lexer
 }
+
+func TestPublicLexer(t *testing.T) {
+	l, err := NewLexer("test.proto", strings.NewReader(`// leading
+syntax = "proto3"; // trailing
+message Foo { int32 max = 0x10 [default=-1.5]; }
+`), nil)
+	require.NoError(t, err)
+
+	type tokenInfo struct {
+		kind  TokenKind
+		text  string
+		value interface{}
+		start string
+	}
+	expected := []tokenInfo{
+		{TokenKeyword, "syntax", ast.Identifier("syntax"), "test.proto:2:1"},
+		{TokenPunctuation, "=", '=', "test.proto:2:8"},
+		{TokenString, `"proto3"`, "proto3", "test.proto:2:10"},
+		{TokenPunctuation, ";", ';', "test.proto:2:18"},
+		{TokenKeyword, "message", ast.Identifier("message"), "test.proto:3:1"},
+		{TokenIdentifier, "Foo", ast.Identifier("Foo"), "test.proto:3:9"},
+		{TokenPunctuation, "{", '{', "test.proto:3:13"},
+		{TokenKeyword, "int32", ast.Identifier("int32"), "test.proto:3:15"},
+		{TokenKeyword, "max", ast.Identifier("max"), "test.proto:3:21"},
+		{TokenPunctuation, "=", '=', "test.proto:3:25"},
+		{TokenInt, "0x10", uint64(16), "test.proto:3:27"},
+		{TokenPunctuation, "[", '[', "test.proto:3:32"},
+		{TokenIdentifier, "default", ast.Identifier("default"), "test.proto:3:33"},
+		{TokenPunctuation, "=", '=', "test.proto:3:40"},
+		{TokenPunctuation, "-", '-', "test.proto:3:41"},
+		{TokenFloat, "1.5", 1.5, "test.proto:3:42"},
+		{TokenPunctuation, "]", ']', "test.proto:3:45"},
+		{TokenPunctuation, ";", ';', "test.proto:3:46"},
+		{TokenPunctuation, "}", '}', "test.proto:3:48"},
+		{TokenEOF, "", nil, "test.proto:4:1"},
+	}
+	var tokens []Token
+	for _, exp := range expected {
+		tok, err := l.Next()
+		require.NoError(t, err)
+		assert.Equal(t, exp.kind, tok.Kind, "token %q", exp.text)
+		assert.Equal(t, exp.text, tok.Text())
+		assert.Equal(t, exp.value, tok.Value(), "token %q", exp.text)
+		assert.Equal(t, exp.start, tok.Start().String(), "token %q", exp.text)
+		tokens = append(tokens, tok)
+	}
+	// EOF is sticky
+	tok, err := l.Next()
+	require.NoError(t, err)
+	assert.Equal(t, TokenEOF, tok.Kind)
+
+	require.Equal(t, 1, tokens[0].LeadingComments().Len())
+	assert.Equal(t, "// leading\n", tokens[0].LeadingComments().Index(0).RawText())
+	require.Equal(t, 1, tokens[3].TrailingComments().Len())
+	assert.Equal(t, "// trailing\n", tokens[3].TrailingComments().Index(0).RawText())
+	assert.Equal(t, "test.proto:2:19", tokens[3].End().String())
+	assert.Same(t, l.FileInfo(), l.FileInfo())
+}
+
+func TestPublicLexerErrors(t *testing.T) {
+	// without a handler, lexing stops at the first error
+	l, err := NewLexer("test.proto", strings.NewReader(`foo "bar`), nil)
+	require.NoError(t, err)
+	tok, err := l.Next()
+	require.NoError(t, err)
+	assert.Equal(t, TokenIdentifier, tok.Kind)
+	_, err = l.Next()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "test.proto:1:5: unexpected EOF")
+	_, err = l.Next()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected EOF")
+
+	// with a handler that does not abort, lexing resumes after the error
+	var reported []error
+	handler := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		reported = append(reported, err)
+		return nil
+	}, nil))
+	l, err = NewLexer("test.proto", strings.NewReader(`foo # bar`), handler)
+	require.NoError(t, err)
+	var kinds []TokenKind
+	var errs []error
+	for {
+		tok, err := l.Next()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		kinds = append(kinds, tok.Kind)
+		if tok.Kind == TokenEOF {
+			break
+		}
+	}
+	assert.Equal(t, []TokenKind{TokenIdentifier, TokenIdentifier, TokenEOF}, kinds)
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "test.proto:1:5: invalid character")
+	assert.Equal(t, errs, reported)
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// Limits are bounds on the resources used to parse a file. They are useful
+// when parsing untrusted sources, so that a pathological file cannot exhaust
+// memory or CPU. A zero value for any limit means that it is unbounded, so
+// the zero value of Limits imposes no limits at all.
+type Limits struct {
+	// The maximum size of a file, in bytes.
+	MaxFileSize int
+	// The maximum nesting depth of braces, brackets, and angle brackets.
+	// This bounds the nesting of messages, groups, oneofs, and message and
+	// array literals in option values. For example, a file with a top-level
+	// message that has a nested message has a nesting depth of two.
+	MaxNestingDepth int
+	// The maximum number of declarations in a file. This counts all elements
+	// of the file, including nested ones, such as messages, fields, enum
+	// values, and options. Compact options, like those in brackets after a
+	// field, are not counted.
+	MaxDeclarations int
+	// The maximum length of a single string literal, in bytes, after escape
+	// sequences have been interpreted.
+	MaxStringLength int
+}
+
+// LimitError is the error reported when a file exceeds one of the limits
+// configured in a Limits struct.
+type LimitError struct {
+	// The name of the limit that was exceeded, like "nesting depth".
+	Limit string
+	// The configured maximum.
+	Max int
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case limitFileSize, limitStringLength:
+		return fmt.Sprintf("%s exceeds limit of %d bytes", e.Limit, e.Max)
+	default:
+		return fmt.Sprintf("%s exceeds limit of %d", e.Limit, e.Max)
+	}
+}
+
+const (
+	limitFileSize     = "file size"
+	limitNestingDepth = "nesting depth"
+	limitDeclarations = "number of declarations"
+	limitStringLength = "string literal length"
+
+	// how often the lexer checks if the context has been cancelled,
+	// in number of tokens
+	cancelCheckInterval = 256
+)
+
+// ParseWithLimits is like Parse, except that it enforces the given limits
+// and stops early if the given context is cancelled.
+//
+// If a limit is exceeded, a *LimitError is reported to the given handler,
+// positioned at the element that exceeded the limit, and parsing stops
+// immediately. If the context is cancelled, parsing also stops immediately and
+// the context's error is returned. In either case, the returned AST is nil.
+func ParseWithLimits(ctx context.Context, filename string, r io.Reader, handler *reporter.Handler, limits Limits) (*ast.FileNode, error) {
+	if limits.MaxFileSize > 0 {
+		// read at most one byte past the limit, so we can tell if the
+		// file is too large without reading all of it
+		r = io.LimitReader(r, int64(limits.MaxFileSize)+1)
+	}
+	lx, err := newLexer(r, filename, handler)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxFileSize > 0 && len(lx.input.data) > limits.MaxFileSize {
+		err := reporter.Error(ast.UnknownPos(filename), &LimitError{Limit: limitFileSize, Max: limits.MaxFileSize})
+		_ = handler.HandleError(err)
+		return nil, err
+	}
+	lx.ctx = ctx
+	lx.limits = limits
+	protoParse(lx)
+	if lx.abortErr != nil {
+		return nil, lx.abortErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if lx.res == nil || len(lx.res.Children()) == 0 {
+		// nil AST means there was an error that prevented any parsing
+		// or the file was empty; synthesize empty non-nil AST
+		lx.res = ast.NewEmptyFileNode(filename)
+	}
+	return lx.res, handler.Error()
+}
+
+// countDeclaration is called by the parser each time it reduces a
+// declaration. If this exceeds the maximum number of declarations, the
+// limit error is reported and lexing is aborted, which stops the parser.
+// Since the parser reduces a declaration only after all of its contents,
+// the error is reported at the first declaration to be completed after the
+// limit was reached.
+func (l *protoLex) countDeclaration(decl ast.Node) {
+	if l.limits.MaxDeclarations <= 0 || l.abortErr != nil {
+		return
+	}
+	if _, ok := decl.(*ast.EmptyDeclNode); ok {
+		return
+	}
+	l.declCount++
+	if l.declCount > l.limits.MaxDeclarations {
+		l.abort(reporter.Error(l.info.NodeInfo(decl).Start(), &LimitError{Limit: limitDeclarations, Max: l.limits.MaxDeclarations}))
+	}
+}
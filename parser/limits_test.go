@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jhump/protocompile/reporter"
+)
+
+const limitsSource = `syntax = "proto2";
+package foo;
+option (str) = "abcdefghij";
+message Foo {
+  optional string name = 1 [default = "abc"];
+  message Bar {
+    option (msg) = { a: [ 1, 2 ] };
+    extensions 100 to max;
+  }
+}
+enum Kind {
+  KIND_UNSET = 0;
+}
+`
+
+func TestParseWithLimits(t *testing.T) {
+	testCases := []struct {
+		name   string
+		limits Limits
+		errMsg string
+	}{
+		{
+			name: "no limits",
+		},
+		{
+			name:   "limits not exceeded",
+			limits: Limits{MaxFileSize: len(limitsSource), MaxNestingDepth: 4, MaxDeclarations: 9, MaxStringLength: 10},
+		},
+		{
+			name:   "file size",
+			limits: Limits{MaxFileSize: len(limitsSource) - 1},
+			errMsg: "test.proto: file size exceeds limit of 237 bytes",
+		},
+		{
+			name:   "nesting depth",
+			limits: Limits{MaxNestingDepth: 3},
+			errMsg: "test.proto:7:25: nesting depth exceeds limit of 3",
+		},
+		{
+			name:   "declarations",
+			limits: Limits{MaxDeclarations: 8},
+			errMsg: "test.proto:11:1: number of declarations exceeds limit of 8",
+		},
+		{
+			name:   "declarations in container",
+			limits: Limits{MaxDeclarations: 4},
+			errMsg: "test.proto:8:5: number of declarations exceeds limit of 4",
+		},
+		{
+			name:   "string length",
+			limits: Limits{MaxStringLength: 9},
+			errMsg: "test.proto:3:16: string literal length exceeds limit of 9 bytes",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reported []error
+			handler := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+				reported = append(reported, err)
+				return nil
+			}, nil))
+			file, err := ParseWithLimits(context.Background(), "test.proto", strings.NewReader(limitsSource), handler, tc.limits)
+			if tc.errMsg == "" {
+				require.NoError(t, err)
+				require.NotNil(t, file)
+				assert.Len(t, file.Decls, 4)
+				assert.Empty(t, reported)
+				return
+			}
+			assert.Nil(t, file)
+			require.EqualError(t, err, tc.errMsg)
+			var limitErr *LimitError
+			assert.True(t, errors.As(err, &limitErr))
+			// only the limit error is reported, not any consequent syntax errors
+			require.Len(t, reported, 1)
+			assert.Equal(t, err, reported[0])
+		})
+	}
+}
+
+func TestParseWithLimitsStopsAtDeclarationLimit(t *testing.T) {
+	// the rest of the file is not parsed once the limit is exceeded, so
+	// the syntax error at the end is never reported
+	source := strings.Repeat("message Foo {}\n", 100) + "message !@#"
+	var reported []error
+	handler := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		reported = append(reported, err)
+		return nil
+	}, nil))
+	file, err := ParseWithLimits(context.Background(), "test.proto", strings.NewReader(source), handler, Limits{MaxDeclarations: 10})
+	assert.Nil(t, file)
+	require.EqualError(t, err, "test.proto:11:1: number of declarations exceeds limit of 10")
+	require.Len(t, reported, 1)
+	assert.Equal(t, err, reported[0])
+}
+
+func TestParseWithLimitsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source := strings.Repeat("message Foo {}\n", cancelCheckInterval)
+	file, err := ParseWithLimits(ctx, "test.proto", strings.NewReader(source), reporter.NewHandler(nil), Limits{})
+	assert.Nil(t, file)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -243,6 +243,19 @@ func TestBasicSuccess(t *testing.T) {
 	assert.Equal(t, "proto3", result.AST().Syntax.Syntax.AsString())
 }
 
+func TestParseInvalidUTF8(t *testing.T) {
+	// with a reporter that never aborts, the parser must still terminate
+	var reported []error
+	handler := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		reported = append(reported, err)
+		return nil
+	}, nil))
+	_, err := Parse("test.proto", strings.NewReader("syntax = \"proto3\";\nmessage \xff Foo {}"), handler)
+	assert.Equal(t, reporter.ErrInvalidSource, err)
+	require.NotEmpty(t, reported)
+	assert.EqualError(t, reported[0], "test.proto:2:9: invalid UTF8 at offset 27: ff")
+}
+
 func BenchmarkBasicSuccess(b *testing.B) {
 	r := readerForTestdata(b, "largeproto.proto")
 	bs, err := io.ReadAll(r)
@@ -160,6 +160,7 @@ file : syntax {
 
 fileDecls : fileDecls fileDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -167,6 +168,7 @@ fileDecls : fileDecls fileDecl {
 	}
 	| fileDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.FileElement{$1}
 		} else {
 			$$ = nil
@@ -621,6 +623,7 @@ oneof : _ONEOF name '{' ooDecls '}' {
 
 ooDecls : ooDecls ooDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -628,6 +631,7 @@ ooDecls : ooDecls ooDecl {
 	}
 	| ooDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.OneOfElement{$1}
 		} else {
 			$$ = nil
@@ -774,6 +778,7 @@ enum : _ENUM name '{' enumDecls '}' {
 
 enumDecls : enumDecls enumDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -781,6 +786,7 @@ enumDecls : enumDecls enumDecl {
 	}
 	| enumDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.EnumElement{$1}
 		} else {
 			$$ = nil
@@ -822,6 +828,7 @@ message : _MESSAGE name '{' messageDecls '}' {
 
 messageDecls : messageDecls messageDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -829,6 +836,7 @@ messageDecls : messageDecls messageDecl {
 	}
 	| messageDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.MessageElement{$1}
 		} else {
 			$$ = nil
@@ -884,6 +892,7 @@ extend : _EXTEND typeIdent '{' extendDecls '}' {
 
 extendDecls : extendDecls extendDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -891,6 +900,7 @@ extendDecls : extendDecls extendDecl {
 	}
 	| extendDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.ExtendElement{$1}
 		} else {
 			$$ = nil
@@ -922,6 +932,7 @@ service : _SERVICE name '{' serviceDecls '}' {
 
 serviceDecls : serviceDecls serviceDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -929,6 +940,7 @@ serviceDecls : serviceDecls serviceDecl {
 	}
 	| serviceDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.ServiceElement{$1}
 		} else {
 			$$ = nil
@@ -973,6 +985,7 @@ rpcType : '(' _STREAM typeIdent ')' {
 
 rpcDecls : rpcDecls rpcDecl {
 		if $2 != nil {
+			protolex.(*protoLex).countDeclaration($2)
 			$$ = append($1, $2)
 		} else {
 			$$ = $1
@@ -980,6 +993,7 @@ rpcDecls : rpcDecls rpcDecl {
 	}
 	| rpcDecl {
 		if $1 != nil {
+			protolex.(*protoLex).countDeclaration($1)
 			$$ = []ast.RPCElement{$1}
 		} else {
 			$$ = nil
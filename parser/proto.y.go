@@ -210,7 +210,7 @@ const protoEofCode = 1
 const protoErrCode = 2
 const protoInitialStackSize = 16
 
-//line proto.y:1211
+//line proto.y:1225
 
 //line yacctab:1
 var protoExca = [...]int{
@@ -1236,6 +1236,7 @@ protodefault:
 //line proto.y:161
 		{
 			if protoDollar[2].fileDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].fileDecl)
 				protoVAL.fileDecls = append(protoDollar[1].fileDecls, protoDollar[2].fileDecl)
 			} else {
 				protoVAL.fileDecls = protoDollar[1].fileDecls
@@ -1243,9 +1244,10 @@ protodefault:
 		}
 	case 6:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:168
+//line proto.y:169
 		{
 			if protoDollar[1].fileDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].fileDecl)
 				protoVAL.fileDecls = []ast.FileElement{protoDollar[1].fileDecl}
 			} else {
 				protoVAL.fileDecls = nil
@@ -1253,145 +1255,145 @@ protodefault:
 		}
 	case 7:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:176
+//line proto.y:178
 		{
 			protoVAL.fileDecl = protoDollar[1].imprt
 		}
 	case 8:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:179
+//line proto.y:181
 		{
 			protoVAL.fileDecl = protoDollar[1].pkg
 		}
 	case 9:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:182
+//line proto.y:184
 		{
 			protoVAL.fileDecl = protoDollar[1].opt
 		}
 	case 10:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:185
+//line proto.y:187
 		{
 			protoVAL.fileDecl = protoDollar[1].msg
 		}
 	case 11:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:188
+//line proto.y:190
 		{
 			protoVAL.fileDecl = protoDollar[1].en
 		}
 	case 12:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:191
+//line proto.y:193
 		{
 			protoVAL.fileDecl = protoDollar[1].extend
 		}
 	case 13:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:194
+//line proto.y:196
 		{
 			protoVAL.fileDecl = protoDollar[1].svc
 		}
 	case 14:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:197
+//line proto.y:199
 		{
 			protoVAL.fileDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 15:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:200
+//line proto.y:202
 		{
 			protoVAL.fileDecl = nil
 		}
 	case 16:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:203
+//line proto.y:205
 		{
 			protoVAL.fileDecl = nil
 		}
 	case 17:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:207
+//line proto.y:209
 		{
 			protoVAL.syn = ast.NewSyntaxNode(protoDollar[1].id.ToKeyword(), protoDollar[2].b, protoDollar[3].str.toStringValueNode(), protoDollar[4].b)
 		}
 	case 18:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:211
+//line proto.y:213
 		{
 			protoVAL.imprt = ast.NewImportNode(protoDollar[1].id.ToKeyword(), nil, nil, protoDollar[2].str.toStringValueNode(), protoDollar[3].b)
 		}
 	case 19:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:214
+//line proto.y:216
 		{
 			protoVAL.imprt = ast.NewImportNode(protoDollar[1].id.ToKeyword(), nil, protoDollar[2].id.ToKeyword(), protoDollar[3].str.toStringValueNode(), protoDollar[4].b)
 		}
 	case 20:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:217
+//line proto.y:219
 		{
 			protoVAL.imprt = ast.NewImportNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), nil, protoDollar[3].str.toStringValueNode(), protoDollar[4].b)
 		}
 	case 21:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:221
+//line proto.y:223
 		{
 			protoVAL.pkg = ast.NewPackageNode(protoDollar[1].id.ToKeyword(), protoDollar[2].cid.toIdentValueNode(nil), protoDollar[3].b)
 		}
 	case 22:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:225
+//line proto.y:227
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, nil, nil}
 		}
 	case 23:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:228
+//line proto.y:230
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, protoDollar[2].b, protoDollar[3].cid}
 		}
 	case 24:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:236
+//line proto.y:238
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, nil, nil}
 		}
 	case 25:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:239
+//line proto.y:241
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, protoDollar[2].b, protoDollar[3].cid}
 		}
 	case 26:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:243
+//line proto.y:245
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, nil, nil}
 		}
 	case 27:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:246
+//line proto.y:248
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, protoDollar[2].b, protoDollar[3].cid}
 		}
 	case 28:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:250
+//line proto.y:252
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, nil, nil}
 		}
 	case 29:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:253
+//line proto.y:255
 		{
 			protoVAL.cid = &identList{protoDollar[1].id, protoDollar[2].b, protoDollar[3].cid}
 		}
 	case 30:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:257
+//line proto.y:259
 		{
 			refs, dots := protoDollar[2].optNms.toNodes()
 			optName := ast.NewOptionNameNode(refs, dots)
@@ -1399,37 +1401,37 @@ protodefault:
 		}
 	case 31:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:263
+//line proto.y:265
 		{
 			protoVAL.optNms = &fieldRefList{protoDollar[1].ref, nil, nil}
 		}
 	case 32:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:266
+//line proto.y:268
 		{
 			protoVAL.optNms = &fieldRefList{protoDollar[1].ref, protoDollar[2].b, protoDollar[3].optNms}
 		}
 	case 33:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:270
+//line proto.y:272
 		{
 			protoVAL.ref = ast.NewFieldReferenceNode(protoDollar[1].id)
 		}
 	case 34:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:273
+//line proto.y:275
 		{
 			protoVAL.ref = ast.NewExtensionFieldReferenceNode(protoDollar[1].b, protoDollar[2].tid, protoDollar[3].b)
 		}
 	case 37:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:280
+//line proto.y:282
 		{
 			protoVAL.v = protoDollar[1].str.toStringValueNode()
 		}
 	case 39:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:284
+//line proto.y:286
 		{
 			if protoDollar[1].id.Val == "true" || protoDollar[1].id.Val == "false" {
 				protoVAL.v = ast.NewBoolLiteralNode(protoDollar[1].id.ToKeyword())
@@ -1441,51 +1443,51 @@ protodefault:
 		}
 	case 40:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:294
+//line proto.y:296
 		{
 			protoVAL.v = protoDollar[1].f
 		}
 	case 41:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:297
+//line proto.y:299
 		{
 			protoVAL.v = ast.NewSignedFloatLiteralNode(protoDollar[1].b, protoDollar[2].f)
 		}
 	case 42:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:300
+//line proto.y:302
 		{
 			protoVAL.v = ast.NewSignedFloatLiteralNode(protoDollar[1].b, protoDollar[2].f)
 		}
 	case 43:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:303
+//line proto.y:305
 		{
 			f := ast.NewSpecialFloatLiteralNode(protoDollar[2].id.ToKeyword())
 			protoVAL.v = ast.NewSignedFloatLiteralNode(protoDollar[1].b, f)
 		}
 	case 44:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:307
+//line proto.y:309
 		{
 			f := ast.NewSpecialFloatLiteralNode(protoDollar[2].id.ToKeyword())
 			protoVAL.v = ast.NewSignedFloatLiteralNode(protoDollar[1].b, f)
 		}
 	case 45:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:311
+//line proto.y:313
 		{
 			protoVAL.v = protoDollar[1].i
 		}
 	case 46:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:314
+//line proto.y:316
 		{
 			protoVAL.v = ast.NewPositiveUintLiteralNode(protoDollar[1].b, protoDollar[2].i)
 		}
 	case 47:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:317
+//line proto.y:319
 		{
 			if protoDollar[2].i.Val > math.MaxInt64+1 {
 				// can't represent as int so treat as float literal
@@ -1496,26 +1498,26 @@ protodefault:
 		}
 	case 48:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:326
+//line proto.y:328
 		{
 			protoVAL.str = &stringList{protoDollar[1].s, nil}
 		}
 	case 49:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:329
+//line proto.y:331
 		{
 			protoVAL.str = &stringList{protoDollar[1].s, protoDollar[2].str}
 		}
 	case 50:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:333
+//line proto.y:335
 		{
 			fields, delims := protoDollar[2].msgLit.toNodes()
 			protoVAL.v = ast.NewMessageLiteralNode(protoDollar[1].b, fields, delims, protoDollar[3].b)
 		}
 	case 51:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:338
+//line proto.y:340
 		{
 			if protoDollar[1].msgEntry != nil {
 				protoVAL.msgLit = &messageFieldList{protoDollar[1].msgEntry, nil}
@@ -1525,7 +1527,7 @@ protodefault:
 		}
 	case 52:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:345
+//line proto.y:347
 		{
 			if protoDollar[1].msgEntry != nil {
 				protoVAL.msgLit = &messageFieldList{protoDollar[1].msgEntry, protoDollar[2].msgLit}
@@ -1535,13 +1537,13 @@ protodefault:
 		}
 	case 53:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:352
+//line proto.y:354
 		{
 			protoVAL.msgLit = nil
 		}
 	case 54:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:356
+//line proto.y:358
 		{
 			if protoDollar[1].msgField != nil {
 				protoVAL.msgEntry = &messageFieldEntry{protoDollar[1].msgField, nil}
@@ -1551,7 +1553,7 @@ protodefault:
 		}
 	case 55:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:363
+//line proto.y:365
 		{
 			if protoDollar[1].msgField != nil {
 				protoVAL.msgEntry = &messageFieldEntry{protoDollar[1].msgField, protoDollar[2].b}
@@ -1561,7 +1563,7 @@ protodefault:
 		}
 	case 56:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:370
+//line proto.y:372
 		{
 			if protoDollar[1].msgField != nil {
 				protoVAL.msgEntry = &messageFieldEntry{protoDollar[1].msgField, protoDollar[2].b}
@@ -1571,25 +1573,25 @@ protodefault:
 		}
 	case 57:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:377
+//line proto.y:379
 		{
 			protoVAL.msgEntry = nil
 		}
 	case 58:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:380
+//line proto.y:382
 		{
 			protoVAL.msgEntry = nil
 		}
 	case 59:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:383
+//line proto.y:385
 		{
 			protoVAL.msgEntry = nil
 		}
 	case 60:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:387
+//line proto.y:389
 		{
 			if protoDollar[1].ref != nil {
 				protoVAL.msgField = ast.NewMessageFieldNode(protoDollar[1].ref, protoDollar[2].b, protoDollar[3].v)
@@ -1599,7 +1601,7 @@ protodefault:
 		}
 	case 61:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:394
+//line proto.y:396
 		{
 			if protoDollar[1].ref != nil {
 				val := ast.NewArrayLiteralNode(protoDollar[2].b, nil, nil, protoDollar[3].b)
@@ -1610,7 +1612,7 @@ protodefault:
 		}
 	case 62:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:402
+//line proto.y:404
 		{
 			if protoDollar[1].ref != nil {
 				val := ast.NewArrayLiteralNode(protoDollar[3].b, nil, nil, protoDollar[4].b)
@@ -1621,7 +1623,7 @@ protodefault:
 		}
 	case 63:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:410
+//line proto.y:412
 		{
 			if protoDollar[1].ref != nil {
 				vals, commas := protoDollar[3].sl.toNodes()
@@ -1633,7 +1635,7 @@ protodefault:
 		}
 	case 64:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:419
+//line proto.y:421
 		{
 			if protoDollar[1].ref != nil {
 				vals, commas := protoDollar[4].sl.toNodes()
@@ -1645,13 +1647,13 @@ protodefault:
 		}
 	case 65:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:428
+//line proto.y:430
 		{
 			protoVAL.msgField = nil
 		}
 	case 66:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:431
+//line proto.y:433
 		{
 			if protoDollar[1].ref != nil {
 				protoVAL.msgField = ast.NewMessageFieldNode(protoDollar[1].ref, protoDollar[2].b, protoDollar[3].v)
@@ -1661,7 +1663,7 @@ protodefault:
 		}
 	case 67:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:438
+//line proto.y:440
 		{
 			if protoDollar[1].ref != nil {
 				protoVAL.msgField = ast.NewMessageFieldNode(protoDollar[1].ref, nil, protoDollar[2].v)
@@ -1671,7 +1673,7 @@ protodefault:
 		}
 	case 68:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:445
+//line proto.y:447
 		{
 			if protoDollar[1].ref != nil {
 				fields, delims := protoDollar[4].msgLit.toNodes()
@@ -1683,7 +1685,7 @@ protodefault:
 		}
 	case 69:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:454
+//line proto.y:456
 		{
 			if protoDollar[1].ref != nil {
 				fields, delims := protoDollar[3].msgLit.toNodes()
@@ -1695,49 +1697,49 @@ protodefault:
 		}
 	case 70:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:463
+//line proto.y:465
 		{
 			protoVAL.msgField = nil
 		}
 	case 71:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:466
+//line proto.y:468
 		{
 			protoVAL.msgField = nil
 		}
 	case 72:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:470
+//line proto.y:472
 		{
 			protoVAL.ref = ast.NewFieldReferenceNode(protoDollar[1].id)
 		}
 	case 73:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:473
+//line proto.y:475
 		{
 			protoVAL.ref = ast.NewExtensionFieldReferenceNode(protoDollar[1].b, protoDollar[2].tid, protoDollar[3].b)
 		}
 	case 74:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:476
+//line proto.y:478
 		{
 			protoVAL.ref = nil
 		}
 	case 75:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:480
+//line proto.y:482
 		{
 			protoVAL.sl = &valueList{protoDollar[1].v, nil, nil}
 		}
 	case 76:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:483
+//line proto.y:485
 		{
 			protoVAL.sl = &valueList{protoDollar[1].v, protoDollar[2].b, protoDollar[3].sl}
 		}
 	case 77:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:486
+//line proto.y:488
 		{
 			fields, delims := protoDollar[2].msgLit.toNodes()
 			msg := ast.NewMessageLiteralNode(protoDollar[1].b, fields, delims, protoDollar[3].b)
@@ -1745,7 +1747,7 @@ protodefault:
 		}
 	case 78:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:491
+//line proto.y:493
 		{
 			fields, delims := protoDollar[2].msgLit.toNodes()
 			msg := ast.NewMessageLiteralNode(protoDollar[1].b, fields, delims, protoDollar[3].b)
@@ -1753,182 +1755,182 @@ protodefault:
 		}
 	case 79:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:496
+//line proto.y:498
 		{
 			protoVAL.sl = nil
 		}
 	case 80:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:499
+//line proto.y:501
 		{
 			protoVAL.sl = protoDollar[5].sl
 		}
 	case 81:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:503
+//line proto.y:505
 		{
 			protoVAL.tid = protoDollar[1].cid.toIdentValueNode(nil)
 		}
 	case 82:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:506
+//line proto.y:508
 		{
 			protoVAL.tid = protoDollar[2].cid.toIdentValueNode(protoDollar[1].b)
 		}
 	case 83:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:510
+//line proto.y:512
 		{
 			protoVAL.tid = protoDollar[1].cid.toIdentValueNode(nil)
 		}
 	case 84:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:513
+//line proto.y:515
 		{
 			protoVAL.tid = protoDollar[2].cid.toIdentValueNode(protoDollar[1].b)
 		}
 	case 85:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:517
+//line proto.y:519
 		{
 			protoVAL.tid = protoDollar[1].cid.toIdentValueNode(nil)
 		}
 	case 86:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:520
+//line proto.y:522
 		{
 			protoVAL.tid = protoDollar[2].cid.toIdentValueNode(protoDollar[1].b)
 		}
 	case 87:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:524
+//line proto.y:526
 		{
 			protoVAL.tid = protoDollar[1].cid.toIdentValueNode(nil)
 		}
 	case 88:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:527
+//line proto.y:529
 		{
 			protoVAL.tid = protoDollar[2].cid.toIdentValueNode(protoDollar[1].b)
 		}
 	case 89:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:531
+//line proto.y:533
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 90:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:534
+//line proto.y:536
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 91:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:537
+//line proto.y:539
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 92:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:540
+//line proto.y:542
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 93:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:543
+//line proto.y:545
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 94:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:546
+//line proto.y:548
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 95:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:549
+//line proto.y:551
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, nil, protoDollar[5].b)
 		}
 	case 96:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:552
+//line proto.y:554
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, protoDollar[5].cmpctOpts, protoDollar[6].b)
 		}
 	case 97:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:556
+//line proto.y:558
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 98:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:559
+//line proto.y:561
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 99:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:562
+//line proto.y:564
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b)
 		}
 	case 100:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:565
+//line proto.y:567
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 101:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:568
+//line proto.y:570
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 102:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:571
+//line proto.y:573
 		{
 			protoVAL.fld = ast.NewFieldNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b)
 		}
 	case 103:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:574
+//line proto.y:576
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, nil, protoDollar[5].b)
 		}
 	case 104:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:577
+//line proto.y:579
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, protoDollar[5].cmpctOpts, protoDollar[6].b)
 		}
 	case 105:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:581
+//line proto.y:583
 		{
 			opts, commas := protoDollar[2].opts.toNodes()
 			protoVAL.cmpctOpts = ast.NewCompactOptionsNode(protoDollar[1].b, opts, commas, protoDollar[3].b)
 		}
 	case 106:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:586
+//line proto.y:588
 		{
 			protoVAL.opts = &compactOptionList{protoDollar[1].opt, nil, nil}
 		}
 	case 107:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:589
+//line proto.y:591
 		{
 			protoVAL.opts = &compactOptionList{protoDollar[1].opt, protoDollar[2].b, protoDollar[3].opts}
 		}
 	case 108:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:593
+//line proto.y:595
 		{
 			refs, dots := protoDollar[1].optNms.toNodes()
 			optName := ast.NewOptionNameNode(refs, dots)
@@ -1936,51 +1938,52 @@ protodefault:
 		}
 	case 109:
 		protoDollar = protoS[protopt-8 : protopt+1]
-//line proto.y:599
+//line proto.y:601
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b, protoDollar[7].msgDecls, protoDollar[8].b)
 		}
 	case 110:
 		protoDollar = protoS[protopt-8 : protopt+1]
-//line proto.y:602
+//line proto.y:604
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b, protoDollar[7].msgDecls, protoDollar[8].b)
 		}
 	case 111:
 		protoDollar = protoS[protopt-8 : protopt+1]
-//line proto.y:605
+//line proto.y:607
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, nil, protoDollar[6].b, protoDollar[7].msgDecls, protoDollar[8].b)
 		}
 	case 112:
 		protoDollar = protoS[protopt-9 : protopt+1]
-//line proto.y:608
+//line proto.y:610
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b, protoDollar[8].msgDecls, protoDollar[9].b)
 		}
 	case 113:
 		protoDollar = protoS[protopt-9 : protopt+1]
-//line proto.y:611
+//line proto.y:613
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b, protoDollar[8].msgDecls, protoDollar[9].b)
 		}
 	case 114:
 		protoDollar = protoS[protopt-9 : protopt+1]
-//line proto.y:614
+//line proto.y:616
 		{
 			protoVAL.grp = ast.NewGroupNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id.ToKeyword(), protoDollar[3].id, protoDollar[4].b, protoDollar[5].i, protoDollar[6].cmpctOpts, protoDollar[7].b, protoDollar[8].msgDecls, protoDollar[9].b)
 		}
 	case 115:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:618
+//line proto.y:620
 		{
 			protoVAL.oo = ast.NewOneOfNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].ooDecls, protoDollar[5].b)
 		}
 	case 116:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:622
+//line proto.y:624
 		{
 			if protoDollar[2].ooDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].ooDecl)
 				protoVAL.ooDecls = append(protoDollar[1].ooDecls, protoDollar[2].ooDecl)
 			} else {
 				protoVAL.ooDecls = protoDollar[1].ooDecls
@@ -1988,9 +1991,10 @@ protodefault:
 		}
 	case 117:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:629
+//line proto.y:632
 		{
 			if protoDollar[1].ooDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].ooDecl)
 				protoVAL.ooDecls = []ast.OneOfElement{protoDollar[1].ooDecl}
 			} else {
 				protoVAL.ooDecls = nil
@@ -1998,218 +2002,219 @@ protodefault:
 		}
 	case 118:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:636
+//line proto.y:640
 		{
 			protoVAL.ooDecls = nil
 		}
 	case 119:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:640
+//line proto.y:644
 		{
 			protoVAL.ooDecl = protoDollar[1].opt
 		}
 	case 120:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:643
+//line proto.y:647
 		{
 			protoVAL.ooDecl = protoDollar[1].fld
 		}
 	case 121:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:646
+//line proto.y:650
 		{
 			protoVAL.ooDecl = protoDollar[1].grp
 		}
 	case 122:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:649
+//line proto.y:653
 		{
 			protoVAL.ooDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 123:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:652
+//line proto.y:656
 		{
 			protoVAL.ooDecl = nil
 		}
 	case 124:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:655
+//line proto.y:659
 		{
 			protoVAL.ooDecl = nil
 		}
 	case 125:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:659
+//line proto.y:663
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, nil, protoDollar[5].b)
 		}
 	case 126:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:662
+//line proto.y:666
 		{
 			protoVAL.fld = ast.NewFieldNode(nil, protoDollar[1].tid, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, protoDollar[5].cmpctOpts, protoDollar[6].b)
 		}
 	case 127:
 		protoDollar = protoS[protopt-7 : protopt+1]
-//line proto.y:666
+//line proto.y:670
 		{
 			protoVAL.grp = ast.NewGroupNode(nil, protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, nil, protoDollar[5].b, protoDollar[6].msgDecls, protoDollar[7].b)
 		}
 	case 128:
 		protoDollar = protoS[protopt-8 : protopt+1]
-//line proto.y:669
+//line proto.y:673
 		{
 			protoVAL.grp = ast.NewGroupNode(nil, protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, protoDollar[5].cmpctOpts, protoDollar[6].b, protoDollar[7].msgDecls, protoDollar[8].b)
 		}
 	case 129:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:673
+//line proto.y:677
 		{
 			protoVAL.mapFld = ast.NewMapFieldNode(protoDollar[1].mapType, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, nil, protoDollar[5].b)
 		}
 	case 130:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:676
+//line proto.y:680
 		{
 			protoVAL.mapFld = ast.NewMapFieldNode(protoDollar[1].mapType, protoDollar[2].id, protoDollar[3].b, protoDollar[4].i, protoDollar[5].cmpctOpts, protoDollar[6].b)
 		}
 	case 131:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:680
+//line proto.y:684
 		{
 			protoVAL.mapType = ast.NewMapTypeNode(protoDollar[1].id.ToKeyword(), protoDollar[2].b, protoDollar[3].id, protoDollar[4].b, protoDollar[5].tid, protoDollar[6].b)
 		}
 	case 144:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:697
+//line proto.y:701
 		{
 			ranges, commas := protoDollar[2].rngs.toNodes()
 			protoVAL.ext = ast.NewExtensionRangeNode(protoDollar[1].id.ToKeyword(), ranges, commas, nil, protoDollar[3].b)
 		}
 	case 145:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:701
+//line proto.y:705
 		{
 			ranges, commas := protoDollar[2].rngs.toNodes()
 			protoVAL.ext = ast.NewExtensionRangeNode(protoDollar[1].id.ToKeyword(), ranges, commas, protoDollar[3].cmpctOpts, protoDollar[4].b)
 		}
 	case 146:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:706
+//line proto.y:710
 		{
 			protoVAL.rngs = &rangeList{protoDollar[1].rng, nil, nil}
 		}
 	case 147:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:709
+//line proto.y:713
 		{
 			protoVAL.rngs = &rangeList{protoDollar[1].rng, protoDollar[2].b, protoDollar[3].rngs}
 		}
 	case 148:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:713
+//line proto.y:717
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].i, nil, nil, nil)
 		}
 	case 149:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:716
+//line proto.y:720
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].i, protoDollar[2].id.ToKeyword(), protoDollar[3].i, nil)
 		}
 	case 150:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:719
+//line proto.y:723
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].i, protoDollar[2].id.ToKeyword(), nil, protoDollar[3].id.ToKeyword())
 		}
 	case 151:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:723
+//line proto.y:727
 		{
 			protoVAL.rngs = &rangeList{protoDollar[1].rng, nil, nil}
 		}
 	case 152:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:726
+//line proto.y:730
 		{
 			protoVAL.rngs = &rangeList{protoDollar[1].rng, protoDollar[2].b, protoDollar[3].rngs}
 		}
 	case 153:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:730
+//line proto.y:734
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].il, nil, nil, nil)
 		}
 	case 154:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:733
+//line proto.y:737
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].il, protoDollar[2].id.ToKeyword(), protoDollar[3].il, nil)
 		}
 	case 155:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:736
+//line proto.y:740
 		{
 			protoVAL.rng = ast.NewRangeNode(protoDollar[1].il, protoDollar[2].id.ToKeyword(), nil, protoDollar[3].id.ToKeyword())
 		}
 	case 156:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:740
+//line proto.y:744
 		{
 			protoVAL.il = protoDollar[1].i
 		}
 	case 157:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:743
+//line proto.y:747
 		{
 			protoVAL.il = ast.NewNegativeIntLiteralNode(protoDollar[1].b, protoDollar[2].i)
 		}
 	case 158:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:747
+//line proto.y:751
 		{
 			ranges, commas := protoDollar[2].rngs.toNodes()
 			protoVAL.resvd = ast.NewReservedRangesNode(protoDollar[1].id.ToKeyword(), ranges, commas, protoDollar[3].b)
 		}
 	case 160:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:753
+//line proto.y:757
 		{
 			ranges, commas := protoDollar[2].rngs.toNodes()
 			protoVAL.resvd = ast.NewReservedRangesNode(protoDollar[1].id.ToKeyword(), ranges, commas, protoDollar[3].b)
 		}
 	case 162:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:759
+//line proto.y:763
 		{
 			names, commas := protoDollar[2].names.toNodes()
 			protoVAL.resvd = ast.NewReservedNamesNode(protoDollar[1].id.ToKeyword(), names, commas, protoDollar[3].b)
 		}
 	case 163:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:764
+//line proto.y:768
 		{
 			protoVAL.names = &nameList{protoDollar[1].str.toStringValueNode(), nil, nil}
 		}
 	case 164:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:767
+//line proto.y:771
 		{
 			protoVAL.names = &nameList{protoDollar[1].str.toStringValueNode(), protoDollar[2].b, protoDollar[3].names}
 		}
 	case 165:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:771
+//line proto.y:775
 		{
 			protoVAL.en = ast.NewEnumNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].enDecls, protoDollar[5].b)
 		}
 	case 166:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:775
+//line proto.y:779
 		{
 			if protoDollar[2].enDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].enDecl)
 				protoVAL.enDecls = append(protoDollar[1].enDecls, protoDollar[2].enDecl)
 			} else {
 				protoVAL.enDecls = protoDollar[1].enDecls
@@ -2217,9 +2222,10 @@ protodefault:
 		}
 	case 167:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:782
+//line proto.y:787
 		{
 			if protoDollar[1].enDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].enDecl)
 				protoVAL.enDecls = []ast.EnumElement{protoDollar[1].enDecl}
 			} else {
 				protoVAL.enDecls = nil
@@ -2227,69 +2233,70 @@ protodefault:
 		}
 	case 168:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:789
+//line proto.y:795
 		{
 			protoVAL.enDecls = nil
 		}
 	case 169:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:793
+//line proto.y:799
 		{
 			protoVAL.enDecl = protoDollar[1].opt
 		}
 	case 170:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:796
+//line proto.y:802
 		{
 			protoVAL.enDecl = protoDollar[1].env
 		}
 	case 171:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:799
+//line proto.y:805
 		{
 			protoVAL.enDecl = protoDollar[1].resvd
 		}
 	case 172:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:802
+//line proto.y:808
 		{
 			protoVAL.enDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 173:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:805
+//line proto.y:811
 		{
 			protoVAL.enDecl = nil
 		}
 	case 174:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:808
+//line proto.y:814
 		{
 			protoVAL.enDecl = nil
 		}
 	case 175:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:812
+//line proto.y:818
 		{
 			protoVAL.env = ast.NewEnumValueNode(protoDollar[1].id, protoDollar[2].b, protoDollar[3].il, nil, protoDollar[4].b)
 		}
 	case 176:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:815
+//line proto.y:821
 		{
 			protoVAL.env = ast.NewEnumValueNode(protoDollar[1].id, protoDollar[2].b, protoDollar[3].il, protoDollar[4].cmpctOpts, protoDollar[5].b)
 		}
 	case 177:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:819
+//line proto.y:825
 		{
 			protoVAL.msg = ast.NewMessageNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].msgDecls, protoDollar[5].b)
 		}
 	case 178:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:823
+//line proto.y:829
 		{
 			if protoDollar[2].msgDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].msgDecl)
 				protoVAL.msgDecls = append(protoDollar[1].msgDecls, protoDollar[2].msgDecl)
 			} else {
 				protoVAL.msgDecls = protoDollar[1].msgDecls
@@ -2297,9 +2304,10 @@ protodefault:
 		}
 	case 179:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:830
+//line proto.y:837
 		{
 			if protoDollar[1].msgDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].msgDecl)
 				protoVAL.msgDecls = []ast.MessageElement{protoDollar[1].msgDecl}
 			} else {
 				protoVAL.msgDecls = nil
@@ -2307,99 +2315,100 @@ protodefault:
 		}
 	case 180:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:837
+//line proto.y:845
 		{
 			protoVAL.msgDecls = nil
 		}
 	case 181:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:841
+//line proto.y:849
 		{
 			protoVAL.msgDecl = protoDollar[1].fld
 		}
 	case 182:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:844
+//line proto.y:852
 		{
 			protoVAL.msgDecl = protoDollar[1].en
 		}
 	case 183:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:847
+//line proto.y:855
 		{
 			protoVAL.msgDecl = protoDollar[1].msg
 		}
 	case 184:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:850
+//line proto.y:858
 		{
 			protoVAL.msgDecl = protoDollar[1].extend
 		}
 	case 185:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:853
+//line proto.y:861
 		{
 			protoVAL.msgDecl = protoDollar[1].ext
 		}
 	case 186:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:856
+//line proto.y:864
 		{
 			protoVAL.msgDecl = protoDollar[1].grp
 		}
 	case 187:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:859
+//line proto.y:867
 		{
 			protoVAL.msgDecl = protoDollar[1].opt
 		}
 	case 188:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:862
+//line proto.y:870
 		{
 			protoVAL.msgDecl = protoDollar[1].oo
 		}
 	case 189:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:865
+//line proto.y:873
 		{
 			protoVAL.msgDecl = protoDollar[1].mapFld
 		}
 	case 190:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:868
+//line proto.y:876
 		{
 			protoVAL.msgDecl = protoDollar[1].resvd
 		}
 	case 191:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:871
+//line proto.y:879
 		{
 			protoVAL.msgDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 192:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:874
+//line proto.y:882
 		{
 			protoVAL.msgDecl = nil
 		}
 	case 193:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:877
+//line proto.y:885
 		{
 			protoVAL.msgDecl = nil
 		}
 	case 194:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:881
+//line proto.y:889
 		{
 			protoVAL.extend = ast.NewExtendNode(protoDollar[1].id.ToKeyword(), protoDollar[2].tid, protoDollar[3].b, protoDollar[4].extDecls, protoDollar[5].b)
 		}
 	case 195:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:885
+//line proto.y:893
 		{
 			if protoDollar[2].extDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].extDecl)
 				protoVAL.extDecls = append(protoDollar[1].extDecls, protoDollar[2].extDecl)
 			} else {
 				protoVAL.extDecls = protoDollar[1].extDecls
@@ -2407,9 +2416,10 @@ protodefault:
 		}
 	case 196:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:892
+//line proto.y:901
 		{
 			if protoDollar[1].extDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].extDecl)
 				protoVAL.extDecls = []ast.ExtendElement{protoDollar[1].extDecl}
 			} else {
 				protoVAL.extDecls = nil
@@ -2417,51 +2427,52 @@ protodefault:
 		}
 	case 197:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:899
+//line proto.y:909
 		{
 			protoVAL.extDecls = nil
 		}
 	case 198:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:903
+//line proto.y:913
 		{
 			protoVAL.extDecl = protoDollar[1].fld
 		}
 	case 199:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:906
+//line proto.y:916
 		{
 			protoVAL.extDecl = protoDollar[1].grp
 		}
 	case 200:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:909
+//line proto.y:919
 		{
 			protoVAL.extDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 201:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:912
+//line proto.y:922
 		{
 			protoVAL.extDecl = nil
 		}
 	case 202:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:915
+//line proto.y:925
 		{
 			protoVAL.extDecl = nil
 		}
 	case 203:
 		protoDollar = protoS[protopt-5 : protopt+1]
-//line proto.y:919
+//line proto.y:929
 		{
 			protoVAL.svc = ast.NewServiceNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].b, protoDollar[4].svcDecls, protoDollar[5].b)
 		}
 	case 204:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:923
+//line proto.y:933
 		{
 			if protoDollar[2].svcDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].svcDecl)
 				protoVAL.svcDecls = append(protoDollar[1].svcDecls, protoDollar[2].svcDecl)
 			} else {
 				protoVAL.svcDecls = protoDollar[1].svcDecls
@@ -2469,9 +2480,10 @@ protodefault:
 		}
 	case 205:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:930
+//line proto.y:941
 		{
 			if protoDollar[1].svcDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].svcDecl)
 				protoVAL.svcDecls = []ast.ServiceElement{protoDollar[1].svcDecl}
 			} else {
 				protoVAL.svcDecls = nil
@@ -2479,69 +2491,70 @@ protodefault:
 		}
 	case 206:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:937
+//line proto.y:949
 		{
 			protoVAL.svcDecls = nil
 		}
 	case 207:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:944
+//line proto.y:956
 		{
 			protoVAL.svcDecl = protoDollar[1].opt
 		}
 	case 208:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:947
+//line proto.y:959
 		{
 			protoVAL.svcDecl = protoDollar[1].mtd
 		}
 	case 209:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:950
+//line proto.y:962
 		{
 			protoVAL.svcDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 210:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:953
+//line proto.y:965
 		{
 			protoVAL.svcDecl = nil
 		}
 	case 211:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:956
+//line proto.y:968
 		{
 			protoVAL.svcDecl = nil
 		}
 	case 212:
 		protoDollar = protoS[protopt-6 : protopt+1]
-//line proto.y:960
+//line proto.y:972
 		{
 			protoVAL.mtd = ast.NewRPCNode(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].rpcType, protoDollar[4].id.ToKeyword(), protoDollar[5].rpcType, protoDollar[6].b)
 		}
 	case 213:
 		protoDollar = protoS[protopt-8 : protopt+1]
-//line proto.y:963
+//line proto.y:975
 		{
 			protoVAL.mtd = ast.NewRPCNodeWithBody(protoDollar[1].id.ToKeyword(), protoDollar[2].id, protoDollar[3].rpcType, protoDollar[4].id.ToKeyword(), protoDollar[5].rpcType, protoDollar[6].b, protoDollar[7].rpcDecls, protoDollar[8].b)
 		}
 	case 214:
 		protoDollar = protoS[protopt-4 : protopt+1]
-//line proto.y:967
+//line proto.y:979
 		{
 			protoVAL.rpcType = ast.NewRPCTypeNode(protoDollar[1].b, protoDollar[2].id.ToKeyword(), protoDollar[3].tid, protoDollar[4].b)
 		}
 	case 215:
 		protoDollar = protoS[protopt-3 : protopt+1]
-//line proto.y:970
+//line proto.y:982
 		{
 			protoVAL.rpcType = ast.NewRPCTypeNode(protoDollar[1].b, nil, protoDollar[2].tid, protoDollar[3].b)
 		}
 	case 216:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:974
+//line proto.y:986
 		{
 			if protoDollar[2].rpcDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[2].rpcDecl)
 				protoVAL.rpcDecls = append(protoDollar[1].rpcDecls, protoDollar[2].rpcDecl)
 			} else {
 				protoVAL.rpcDecls = protoDollar[1].rpcDecls
@@ -2549,9 +2562,10 @@ protodefault:
 		}
 	case 217:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:981
+//line proto.y:994
 		{
 			if protoDollar[1].rpcDecl != nil {
+				protolex.(*protoLex).countDeclaration(protoDollar[1].rpcDecl)
 				protoVAL.rpcDecls = []ast.RPCElement{protoDollar[1].rpcDecl}
 			} else {
 				protoVAL.rpcDecls = nil
@@ -2559,31 +2573,31 @@ protodefault:
 		}
 	case 218:
 		protoDollar = protoS[protopt-0 : protopt+1]
-//line proto.y:988
+//line proto.y:1002
 		{
 			protoVAL.rpcDecls = nil
 		}
 	case 219:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:992
+//line proto.y:1006
 		{
 			protoVAL.rpcDecl = protoDollar[1].opt
 		}
 	case 220:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:995
+//line proto.y:1009
 		{
 			protoVAL.rpcDecl = ast.NewEmptyDeclNode(protoDollar[1].b)
 		}
 	case 221:
 		protoDollar = protoS[protopt-2 : protopt+1]
-//line proto.y:998
+//line proto.y:1012
 		{
 			protoVAL.rpcDecl = nil
 		}
 	case 222:
 		protoDollar = protoS[protopt-1 : protopt+1]
-//line proto.y:1001
+//line proto.y:1015
 		{
 			protoVAL.rpcDecl = nil
 		}
@@ -0,0 +1,1184 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// SynthesizeAST creates an AST that corresponds to the given file descriptor
+// proto. The returned AST is backed by synthetic source text (which can be
+// printed via ast.Print) that, when parsed and compiled, would produce the
+// given descriptor. If the given descriptor includes source code info, the
+// comments therein are included in the AST and the source locations are used
+// to order the declarations in the file.
+//
+// Options are included in the AST as option declarations. Custom options that
+// are present in the descriptor only as unrecognized fields are resolved using
+// extensions in protoregistry.GlobalTypes, or in the resolver provided via
+// WithExtensionResolver. If any cannot be resolved, an error is returned,
+// since their names and types cannot be known without a definition of the
+// custom option.
+//
+// An error is also returned if the given descriptor is malformed in a way that
+// prevents it from being represented in source form, such as a group or map
+// field whose corresponding nested message is absent.
+func SynthesizeAST(fd *descriptorpb.FileDescriptorProto, opts ...SynthesizeOption) (*ast.FileNode, error) {
+	res, err := ResultWithSynthesizedAST(fd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.AST(), nil
+}
+
+// ResultWithSynthesizedAST returns a parse result for the given file
+// descriptor proto whose AST is synthesized from the descriptor, as if by
+// SynthesizeAST. Unlike ResultWithoutAST, the methods for looking up AST nodes
+// return nodes in the synthesized AST, with meaningful position information.
+func ResultWithSynthesizedAST(fd *descriptorpb.FileDescriptorProto, opts ...SynthesizeOption) (Result, error) {
+	s := &astSynthesizer{
+		e:          ast.NewEditor(ast.NewEmptyFileNode(fd.GetName())),
+		r:          &result{proto: fd, nodes: map[proto.Message]ast.Node{}},
+		locs:       map[string][]*descriptorpb.SourceCodeInfo_Location{},
+		extensions: protoregistry.GlobalTypes,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for _, loc := range fd.GetSourceCodeInfo().GetLocation() {
+		key := pathKey(loc.Path)
+		s.locs[key] = append(s.locs[key], loc)
+	}
+	file, err := s.synthesizeFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	s.r.file = file
+	return s.r, nil
+}
+
+// SynthesizeOption is an option that can be passed to SynthesizeAST or
+// ResultWithSynthesizedAST to customize how the AST is synthesized.
+type SynthesizeOption func(*astSynthesizer)
+
+// WithExtensionResolver returns an option that causes custom options that
+// are present in the descriptor as unrecognized fields to be resolved using
+// the given resolver, instead of protoregistry.GlobalTypes. For a descriptor
+// that was not compiled into the program, such as one loaded from a
+// descriptor set, this should be a resolver for the file's dependencies.
+func WithExtensionResolver(res protoregistry.ExtensionTypeResolver) SynthesizeOption {
+	return func(s *astSynthesizer) {
+		s.extensions = res
+	}
+}
+
+type astSynthesizer struct {
+	e    *ast.Editor
+	r    *result
+	locs map[string][]*descriptorpb.SourceCodeInfo_Location
+	// used to resolve custom options that are unrecognized fields
+	extensions protoregistry.ExtensionTypeResolver
+}
+
+// decl is a declaration along with its location in the source code info.
+type decl struct {
+	node ast.Node
+	loc  *descriptorpb.SourceCodeInfo_Location
+}
+
+// location returns the source location for the given path. Some paths can
+// have more than one location, such as when a repeated option is declared
+// multiple times, so this returns the next location that has not already
+// been returned.
+func (s *astSynthesizer) location(path ...int32) *descriptorpb.SourceCodeInfo_Location {
+	key := pathKey(path)
+	locs := s.locs[key]
+	if len(locs) == 0 {
+		return nil
+	}
+	s.locs[key] = locs[1:]
+	return locs[0]
+}
+
+// addDecl adds comments from the given location to the given node and then
+// returns the node and location as a decl.
+func (s *astSynthesizer) addDecl(decls []decl, n ast.Node, loc *descriptorpb.SourceCodeInfo_Location) ([]decl, error) {
+	if err := s.addComments(n, loc); err != nil {
+		return nil, err
+	}
+	return append(decls, decl{node: n, loc: loc}), nil
+}
+
+// addComments adds comments from the given location to the given node.
+func (s *astSynthesizer) addComments(n ast.Node, loc *descriptorpb.SourceCodeInfo_Location) error {
+	if loc != nil {
+		for _, c := range loc.LeadingDetachedComments {
+			lines := commentLines(c)
+			for i, line := range lines {
+				var err error
+				if i == len(lines)-1 {
+					err = s.e.AddDetachedComment(n, line)
+				} else {
+					err = s.e.AddComment(n, line)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if loc.LeadingComments != nil {
+			for _, line := range commentLines(loc.GetLeadingComments()) {
+				if err := s.e.AddComment(n, line); err != nil {
+					return err
+				}
+			}
+		}
+		if loc.TrailingComments != nil {
+			for _, line := range commentLines(loc.GetTrailingComments()) {
+				if err := s.e.AddTrailingComment(n, line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// commentLines converts the given comment text, from source code info, into
+// comments. If the text does not end with a newline, it came from a block
+// comment, so a single block comment is returned. Otherwise, the text is
+// converted into line comments.
+func commentLines(text string) []string {
+	if !strings.HasSuffix(text, "\n") && !strings.Contains(text, "*/") {
+		return []string{"/*" + text + "*/"}
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "//" + line
+	}
+	return lines
+}
+
+// sortDecls sorts the given declarations by their position in source code
+// info. Declarations without a source location remain after the declaration
+// that precedes them.
+func sortDecls(decls []decl) {
+	type position struct{ line, col int32 }
+	positions := make(map[ast.Node]position, len(decls))
+	pos := position{-1, -1}
+	for _, d := range decls {
+		if span := d.loc.GetSpan(); len(span) >= 2 {
+			pos = position{span[0], span[1]}
+		}
+		positions[d.node] = pos
+	}
+	sort.SliceStable(decls, func(i, j int) bool {
+		posI, posJ := positions[decls[i].node], positions[decls[j].node]
+		if posI.line != posJ.line {
+			return posI.line < posJ.line
+		}
+		return posI.col < posJ.col
+	})
+}
+
+func (s *astSynthesizer) synthesizeFile(fd *descriptorpb.FileDescriptorProto) (*ast.FileNode, error) {
+	var syntax *ast.SyntaxNode
+	var decls []decl
+	var err error
+	if fd.Syntax != nil {
+		syntax = s.e.Syntax(fd.GetSyntax())
+		if _, err := s.addDecl(nil, syntax, s.location(internal.File_syntaxTag)); err != nil {
+			return nil, err
+		}
+	}
+	if fd.Package != nil {
+		decls, err = s.addDecl(decls, s.e.Package(fd.GetPackage()), s.location(internal.File_packageTag))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, dep := range fd.Dependency {
+		modifier := ""
+		if containsIndex(fd.PublicDependency, i) {
+			modifier = "public"
+		} else if containsIndex(fd.WeakDependency, i) {
+			modifier = "weak"
+		}
+		decls, err = s.addDecl(decls, s.e.Import(dep, modifier), s.location(internal.File_dependencyTag, int32(i)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if decls, err = s.options(decls, fd.GetOptions(), []int32{internal.File_optionsTag}); err != nil {
+		return nil, err
+	}
+
+	isProto3 := fd.GetSyntax() == "proto3"
+	var members []*member
+	if members, err = s.extends(members, fd.Extension, fd.MessageType, isProto3, nil); err != nil {
+		return nil, err
+	}
+	if members, err = s.nestedMessages(members, fd.MessageType, isProto3, nil); err != nil {
+		return nil, err
+	}
+	decls = append(decls, orderMembers(members, len(fd.MessageType))...)
+	for i, ed := range fd.EnumType {
+		path := []int32{internal.File_enumsTag, int32(i)}
+		en, err := s.enum(ed, path)
+		if err != nil {
+			return nil, err
+		}
+		if decls, err = s.addDecl(decls, en, s.location(path...)); err != nil {
+			return nil, err
+		}
+	}
+	for i, sd := range fd.Service {
+		path := []int32{internal.File_servicesTag, int32(i)}
+		svc, err := s.service(sd, path)
+		if err != nil {
+			return nil, err
+		}
+		if decls, err = s.addDecl(decls, svc, s.location(path...)); err != nil {
+			return nil, err
+		}
+	}
+
+	sortDecls(decls)
+	if syntax != nil {
+		if err := s.e.SetSyntax(syntax); err != nil {
+			return nil, err
+		}
+	}
+	nodes := make([]ast.Node, len(decls))
+	for i, d := range decls {
+		nodes[i] = d.node
+	}
+	if err := s.e.Append(s.e.File(), nodes...); err != nil {
+		return nil, err
+	}
+	s.r.putFileNode(fd, s.e.File())
+	return s.e.File(), nil
+}
+
+func containsIndex(indexes []int32, index int) bool {
+	for _, i := range indexes {
+		if int(i) == index {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *astSynthesizer) message(md *descriptorpb.DescriptorProto, isProto3 bool, path []int32) (*ast.MessageNode, error) {
+	decls, err := s.messageBody(md, isProto3, path)
+	if err != nil {
+		return nil, err
+	}
+	msg := s.e.Message(md.GetName(), decls...)
+	s.r.putMessageNode(md, msg)
+	return msg, nil
+}
+
+func (s *astSynthesizer) messageBody(md *descriptorpb.DescriptorProto, isProto3 bool, path []int32) ([]ast.MessageElement, error) {
+	var decls []decl
+	var err error
+	if decls, err = s.options(decls, md.GetOptions(), appendPath(path, internal.Message_optionsTag)); err != nil {
+		return nil, err
+	}
+
+	var members []*member
+	var oneOfs []*member
+	for i, fld := range md.Field {
+		fldPath := appendPath(path, internal.Message_fieldsTag, int32(i))
+		n, msgIndex, err := s.field(fld, md.NestedType, isProto3, path, fldPath)
+		if err != nil {
+			return nil, err
+		}
+		d, err := s.addDecl(nil, n, s.location(fldPath...))
+		if err != nil {
+			return nil, err
+		}
+		m := &member{decl: d[0], field: i, ext: -1}
+		if msgIndex >= 0 {
+			m.msgs = []int{msgIndex}
+		}
+		if fld.OneofIndex == nil || fld.GetProto3Optional() {
+			members = append(members, m)
+			continue
+		}
+		index := int(fld.GetOneofIndex())
+		if index < 0 || index >= len(md.OneofDecl) {
+			return nil, fmt.Errorf("field %s.%s has invalid oneof index %d", md.GetName(), fld.GetName(), index)
+		}
+		if oneOfs == nil {
+			oneOfs = make([]*member, len(md.OneofDecl))
+		}
+		if oneOfs[index] == nil {
+			// the oneof is declared where its first field is; its node is
+			// created below, after all of its fields are known
+			oneOfs[index] = &member{decl: decl{loc: m.loc}, field: i, ext: -1}
+			members = append(members, oneOfs[index])
+		}
+		oneOfs[index].msgs = append(oneOfs[index].msgs, m.msgs...)
+		oneOfs[index].fields = append(oneOfs[index].fields, m.node.(ast.OneOfElement))
+	}
+	for i, oo := range oneOfs {
+		if oo == nil {
+			continue
+		}
+		ood := md.OneofDecl[i]
+		ooPath := appendPath(path, internal.Message_oneOfsTag, int32(i))
+		ooDecls, err := s.options(nil, ood.GetOptions(), appendPath(ooPath, internal.OneOf_optionsTag))
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]ast.OneOfElement, 0, len(ooDecls)+len(oo.fields))
+		for _, d := range ooDecls {
+			elements = append(elements, d.node.(ast.OneOfElement))
+		}
+		elements = append(elements, oo.fields...)
+		n := s.e.OneOf(ood.GetName(), elements...)
+		s.r.putOneOfNode(ood, n)
+		loc := s.location(ooPath...)
+		d, err := s.addDecl(nil, n, loc)
+		if err != nil {
+			return nil, err
+		}
+		oo.node = n
+		if loc != nil {
+			oo.loc = d[0].loc
+		}
+	}
+	if members, err = s.extends(members, md.Extension, md.NestedType, isProto3, path); err != nil {
+		return nil, err
+	}
+	if members, err = s.nestedMessages(members, md.NestedType, isProto3, path); err != nil {
+		return nil, err
+	}
+	decls = append(decls, orderMembers(members, len(md.NestedType))...)
+
+	for i, ed := range md.EnumType {
+		enumPath := appendPath(path, internal.Message_enumsTag, int32(i))
+		en, err := s.enum(ed, enumPath)
+		if err != nil {
+			return nil, err
+		}
+		if decls, err = s.addDecl(decls, en, s.location(enumPath...)); err != nil {
+			return nil, err
+		}
+	}
+
+	// extension ranges with the same options are declared together
+	for start := 0; start < len(md.ExtensionRange); {
+		end := start + 1
+		for end < len(md.ExtensionRange) && proto.Equal(md.ExtensionRange[start].GetOptions(), md.ExtensionRange[end].GetOptions()) {
+			end++
+		}
+		ranges := make([]*ast.RangeNode, end-start)
+		var loc *descriptorpb.SourceCodeInfo_Location
+		for i := start; i < end; i++ {
+			er := md.ExtensionRange[i]
+			ranges[i-start] = s.messageRange(er.GetStart(), er.GetEnd())
+			s.r.putExtensionRangeNode(er, ranges[i-start])
+			rangeLoc := s.location(appendPath(path, internal.Message_extensionRangeTag, int32(i))...)
+			if loc == nil {
+				loc = rangeLoc
+			}
+		}
+		optsPath := appendPath(path, internal.Message_extensionRangeTag, int32(start), internal.ExtensionRange_optionsTag)
+		opts, err := s.compactOptions(nil, md.ExtensionRange[start].GetOptions(), optsPath)
+		if err != nil {
+			return nil, err
+		}
+		if decls, err = s.addDecl(decls, s.e.ExtensionRange(ranges, opts), loc); err != nil {
+			return nil, err
+		}
+		start = end
+	}
+	if len(md.ReservedRange) > 0 {
+		ranges := make([]*ast.RangeNode, len(md.ReservedRange))
+		var loc *descriptorpb.SourceCodeInfo_Location
+		for i, rr := range md.ReservedRange {
+			ranges[i] = s.messageRange(rr.GetStart(), rr.GetEnd())
+			s.r.putMessageReservedRangeNode(rr, ranges[i])
+			if rangeLoc := s.location(appendPath(path, internal.Message_reservedRangeTag, int32(i))...); loc == nil {
+				loc = rangeLoc
+			}
+		}
+		if decls, err = s.addDecl(decls, s.e.ReservedRanges(ranges...), loc); err != nil {
+			return nil, err
+		}
+	}
+	if len(md.ReservedName) > 0 {
+		loc := s.location(appendPath(path, internal.Message_reservedNameTag, 0)...)
+		if decls, err = s.addDecl(decls, s.e.ReservedNames(md.ReservedName...), loc); err != nil {
+			return nil, err
+		}
+	}
+
+	sortDecls(decls)
+	elements := make([]ast.MessageElement, len(decls))
+	for i, d := range decls {
+		elements[i] = d.node.(ast.MessageElement)
+	}
+	return elements, nil
+}
+
+func (s *astSynthesizer) messageRange(start, end int32) *ast.RangeNode {
+	// end is exclusive in descriptors
+	if end-1 == internal.MaxNormalTag || end-1 == internal.MaxTag {
+		return s.e.RangeToMax(int64(start))
+	}
+	return s.e.Range(int64(start), int64(end-1))
+}
+
+// member is a declaration that defines fields, extensions, or messages. The
+// indexes of these elements are used to order members so that the descriptor
+// produced from the synthesized source has elements in the same order.
+type member struct {
+	decl
+	// index of the (first) field or extension defined by this member, or -1
+	field, ext int
+	// indexes of messages defined by this member
+	msgs []int
+	// for oneofs, the fields in the oneof
+	fields []ast.OneOfElement
+}
+
+// orderMembers returns the given members as declarations, ordered so that
+// their fields, extensions, and messages appear in the same order in which
+// they are defined in the descriptor. This matters for groups and map fields,
+// which define both a field and a message.
+func orderMembers(members []*member, numMsgs int) []decl {
+	var fields, exts []*member
+	byMsg := make([]*member, numMsgs)
+	for _, m := range members {
+		if m.field >= 0 {
+			fields = append(fields, m)
+		}
+		if m.ext >= 0 {
+			exts = append(exts, m)
+		}
+		for _, index := range m.msgs {
+			byMsg[index] = m
+		}
+	}
+	emitted := make(map[*member]bool, len(members))
+	head := func(seq []*member) *member {
+		for _, m := range seq {
+			if !emitted[m] {
+				return m
+			}
+		}
+		return nil
+	}
+	ready := func(m *member) bool {
+		if m.field >= 0 && head(fields) != m {
+			return false
+		}
+		if m.ext >= 0 && head(exts) != m {
+			return false
+		}
+		for _, index := range m.msgs {
+			for _, other := range byMsg[:index] {
+				if other != nil && other != m && !emitted[other] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	decls := make([]decl, 0, len(members))
+	for len(decls) < len(members) {
+		var next *member
+		for _, seq := range [][]*member{fields, exts, byMsg} {
+			if candidate := head(seq); candidate != nil && ready(candidate) {
+				next = candidate
+				break
+			}
+		}
+		if next == nil {
+			// descriptor has elements in an order that cannot be reproduced
+			next = head(members)
+		}
+		emitted[next] = true
+		decls = append(decls, next.decl)
+	}
+	return decls
+}
+
+// nestedMessages adds members for the given messages, except those that are
+// already defined by other members (for groups and map entries). The given
+// path is the path of the message that encloses the messages, or empty if
+// they are top-level messages in the file.
+func (s *astSynthesizer) nestedMessages(members []*member, msgs []*descriptorpb.DescriptorProto, isProto3 bool, path []int32) ([]*member, error) {
+	defined := map[int]bool{}
+	for _, m := range members {
+		for _, index := range m.msgs {
+			defined[index] = true
+		}
+	}
+	for i, md := range msgs {
+		if defined[i] {
+			continue
+		}
+		msgPath := appendPath(path, internal.File_messagesTag, int32(i))
+		if len(path) > 0 {
+			msgPath = appendPath(path, internal.Message_nestedMessagesTag, int32(i))
+		}
+		msg, err := s.message(md, isProto3, msgPath)
+		if err != nil {
+			return nil, err
+		}
+		d, err := s.addDecl(nil, msg, s.location(msgPath...))
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member{decl: d[0], field: -1, ext: -1, msgs: []int{i}})
+	}
+	return members, nil
+}
+
+// extends adds members for extend blocks for the given extensions.
+// Consecutive extensions with the same extendee are declared in the same
+// extend block. The given msgs are the messages in the same scope as the
+// extensions, for extensions that are groups. The given path is the path of
+// the message that encloses the extensions, or empty if they are top-level
+// extensions in the file.
+func (s *astSynthesizer) extends(members []*member, exts []*descriptorpb.FieldDescriptorProto, msgs []*descriptorpb.DescriptorProto, isProto3 bool, path []int32) ([]*member, error) {
+	extPath := appendPath(path, internal.File_extensionsTag)
+	if len(path) > 0 {
+		extPath = appendPath(path, internal.Message_extensionsTag)
+	}
+	for start := 0; start < len(exts); {
+		end := start + 1
+		for end < len(exts) && exts[end].GetExtendee() == exts[start].GetExtendee() {
+			end++
+		}
+		elements := make([]ast.ExtendElement, 0, end-start)
+		m := &member{field: -1, ext: start}
+		for i := start; i < end; i++ {
+			fldPath := appendPath(extPath, int32(i))
+			n, msgIndex, err := s.field(exts[i], msgs, isProto3, path, fldPath)
+			if err != nil {
+				return nil, err
+			}
+			fldLoc := s.location(fldPath...)
+			if _, err := s.addDecl(nil, n, fldLoc); err != nil {
+				return nil, err
+			}
+			elements = append(elements, n.(ast.ExtendElement))
+			if msgIndex >= 0 {
+				m.msgs = append(m.msgs, msgIndex)
+			}
+			if m.loc == nil {
+				m.loc = fldLoc
+			}
+		}
+		ext := s.e.Extend(exts[start].GetExtendee(), elements...)
+		// the extend block's comments are on the location for all extensions
+		d, err := s.addDecl(nil, ext, s.location(extPath...))
+		if err != nil {
+			return nil, err
+		}
+		m.node = ext
+		if m.loc == nil {
+			m.loc = d[0].loc
+		}
+		members = append(members, m)
+		start = end
+	}
+	return members, nil
+}
+
+// field creates a node for the given field. The given msgs are the messages
+// in the same scope as the field, which are searched for the message
+// definitions for groups and map entries. The given msgPath is the path of
+// the message that contains msgs (or empty if msgs are top-level messages in
+// the file). If the field defines one of msgs, because it is a group or map
+// field, the index of that message is also returned. Otherwise, the returned
+// index is -1.
+func (s *astSynthesizer) field(fld *descriptorpb.FieldDescriptorProto, msgs []*descriptorpb.DescriptorProto, isProto3 bool, msgPath, fldPath []int32) (ast.Node, int, error) {
+	var label string
+	switch {
+	case fld.GetProto3Optional():
+		label = "optional"
+	case fld.OneofIndex != nil:
+	case fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		label = "repeated"
+	case fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+		label = "required"
+	case !isProto3:
+		label = "optional"
+	}
+
+	opts, err := s.compactOptions(s.fieldPseudoOptions(fld), fld.GetOptions(), appendPath(fldPath, internal.Field_optionsTag))
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		index, md := findNestedMessage(msgs, fld.GetTypeName())
+		if md == nil {
+			return nil, -1, fmt.Errorf("field %s: could not find message %s for group", fld.GetName(), fld.GetTypeName())
+		}
+		nestedTag := int32(internal.Message_nestedMessagesTag)
+		if len(msgPath) == 0 {
+			nestedTag = internal.File_messagesTag
+		}
+		path := appendPath(msgPath, nestedTag, int32(index))
+		decls, err := s.messageBody(md, isProto3, path)
+		if err != nil {
+			return nil, -1, err
+		}
+		grp := s.e.Group(label, md.GetName(), uint64(fld.GetNumber()), opts, decls...)
+		// comments for a group may be on the location for its message
+		if err := s.addComments(grp, s.location(path...)); err != nil {
+			return nil, -1, err
+		}
+		s.r.putFieldNode(fld, grp)
+		s.r.putMessageNode(md, grp)
+		return grp, index, nil
+	}
+
+	if fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED &&
+		(fld.Type == nil || fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE) {
+		if index, md := findNestedMessage(msgs, fld.GetTypeName()); md != nil && md.GetOptions().GetMapEntry() {
+			if len(md.Field) != 2 {
+				return nil, -1, fmt.Errorf("field %s: map entry %s should have two fields but has %d", fld.GetName(), md.GetName(), len(md.Field))
+			}
+			mapFld := s.e.MapField(fieldType(md.Field[0]), fieldType(md.Field[1]), fld.GetName(), uint64(fld.GetNumber()), opts)
+			s.r.putFieldNode(fld, mapFld)
+			s.r.putMessageNode(md, mapFld)
+			s.r.putFieldNode(md.Field[0], mapFld.KeyField())
+			s.r.putFieldNode(md.Field[1], mapFld.ValueField())
+			return mapFld, index, nil
+		}
+	}
+
+	n := s.e.Field(label, fieldType(fld), fld.GetName(), uint64(fld.GetNumber()), opts)
+	s.r.putFieldNode(fld, n)
+	return n, -1, nil
+}
+
+func fieldType(fld *descriptorpb.FieldDescriptorProto) string {
+	if fld.TypeName != nil {
+		return fld.GetTypeName()
+	}
+	return strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))
+}
+
+// findNestedMessage finds the message with the given type name in the given
+// messages, which are all in the same scope. The returned index is -1 if no
+// such message is found.
+func findNestedMessage(msgs []*descriptorpb.DescriptorProto, typeName string) (int, *descriptorpb.DescriptorProto) {
+	name := typeName
+	if pos := strings.LastIndexByte(name, '.'); pos >= 0 {
+		name = name[pos+1:]
+	}
+	for i, md := range msgs {
+		if md.GetName() == name {
+			return i, md
+		}
+	}
+	return -1, nil
+}
+
+// fieldPseudoOptions returns compact options for the given field's default
+// value and JSON name, which are declared as options in source but are not
+// stored in the field's options message.
+func (s *astSynthesizer) fieldPseudoOptions(fld *descriptorpb.FieldDescriptorProto) []*ast.OptionNode {
+	var opts []*ast.OptionNode
+	if fld.DefaultValue != nil {
+		if val := s.defaultValue(fld); val != nil {
+			opts = append(opts, s.e.CompactOption("default", val))
+		}
+	}
+	if fld.JsonName != nil && fld.GetJsonName() != internal.JsonName(fld.GetName()) {
+		opts = append(opts, s.e.CompactOption("json_name", s.e.String(fld.GetJsonName())))
+	}
+	return opts
+}
+
+func (s *astSynthesizer) defaultValue(fld *descriptorpb.FieldDescriptorProto) ast.ValueNode {
+	val := fld.GetDefaultValue()
+	switch fld.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return s.e.String(val)
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		// the default value is already escaped, like in a string literal
+		n, err := parseValue(`"` + val + `"`)
+		if err != nil {
+			return nil
+		}
+		return s.copyValue(n)
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return s.e.Bool(val == "true")
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		switch val {
+		case "inf":
+			return s.e.Float(math.Inf(1))
+		case "-inf":
+			return s.e.Float(math.Inf(-1))
+		case "nan":
+			return s.e.Float(math.NaN())
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil
+		}
+		return s.e.Float(f)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return s.e.Int(i)
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		u, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return s.e.Uint(u)
+	default:
+		// enums (and fields whose type is not known because the descriptor
+		// is not linked)
+		return s.e.Identifier(val)
+	}
+}
+
+func (s *astSynthesizer) enum(ed *descriptorpb.EnumDescriptorProto, path []int32) (*ast.EnumNode, error) {
+	var decls []decl
+	var err error
+	if decls, err = s.options(decls, ed.GetOptions(), appendPath(path, internal.Enum_optionsTag)); err != nil {
+		return nil, err
+	}
+	for i, evd := range ed.Value {
+		valPath := appendPath(path, internal.Enum_valuesTag, int32(i))
+		opts, err := s.compactOptions(nil, evd.GetOptions(), appendPath(valPath, internal.EnumVal_optionsTag))
+		if err != nil {
+			return nil, err
+		}
+		ev := s.e.EnumValue(evd.GetName(), int64(evd.GetNumber()), opts)
+		s.r.putEnumValueNode(evd, ev)
+		if decls, err = s.addDecl(decls, ev, s.location(valPath...)); err != nil {
+			return nil, err
+		}
+	}
+	if len(ed.ReservedRange) > 0 {
+		ranges := make([]*ast.RangeNode, len(ed.ReservedRange))
+		var loc *descriptorpb.SourceCodeInfo_Location
+		for i, rr := range ed.ReservedRange {
+			// end is inclusive in enum reserved ranges
+			if rr.GetEnd() == math.MaxInt32 && rr.GetStart() != math.MaxInt32 {
+				ranges[i] = s.e.RangeToMax(int64(rr.GetStart()))
+			} else {
+				ranges[i] = s.e.Range(int64(rr.GetStart()), int64(rr.GetEnd()))
+			}
+			s.r.putEnumReservedRangeNode(rr, ranges[i])
+			if rangeLoc := s.location(appendPath(path, internal.Enum_reservedRangeTag, int32(i))...); loc == nil {
+				loc = rangeLoc
+			}
+		}
+		if decls, err = s.addDecl(decls, s.e.ReservedRanges(ranges...), loc); err != nil {
+			return nil, err
+		}
+	}
+	if len(ed.ReservedName) > 0 {
+		loc := s.location(appendPath(path, internal.Enum_reservedNameTag, 0)...)
+		if decls, err = s.addDecl(decls, s.e.ReservedNames(ed.ReservedName...), loc); err != nil {
+			return nil, err
+		}
+	}
+
+	sortDecls(decls)
+	elements := make([]ast.EnumElement, len(decls))
+	for i, d := range decls {
+		elements[i] = d.node.(ast.EnumElement)
+	}
+	en := s.e.Enum(ed.GetName(), elements...)
+	s.r.putEnumNode(ed, en)
+	return en, nil
+}
+
+func (s *astSynthesizer) service(sd *descriptorpb.ServiceDescriptorProto, path []int32) (*ast.ServiceNode, error) {
+	var decls []decl
+	var err error
+	if decls, err = s.options(decls, sd.GetOptions(), appendPath(path, internal.Service_optionsTag)); err != nil {
+		return nil, err
+	}
+	for i, mtd := range sd.Method {
+		mtdPath := appendPath(path, internal.Service_methodsTag, int32(i))
+		mtdDecls, err := s.options(nil, mtd.GetOptions(), appendPath(mtdPath, internal.Method_optionsTag))
+		if err != nil {
+			return nil, err
+		}
+		sortDecls(mtdDecls)
+		elements := make([]ast.RPCElement, len(mtdDecls))
+		for i, d := range mtdDecls {
+			elements[i] = d.node.(ast.RPCElement)
+		}
+		rpc := s.e.RPC(mtd.GetName(), mtd.GetInputType(), mtd.GetClientStreaming(), mtd.GetOutputType(), mtd.GetServerStreaming(), elements...)
+		s.r.putMethodNode(mtd, rpc)
+		if decls, err = s.addDecl(decls, rpc, s.location(mtdPath...)); err != nil {
+			return nil, err
+		}
+	}
+
+	sortDecls(decls)
+	elements := make([]ast.ServiceElement, len(decls))
+	for i, d := range decls {
+		elements[i] = d.node.(ast.ServiceElement)
+	}
+	svc := s.e.Service(sd.GetName(), elements...)
+	s.r.putServiceNode(sd, svc)
+	return svc, nil
+}
+
+// optionsMessage is implemented by all options messages, like *FileOptions
+// and *FieldOptions.
+type optionsMessage interface {
+	proto.Message
+	GetUninterpretedOption() []*descriptorpb.UninterpretedOption
+}
+
+// options adds option declarations to decls for the given options message,
+// whose path is given.
+func (s *astSynthesizer) options(decls []decl, opts optionsMessage, path []int32) ([]decl, error) {
+	err := s.eachOption(opts, path, func(name string, val ast.ValueNode, uo *descriptorpb.UninterpretedOption, loc *descriptorpb.SourceCodeInfo_Location) error {
+		opt := s.e.Option(name, val)
+		if uo != nil {
+			s.putUninterpretedOption(uo, opt)
+		}
+		var err error
+		decls, err = s.addDecl(decls, opt, loc)
+		return err
+	})
+	return decls, err
+}
+
+// compactOptions returns compact options for the given options message, whose
+// path is given. The given pseudo options, if any, are included first.
+func (s *astSynthesizer) compactOptions(pseudoOpts []*ast.OptionNode, opts optionsMessage, path []int32) (*ast.CompactOptionsNode, error) {
+	compactOpts := pseudoOpts
+	err := s.eachOption(opts, path, func(name string, val ast.ValueNode, uo *descriptorpb.UninterpretedOption, _ *descriptorpb.SourceCodeInfo_Location) error {
+		opt := s.e.CompactOption(name, val)
+		if uo != nil {
+			s.putUninterpretedOption(uo, opt)
+		}
+		compactOpts = append(compactOpts, opt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.e.CompactOptions(compactOpts...), nil
+}
+
+func (s *astSynthesizer) putUninterpretedOption(uo *descriptorpb.UninterpretedOption, opt *ast.OptionNode) {
+	s.r.putOptionNode(uo, opt)
+	for i, part := range uo.Name {
+		if i < len(opt.Name.Parts) {
+			s.r.putOptionNamePartNode(part, opt.Name.Parts[i])
+		}
+	}
+}
+
+// eachOption calls the given function for each option in the given options
+// message, in order of field number, followed by any uninterpreted options.
+func (s *astSynthesizer) eachOption(opts optionsMessage, path []int32, fn func(name string, val ast.ValueNode, uo *descriptorpb.UninterpretedOption, loc *descriptorpb.SourceCodeInfo_Location) error) error {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+	msg := opts.ProtoReflect()
+	if len(msg.GetUnknown()) > 0 {
+		// custom options may be unrecognized fields, so try to resolve them
+		// using known extensions
+		resolved, err := internal.ResolveUnknownExtensions(opts, s.extensions)
+		if err != nil {
+			return err
+		}
+		msg = resolved.ProtoReflect()
+		if err := unrecognizedFieldsError(msg); err != nil {
+			return err
+		}
+	}
+	var fields []protoreflect.FieldDescriptor
+	msg.Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fld.Number() != internal.UninterpretedOptionsTag {
+			fields = append(fields, fld)
+		}
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Number() < fields[j].Number()
+	})
+	for _, fld := range fields {
+		name := optionFieldName(fld, "(", ")")
+		fldPath := appendPath(path, int32(fld.Number()))
+		val := msg.Get(fld)
+		if fld.IsList() {
+			list := val.List()
+			for i := 0; i < list.Len(); i++ {
+				v, err := s.optionValue(fld, list.Get(i))
+				if err != nil {
+					return err
+				}
+				if err := fn(name, v, nil, s.location(fldPath...)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		v, err := s.optionValue(fld, val)
+		if err != nil {
+			return err
+		}
+		if err := fn(name, v, nil, s.location(fldPath...)); err != nil {
+			return err
+		}
+	}
+	for i, uo := range opts.GetUninterpretedOption() {
+		var name strings.Builder
+		for j, part := range uo.Name {
+			if j > 0 {
+				name.WriteByte('.')
+			}
+			if part.GetIsExtension() {
+				name.WriteString("(" + part.GetNamePart() + ")")
+			} else {
+				name.WriteString(part.GetNamePart())
+			}
+		}
+		val, err := s.uninterpretedValue(uo)
+		if err != nil {
+			return err
+		}
+		loc := s.location(appendPath(path, internal.UninterpretedOptionsTag, int32(i))...)
+		if err := fn(name.String(), val, uo, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func optionFieldName(fld protoreflect.FieldDescriptor, open, close string) string {
+	if fld.IsExtension() {
+		return open + "." + string(fld.FullName()) + close
+	}
+	if fld.Kind() == protoreflect.GroupKind && open == "[" {
+		// in message literals, groups are referenced by their type name
+		return string(fld.Message().Name())
+	}
+	return string(fld.Name())
+}
+
+func (s *astSynthesizer) optionValue(fld protoreflect.FieldDescriptor, val protoreflect.Value) (ast.ValueNode, error) {
+	switch fld.Kind() {
+	case protoreflect.BoolKind:
+		return s.e.Bool(val.Bool()), nil
+	case protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return s.e.Int(val.Int()), nil
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+		protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return s.e.Uint(val.Uint()), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return s.e.Float(val.Float()), nil
+	case protoreflect.StringKind:
+		return s.e.String(val.String()), nil
+	case protoreflect.BytesKind:
+		return s.e.String(string(val.Bytes())), nil
+	case protoreflect.EnumKind:
+		if ev := fld.Enum().Values().ByNumber(val.Enum()); ev != nil {
+			return s.e.Ident(string(ev.Name())), nil
+		}
+		return s.e.Int(int64(val.Enum())), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return s.messageLiteral(val.Message())
+	default:
+		return nil, fmt.Errorf("option %s has unsupported kind %v", fld.FullName(), fld.Kind())
+	}
+}
+
+// unrecognizedFieldsError returns an error if the given message, which is an
+// options message or the value of an option, has unrecognized fields. These
+// are custom options whose extensions are not known, so they cannot be
+// represented in source.
+func unrecognizedFieldsError(msg protoreflect.Message) error {
+	unknown := msg.GetUnknown()
+	if len(unknown) == 0 {
+		return nil
+	}
+	num, _, _ := protowire.ConsumeTag(unknown)
+	return fmt.Errorf("%s has unrecognized field %d, which may be a custom option whose extension is not known", msg.Descriptor().FullName(), num)
+}
+
+func (s *astSynthesizer) messageLiteral(msg protoreflect.Message) (ast.ValueNode, error) {
+	if err := unrecognizedFieldsError(msg); err != nil {
+		return nil, err
+	}
+	var fields []protoreflect.FieldDescriptor
+	msg.Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fld)
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Number() < fields[j].Number()
+	})
+	var elements []*ast.MessageFieldNode
+	for _, fld := range fields {
+		name := optionFieldName(fld, "[", "]")
+		val := msg.Get(fld)
+		switch {
+		case fld.IsMap():
+			var err error
+			val.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				var key, value ast.ValueNode
+				if key, err = s.optionValue(fld.MapKey(), k.Value()); err != nil {
+					return false
+				}
+				if value, err = s.optionValue(fld.MapValue(), v); err != nil {
+					return false
+				}
+				entry := s.e.MessageLiteral(s.e.MessageField("key", key), s.e.MessageField("value", value))
+				elements = append(elements, s.e.MessageField(name, entry))
+				return true
+			})
+			if err != nil {
+				return nil, err
+			}
+		case fld.IsList():
+			list := val.List()
+			for i := 0; i < list.Len(); i++ {
+				v, err := s.optionValue(fld, list.Get(i))
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, s.e.MessageField(name, v))
+			}
+		default:
+			v, err := s.optionValue(fld, val)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, s.e.MessageField(name, v))
+		}
+	}
+	return s.e.MessageLiteral(elements...), nil
+}
+
+func (s *astSynthesizer) uninterpretedValue(uo *descriptorpb.UninterpretedOption) (ast.ValueNode, error) {
+	switch {
+	case uo.IdentifierValue != nil:
+		return s.e.Identifier(uo.GetIdentifierValue()), nil
+	case uo.PositiveIntValue != nil:
+		return s.e.Uint(uo.GetPositiveIntValue()), nil
+	case uo.NegativeIntValue != nil:
+		return s.e.Int(uo.GetNegativeIntValue()), nil
+	case uo.DoubleValue != nil:
+		return s.e.Float(uo.GetDoubleValue()), nil
+	case uo.StringValue != nil:
+		return s.e.String(string(uo.GetStringValue())), nil
+	case uo.AggregateValue != nil:
+		n, err := parseValue("{" + uo.GetAggregateValue() + "}")
+		if err != nil {
+			return nil, fmt.Errorf("invalid aggregate value for option: %w", err)
+		}
+		return s.copyValue(n), nil
+	default:
+		return nil, fmt.Errorf("uninterpreted option has no value")
+	}
+}
+
+// parseValue parses the given text as the value of an option.
+func parseValue(text string) (ast.ValueNode, error) {
+	file, err := Parse("", strings.NewReader("option x = "+text+";"), reporter.NewHandler(nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Decls) != 1 {
+		return nil, fmt.Errorf("invalid value: %s", text)
+	}
+	opt, ok := file.Decls[0].(*ast.OptionNode)
+	if !ok {
+		return nil, fmt.Errorf("invalid value: %s", text)
+	}
+	return opt.Val, nil
+}
+
+// copyValue returns a copy of the given value node, created by the builder.
+// Message and array literals are copied faithfully, including separators, so
+// that the copy's aggregate value matches that of the original.
+func (s *astSynthesizer) copyValue(n ast.ValueNode) ast.ValueNode {
+	switch n := n.(type) {
+	case *ast.ArrayLiteralNode:
+		vals := make([]ast.ValueNode, len(n.Elements))
+		for i, v := range n.Elements {
+			vals[i] = s.copyValue(v)
+		}
+		return ast.NewArrayLiteralNode(s.copyRune(n.OpenBracket), vals, s.copyRunes(n.Commas), s.copyRune(n.CloseBracket))
+	case *ast.MessageLiteralNode:
+		fields := make([]*ast.MessageFieldNode, len(n.Elements))
+		for i, fld := range n.Elements {
+			var name *ast.FieldReferenceNode
+			if fld.Name.IsExtension() {
+				name = ast.NewExtensionFieldReferenceNode(s.copyRune(fld.Name.Open), s.e.Identifier(string(fld.Name.Name.AsIdentifier())), s.copyRune(fld.Name.Close))
+			} else {
+				name = ast.NewFieldReferenceNode(s.e.Ident(string(fld.Name.Name.AsIdentifier())))
+			}
+			fields[i] = ast.NewMessageFieldNode(name, s.copyRune(fld.Sep), s.copyValue(fld.Val))
+		}
+		return ast.NewMessageLiteralNode(s.copyRune(n.Open), fields, s.copyRunes(n.Seps), s.copyRune(n.Close))
+	}
+	switch val := n.Value().(type) {
+	case string:
+		return s.e.String(val)
+	case int64:
+		return s.e.Int(val)
+	case uint64:
+		return s.e.Uint(val)
+	case float64:
+		return s.e.Float(val)
+	case bool:
+		return s.e.Bool(val)
+	case ast.Identifier:
+		return s.e.Identifier(string(val))
+	default:
+		panic(fmt.Sprintf("unexpected value type: %T", val))
+	}
+}
+
+func (s *astSynthesizer) copyRune(n *ast.RuneNode) *ast.RuneNode {
+	if n == nil {
+		return nil
+	}
+	return s.e.Rune(n.Rune)
+}
+
+func (s *astSynthesizer) copyRunes(nodes []*ast.RuneNode) []*ast.RuneNode {
+	if nodes == nil {
+		return nil
+	}
+	runes := make([]*ast.RuneNode, len(nodes))
+	for i, n := range nodes {
+		runes[i] = s.copyRune(n)
+	}
+	return runes
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+func TestSynthesizeASTRoundTrip(t *testing.T) {
+	err := filepath.Walk("../internal/testprotos", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(path) != ".proto" {
+			return nil
+		}
+		t.Run(path, func(t *testing.T) {
+			f, err := os.Open(path)
+			require.NoError(t, err)
+			defer func() {
+				_ = f.Close()
+			}()
+			res := parseResult(t, filepath.Base(path), f)
+
+			file, err := SynthesizeAST(res.Proto())
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, ast.Print(&buf, file))
+			synthesized := parseResult(t, filepath.Base(path), &buf)
+			if !proto.Equal(res.Proto(), synthesized.Proto()) {
+				assert.Equal(t, prototext.Format(res.Proto()), prototext.Format(synthesized.Proto()), "source:\n%s", buf.String())
+			}
+		})
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func parseResult(t *testing.T, filename string, r io.Reader) Result {
+	handler := reporter.NewHandler(nil)
+	file, err := Parse(filename, r, handler)
+	require.NoError(t, err)
+	res, err := ResultFromAST(file, true, handler)
+	require.NoError(t, err)
+	return res
+}
+
+func TestSynthesizeAST(t *testing.T) {
+	fd := &descriptorpb.FileDescriptorProto{}
+	err := prototext.Unmarshal([]byte(`
+		name: "test.proto"
+		package: "foo.bar"
+		dependency: "google/protobuf/descriptor.proto"
+		syntax: "proto3"
+		options: { java_package: "com.foo.bar" }
+		message_type: {
+			name: "Foo"
+			field: { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT64 json_name: "ID" }
+			field: { name: "attrs" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".foo.bar.Foo.AttrsEntry" }
+			field: { name: "s" number: 3 label: LABEL_OPTIONAL type: TYPE_STRING oneof_index: 0 }
+			field: { name: "k" number: 4 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".foo.bar.Kind" oneof_index: 0 options: { deprecated: true } }
+			field: { name: "opt" number: 5 label: LABEL_OPTIONAL type: TYPE_BOOL oneof_index: 1 proto3_optional: true }
+			nested_type: {
+				name: "AttrsEntry"
+				field: { name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING }
+				field: { name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_BYTES }
+				options: { map_entry: true }
+			}
+			oneof_decl: { name: "choice" }
+			oneof_decl: { name: "_opt" }
+			reserved_range: { start: 10 end: 11 }
+			reserved_range: { start: 20 end: 536870912 }
+			reserved_name: "foo"
+		}
+		enum_type: {
+			name: "Kind"
+			value: { name: "KIND_UNSET" number: 0 }
+			value: { name: "KIND_NEG" number: -1 }
+		}
+		service: {
+			name: "Svc"
+			method: { name: "Get" input_type: ".foo.bar.Foo" output_type: ".foo.bar.Foo" server_streaming: true options: { idempotency_level: NO_SIDE_EFFECTS } }
+		}
+		source_code_info: {
+			location: { path: [4, 0] span: [5, 0, 20, 1] leading_comments: " Foo is a message.\n" leading_detached_comments: " Detached\n" }
+			location: { path: [4, 0, 2, 0] span: [6, 2, 30] trailing_comments: " the ID\n" }
+			location: { path: [5, 0] span: [22, 0, 25, 1] leading_comments: " Kind is an enum " }
+		}`), fd)
+	require.NoError(t, err)
+
+	res, err := ResultWithSynthesizedAST(fd)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, ast.Print(&buf, res.AST()))
+	assert.Equal(t, `syntax = "proto3";
+
+package foo.bar;
+
+import "google/protobuf/descriptor.proto";
+
+option java_package = "com.foo.bar";
+
+// Detached
+
+// Foo is a message.
+message Foo {
+  uint64 id = 1 [json_name = "ID"]; // the ID
+  map<string, bytes> attrs = 2;
+  oneof choice {
+    string s = 3;
+    .foo.bar.Kind k = 4 [deprecated = true];
+  }
+  optional bool opt = 5;
+  reserved 10, 20 to max;
+  reserved "foo";
+}
+
+/* Kind is an enum */
+enum Kind {
+  KIND_UNSET = 0;
+  KIND_NEG = -1;
+}
+
+service Svc {
+  rpc Get(.foo.bar.Foo) returns (stream .foo.bar.Foo) {
+    option idempotency_level = NO_SIDE_EFFECTS;
+  }
+}
+`, buf.String())
+
+	// nodes can be found for elements of the descriptor
+	md := fd.MessageType[0]
+	assert.Equal(t, "test.proto:12:1", res.AST().NodeInfo(res.MessageNode(md)).Start().String())
+	assert.Equal(t, "test.proto:14:3", res.AST().NodeInfo(res.FieldNode(md.Field[1])).Start().String())
+	assert.Equal(t, "test.proto:15:3", res.AST().NodeInfo(res.OneOfNode(md.OneofDecl[0])).Start().String())
+	assert.Equal(t, "test.proto:27:3", res.AST().NodeInfo(res.EnumValueNode(fd.EnumType[0].Value[1])).Start().String())
+	assert.Equal(t, "test.proto:31:3", res.AST().NodeInfo(res.MethodNode(fd.Service[0].Method[0])).Start().String())
+}
+
+func TestSynthesizeASTUnrecognizedOptions(t *testing.T) {
+	extFile := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, prototext.Unmarshal([]byte(`
+		name: "ext.proto"
+		package: "foo"
+		dependency: "google/protobuf/descriptor.proto"
+		extension: { name: "tag" number: 50001 label: LABEL_OPTIONAL type: TYPE_STRING extendee: ".google.protobuf.FileOptions" }`), extFile))
+	extFd, err := protodesc.NewFile(extFile, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	var types protoregistry.Types
+	require.NoError(t, types.RegisterExtension(dynamicpb.NewExtensionType(extFd.Extensions().Get(0))))
+
+	// like in a file loaded from a descriptor set, the custom option is an
+	// unrecognized field
+	opts := &descriptorpb.FileOptions{}
+	opts.ProtoReflect().SetUnknown(protowire.AppendString(protowire.AppendTag(nil, 50001, protowire.BytesType), "hello"))
+	fd := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"ext.proto"},
+		Options:    opts,
+	}
+
+	_, err = SynthesizeAST(fd)
+	require.EqualError(t, err, "google.protobuf.FileOptions has unrecognized field 50001, which may be a custom option whose extension is not known")
+
+	file, err := SynthesizeAST(fd, WithExtensionResolver(&types))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, ast.Print(&buf, file))
+	assert.Equal(t, `syntax = "proto3";
+
+import "ext.proto";
+
+option (.foo.tag) = "hello";
+`, buf.String())
+}
@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"io"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// TokenKind indicates the kind of a lexical token.
+type TokenKind int
+
+const (
+	// TokenEOF is the kind of the final token, which indicates the end of
+	// the input. The token has no text, but it may have leading comments.
+	TokenEOF = TokenKind(iota)
+	// TokenIdentifier is the kind of a token that is a simple (unqualified)
+	// identifier.
+	TokenIdentifier
+	// TokenKeyword is the kind of a token that is a keyword in the protobuf
+	// language, such as "message" or "int32". Note that keywords are not
+	// reserved: depending on context, a keyword may be used as an
+	// identifier, like for the name of a field.
+	TokenKeyword
+	// TokenString is the kind of a token that is a string literal.
+	TokenString
+	// TokenInt is the kind of a token that is an integer literal. Note that
+	// integer literals are always unsigned. A negative value is indicated
+	// by a preceding '-' punctuation token.
+	TokenInt
+	// TokenFloat is the kind of a token that is a floating point literal.
+	// This includes integer literals that are too large to fit in a uint64.
+	TokenFloat
+	// TokenPunctuation is the kind of a token that is a single punctuation
+	// character, such as '{' or ';'.
+	TokenPunctuation
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenEOF:
+		return "EOF"
+	case TokenIdentifier:
+		return "identifier"
+	case TokenKeyword:
+		return "keyword"
+	case TokenString:
+		return "string literal"
+	case TokenInt:
+		return "int literal"
+	case TokenFloat:
+		return "float literal"
+	case TokenPunctuation:
+		return "punctuation"
+	default:
+		return "unknown"
+	}
+}
+
+// Token is a lexical token in a protobuf source file.
+type Token struct {
+	Kind TokenKind
+	// Node is the AST node for the token. Its concrete type depends on the
+	// kind of the token:
+	//   TokenIdentifier, TokenKeyword: *ast.IdentNode
+	//   TokenString:                   *ast.StringLiteralNode
+	//   TokenInt:                      *ast.UintLiteralNode
+	//   TokenFloat:                    *ast.FloatLiteralNode
+	//   TokenPunctuation, TokenEOF:    *ast.RuneNode
+	Node ast.TerminalNode
+
+	info ast.NodeInfo
+}
+
+// Text returns the token's text, exactly as it appears in the source. So
+// string literals include quotes and escape sequences in this text.
+func (t Token) Text() string {
+	return t.info.RawText()
+}
+
+// Value returns the value of the token. For string literals, this is the
+// string value, with escape sequences interpreted. For integer and float
+// literals, this is a uint64 or float64 respectively. For identifiers and
+// keywords, this is an ast.Identifier. For punctuation, this is a rune.
+// For the EOF token, this is nil.
+func (t Token) Value() interface{} {
+	switch n := t.Node.(type) {
+	case *ast.RuneNode:
+		if t.Kind == TokenEOF {
+			return nil
+		}
+		return n.Rune
+	case ast.ValueNode:
+		return n.Value()
+	default:
+		return nil
+	}
+}
+
+// Start returns the position of the first character of the token.
+func (t Token) Start() ast.SourcePos {
+	return t.info.Start()
+}
+
+// End returns the position just after the last character of the token.
+func (t Token) End() ast.SourcePos {
+	return t.info.End()
+}
+
+// LeadingComments returns the comments that precede the token and are
+// attributed to it.
+func (t Token) LeadingComments() ast.Comments {
+	return t.info.LeadingComments()
+}
+
+// TrailingComments returns the comments that follow the token and are
+// attributed to it.
+//
+// A comment that follows a token may instead be attributed to the token
+// after it, as a leading comment. So trailing comments are not known until
+// the next token has been read. If this method is called before then, it
+// will return no comments.
+func (t Token) TrailingComments() ast.Comments {
+	return t.info.TrailingComments()
+}
+
+// Lexer is a tokenizer for protobuf source. It can be used to examine the
+// lexical tokens in a file without parsing it. The tokens include comment
+// and position information and are attributed in the same way as when the
+// file is parsed. So the leading and trailing comments of a token are the
+// same as for the corresponding element of the file's AST.
+type Lexer struct {
+	lex *protoLex
+	eof *Token
+}
+
+// NewLexer creates a new lexer that reads protobuf source from the given
+// reader. The given filename is used in the positions of returned tokens
+// and errors. If the given handler is nil, the lexer will stop at the
+// first error.
+//
+// The reader's entire contents are read into memory when the lexer is
+// created, which is the only time an error can be returned.
+func NewLexer(filename string, r io.Reader, handler *reporter.Handler) (*Lexer, error) {
+	if handler == nil {
+		handler = reporter.NewHandler(nil)
+	}
+	lx, err := newLexer(r, filename, handler)
+	if err != nil {
+		return nil, err
+	}
+	return &Lexer{lex: lx}, nil
+}
+
+// Next returns the next token. When the end of input is reached, this returns
+// a token whose kind is TokenEOF. All subsequent calls will return the same
+// token.
+//
+// If the input contains a lexical error, such as an unterminated string
+// literal, the error is reported to the lexer's handler. If the handler
+// does not return an error, this method returns the error and may be called
+// again to resume lexing at the position after the error. Otherwise, this
+// method and all subsequent calls return the error from the handler.
+func (l *Lexer) Next() (Token, error) {
+	if l.eof != nil {
+		return *l.eof, nil
+	}
+	if err := l.lex.handler.ReporterError(); err != nil {
+		return Token{}, err
+	}
+
+	var lval protoSymType
+	tok := l.lex.Lex(&lval)
+	switch tok {
+	case 0:
+		if err := l.lex.handler.ReporterError(); err != nil {
+			return Token{}, err
+		}
+		eof := l.token(TokenEOF, lval.b)
+		l.eof = &eof
+		return eof, nil
+	case _ERROR:
+		if err := l.lex.handler.ReporterError(); err != nil {
+			return Token{}, err
+		}
+		return Token{}, lval.err
+	case _NAME:
+		return l.token(TokenIdentifier, lval.id), nil
+	case _STRING_LIT:
+		return l.token(TokenString, lval.s), nil
+	case _INT_LIT:
+		return l.token(TokenInt, lval.i), nil
+	case _FLOAT_LIT:
+		return l.token(TokenFloat, lval.f), nil
+	}
+	if lval.id != nil {
+		return l.token(TokenKeyword, lval.id), nil
+	}
+	return l.token(TokenPunctuation, lval.b), nil
+}
+
+func (l *Lexer) token(kind TokenKind, n ast.TerminalNode) Token {
+	return Token{Kind: kind, Node: n, info: l.lex.info.NodeInfo(n)}
+}
+
+// FileInfo returns information about the file being lexed, including the
+// position and comment information for all tokens returned so far.
+func (l *Lexer) FileInfo() *ast.FileInfo {
+	return l.lex.info
+}
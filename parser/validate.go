@@ -174,6 +174,23 @@ func validateMessage(res *result, isProto3 bool, name protoreflect.FullName, md
 		}
 	}
 
+	return validateJsonNames(res, isProto3, scope, md, handler)
+}
+
+// validateJsonNames checks that no two fields in the given message have the
+// same default JSON name. Conflicts that involve custom JSON names (via the
+// json_name option) are checked when options are interpreted.
+func validateJsonNames(res *result, isProto3 bool, scope string, md *descriptorpb.DescriptorProto, handler *reporter.Handler) error {
+	for _, conflict := range internal.JsonNameConflicts(md, true, false) {
+		pos := res.file.NodeInfo(res.FieldNode(conflict.Field).FieldName()).Start()
+		existingPos := res.file.NodeInfo(res.FieldNode(conflict.Existing).FieldName()).Start()
+		err := conflict.Err(scope, existingPos)
+		if !conflict.IsError(isProto3) {
+			handler.HandleWarning(pos, err)
+		} else if err := handler.HandleError(reporter.Error(pos, err)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -341,6 +358,8 @@ type tagRange struct {
 	start int32
 	end   int32
 	node  ast.RangeDeclNode
+	// index of the range in the descriptor, used when there is no AST
+	index int
 }
 
 type tagRanges []tagRange
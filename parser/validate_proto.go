@@ -0,0 +1,793 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/reporter"
+)
+
+// DescriptorError is the underlying error for all errors reported by
+// ValidateProto. Since the descriptor proto being validated has no AST, the
+// element that caused the error is identified by a path. The path has the
+// same structure as the path of a location in a descriptorpb.SourceCodeInfo:
+// it is a sequence of field numbers and list indexes that describe how to get
+// from the file descriptor to the element in question.
+type DescriptorError struct {
+	// The path to the element that caused the error.
+	Path []int32
+	// The error message.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *DescriptorError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DescriptorError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateProto validates the given file descriptor proto. This is meant for
+// descriptor protos that were not produced by parsing source code, such as
+// those that are built programmatically or deserialized from bytes. (Results
+// produced by ResultFromAST are already validated.) It performs the same
+// checks that protoc does when building a descriptor from a descriptor proto,
+// except for those that require resolving references to other elements, which
+// are instead checked during linking.
+//
+// Since there is no AST, errors are not reported with precise source positions.
+// Instead, the underlying error of every reported error is a *DescriptorError,
+// which has the path to the element in question. If the given file includes
+// source code info with a location for that path (or one of its ancestors),
+// the error's position is the start of that location's span. Otherwise, the
+// position has only a filename.
+//
+// The given handler is used to report any errors encountered. If any errors
+// are reported, this function returns a non-nil error.
+func ValidateProto(fd *descriptorpb.FileDescriptorProto, handler *reporter.Handler) error {
+	v := &protoValidator{fd: fd, handler: handler, isProto3: fd.GetSyntax() == "proto3"}
+	if err := v.validateFile(); err != nil {
+		return err
+	}
+	return handler.Error()
+}
+
+type protoValidator struct {
+	fd       *descriptorpb.FileDescriptorProto
+	handler  *reporter.Handler
+	isProto3 bool
+	// lazily computed index of source code info locations, keyed by path
+	locs map[string]*descriptorpb.SourceCodeInfo_Location
+}
+
+func (v *protoValidator) errorf(path []int32, format string, args ...interface{}) error {
+	err := &DescriptorError{Path: path, Err: fmt.Errorf(format, args...)}
+	return v.handler.HandleError(reporter.Error(v.pos(path), err))
+}
+
+func (v *protoValidator) pos(path []int32) ast.SourcePos {
+	if v.locs == nil {
+		v.locs = map[string]*descriptorpb.SourceCodeInfo_Location{}
+		for _, loc := range v.fd.GetSourceCodeInfo().GetLocation() {
+			key := pathKey(loc.Path)
+			if _, ok := v.locs[key]; !ok {
+				v.locs[key] = loc
+			}
+		}
+	}
+	// use the most specific location we can find
+	for p := path; ; p = p[:len(p)-1] {
+		if loc := v.locs[pathKey(p)]; loc != nil && len(loc.Span) >= 3 {
+			return ast.SourcePos{
+				Filename: v.fd.GetName(),
+				Line:     int(loc.Span[0]) + 1,
+				Col:      int(loc.Span[1]) + 1,
+			}
+		}
+		if len(p) == 0 {
+			return ast.UnknownPos(v.fd.GetName())
+		}
+	}
+}
+
+func pathKey(p []int32) string {
+	var buf strings.Builder
+	for _, e := range p {
+		fmt.Fprintf(&buf, "%d,", e)
+	}
+	return buf.String()
+}
+
+// appendPath returns a new path, that does not share storage with the given
+// one, with the given elements appended.
+func appendPath(path []int32, elements ...int32) []int32 {
+	p := make([]int32, len(path), len(path)+len(elements))
+	copy(p, path)
+	return append(p, elements...)
+}
+
+func (v *protoValidator) validateFile() error {
+	fd := v.fd
+	if fd.GetName() == "" {
+		if err := v.errorf([]int32{internal.File_nameTag}, "file name is missing"); err != nil {
+			return err
+		}
+	}
+	if fd.Syntax != nil && fd.GetSyntax() != "proto2" && fd.GetSyntax() != "proto3" {
+		if err := v.errorf([]int32{internal.File_syntaxTag}, `syntax value must be "proto2" or "proto3"`); err != nil {
+			return err
+		}
+	}
+	if fd.Package != nil && !isQualifiedIdentifier(fd.GetPackage()) {
+		if err := v.errorf([]int32{internal.File_packageTag}, "package name %q is not valid", fd.GetPackage()); err != nil {
+			return err
+		}
+	}
+
+	imports := map[string]struct{}{}
+	for i, dep := range fd.Dependency {
+		if _, ok := imports[dep]; ok {
+			if err := v.errorf([]int32{internal.File_dependencyTag, int32(i)}, "import %q was listed twice", dep); err != nil {
+				return err
+			}
+		}
+		imports[dep] = struct{}{}
+	}
+	for i, index := range fd.PublicDependency {
+		if index < 0 || int(index) >= len(fd.Dependency) {
+			if err := v.errorf([]int32{internal.File_publicDependencyTag, int32(i)}, "public dependency index %d is out of range", index); err != nil {
+				return err
+			}
+		}
+	}
+	for i, index := range fd.WeakDependency {
+		if index < 0 || int(index) >= len(fd.Dependency) {
+			if err := v.errorf([]int32{internal.File_weakDependencyTag, int32(i)}, "weak dependency index %d is out of range", index); err != nil {
+				return err
+			}
+		}
+	}
+
+	prefix := fd.GetPackage()
+	if prefix != "" {
+		prefix += "."
+	}
+	for i, md := range fd.MessageType {
+		if err := v.validateMessage(prefix+md.GetName(), []int32{internal.File_messagesTag, int32(i)}, md); err != nil {
+			return err
+		}
+	}
+	for i, ed := range fd.EnumType {
+		if err := v.validateEnum(prefix+ed.GetName(), []int32{internal.File_enumsTag, int32(i)}, ed); err != nil {
+			return err
+		}
+	}
+	for i, fld := range fd.Extension {
+		if err := v.validateField(prefix+fld.GetName(), []int32{internal.File_extensionsTag, int32(i)}, fld, true); err != nil {
+			return err
+		}
+	}
+	for i, sd := range fd.Service {
+		if err := v.validateService(prefix+sd.GetName(), []int32{internal.File_servicesTag, int32(i)}, sd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *protoValidator) checkName(scope string, path []int32, name string) error {
+	if !isIdentifier(name) {
+		return v.errorf(path, "%s: name %q is not a valid identifier", scope, name)
+	}
+	return nil
+}
+
+func (v *protoValidator) validateMessage(fqn string, path []int32, md *descriptorpb.DescriptorProto) error {
+	scope := fmt.Sprintf("message %s", fqn)
+	if err := v.checkName(scope, appendPath(path, internal.Message_nameTag), md.GetName()); err != nil {
+		return err
+	}
+
+	isMessageSet := md.GetOptions().GetMessageSetWireFormat()
+	maxTag := int32(internal.MaxNormalTag)
+	if isMessageSet {
+		maxTag = internal.MaxMessageSetTag
+		if len(md.Field) > 0 {
+			if err := v.errorf(appendPath(path, internal.Message_fieldsTag, 0), "%s: messages with message-set wire format cannot contain non-extension fields", scope); err != nil {
+				return err
+			}
+		}
+		if len(md.ExtensionRange) == 0 {
+			if err := v.errorf(path, "%s: messages with message-set wire format must contain at least one extension range", scope); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v.isProto3 && len(md.ExtensionRange) > 0 {
+		if err := v.errorf(appendPath(path, internal.Message_extensionRangeTag, 0), "%s: extension ranges are not allowed in proto3", scope); err != nil {
+			return err
+		}
+	}
+
+	// check that range bounds are valid
+	rsvd := make(tagRanges, len(md.ReservedRange))
+	for i, r := range md.ReservedRange {
+		rngPath := appendPath(path, internal.Message_reservedRangeTag, int32(i))
+		if err := v.checkRange(rngPath, r.GetStart(), r.GetEnd()-1, maxTag); err != nil {
+			return err
+		}
+		rsvd[i] = tagRange{start: r.GetStart(), end: r.GetEnd(), index: i}
+	}
+	exts := make(tagRanges, len(md.ExtensionRange))
+	for i, r := range md.ExtensionRange {
+		rngPath := appendPath(path, internal.Message_extensionRangeTag, int32(i))
+		if err := v.checkRange(rngPath, r.GetStart(), r.GetEnd()-1, maxTag); err != nil {
+			return err
+		}
+		exts[i] = tagRange{start: r.GetStart(), end: r.GetEnd(), index: i}
+	}
+
+	// reserved ranges should not overlap
+	sort.Sort(rsvd)
+	for i := 1; i < len(rsvd); i++ {
+		if rsvd[i].start < rsvd[i-1].end {
+			rngPath := appendPath(path, internal.Message_reservedRangeTag, int32(rsvd[i].index))
+			if err := v.errorf(rngPath, "%s: reserved ranges overlap: %d to %d and %d to %d", scope, rsvd[i-1].start, rsvd[i-1].end-1, rsvd[i].start, rsvd[i].end-1); err != nil {
+				return err
+			}
+		}
+	}
+	// extensions ranges should not overlap
+	sort.Sort(exts)
+	for i := 1; i < len(exts); i++ {
+		if exts[i].start < exts[i-1].end {
+			rngPath := appendPath(path, internal.Message_extensionRangeTag, int32(exts[i].index))
+			if err := v.errorf(rngPath, "%s: extension ranges overlap: %d to %d and %d to %d", scope, exts[i-1].start, exts[i-1].end-1, exts[i].start, exts[i].end-1); err != nil {
+				return err
+			}
+		}
+	}
+	// see if any extension range overlaps any reserved range
+	for _, ext := range exts {
+		for _, rsv := range rsvd {
+			if ext.start < rsv.end && rsv.start < ext.end {
+				rngPath := appendPath(path, internal.Message_extensionRangeTag, int32(ext.index))
+				if err := v.errorf(rngPath, "%s: extension range %d to %d overlaps reserved range %d to %d", scope, ext.start, ext.end-1, rsv.start, rsv.end-1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	rsvdNames := map[string]struct{}{}
+	for i, n := range md.ReservedName {
+		if _, ok := rsvdNames[n]; ok {
+			if err := v.errorf(appendPath(path, internal.Message_reservedNameTag, int32(i)), "%s: name %q is reserved multiple times", scope, n); err != nil {
+				return err
+			}
+		}
+		rsvdNames[n] = struct{}{}
+	}
+
+	// now, check that fields don't re-use tags and don't try to use extension
+	// or reserved ranges or reserved names
+	fieldTags := map[int32]string{}
+	for i, fld := range md.Field {
+		fldPath := appendPath(path, internal.Message_fieldsTag, int32(i))
+		if err := v.validateField(fqn+"."+fld.GetName(), fldPath, fld, false); err != nil {
+			return err
+		}
+		if _, ok := rsvdNames[fld.GetName()]; ok {
+			if err := v.errorf(appendPath(fldPath, internal.Field_nameTag), "%s: field %s is using a reserved name", scope, fld.GetName()); err != nil {
+				return err
+			}
+		}
+		numPath := appendPath(fldPath, internal.Field_numberTag)
+		if err := v.checkTag(numPath, fld.GetNumber(), maxTag); err != nil {
+			return err
+		}
+		if existing := fieldTags[fld.GetNumber()]; existing != "" {
+			if err := v.errorf(numPath, "%s: fields %s and %s both have the same tag %d", scope, existing, fld.GetName(), fld.GetNumber()); err != nil {
+				return err
+			}
+		}
+		fieldTags[fld.GetNumber()] = fld.GetName()
+		for _, rsv := range rsvd {
+			if fld.GetNumber() >= rsv.start && fld.GetNumber() < rsv.end {
+				if err := v.errorf(numPath, "%s: field %s is using tag %d which is in reserved range %d to %d", scope, fld.GetName(), fld.GetNumber(), rsv.start, rsv.end-1); err != nil {
+					return err
+				}
+			}
+		}
+		for _, ext := range exts {
+			if fld.GetNumber() >= ext.start && fld.GetNumber() < ext.end {
+				if err := v.errorf(numPath, "%s: field %s is using tag %d which is in extension range %d to %d", scope, fld.GetName(), fld.GetNumber(), ext.start, ext.end-1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := v.validateOneofs(scope, path, md); err != nil {
+		return err
+	}
+	if err := v.validateJsonNames(scope, path, md); err != nil {
+		return err
+	}
+
+	if md.GetOptions().GetMapEntry() {
+		if reason := checkMapEntry(md); reason != "" {
+			if err := v.errorf(path, "%s: invalid map entry: %s", scope, reason); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, nested := range md.NestedType {
+		if err := v.validateMessage(fqn+"."+nested.GetName(), appendPath(path, internal.Message_nestedMessagesTag, int32(i)), nested); err != nil {
+			return err
+		}
+	}
+	for i, ed := range md.EnumType {
+		if err := v.validateEnum(fqn+"."+ed.GetName(), appendPath(path, internal.Message_enumsTag, int32(i)), ed); err != nil {
+			return err
+		}
+	}
+	for i, ext := range md.Extension {
+		if err := v.validateField(fqn+"."+ext.GetName(), appendPath(path, internal.Message_extensionsTag, int32(i)), ext, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *protoValidator) validateOneofs(scope string, path []int32, md *descriptorpb.DescriptorProto) error {
+	for i, ood := range md.OneofDecl {
+		oodScope := fmt.Sprintf("%s: oneof %s", scope, ood.GetName())
+		if err := v.checkName(oodScope, appendPath(path, internal.Message_oneOfsTag, int32(i), internal.OneOf_nameTag), ood.GetName()); err != nil {
+			return err
+		}
+	}
+
+	// fields in a oneof must be contiguous, and every oneof needs at least one field
+	fieldCounts := make([]int, len(md.OneofDecl))
+	lastIndex := int32(-1)
+	for i, fld := range md.Field {
+		fldPath := appendPath(path, internal.Message_fieldsTag, int32(i))
+		if fld.GetProto3Optional() {
+			if !v.isProto3 {
+				if err := v.errorf(appendPath(fldPath, internal.Field_proto3OptionalTag), "%s: field %s: proto3_optional is only allowed in proto3 files", scope, fld.GetName()); err != nil {
+					return err
+				}
+			}
+			if fld.OneofIndex == nil {
+				if err := v.errorf(appendPath(fldPath, internal.Field_proto3OptionalTag), "%s: field %s: fields with proto3_optional set must be a member of a one-field oneof", scope, fld.GetName()); err != nil {
+					return err
+				}
+			}
+		}
+		if fld.OneofIndex == nil {
+			lastIndex = -1
+			continue
+		}
+		index := fld.GetOneofIndex()
+		if index < 0 || int(index) >= len(md.OneofDecl) {
+			if err := v.errorf(appendPath(fldPath, internal.Field_oneofIndexTag), "%s: field %s: oneof index %d is out of range", scope, fld.GetName(), index); err != nil {
+				return err
+			}
+			lastIndex = -1
+			continue
+		}
+		if index != lastIndex && fieldCounts[index] > 0 {
+			if err := v.errorf(appendPath(fldPath, internal.Field_oneofIndexTag), "%s: fields in the same oneof must be defined consecutively; field %s cannot be defined after the end of oneof %s", scope, fld.GetName(), md.OneofDecl[index].GetName()); err != nil {
+				return err
+			}
+		}
+		fieldCounts[index]++
+		lastIndex = index
+	}
+
+	for i, count := range fieldCounts {
+		if count == 0 {
+			if err := v.errorf(appendPath(path, internal.Message_oneOfsTag, int32(i)), "%s: oneof %s must contain at least one field", scope, md.OneofDecl[i].GetName()); err != nil {
+				return err
+			}
+		}
+	}
+	for i, fld := range md.Field {
+		if !fld.GetProto3Optional() || fld.OneofIndex == nil {
+			continue
+		}
+		index := fld.GetOneofIndex()
+		if index >= 0 && int(index) < len(fieldCounts) && fieldCounts[index] > 1 {
+			fldPath := appendPath(path, internal.Message_fieldsTag, int32(i))
+			if err := v.errorf(appendPath(fldPath, internal.Field_oneofIndexTag), "%s: field %s: fields with proto3_optional set must be a member of a one-field oneof", scope, fld.GetName()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateJsonNames checks that the JSON names of the given message's fields
+// do not conflict. This checks both default and custom JSON names.
+func (v *protoValidator) validateJsonNames(scope string, path []int32, md *descriptorpb.DescriptorProto) error {
+	indexes := make(map[*descriptorpb.FieldDescriptorProto]int32, len(md.Field))
+	for i, fld := range md.Field {
+		indexes[fld] = int32(i)
+	}
+	for _, conflict := range internal.JsonNameConflicts(md, true, true) {
+		fldPath := appendPath(path, internal.Message_fieldsTag, indexes[conflict.Field])
+		existingPath := appendPath(path, internal.Message_fieldsTag, indexes[conflict.Existing])
+		if conflict.Custom {
+			fldPath = append(fldPath, internal.Field_jsonNameTag)
+		}
+		if conflict.ExistingCustom {
+			existingPath = append(existingPath, internal.Field_jsonNameTag)
+		}
+		err := &DescriptorError{Path: fldPath, Err: conflict.Err(scope, v.pos(existingPath))}
+		if !conflict.IsError(v.isProto3) {
+			v.handler.HandleWarning(v.pos(fldPath), err)
+		} else if err := v.handler.HandleError(reporter.Error(v.pos(fldPath), err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMapEntry checks that the given message, which has the map_entry option
+// set, has the shape of a map entry. If not, it returns a description of the
+// problem. Otherwise, it returns the empty string.
+func checkMapEntry(md *descriptorpb.DescriptorProto) string {
+	if !strings.HasSuffix(md.GetName(), "Entry") {
+		return "name must end with \"Entry\""
+	}
+	if len(md.ExtensionRange) > 0 || len(md.Extension) > 0 || len(md.NestedType) > 0 ||
+		len(md.EnumType) > 0 || len(md.OneofDecl) > 0 {
+		return "must not contain anything other than key and value fields"
+	}
+	if len(md.Field) != 2 {
+		return "must have exactly two fields"
+	}
+	key, val := md.Field[0], md.Field[1]
+	if key.GetName() != "key" || key.GetNumber() != 1 {
+		return "first field must be named \"key\" with number 1"
+	}
+	if val.GetName() != "value" || val.GetNumber() != 2 {
+		return "second field must be named \"value\" with number 2"
+	}
+	if key.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL || val.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL {
+		return "key and value fields must have optional labels"
+	}
+	switch key.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+		descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+		descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_ENUM,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return fmt.Sprintf("key field cannot have type %s", strings.ToLower(strings.TrimPrefix(key.GetType().String(), "TYPE_")))
+	}
+	if key.TypeName != nil && key.Type == nil {
+		return "key field must have a scalar type"
+	}
+	return ""
+}
+
+func (v *protoValidator) checkTag(path []int32, tag, maxTag int32) error {
+	if tag < 1 {
+		return v.errorf(path, "tag number %d must be greater than zero", tag)
+	} else if tag > maxTag {
+		return v.errorf(path, "tag number %d is higher than max allowed tag number (%d)", tag, maxTag)
+	} else if tag >= internal.SpecialReservedStart && tag <= internal.SpecialReservedEnd {
+		return v.errorf(path, "tag number %d is in disallowed reserved range %d-%d", tag, internal.SpecialReservedStart, internal.SpecialReservedEnd)
+	}
+	return nil
+}
+
+// checkRange checks the given inclusive range. The given path should be the path
+// to the range (which must have start and end fields that use the same tags as
+// in a message's reserved range).
+func (v *protoValidator) checkRange(path []int32, start, end, maxVal int32) error {
+	if start < 1 || start > maxVal {
+		if err := v.errorf(appendPath(path, internal.ReservedRange_startTag), "range start %d is out of range: should be between %d and %d", start, 1, maxVal); err != nil {
+			return err
+		}
+	}
+	if end < 1 || end > maxVal {
+		if err := v.errorf(appendPath(path, internal.ReservedRange_endTag), "range end %d is out of range: should be between %d and %d", end, 1, maxVal); err != nil {
+			return err
+		}
+	}
+	if start > end {
+		return v.errorf(path, "range, %d to %d, is invalid: start must be <= end", start, end)
+	}
+	return nil
+}
+
+func (v *protoValidator) validateField(fqn string, path []int32, fld *descriptorpb.FieldDescriptorProto, isExtension bool) error {
+	scope := fmt.Sprintf("field %s", fqn)
+	if isExtension {
+		scope = fmt.Sprintf("extension %s", fqn)
+	}
+	if err := v.checkName(scope, appendPath(path, internal.Field_nameTag), fld.GetName()); err != nil {
+		return err
+	}
+
+	if isExtension {
+		if fld.GetExtendee() == "" {
+			if err := v.errorf(appendPath(path, internal.Field_extendeeTag), "%s: extension is missing extendee", scope); err != nil {
+				return err
+			}
+		}
+		if fld.OneofIndex != nil {
+			if err := v.errorf(appendPath(path, internal.Field_oneofIndexTag), "%s: extensions cannot be in a oneof", scope); err != nil {
+				return err
+			}
+		}
+		// checking the tag number requires knowing if the extendee uses
+		// message-set wire format, so that is checked during linking
+		if fld.GetNumber() < 1 {
+			if err := v.errorf(appendPath(path, internal.Field_numberTag), "tag number %d must be greater than zero", fld.GetNumber()); err != nil {
+				return err
+			}
+		}
+	} else if fld.Extendee != nil {
+		if err := v.errorf(appendPath(path, internal.Field_extendeeTag), "%s: extendee is set for non-extension field", scope); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case fld.Type == nil && fld.GetTypeName() == "":
+		if err := v.errorf(path, "%s: field has no type", scope); err != nil {
+			return err
+		}
+	case fld.Type != nil && isScalarType(fld.GetType()):
+		if fld.TypeName != nil {
+			if err := v.errorf(appendPath(path, internal.Field_typeNameTag), "%s: field with scalar type %s should not have a type name", scope, strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))); err != nil {
+				return err
+			}
+		}
+	case fld.GetTypeName() == "":
+		if err := v.errorf(appendPath(path, internal.Field_typeNameTag), "%s: field with message or enum type is missing type name", scope); err != nil {
+			return err
+		}
+	}
+
+	if v.isProto3 {
+		if fld.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			if err := v.errorf(appendPath(path, internal.Field_typeTag), "%s: groups are not allowed in proto3", scope); err != nil {
+				return err
+			}
+		}
+		if fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+			if err := v.errorf(appendPath(path, internal.Field_labelTag), "%s: label 'required' is not allowed in proto3", scope); err != nil {
+				return err
+			}
+		}
+		if fld.DefaultValue != nil {
+			if err := v.errorf(appendPath(path, internal.Field_defaultTag), "%s: default values are not allowed in proto3", scope); err != nil {
+				return err
+			}
+		}
+	} else if isExtension && fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REQUIRED {
+		if err := v.errorf(appendPath(path, internal.Field_labelTag), "%s: extension fields cannot be 'required'", scope); err != nil {
+			return err
+		}
+	}
+
+	if fld.DefaultValue != nil && !v.isProto3 {
+		if err := v.checkDefault(scope, appendPath(path, internal.Field_defaultTag), fld); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *protoValidator) checkDefault(scope string, path []int32, fld *descriptorpb.FieldDescriptorProto) error {
+	if fld.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return v.errorf(path, "%s: default value cannot be set because field is repeated", scope)
+	}
+	val := fld.GetDefaultValue()
+	var ok bool
+	switch fld.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return v.errorf(path, "%s: default value cannot be set because field is a message", scope)
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		_, err := strconv.ParseInt(val, 10, 32)
+		ok = err == nil
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		_, err := strconv.ParseInt(val, 10, 64)
+		ok = err == nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		_, err := strconv.ParseUint(val, 10, 32)
+		ok = err == nil
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		_, err := strconv.ParseUint(val, 10, 64)
+		ok = err == nil
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		switch val {
+		case "inf", "-inf", "nan":
+			ok = true
+		default:
+			f, err := strconv.ParseFloat(val, 64)
+			ok = err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		ok = val == "true" || val == "false"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		// we can't check that it is a valid value until the enum is resolved
+		ok = isIdentifier(val)
+	default:
+		// strings and bytes can have any default value
+		// TODO: validate escape sequences in default values for bytes fields?
+		ok = true
+	}
+	if !ok {
+		return v.errorf(path, "%s: invalid default value %q", scope, val)
+	}
+	return nil
+}
+
+func (v *protoValidator) validateEnum(fqn string, path []int32, ed *descriptorpb.EnumDescriptorProto) error {
+	scope := fmt.Sprintf("enum %s", fqn)
+	if err := v.checkName(scope, appendPath(path, internal.Enum_nameTag), ed.GetName()); err != nil {
+		return err
+	}
+
+	if len(ed.Value) == 0 {
+		if err := v.errorf(path, "%s: enums must define at least one value", scope); err != nil {
+			return err
+		}
+	}
+	if v.isProto3 && len(ed.Value) > 0 && ed.Value[0].GetNumber() != 0 {
+		if err := v.errorf(appendPath(path, internal.Enum_valuesTag, 0, internal.EnumVal_numberTag), "%s: proto3 requires that first value in enum have numeric value of 0", scope); err != nil {
+			return err
+		}
+	}
+
+	// check for aliases
+	allowAlias := ed.GetOptions().GetAllowAlias()
+	vals := map[int32]string{}
+	hasAlias := false
+	for i, evd := range ed.Value {
+		valPath := appendPath(path, internal.Enum_valuesTag, int32(i))
+		if err := v.checkName(fmt.Sprintf("%s: value %s", scope, evd.GetName()), appendPath(valPath, internal.EnumVal_nameTag), evd.GetName()); err != nil {
+			return err
+		}
+		if existing, ok := vals[evd.GetNumber()]; ok {
+			if allowAlias {
+				hasAlias = true
+			} else if err := v.errorf(appendPath(valPath, internal.EnumVal_numberTag), "%s: values %s and %s both have the same numeric value %d; use allow_alias option if intentional", scope, existing, evd.GetName(), evd.GetNumber()); err != nil {
+				return err
+			}
+		}
+		vals[evd.GetNumber()] = evd.GetName()
+	}
+	if allowAlias && !hasAlias {
+		if err := v.errorf(appendPath(path, internal.Enum_optionsTag), "%s: allow_alias is true but no values are aliases", scope); err != nil {
+			return err
+		}
+	}
+
+	// reserved ranges should not overlap
+	rsvd := make(tagRanges, len(ed.ReservedRange))
+	for i, r := range ed.ReservedRange {
+		rngPath := appendPath(path, internal.Enum_reservedRangeTag, int32(i))
+		if r.GetStart() > r.GetEnd() {
+			if err := v.errorf(rngPath, "range, %d to %d, is invalid: start must be <= end", r.GetStart(), r.GetEnd()); err != nil {
+				return err
+			}
+		}
+		rsvd[i] = tagRange{start: r.GetStart(), end: r.GetEnd(), index: i}
+	}
+	sort.Sort(rsvd)
+	for i := 1; i < len(rsvd); i++ {
+		if rsvd[i].start <= rsvd[i-1].end {
+			rngPath := appendPath(path, internal.Enum_reservedRangeTag, int32(rsvd[i].index))
+			if err := v.errorf(rngPath, "%s: reserved ranges overlap: %d to %d and %d to %d", scope, rsvd[i-1].start, rsvd[i-1].end, rsvd[i].start, rsvd[i].end); err != nil {
+				return err
+			}
+		}
+	}
+
+	rsvdNames := map[string]struct{}{}
+	for i, n := range ed.ReservedName {
+		if _, ok := rsvdNames[n]; ok {
+			if err := v.errorf(appendPath(path, internal.Enum_reservedNameTag, int32(i)), "%s: name %q is reserved multiple times", scope, n); err != nil {
+				return err
+			}
+		}
+		rsvdNames[n] = struct{}{}
+	}
+	for i, ev := range ed.Value {
+		valPath := appendPath(path, internal.Enum_valuesTag, int32(i))
+		if _, ok := rsvdNames[ev.GetName()]; ok {
+			if err := v.errorf(appendPath(valPath, internal.EnumVal_nameTag), "%s: value %s is using a reserved name", scope, ev.GetName()); err != nil {
+				return err
+			}
+		}
+		for _, rsv := range rsvd {
+			if ev.GetNumber() >= rsv.start && ev.GetNumber() <= rsv.end {
+				if err := v.errorf(appendPath(valPath, internal.EnumVal_numberTag), "%s: value %s is using number %d which is in reserved range %d to %d", scope, ev.GetName(), ev.GetNumber(), rsv.start, rsv.end); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (v *protoValidator) validateService(fqn string, path []int32, sd *descriptorpb.ServiceDescriptorProto) error {
+	scope := fmt.Sprintf("service %s", fqn)
+	if err := v.checkName(scope, appendPath(path, internal.Service_nameTag), sd.GetName()); err != nil {
+		return err
+	}
+	for i, mtd := range sd.Method {
+		mtdPath := appendPath(path, internal.Service_methodsTag, int32(i))
+		mtdScope := fmt.Sprintf("method %s.%s", fqn, mtd.GetName())
+		if err := v.checkName(mtdScope, appendPath(mtdPath, internal.Method_nameTag), mtd.GetName()); err != nil {
+			return err
+		}
+		if mtd.GetInputType() == "" {
+			if err := v.errorf(appendPath(mtdPath, internal.Method_inputTag), "%s: method is missing request type", mtdScope); err != nil {
+				return err
+			}
+		}
+		if mtd.GetOutputType() == "" {
+			if err := v.errorf(appendPath(mtdPath, internal.Method_outputTag), "%s: method is missing response type", mtdScope); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isScalarType(t descriptorpb.FieldDescriptorProto_Type) bool {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+		descriptorpb.FieldDescriptorProto_TYPE_GROUP,
+		descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return false
+	default:
+		return true
+	}
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isQualifiedIdentifier(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if !isIdentifier(part) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile/reporter"
+)
+
+func TestValidateProto(t *testing.T) {
+	testCases := []struct {
+		name     string
+		contents string
+		errMsg   string
+		path     []int32
+	}{
+		{
+			name: "valid",
+			contents: `
+				name: "test.proto" syntax: "proto2" package: "foo.bar"
+				message_type: <
+					name: "Foo"
+					field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 default_value: "-123" >
+					field: < name: "b" number: 2 label: LABEL_OPTIONAL type_name: ".foo.bar.Foo" >
+					field: < name: "m" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".foo.bar.Foo.MEntry" >
+					nested_type: <
+						name: "MEntry"
+						field: < name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING >
+						field: < name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 >
+						options: < map_entry: true >
+					>
+					extension_range: < start: 100 end: 200 >
+					reserved_range: < start: 10 end: 20 >
+					reserved_name: "c"
+				>
+				enum_type: <
+					name: "Enum"
+					value: < name: "A" number: 1 >
+					value: < name: "B" number: 1 >
+					options: < allow_alias: true >
+				>
+				extension: < name: "ext" number: 100 label: LABEL_OPTIONAL type: TYPE_DOUBLE extendee: ".foo.bar.Foo" default_value: "inf" >
+				service: <
+					name: "Svc"
+					method: < name: "Do" input_type: ".foo.bar.Foo" output_type: ".foo.bar.Foo" >
+				>`,
+		},
+		{
+			name:     "bad syntax",
+			contents: `name: "test.proto" syntax: "proto1"`,
+			errMsg:   `test.proto: syntax value must be "proto2" or "proto3"`,
+			path:     []int32{12},
+		},
+		{
+			name:     "bad package",
+			contents: `name: "test.proto" package: "foo..bar"`,
+			errMsg:   `test.proto: package name "foo..bar" is not valid`,
+			path:     []int32{2},
+		},
+		{
+			name:     "duplicate import",
+			contents: `name: "test.proto" dependency: "a.proto" dependency: "a.proto"`,
+			errMsg:   `test.proto: import "a.proto" was listed twice`,
+			path:     []int32{3, 1},
+		},
+		{
+			name:     "bad public dependency",
+			contents: `name: "test.proto" dependency: "a.proto" public_dependency: 1`,
+			errMsg:   `test.proto: public dependency index 1 is out of range`,
+			path:     []int32{10, 0},
+		},
+		{
+			name:     "bad message name",
+			contents: `name: "test.proto" message_type: < name: "Foo.Bar" >`,
+			errMsg:   `test.proto: message Foo.Bar: name "Foo.Bar" is not a valid identifier`,
+			path:     []int32{4, 0, 1},
+		},
+		{
+			name:     "tag too large",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 536870912 label: LABEL_OPTIONAL type: TYPE_INT32 > >`,
+			errMsg:   `test.proto: tag number 536870912 is higher than max allowed tag number (536870911)`,
+			path:     []int32{4, 0, 2, 0, 3},
+		},
+		{
+			name:     "tag in special reserved range",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 19000 label: LABEL_OPTIONAL type: TYPE_INT32 > >`,
+			errMsg:   `test.proto: tag number 19000 is in disallowed reserved range 19000-19999`,
+			path:     []int32{4, 0, 2, 0, 3},
+		},
+		{
+			name: "duplicate tag",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				field: < name: "b" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 > >`,
+			errMsg: `test.proto: message Foo: fields a and b both have the same tag 1`,
+			path:   []int32{4, 0, 2, 1, 3},
+		},
+		{
+			name: "reserved tag",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				field: < name: "a" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				reserved_range: < start: 1 end: 10 > >`,
+			errMsg: `test.proto: message Foo: field a is using tag 5 which is in reserved range 1 to 9`,
+			path:   []int32{4, 0, 2, 0, 3},
+		},
+		{
+			name: "reserved name",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				field: < name: "a" number: 5 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				reserved_name: "a" >`,
+			errMsg: `test.proto: message Foo: field a is using a reserved name`,
+			path:   []int32{4, 0, 2, 0, 1},
+		},
+		{
+			name: "extension range overlaps reserved range",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				extension_range: < start: 5 end: 15 >
+				reserved_range: < start: 1 end: 10 > >`,
+			errMsg: `test.proto: message Foo: extension range 5 to 14 overlaps reserved range 1 to 9`,
+			path:   []int32{4, 0, 5, 0},
+		},
+		{
+			name: "invalid range",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				reserved_range: < start: 10 end: 5 > >`,
+			errMsg: `test.proto: range, 10 to 4, is invalid: start must be <= end`,
+			path:   []int32{4, 0, 9, 0},
+		},
+		{
+			name:     "extension ranges in proto3",
+			contents: `name: "test.proto" syntax: "proto3" message_type: < name: "Foo" extension_range: < start: 1 end: 10 > >`,
+			errMsg:   `test.proto: message Foo: extension ranges are not allowed in proto3`,
+			path:     []int32{4, 0, 5, 0},
+		},
+		{
+			name:     "message set with fields",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 > extension_range: < start: 2 end: 10 > options: < message_set_wire_format: true > >`,
+			errMsg:   `test.proto: message Foo: messages with message-set wire format cannot contain non-extension fields`,
+			path:     []int32{4, 0, 2, 0},
+		},
+		{
+			name:     "empty oneof",
+			contents: `name: "test.proto" message_type: < name: "Foo" oneof_decl: < name: "o" > >`,
+			errMsg:   `test.proto: message Foo: oneof o must contain at least one field`,
+			path:     []int32{4, 0, 8, 0},
+		},
+		{
+			name: "non-contiguous oneof",
+			contents: `name: "test.proto" message_type: < name: "Foo"
+				field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 >
+				field: < name: "b" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				field: < name: "c" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 0 >
+				oneof_decl: < name: "o" > >`,
+			errMsg: `test.proto: message Foo: fields in the same oneof must be defined consecutively; field c cannot be defined after the end of oneof o`,
+			path:   []int32{4, 0, 2, 2, 9},
+		},
+		{
+			name:     "oneof index out of range",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 oneof_index: 1 > >`,
+			errMsg:   `test.proto: message Foo: field a: oneof index 1 is out of range`,
+			path:     []int32{4, 0, 2, 0, 9},
+		},
+		{
+			name:     "proto3 optional not in oneof",
+			contents: `name: "test.proto" syntax: "proto3" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 proto3_optional: true > >`,
+			errMsg:   `test.proto: message Foo: field a: fields with proto3_optional set must be a member of a one-field oneof`,
+			path:     []int32{4, 0, 2, 0, 17},
+		},
+		{
+			name: "bad map entry",
+			contents: `name: "test.proto" message_type: < name: "Foo" nested_type: < name: "MEntry"
+				field: < name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_BYTES >
+				field: < name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				options: < map_entry: true > > >`,
+			errMsg: `test.proto: message Foo.MEntry: invalid map entry: key field cannot have type bytes`,
+			path:   []int32{4, 0, 3, 0},
+		},
+		{
+			name:     "field missing type",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL > >`,
+			errMsg:   `test.proto: field Foo.a: field has no type`,
+			path:     []int32{4, 0, 2, 0},
+		},
+		{
+			name:     "scalar with type name",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 type_name: ".Foo" > >`,
+			errMsg:   `test.proto: field Foo.a: field with scalar type int32 should not have a type name`,
+			path:     []int32{4, 0, 2, 0, 6},
+		},
+		{
+			name:     "required in proto3",
+			contents: `name: "test.proto" syntax: "proto3" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_REQUIRED type: TYPE_INT32 > >`,
+			errMsg:   `test.proto: field Foo.a: label 'required' is not allowed in proto3`,
+			path:     []int32{4, 0, 2, 0, 4},
+		},
+		{
+			name:     "bad default",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_UINT32 default_value: "-1" > >`,
+			errMsg:   `test.proto: field Foo.a: invalid default value "-1"`,
+			path:     []int32{4, 0, 2, 0, 7},
+		},
+		{
+			name:     "default on repeated",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 1 label: LABEL_REPEATED type: TYPE_BOOL default_value: "true" > >`,
+			errMsg:   `test.proto: field Foo.a: default value cannot be set because field is repeated`,
+			path:     []int32{4, 0, 2, 0, 7},
+		},
+		{
+			name:     "extension without extendee",
+			contents: `name: "test.proto" extension: < name: "a" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 >`,
+			errMsg:   `test.proto: extension a: extension is missing extendee`,
+			path:     []int32{7, 0, 2},
+		},
+		{
+			name:     "required extension",
+			contents: `name: "test.proto" extension: < name: "a" number: 1 label: LABEL_REQUIRED type: TYPE_INT32 extendee: ".Foo" >`,
+			errMsg:   `test.proto: extension a: extension fields cannot be 'required'`,
+			path:     []int32{7, 0, 4},
+		},
+		{
+			name:     "empty enum",
+			contents: `name: "test.proto" enum_type: < name: "Foo" >`,
+			errMsg:   `test.proto: enum Foo: enums must define at least one value`,
+			path:     []int32{5, 0},
+		},
+		{
+			name:     "proto3 enum first value",
+			contents: `name: "test.proto" syntax: "proto3" enum_type: < name: "Foo" value: < name: "A" number: 1 > >`,
+			errMsg:   `test.proto: enum Foo: proto3 requires that first value in enum have numeric value of 0`,
+			path:     []int32{5, 0, 2, 0, 2},
+		},
+		{
+			name:     "enum alias not allowed",
+			contents: `name: "test.proto" enum_type: < name: "Foo" value: < name: "A" number: 1 > value: < name: "B" number: 1 > >`,
+			errMsg:   `test.proto: enum Foo: values A and B both have the same numeric value 1; use allow_alias option if intentional`,
+			path:     []int32{5, 0, 2, 1, 2},
+		},
+		{
+			name:     "allow alias without alias",
+			contents: `name: "test.proto" enum_type: < name: "Foo" value: < name: "A" number: 1 > options: < allow_alias: true > >`,
+			errMsg:   `test.proto: enum Foo: allow_alias is true but no values are aliases`,
+			path:     []int32{5, 0, 3},
+		},
+		{
+			name:     "enum reserved number",
+			contents: `name: "test.proto" enum_type: < name: "Foo" value: < name: "A" number: 1 > reserved_range: < start: 1 end: 1 > >`,
+			errMsg:   `test.proto: enum Foo: value A is using number 1 which is in reserved range 1 to 1`,
+			path:     []int32{5, 0, 2, 0, 2},
+		},
+		{
+			name:     "method missing input",
+			contents: `name: "test.proto" service: < name: "Svc" method: < name: "Do" output_type: ".Foo" > >`,
+			errMsg:   `test.proto: method Svc.Do: method is missing request type`,
+			path:     []int32{6, 0, 2, 0, 2},
+		},
+		{
+			name: "default JSON name conflict",
+			contents: `name: "test.proto" syntax: "proto3" message_type: < name: "Foo"
+				field: < name: "foo_bar" json_name: "fooBar" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				field: < name: "fooBar" json_name: "fooBar" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 > >`,
+			errMsg: `test.proto: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at test.proto`,
+			path:   []int32{4, 0, 2, 1},
+		},
+		{
+			name: "custom JSON name conflict",
+			contents: `name: "test.proto" syntax: "proto2" message_type: < name: "Foo"
+				field: < name: "foo" json_name: "abc" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 >
+				field: < name: "bar" json_name: "abc" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 > >`,
+			errMsg: `test.proto: message Foo: custom JSON name "abc" of field bar conflicts with custom JSON name of field foo, defined at test.proto`,
+			path:   []int32{4, 0, 2, 1, 10},
+		},
+		{
+			name: "position from source info",
+			contents: `name: "test.proto" message_type: < name: "Foo" field: < name: "a" number: 0 label: LABEL_OPTIONAL type: TYPE_INT32 > >
+				source_code_info: <
+					location: < path: [4, 0] span: [2, 0, 5, 1] >
+					location: < path: [4, 0, 2, 0] span: [3, 2, 20] >
+				>`,
+			errMsg: `test.proto:4:3: tag number 0 must be greater than zero`,
+			path:   []int32{4, 0, 2, 0, 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var fd descriptorpb.FileDescriptorProto
+			require.NoError(t, prototext.Unmarshal([]byte(tc.contents), &fd))
+			h := reporter.NewHandler(nil)
+			err := ValidateProto(&fd, h)
+			if tc.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.errMsg, err.Error())
+			var descErr *DescriptorError
+			require.True(t, errors.As(err, &descErr))
+			assert.Equal(t, tc.path, descErr.Path)
+		})
+	}
+}
+
+func TestValidateProtoReportsAllErrors(t *testing.T) {
+	var fd descriptorpb.FileDescriptorProto
+	err := prototext.Unmarshal([]byte(`
+		name: "test.proto" syntax: "proto3"
+		message_type: < name: "Foo" field: < name: "a" number: 0 label: LABEL_REQUIRED type: TYPE_INT32 > >
+		enum_type: < name: "Bar" value: < name: "X" number: 1 > >`), &fd)
+	require.NoError(t, err)
+	var errs []string
+	h := reporter.NewHandler(reporter.NewReporter(func(err reporter.ErrorWithPos) error {
+		errs = append(errs, err.Error())
+		return nil
+	}, nil))
+	err = ValidateProto(&fd, h)
+	assert.Equal(t, reporter.ErrInvalidSource, err)
+	assert.Equal(t, []string{
+		`test.proto: field Foo.a: label 'required' is not allowed in proto3`,
+		`test.proto: tag number 0 must be greater than zero`,
+		`test.proto: enum Bar: proto3 requires that first value in enum have numeric value of 0`,
+	}, errs)
+}
@@ -388,6 +388,24 @@ func TestBasicValidation(t *testing.T) {
 			contents: `option (opt) = {m []};`,
 			succeeds: true,
 		},
+		{
+			contents: `syntax = "proto3"; message Foo { string foo_bar = 1; string fooBar = 2; }`,
+			errMsg:   `test.proto:1:61: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at test.proto:1:41`,
+		},
+		{
+			// only a warning in proto2
+			contents: `syntax = "proto2"; message Foo { optional string foo_bar = 1; optional string fooBar = 2; }`,
+			succeeds: true,
+		},
+		{
+			// conflicts are allowed with deprecated_legacy_json_field_conflicts
+			contents: `syntax = "proto3"; message Foo { option deprecated_legacy_json_field_conflicts = true; string foo_bar = 1; string fooBar = 2; }`,
+			succeeds: true,
+		},
+		{
+			contents: `syntax = "proto3"; message Foo { option deprecated_legacy_json_field_conflicts = false; string foo_bar = 1; string fooBar = 2; }`,
+			errMsg:   `test.proto:1:116: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at test.proto:1:96`,
+		},
 	}
 
 	for i, tc := range testCases {
@@ -406,3 +424,19 @@ func TestBasicValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestJsonNameConflictWarning(t *testing.T) {
+	var warnings []string
+	h := reporter.NewHandler(reporter.NewReporter(nil, func(err reporter.ErrorWithPos) {
+		warnings = append(warnings, err.Error())
+	}))
+	contents := `syntax = "proto2"; message Foo { optional string foo_bar = 1; optional string fooBar = 2; }`
+	file, err := Parse("test.proto", strings.NewReader(contents), h)
+	if assert.NoError(t, err) {
+		_, err = ResultFromAST(file, true, h)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		`test.proto:1:79: message Foo: default JSON name "fooBar" of field fooBar conflicts with default JSON name of field foo_bar, defined at test.proto:1:50`,
+	}, warnings)
+}
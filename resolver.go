@@ -38,7 +38,10 @@ type SearchResult struct {
 	AST *ast.FileNode
 	// A descriptor proto that represents the file. If the field below is not
 	// set, then the compiler will link this proto with its dependencies to
-	// produce a linked descriptor.
+	// produce a linked descriptor. The proto is validated before it is
+	// linked, so it need not come from a trusted source. Errors found in it
+	// are reported with the path to the offending element (see
+	// parser.DescriptorError).
 	Proto *descriptorpb.FileDescriptorProto
 	// A fully linked descriptor that represents the file. If this field is set,
 	// then the compiler has no additional work to do for this file as it is
@@ -142,7 +145,9 @@ func SourceAccessorFromMap(srcs map[string]string) func(string) (io.ReadCloser,
 }
 
 // WithStandardImports returns a new resolver that knows about the same standard
-// imports that are included with protoc.
+// imports that are included with protoc. The standard imports are only used
+// for files that the given resolver cannot find, so it can provide other
+// versions of them.
 func WithStandardImports(r Resolver) Resolver {
 	return ResolverFunc(func(name string) (SearchResult, error) {
 		res, err := r.FindFileByPath(name)
@@ -0,0 +1,242 @@
+package protocompile
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protocompile/linker"
+)
+
+// FileSelector describes a set of protobuf source files that reside in one or
+// more import paths (directories). It can be used to discover all of the
+// files in a source tree and to compute the name of each file relative to the
+// import path in which it was found. This is the name with which other files
+// would import it and the name that should be given to a Compiler.
+type FileSelector struct {
+	// The import paths to search. If nil or empty, the current working
+	// directory is searched. These should generally be the same import paths
+	// used by the compiler's SourceResolver.
+	ImportPaths []string
+	// Optional glob patterns that indicate which files to include. If nil or
+	// empty, all files with a ".proto" extension are included. Patterns are
+	// matched against the import-relative file name, which always uses a
+	// forward slash ('/') as the path separator. Patterns use the syntax of
+	// path.Match, with one addition: a path element of "**" matches zero or
+	// more path elements. So "foo/**/*.proto" matches "foo/bar.proto" as
+	// well as "foo/bar/baz/buzz.proto".
+	//
+	// Only files with a ".proto" extension are ever selected, even if a
+	// pattern would match other files.
+	Include []string
+	// Optional glob patterns that indicate which files to exclude. The syntax
+	// is the same as for Include. A file that matches both an include and an
+	// exclude pattern is excluded.
+	Exclude []string
+}
+
+// FindFiles walks the import paths and returns the import-relative names of
+// all selected files. The returned names are sorted and contain no
+// duplicates.
+//
+// If any selected file can be reached via more than one name, because some
+// import paths are nested inside of others, then an error is returned. The
+// error will be a *MultipleNamesError. Similarly, if the same name refers to
+// different files in different import paths, so that the file in a later
+// import path is shadowed by the one in an earlier import path, the error
+// will be a *ShadowedFileError.
+func (s *FileSelector) FindFiles() ([]string, error) {
+	for _, pattern := range s.Include {
+		if err := checkGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range s.Exclude {
+		if err := checkGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	importPaths := s.ImportPaths
+	if len(importPaths) == 0 {
+		importPaths = []string{"."}
+	}
+
+	// maps import-relative name to location on disk
+	byName := map[string]string{}
+	// maps location on disk to all import-relative names
+	byLocation := map[string][]string{}
+	var names []string
+	for _, importPath := range importPaths {
+		err := filepath.Walk(importPath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(p) != ".proto" {
+				return nil
+			}
+			rel, err := filepath.Rel(importPath, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if !s.selects(name) {
+				return nil
+			}
+			loc, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			if existing, ok := byName[name]; ok {
+				if existing != loc {
+					return &ShadowedFileError{Name: name, Path: p, ShadowedBy: existing}
+				}
+				return nil
+			}
+			byName[name] = loc
+			byLocation[loc] = append(byLocation[loc], name)
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		loc := byName[name]
+		if others := byLocation[loc]; len(others) > 1 {
+			sort.Strings(others)
+			return nil, &MultipleNamesError{Path: loc, Names: others}
+		}
+	}
+	return names, nil
+}
+
+func (s *FileSelector) selects(name string) bool {
+	if len(s.Include) > 0 {
+		included := false
+		for _, pattern := range s.Include {
+			if matchGlob(pattern, name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pattern := range s.Exclude {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// MultipleNamesError is returned by FileSelector.FindFiles when a single file
+// can be reached via more than one import-relative name. This happens when
+// one import path is inside another.
+type MultipleNamesError struct {
+	// The location of the file on disk.
+	Path string
+	// The import-relative names that all refer to the file.
+	Names []string
+}
+
+// Error implements the error interface.
+func (e *MultipleNamesError) Error() string {
+	quoted := make([]string, len(e.Names))
+	for i, n := range e.Names {
+		quoted[i] = fmt.Sprintf("%q", n)
+	}
+	return fmt.Sprintf("file %s is reachable via multiple names: %s", e.Path, strings.Join(quoted, ", "))
+}
+
+// ShadowedFileError is returned by FileSelector.FindFiles when two different
+// files have the same import-relative name, because they are in different
+// import paths. Only the file in the first import path could ever be loaded
+// by a SourceResolver, so the other file is shadowed.
+type ShadowedFileError struct {
+	// The import-relative name of the file.
+	Name string
+	// The path of the file that is shadowed.
+	Path string
+	// The location of the file that shadows it.
+	ShadowedBy string
+}
+
+// Error implements the error interface.
+func (e *ShadowedFileError) Error() string {
+	return fmt.Sprintf("file %s is shadowed by %s: both are named %q", e.Path, e.ShadowedBy, e.Name)
+}
+
+// CompileSelected finds all files indicated by the given selector and then
+// compiles them. The returned files are in the same order as the names
+// returned by sel.FindFiles.
+//
+// If the compiler has no Resolver configured, this uses a SourceResolver with
+// the selector's import paths, which is the same as if the following resolver
+// were configured:
+//
+//  protocompile.WithStandardImports(&protocompile.SourceResolver{
+//      ImportPaths: sel.ImportPaths,
+//  })
+func (c *Compiler) CompileSelected(ctx context.Context, sel *FileSelector) (linker.Files, error) {
+	names, err := sel.FindFiles()
+	if err != nil {
+		return nil, err
+	}
+	if c.Resolver == nil {
+		comp := *c
+		comp.Resolver = WithStandardImports(&SourceResolver{ImportPaths: sel.ImportPaths})
+		return comp.Compile(ctx, names...)
+	}
+	return c.Compile(ctx, names...)
+}
+
+func checkGlob(pattern string) error {
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "**" {
+			continue
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the given slash-separated name matches the given
+// pattern. Each path element is matched using path.Match, except for "**"
+// which matches any number of path elements (including none).
+func matchGlob(pattern, name string) bool {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchGlobElems(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,124 @@
+package protocompile
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSelectorFindFiles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sel      FileSelector
+		expected []string
+	}{
+		{
+			name: "all",
+			sel:  FileSelector{ImportPaths: []string{"internal/testprotos/more"}},
+			expected: []string{
+				"a/b/b1.proto",
+				"a/b/b2.proto",
+				"c/c.proto",
+			},
+		},
+		{
+			name: "include",
+			sel: FileSelector{
+				ImportPaths: []string{"internal/testprotos"},
+				Include:     []string{"more/**", "nopkg/*_new.proto"},
+			},
+			expected: []string{
+				"more/a/b/b1.proto",
+				"more/a/b/b2.proto",
+				"more/c/c.proto",
+				"nopkg/desc_test_nopkg_new.proto",
+			},
+		},
+		{
+			name: "exclude",
+			sel: FileSelector{
+				ImportPaths: []string{"internal/testprotos/more"},
+				Exclude:     []string{"**/b2.proto"},
+			},
+			expected: []string{
+				"a/b/b1.proto",
+				"c/c.proto",
+			},
+		},
+		{
+			name: "include and exclude",
+			sel: FileSelector{
+				ImportPaths: []string{"internal/testprotos"},
+				Include:     []string{"**/desc_test_*.proto"},
+				Exclude:     []string{"desc_test_*.proto"},
+			},
+			expected: []string{
+				"nopkg/desc_test_nopkg.proto",
+				"nopkg/desc_test_nopkg_new.proto",
+				"pkg/desc_test_pkg.proto",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := tc.sel.FindFiles()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestFileSelectorMultipleNames(t *testing.T) {
+	sel := FileSelector{
+		ImportPaths: []string{"internal/testprotos", "internal/testprotos/more"},
+		Include:     []string{"**/c.proto"},
+	}
+	_, err := sel.FindFiles()
+	var multiErr *MultipleNamesError
+	require.True(t, errors.As(err, &multiErr), "expecting *MultipleNamesError; instead got %v", err)
+	assert.Equal(t, []string{"c/c.proto", "more/c/c.proto"}, multiErr.Names)
+}
+
+func TestFileSelectorBadPattern(t *testing.T) {
+	sel := FileSelector{
+		ImportPaths: []string{"internal/testprotos"},
+		Include:     []string{"foo/[a-"},
+	}
+	_, err := sel.FindFiles()
+	assert.Error(t, err)
+}
+
+func TestCompileSelected(t *testing.T) {
+	sel := FileSelector{ImportPaths: []string{"internal/testprotos/more"}}
+	compiler := Compiler{}
+	files, err := compiler.CompileSelected(context.Background(), &sel)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(files))
+	assert.Equal(t, "a/b/b1.proto", files[0].Path())
+	assert.Equal(t, "a/b/b2.proto", files[1].Path())
+	assert.Equal(t, "c/c.proto", files[2].Path())
+}
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern, name string
+		matches       bool
+	}{
+		{"*.proto", "foo.proto", true},
+		{"*.proto", "foo/bar.proto", false},
+		{"**", "foo/bar.proto", true},
+		{"**/*.proto", "foo.proto", true},
+		{"**/*.proto", "foo/bar/baz.proto", true},
+		{"foo/**/baz.proto", "foo/baz.proto", true},
+		{"foo/**/baz.proto", "foo/bar/buzz/baz.proto", true},
+		{"foo/**/baz.proto", "bar/baz.proto", false},
+		{"foo/**", "foo", true},
+		{"foo/?ar.proto", "foo/bar.proto", true},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.matches, matchGlob(tc.pattern, tc.name), "matchGlob(%q, %q)", tc.pattern, tc.name)
+	}
+}
@@ -0,0 +1,280 @@
+package sourceinfo
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/internal"
+	"github.com/jhump/protocompile/walk"
+)
+
+// Part identifies a part of a declaration, like the name of a message or the
+// number of a field. Parts are used to query for the source locations of
+// these parts (see PartLocation).
+type Part int
+
+const (
+	// PartName is the name of an element. For a file, this is the package
+	// name.
+	PartName = Part(iota + 1)
+	// PartNumber is the number of a field or enum value.
+	PartNumber
+	// PartLabel is the label of a field, like "optional" or "repeated".
+	PartLabel
+	// PartType is the type of a field. This is the name of a message or enum
+	// type or the keyword for a scalar type.
+	PartType
+	// PartExtendee is the name of the message that an extension extends. This
+	// is part of the enclosing "extend" block, which may contain several
+	// extensions.
+	PartExtendee
+	// PartDefault is the "default" pseudo-option of a field.
+	PartDefault
+	// PartJSONName is the "json_name" pseudo-option of a field.
+	PartJSONName
+	// PartInputType is the request type of a method.
+	PartInputType
+	// PartOutputType is the response type of a method.
+	PartOutputType
+	// PartInputStream is the "stream" keyword for a method's request type.
+	PartInputStream
+	// PartOutputStream is the "stream" keyword for a method's response type.
+	PartOutputStream
+	// PartSyntax is the syntax declaration of a file.
+	PartSyntax
+)
+
+// DescriptorLocation returns the source location of the given descriptor. The
+// location has the span of the element's declaration and its comments. If the
+// descriptor's file does not have source code info for the element, this
+// returns false.
+func DescriptorLocation(d protoreflect.Descriptor) (protoreflect.SourceLocation, bool) {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	if isZeroLoc(loc) {
+		return protoreflect.SourceLocation{}, false
+	}
+	return loc, true
+}
+
+// PartLocation returns the source location of the given part of the given
+// descriptor's declaration. For example, it can be used to get the span of
+// the type of a field or the name of a message. If the part is not applicable
+// to the given kind of descriptor, or the descriptor's file does not have
+// source code info for it, this returns false.
+func PartLocation(d protoreflect.Descriptor, part Part) (protoreflect.SourceLocation, bool) {
+	var tags []int32
+	var path protoreflect.SourcePath
+	if _, ok := d.(protoreflect.FileDescriptor); !ok {
+		loc, ok := DescriptorLocation(d)
+		if !ok {
+			return protoreflect.SourceLocation{}, false
+		}
+		path = loc.Path
+	}
+	switch d := d.(type) {
+	case protoreflect.FileDescriptor:
+		switch part {
+		case PartName:
+			tags = []int32{internal.File_packageTag}
+		case PartSyntax:
+			tags = []int32{internal.File_syntaxTag}
+		}
+	case protoreflect.MessageDescriptor:
+		if part == PartName {
+			tags = []int32{internal.Message_nameTag}
+		}
+	case protoreflect.FieldDescriptor:
+		switch part {
+		case PartName:
+			tags = []int32{internal.Field_nameTag}
+		case PartNumber:
+			tags = []int32{internal.Field_numberTag}
+		case PartLabel:
+			tags = []int32{internal.Field_labelTag}
+		case PartType:
+			// message and enum types are recorded as type names, scalar
+			// types as types
+			tags = []int32{internal.Field_typeNameTag, internal.Field_typeTag}
+		case PartExtendee:
+			if d.IsExtension() {
+				tags = []int32{internal.Field_extendeeTag}
+			}
+		case PartDefault:
+			tags = []int32{internal.Field_defaultTag}
+		case PartJSONName:
+			tags = []int32{internal.Field_jsonNameTag}
+		}
+	case protoreflect.OneofDescriptor:
+		if part == PartName {
+			tags = []int32{internal.OneOf_nameTag}
+		}
+	case protoreflect.EnumDescriptor:
+		if part == PartName {
+			tags = []int32{internal.Enum_nameTag}
+		}
+	case protoreflect.EnumValueDescriptor:
+		switch part {
+		case PartName:
+			tags = []int32{internal.EnumVal_nameTag}
+		case PartNumber:
+			tags = []int32{internal.EnumVal_numberTag}
+		}
+	case protoreflect.ServiceDescriptor:
+		if part == PartName {
+			tags = []int32{internal.Service_nameTag}
+		}
+	case protoreflect.MethodDescriptor:
+		switch part {
+		case PartName:
+			tags = []int32{internal.Method_nameTag}
+		case PartInputType:
+			tags = []int32{internal.Method_inputTag}
+		case PartOutputType:
+			tags = []int32{internal.Method_outputTag}
+		case PartInputStream:
+			tags = []int32{internal.Method_inputStreamTag}
+		case PartOutputStream:
+			tags = []int32{internal.Method_outputStreamTag}
+		}
+	}
+	locs := d.ParentFile().SourceLocations()
+	for _, tag := range tags {
+		loc := locs.ByPath(append(dup(path), tag))
+		if !isZeroLoc(loc) {
+			return loc, true
+		}
+	}
+	return protoreflect.SourceLocation{}, false
+}
+
+// OptionLocations returns the source locations of the declarations that set
+// the given option field of the given descriptor. The field may be a field
+// of the descriptor's options message, like "deprecated", or an extension
+// (custom option). The declaration of a repeated option may be spread across
+// many statements, so this returns a slice that has a location for each one,
+// in the order they appear in the source. It returns nil if the option is
+// not set or the descriptor's file does not have source code info for it.
+//
+// Options that are not recognized, and thus are left uninterpreted, do not
+// have locations that can be queried this way.
+func OptionLocations(d protoreflect.Descriptor, opt protoreflect.FieldDescriptor) []protoreflect.SourceLocation {
+	var path protoreflect.SourcePath
+	if _, ok := d.(protoreflect.FileDescriptor); !ok {
+		loc, ok := DescriptorLocation(d)
+		if !ok {
+			return nil
+		}
+		path = loc.Path
+	}
+	var optionsTag int32
+	switch d.(type) {
+	case protoreflect.FileDescriptor:
+		optionsTag = internal.File_optionsTag
+	case protoreflect.MessageDescriptor:
+		optionsTag = internal.Message_optionsTag
+	case protoreflect.FieldDescriptor:
+		optionsTag = internal.Field_optionsTag
+	case protoreflect.OneofDescriptor:
+		optionsTag = internal.OneOf_optionsTag
+	case protoreflect.EnumDescriptor:
+		optionsTag = internal.Enum_optionsTag
+	case protoreflect.EnumValueDescriptor:
+		optionsTag = internal.EnumVal_optionsTag
+	case protoreflect.ServiceDescriptor:
+		optionsTag = internal.Service_optionsTag
+	case protoreflect.MethodDescriptor:
+		optionsTag = internal.Method_optionsTag
+	default:
+		return nil
+	}
+	optPath := append(dup(path), optionsTag, int32(opt.Number()))
+
+	var results []protoreflect.SourceLocation
+	locs := d.ParentFile().SourceLocations()
+	for i := 0; i < locs.Len(); i++ {
+		loc := locs.Get(i)
+		switch {
+		case len(loc.Path) == len(optPath) && !opt.IsList() && !opt.IsMap():
+		case len(loc.Path) == len(optPath)+1 && (opt.IsList() || opt.IsMap()):
+			// the extra path element is the index of the value
+		default:
+			continue
+		}
+		if hasPrefix(loc.Path, optPath) {
+			results = append(results, loc)
+		}
+	}
+	return results
+}
+
+// DescriptorAt returns the most specific descriptor in the given file whose
+// declaration includes the given position. The position's line and column
+// are one-based, as they are in ast.SourcePos; its filename and offset are
+// ignored. If the position is not inside the declaration of any element,
+// this returns the file itself (or nil if the file has no source code info).
+//
+// Map entry messages and other synthetic elements that have no source
+// location are never returned. When a position is in a group, which is both
+// a field and a message, the message is returned.
+func DescriptorAt(file protoreflect.FileDescriptor, pos ast.SourcePos) protoreflect.Descriptor {
+	if file.SourceLocations().Len() == 0 {
+		return nil
+	}
+	line, col := pos.Line-1, pos.Col-1
+	var best protoreflect.Descriptor = file
+	var bestLoc protoreflect.SourceLocation
+	_ = walk.Descriptors(file, func(d protoreflect.Descriptor) error {
+		loc, ok := DescriptorLocation(d)
+		if !ok || !spanContains(loc, line, col) {
+			return nil
+		}
+		if best == file || spanWithin(loc, bestLoc) {
+			best, bestLoc = d, loc
+		}
+		return nil
+	})
+	return best
+}
+
+func isZeroLoc(loc protoreflect.SourceLocation) bool {
+	return loc.Path == nil &&
+		loc.StartLine == 0 &&
+		loc.StartColumn == 0 &&
+		loc.EndLine == 0 &&
+		loc.EndColumn == 0
+}
+
+func hasPrefix(path, prefix protoreflect.SourcePath) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// spanContains returns true if the given zero-based line and column are in
+// the span of the given location. The end of the span is exclusive.
+func spanContains(loc protoreflect.SourceLocation, line, col int) bool {
+	if line < loc.StartLine || (line == loc.StartLine && col < loc.StartColumn) {
+		return false
+	}
+	if line > loc.EndLine || (line == loc.EndLine && col >= loc.EndColumn) {
+		return false
+	}
+	return true
+}
+
+// spanWithin returns true if the span of inner is inside the span of outer.
+func spanWithin(inner, outer protoreflect.SourceLocation) bool {
+	if inner.StartLine < outer.StartLine || (inner.StartLine == outer.StartLine && inner.StartColumn < outer.StartColumn) {
+		return false
+	}
+	if inner.EndLine > outer.EndLine || (inner.EndLine == outer.EndLine && inner.EndColumn > outer.EndColumn) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,178 @@
+package sourceinfo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/jhump/protocompile"
+	"github.com/jhump/protocompile/ast"
+	"github.com/jhump/protocompile/linker"
+	"github.com/jhump/protocompile/sourceinfo"
+)
+
+const querySource = `syntax = "proto2";
+package foo.bar;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MethodOptions {
+  repeated string tags = 10101;
+}
+// Leading comment for Foo.
+message Foo {
+  option deprecated = true;
+  // Leading comment for id.
+  optional int32 id = 1 [default = 5]; // Trailing comment for id.
+  oneof kind {
+    string name = 2;
+    Foo child = 3;
+  }
+  enum Kind {
+    KIND_UNSET = 0;
+  }
+}
+service Svc {
+  rpc Do(Foo) returns (stream Foo) {
+    option (tags) = "abc";
+    option deprecated = false;
+    option (tags) = "def";
+  }
+}
+`
+
+func compileForQuery(t *testing.T) linker.File {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"test.proto": querySource}),
+		}),
+		IncludeSourceInfo: true,
+	}
+	fds, err := compiler.Compile(context.Background(), "test.proto")
+	require.NoError(t, err)
+	return fds[0]
+}
+
+// span returns the one-based start and end line and column of the given
+// location, for easy comparison.
+func span(loc protoreflect.SourceLocation) [4]int {
+	return [4]int{loc.StartLine + 1, loc.StartColumn + 1, loc.EndLine + 1, loc.EndColumn + 1}
+}
+
+func TestDescriptorLocation(t *testing.T) {
+	file := compileForQuery(t)
+	msg := file.Messages().ByName("Foo")
+	loc, ok := sourceinfo.DescriptorLocation(msg)
+	require.True(t, ok)
+	assert.Equal(t, [4]int{8, 1, 19, 2}, span(loc))
+	assert.Equal(t, " Leading comment for Foo.\n", loc.LeadingComments)
+
+	fld := msg.Fields().ByName("id")
+	loc, ok = sourceinfo.DescriptorLocation(fld)
+	require.True(t, ok)
+	assert.Equal(t, [4]int{11, 3, 11, 39}, span(loc))
+	assert.Equal(t, " Leading comment for id.\n", loc.LeadingComments)
+	assert.Equal(t, " Trailing comment for id.\n", loc.TrailingComments)
+
+	// no source info
+	_, ok = sourceinfo.DescriptorLocation(descriptorpb.File_google_protobuf_descriptor_proto.Messages().Get(0))
+	assert.False(t, ok)
+}
+
+func TestPartLocation(t *testing.T) {
+	file := compileForQuery(t)
+	msg := file.Messages().ByName("Foo")
+	id := msg.Fields().ByName("id")
+	child := msg.Fields().ByName("child")
+	method := file.Services().Get(0).Methods().Get(0)
+	ext := file.Extensions().Get(0)
+	testCases := []struct {
+		name string
+		d    protoreflect.Descriptor
+		part sourceinfo.Part
+		span [4]int
+	}{
+		{name: "package", d: file, part: sourceinfo.PartName, span: [4]int{2, 1, 2, 17}},
+		{name: "syntax", d: file, part: sourceinfo.PartSyntax, span: [4]int{1, 1, 1, 19}},
+		{name: "message name", d: msg, part: sourceinfo.PartName, span: [4]int{8, 9, 8, 12}},
+		{name: "field label", d: id, part: sourceinfo.PartLabel, span: [4]int{11, 3, 11, 11}},
+		{name: "scalar field type", d: id, part: sourceinfo.PartType, span: [4]int{11, 12, 11, 17}},
+		{name: "field name", d: id, part: sourceinfo.PartName, span: [4]int{11, 18, 11, 20}},
+		{name: "field number", d: id, part: sourceinfo.PartNumber, span: [4]int{11, 23, 11, 24}},
+		{name: "field default", d: id, part: sourceinfo.PartDefault, span: [4]int{11, 26, 11, 37}},
+		{name: "message field type", d: child, part: sourceinfo.PartType, span: [4]int{14, 5, 14, 8}},
+		{name: "oneof name", d: msg.Oneofs().Get(0), part: sourceinfo.PartName, span: [4]int{12, 9, 12, 13}},
+		{name: "enum value number", d: msg.Enums().Get(0).Values().Get(0), part: sourceinfo.PartNumber, span: [4]int{17, 18, 17, 19}},
+		{name: "extendee", d: ext, part: sourceinfo.PartExtendee, span: [4]int{4, 8, 4, 37}},
+		{name: "method input", d: method, part: sourceinfo.PartInputType, span: [4]int{21, 10, 21, 13}},
+		{name: "method output", d: method, part: sourceinfo.PartOutputType, span: [4]int{21, 31, 21, 34}},
+		{name: "method output stream", d: method, part: sourceinfo.PartOutputStream, span: [4]int{21, 24, 21, 30}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loc, ok := sourceinfo.PartLocation(tc.d, tc.part)
+			require.True(t, ok)
+			assert.Equal(t, tc.span, span(loc))
+		})
+	}
+
+	// not applicable or not present
+	_, ok := sourceinfo.PartLocation(msg, sourceinfo.PartNumber)
+	assert.False(t, ok)
+	_, ok = sourceinfo.PartLocation(child, sourceinfo.PartDefault)
+	assert.False(t, ok)
+	_, ok = sourceinfo.PartLocation(method, sourceinfo.PartInputStream)
+	assert.False(t, ok)
+}
+
+func TestOptionLocations(t *testing.T) {
+	file := compileForQuery(t)
+	msg := file.Messages().ByName("Foo")
+	method := file.Services().Get(0).Methods().Get(0)
+	deprecated := (&descriptorpb.MessageOptions{}).ProtoReflect().Descriptor().Fields().ByName("deprecated")
+	locs := sourceinfo.OptionLocations(msg, deprecated)
+	require.Len(t, locs, 1)
+	assert.Equal(t, [4]int{9, 3, 9, 28}, span(locs[0]))
+
+	tags := file.Extensions().ByName("tags")
+	locs = sourceinfo.OptionLocations(method, tags)
+	require.Len(t, locs, 2)
+	assert.Equal(t, [4]int{22, 5, 22, 27}, span(locs[0]))
+	assert.Equal(t, [4]int{24, 5, 24, 27}, span(locs[1]))
+
+	assert.Empty(t, sourceinfo.OptionLocations(file, deprecated))
+}
+
+func TestDescriptorAt(t *testing.T) {
+	file := compileForQuery(t)
+	msg := file.Messages().ByName("Foo")
+	testCases := []struct {
+		line, col int
+		expected  protoreflect.FullName
+	}{
+		// the file's full name is its package
+		{line: 1, col: 1, expected: "foo.bar"},
+		{line: 2, col: 5, expected: "foo.bar"},
+		{line: 5, col: 20, expected: "foo.bar.tags"},
+		{line: 8, col: 1, expected: "foo.bar.Foo"},
+		{line: 9, col: 10, expected: "foo.bar.Foo"},
+		{line: 11, col: 20, expected: "foo.bar.Foo.id"},
+		// trailing comment is not part of the field's span
+		{line: 11, col: 45, expected: "foo.bar.Foo"},
+		{line: 12, col: 3, expected: "foo.bar.Foo.kind"},
+		{line: 14, col: 5, expected: "foo.bar.Foo.child"},
+		{line: 17, col: 5, expected: "foo.bar.Foo.KIND_UNSET"},
+		{line: 21, col: 10, expected: "foo.bar.Svc.Do"},
+		{line: 26, col: 1, expected: "foo.bar.Svc"},
+		{line: 27, col: 1, expected: "foo.bar"},
+	}
+	for _, tc := range testCases {
+		d := sourceinfo.DescriptorAt(file, ast.SourcePos{Line: tc.line, Col: tc.col})
+		require.NotNil(t, d)
+		assert.Equal(t, tc.expected, d.FullName(), "%d:%d", tc.line, tc.col)
+	}
+	assert.Equal(t, msg, sourceinfo.DescriptorAt(file, ast.SourcePos{Line: 8, Col: 5}))
+	assert.Nil(t, sourceinfo.DescriptorAt(descriptorpb.File_google_protobuf_descriptor_proto, ast.SourcePos{Line: 1, Col: 1}))
+}
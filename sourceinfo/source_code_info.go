@@ -3,6 +3,11 @@
 //
 // The inputs to the computation are an AST for a file as well as the index of
 // interpreted options for that file.
+//
+// This package also provides functions for querying the source code info of a
+// file descriptor, such as finding the comments or spans for a descriptor or
+// finding the descriptor at a given position. See DescriptorLocation,
+// PartLocation, OptionLocations, and DescriptorAt.
 package sourceinfo
 
 import (
@@ -17,16 +22,33 @@ import (
 	"github.com/jhump/protocompile/options"
 )
 
+// GenerateOption is an option that can be passed to GenerateSourceInfo to
+// customize the source code info that is generated.
+type GenerateOption func(*sourceCodeInfo)
+
+// WithOptionValueLocations returns an option that causes locations to be
+// generated for the fields and array elements inside the values of
+// interpreted options, using the paths recorded in the given index (see
+// options.WithValueIndex). Protoc does not generate these locations.
+func WithOptionValueLocations(values options.ValueIndex) GenerateOption {
+	return func(sci *sourceCodeInfo) {
+		sci.values = values
+	}
+}
+
 // GenerateSourceInfo generates source code info for the given AST. If the given
 // opts is present, it can generate source code info for interpreted options.
 // Otherwise, any options in the AST will get source code info as uninterpreted
 // options.
-func GenerateSourceInfo(file *ast.FileNode, opts options.Index) *descriptorpb.SourceCodeInfo {
+func GenerateSourceInfo(file *ast.FileNode, opts options.Index, genOpts ...GenerateOption) *descriptorpb.SourceCodeInfo {
 	if file == nil {
 		return nil
 	}
 
 	sci := sourceCodeInfo{file: file, commentsUsed: map[ast.SourcePos]struct{}{}}
+	for _, opt := range genOpts {
+		opt(&sci)
+	}
 	path := make([]int32, 0, 10)
 
 	sci.newLocWithoutComments(file, nil)
@@ -79,6 +101,7 @@ func generateSourceCodeInfoForOption(opts options.Index, sci *sourceCodeInfo, n
 			subPath = subPath[1:]
 		}
 		sci.newLoc(n, append(p, subPath...))
+		generateSourceCodeInfoForOptionValue(sci, n.Val, p)
 		return
 	}
 
@@ -111,6 +134,33 @@ func generateSourceCodeInfoForOption(opts options.Index, sci *sourceCodeInfo, n
 	}
 }
 
+// generateSourceCodeInfoForOptionValue adds locations for the fields inside
+// the given option value, if it is a message literal, using the paths that
+// were recorded in the value index when the option was interpreted. Those
+// paths are relative to the given path of the options message. This does
+// nothing unless the value index was provided via WithOptionValueLocations.
+func generateSourceCodeInfoForOptionValue(sci *sourceCodeInfo, val ast.ValueNode, path []int32) {
+	if sci.values == nil {
+		return
+	}
+	switch val := val.(type) {
+	case *ast.MessageLiteralNode:
+		for _, fld := range val.Elements {
+			if fldPath, ok := sci.values[fld]; ok {
+				sci.newLoc(fld, append(dup(path), fldPath...))
+			}
+			generateSourceCodeInfoForOptionValue(sci, fld.Val, path)
+		}
+	case *ast.ArrayLiteralNode:
+		for _, elem := range val.Elements {
+			if elemPath, ok := sci.values[elem]; ok {
+				sci.newLoc(elem, append(dup(path), elemPath...))
+			}
+			generateSourceCodeInfoForOptionValue(sci, elem, path)
+		}
+	}
+}
+
 func generateSourceCodeInfoForMessage(opts options.Index, sci *sourceCodeInfo, n ast.MessageDeclNode, fieldPath []int32, path []int32) {
 	sci.newLoc(n, path)
 
@@ -397,6 +447,7 @@ type sourceCodeInfo struct {
 	file         *ast.FileNode
 	locs         []*descriptorpb.SourceCodeInfo_Location
 	commentsUsed map[ast.SourcePos]struct{}
+	values       options.ValueIndex
 }
 
 func (sci *sourceCodeInfo) newLocWithoutComments(n ast.Node, path []int32) {
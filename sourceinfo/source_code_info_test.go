@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
@@ -65,6 +66,56 @@ func TestSourceCodeInfo(t *testing.T) {
 	assert.Equal(t, golden, actual, "wrong source code info")
 }
 
+// TestSourceCodeInfoOptionValues checks the locations that are added for the
+// contents of option values when Compiler.IncludeOptionValueSourceInfo is set.
+// The golden output only includes those locations, since the rest are the
+// same as checked by TestSourceCodeInfo.
+func TestSourceCodeInfoOptionValues(t *testing.T) {
+	compile := func(includeOptionValues bool) linker.File {
+		compiler := protocompile.Compiler{
+			Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+				ImportPaths: []string{"../internal/testprotos"},
+			}),
+			IncludeSourceInfo:            true,
+			IncludeOptionValueSourceInfo: includeOptionValues,
+		}
+		fds, err := compiler.Compile(context.Background(), "desc_test_complex.proto")
+		require.NoError(t, err)
+		return fds[0]
+	}
+	fd := compile(true)
+	// the locations without option values must be the same, and in the same
+	// order, so the rest are the added locations
+	withoutValues := compile(false).SourceLocations()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "---- %s ----\n", fd.Path())
+	fdMsg := fd.(linker.Result).Proto()
+	var j int
+	for i := 0; i < fd.SourceLocations().Len(); i++ {
+		loc := fd.SourceLocations().Get(i)
+		if j < withoutValues.Len() && sameLocation(loc, withoutValues.Get(j)) {
+			j++
+			continue
+		}
+		printLocation(fd, fdMsg, loc, &buf)
+	}
+	require.Equal(t, withoutValues.Len(), j, "locations without option values are missing")
+
+	if regenerateMode {
+		err := ioutil.WriteFile("test-source-info-option-values.txt", buf.Bytes(), 0666)
+		require.NoError(t, err)
+	}
+	golden, err := ioutil.ReadFile("test-source-info-option-values.txt")
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), buf.String(), "wrong source code info")
+}
+
+func sameLocation(a, b protoreflect.SourceLocation) bool {
+	return fmt.Sprint(a.Path) == fmt.Sprint(b.Path) &&
+		a.StartLine == b.StartLine && a.StartColumn == b.StartColumn &&
+		a.EndLine == b.EndLine && a.EndColumn == b.EndColumn
+}
+
 // NB: this function can be used to manually inspect the source code info for a
 // descriptor, in a manner that is much easier to read and check than raw
 // descriptor form.
@@ -79,24 +130,27 @@ func printSourceCodeInfo(fd linker.File, out io.Writer) {
 	}
 
 	for i := 0; i < fd.SourceLocations().Len(); i++ {
-		loc := fd.SourceLocations().Get(i)
-		var buf bytes.Buffer
-		findLocation(linker.ResolverFromFile(fd), fdMsg.ProtoReflect(), fdMsg.ProtoReflect().Descriptor(), loc.Path, &buf)
-		fmt.Fprintf(out, "\n\n%s:\n", buf.String())
-		fmt.Fprintf(out, "%s:%d:%d\n", fd.Path(), loc.StartLine+1, loc.StartColumn+1)
-		fmt.Fprintf(out, "%s:%d:%d\n", fd.Path(), loc.EndLine+1, loc.EndColumn+1)
-		if len(loc.LeadingDetachedComments) > 0 {
-			for i, comment := range loc.LeadingDetachedComments {
-				fmt.Fprintf(out, "    Leading detached comment [%d]:\n%s\n", i, comment)
-			}
-		}
-		if loc.LeadingComments != "" {
-			fmt.Fprintf(out, "    Leading comments:\n%s\n", loc.LeadingComments)
-		}
-		if loc.TrailingComments != "" {
-			fmt.Fprintf(out, "    Trailing comments:\n%s\n", loc.TrailingComments)
+		printLocation(fd, fdMsg, fd.SourceLocations().Get(i), out)
+	}
+}
+
+func printLocation(fd linker.File, fdMsg *descriptorpb.FileDescriptorProto, loc protoreflect.SourceLocation, out io.Writer) {
+	var buf bytes.Buffer
+	findLocation(linker.ResolverFromFile(fd), fdMsg.ProtoReflect(), fdMsg.ProtoReflect().Descriptor(), loc.Path, &buf)
+	fmt.Fprintf(out, "\n\n%s:\n", buf.String())
+	fmt.Fprintf(out, "%s:%d:%d\n", fd.Path(), loc.StartLine+1, loc.StartColumn+1)
+	fmt.Fprintf(out, "%s:%d:%d\n", fd.Path(), loc.EndLine+1, loc.EndColumn+1)
+	if len(loc.LeadingDetachedComments) > 0 {
+		for i, comment := range loc.LeadingDetachedComments {
+			fmt.Fprintf(out, "    Leading detached comment [%d]:\n%s\n", i, comment)
 		}
 	}
+	if loc.LeadingComments != "" {
+		fmt.Fprintf(out, "    Leading comments:\n%s\n", loc.LeadingComments)
+	}
+	if loc.TrailingComments != "" {
+		fmt.Fprintf(out, "    Trailing comments:\n%s\n", loc.TrailingComments)
+	}
 }
 
 func findLocation(res protoregistry.ExtensionTypeResolver, msg protoreflect.Message, md protoreflect.MessageDescriptor, path []int32, buf *bytes.Buffer) {
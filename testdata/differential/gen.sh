@@ -0,0 +1,42 @@
+#!/usr/bin/env bash
+
+# Generates the golden descriptor sets for the differential test (see
+# TestDifferential in ../../differential_test.go). To add a file to the
+# corpus, add it to the list of files below and re-run this script. Then
+# re-generate the known divergences in source code info by running the test
+# with regenerateMode set to true.
+
+set -e
+
+cd "$(dirname "$0")"
+
+PROTOC_VERSION="3.12.0"
+PROTOC_OS="$(uname -s)"
+PROTOC_ARCH="$(uname -m)"
+case "${PROTOC_OS}" in
+  Darwin) PROTOC_OS="osx" ;;
+  Linux) PROTOC_OS="linux" ;;
+  *)
+    echo "Invalid value for uname -s: ${PROTOC_OS}" >&2
+    exit 1
+esac
+
+PROTOC="./protoc/bin/protoc"
+
+if [[ "$(${PROTOC} --version 2>/dev/null)" != "libprotoc ${PROTOC_VERSION}" ]]; then
+  rm -rf ./protoc
+  mkdir -p protoc
+  curl -L "https://github.com/protocolbuffers/protobuf/releases/download/v${PROTOC_VERSION}/protoc-${PROTOC_VERSION}-${PROTOC_OS}-${PROTOC_ARCH}.zip" > protoc/protoc.zip
+  cd ./protoc && unzip protoc.zip && cd ..
+fi
+
+FILES=(
+  desc_test1.proto
+  desc_test_comments.proto
+  desc_test_complex.proto
+  proto3_optional/desc_test_proto3_optional.proto
+)
+
+for f in "${FILES[@]}"; do
+  ${PROTOC} --experimental_allow_proto3_optional "--descriptor_set_out=./${f%.proto}.protoset" --include_source_info --include_imports -I. "$f"
+done